@@ -0,0 +1,127 @@
+package attachment
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"net/http"
+
+	// Register the decoders for the image formats we accept
+	_ "image/gif"
+	_ "image/png"
+
+	"github.com/pkg/errors"
+)
+
+// ThumbnailSize is the maximum width or height, in pixels, of generated thumbnails
+const ThumbnailSize = 256
+
+// MaxPixels is the most pixels an image may have to be thumbnailed. Decoding allocates
+// memory for every pixel, so a small file claiming huge dimensions could exhaust it.
+const MaxPixels = 40000000
+
+var allowedContentTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// ContentType sniffs the content type of the provided data, returning an error if
+// it isn't one we accept as an attachment
+func ContentType(data []byte) (string, error) {
+	ct := http.DetectContentType(data)
+
+	if _, ok := allowedContentTypes[ct]; !ok {
+		return "", errors.Errorf("unsupported content type %q", ct)
+	}
+
+	return ct, nil
+}
+
+// Extension returns the file extension used when storing blobs of the given content type
+func Extension(contentType string) string {
+	return allowedContentTypes[contentType]
+}
+
+// Thumbnail decodes the image in r and returns a JPEG encoded copy scaled down to
+// fit within size x size pixels, preserving the aspect ratio. Images which already
+// fit are re-encoded without scaling. Images with more than MaxPixels are rejected
+// before they're decoded.
+func Thumbnail(r io.Reader, size int) ([]byte, error) {
+	// the header read to check the dimensions is decoded again with the rest of the image
+	var header bytes.Buffer
+
+	cfg, _, err := image.DecodeConfig(io.TeeReader(r, &header))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to decode image")
+	}
+
+	if int64(cfg.Width)*int64(cfg.Height) > MaxPixels {
+		return nil, errors.Errorf("image of %dx%d pixels exceeds the maximum of %d pixels", cfg.Width, cfg.Height, MaxPixels)
+	}
+
+	src, _, err := image.Decode(io.MultiReader(&header, r))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to decode image")
+	}
+
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	if w > size || h > size {
+		if w >= h {
+			w, h = size, max(1, h*size/w)
+		} else {
+			w, h = max(1, w*size/h), size
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dst.Set(x, y, average(src, image.Rect(
+				b.Min.X+x*b.Dx()/w,
+				b.Min.Y+y*b.Dy()/h,
+				b.Min.X+(x+1)*b.Dx()/w,
+				b.Min.Y+(y+1)*b.Dy()/h,
+			)))
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, errors.Wrap(err, "unable to encode thumbnail")
+	}
+
+	return buf.Bytes(), nil
+}
+
+// average returns the mean colour of the pixels in r, which gives a much smoother
+// result than nearest-neighbour sampling when shrinking photos
+func average(img image.Image, r image.Rectangle) color.Color {
+	var rs, gs, bs, as, n uint64
+
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			cr, cg, cb, ca := img.At(x, y).RGBA()
+			rs, gs, bs, as = rs+uint64(cr), gs+uint64(cg), bs+uint64(cb), as+uint64(ca)
+			n++
+		}
+	}
+
+	if n == 0 {
+		return color.RGBA64{}
+	}
+
+	return color.RGBA64{R: uint16(rs / n), G: uint16(gs / n), B: uint16(bs / n), A: uint16(as / n)}
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
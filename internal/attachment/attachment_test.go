@@ -0,0 +1,124 @@
+package attachment
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testPNG(t *testing.T, w, h int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: 200, G: 100, B: 50, A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, img))
+
+	return buf.Bytes()
+}
+
+func TestContentType(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		data        []byte
+		expected    string
+		expectedErr string
+	}{
+		{
+			desc:     "PNG is accepted",
+			data:     testPNG(t, 1, 1),
+			expected: "image/png",
+		},
+		{
+			desc:     "GIF is accepted",
+			data:     []byte("GIF89a"),
+			expected: "image/gif",
+		},
+		{
+			desc:        "Plain text is rejected",
+			data:        []byte("not an image"),
+			expectedErr: `unsupported content type "text/plain; charset=utf-8"`,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			ct, err := ContentType(tC.data)
+			if tC.expectedErr != "" {
+				assert.EqualError(t, err, tC.expectedErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tC.expected, ct)
+		})
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	testCases := []struct {
+		desc           string
+		width, height  int
+		expectedWidth  int
+		expectedHeight int
+	}{
+		{
+			desc:           "Landscape images are scaled to the thumbnail width",
+			width:          1000,
+			height:         500,
+			expectedWidth:  100,
+			expectedHeight: 50,
+		},
+		{
+			desc:           "Portrait images are scaled to the thumbnail height",
+			width:          300,
+			height:         600,
+			expectedWidth:  50,
+			expectedHeight: 100,
+		},
+		{
+			desc:           "Small images are not scaled up",
+			width:          20,
+			height:         10,
+			expectedWidth:  20,
+			expectedHeight: 10,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			b, err := Thumbnail(bytes.NewReader(testPNG(t, tC.width, tC.height)), 100)
+			assert.NoError(t, err)
+
+			cfg, format, err := image.DecodeConfig(bytes.NewReader(b))
+			assert.NoError(t, err)
+			assert.Equal(t, "jpeg", format)
+			assert.Equal(t, tC.expectedWidth, cfg.Width)
+			assert.Equal(t, tC.expectedHeight, cfg.Height)
+		})
+	}
+
+	t.Run("Images with too many pixels return an error", func(t *testing.T) {
+		// a tiny PNG whose header claims it's 10000x10000 pixels
+		b := testPNG(t, 1, 1)
+		ihdr := b[12:29]
+		binary.BigEndian.PutUint32(ihdr[4:], 10000)
+		binary.BigEndian.PutUint32(ihdr[8:], 10000)
+		binary.BigEndian.PutUint32(b[29:], crc32.ChecksumIEEE(ihdr))
+
+		_, err := Thumbnail(bytes.NewReader(b), 100)
+		assert.EqualError(t, err, "image of 10000x10000 pixels exceeds the maximum of 40000000 pixels")
+	})
+
+	t.Run("Invalid images return an error", func(t *testing.T) {
+		_, err := Thumbnail(bytes.NewReader([]byte("not an image")), 100)
+		assert.EqualError(t, err, "unable to decode image: image: unknown format")
+	})
+}
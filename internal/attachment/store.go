@@ -0,0 +1,108 @@
+package attachment
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Store persists attachment blobs. Keys are opaque, slash-separated identifiers
+// generated by the caller.
+type Store interface {
+	Put(ctx context.Context, key string, r io.Reader) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+var _ Store = (*FileStore)(nil) // ensure FileStore implements Store
+
+// FileStore is a Store backed by a directory on the local filesystem
+type FileStore struct {
+	root string
+}
+
+func NewFileStore(root string) (*FileStore, error) {
+	if root == "" {
+		return nil, errors.New("root not defined")
+	}
+
+	if err := os.MkdirAll(root, 0750); err != nil {
+		return nil, errors.Wrap(err, "unable to create root directory")
+	}
+
+	return &FileStore{root: root}, nil
+}
+
+func (f *FileStore) Put(ctx context.Context, key string, r io.Reader) error {
+	p, err := f.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0750); err != nil {
+		return errors.Wrap(err, "unable to create blob directory")
+	}
+
+	// Write to a temporary file first so a failed upload never leaves a partial blob behind
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return errors.Wrap(err, "unable to create blob")
+	}
+	defer os.Remove(tmp.Name()) // #nosec G104 -- no-op once renamed
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "unable to write blob")
+	}
+
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "unable to write blob")
+	}
+
+	return errors.Wrap(os.Rename(tmp.Name(), p), "unable to write blob")
+}
+
+func (f *FileStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	p, err := f.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(p) // #nosec G304 -- path is validated to be within root
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to open blob")
+	}
+
+	return file, nil
+}
+
+func (f *FileStore) Delete(ctx context.Context, key string) error {
+	p, err := f.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "unable to delete blob")
+	}
+
+	return nil
+}
+
+// path resolves key to a location on disk, refusing anything that would escape the root
+func (f *FileStore) path(key string) (string, error) {
+	if key == "" {
+		return "", errors.New("key not defined")
+	}
+
+	p := filepath.Join(f.root, filepath.FromSlash(key))
+	if !strings.HasPrefix(p, filepath.Clean(f.root)+string(filepath.Separator)) {
+		return "", errors.Errorf("invalid key %q", key)
+	}
+
+	return p, nil
+}
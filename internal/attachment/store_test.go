@@ -0,0 +1,64 @@
+package attachment
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewFileStore(t *testing.T) {
+	t.Run("Empty root should return error", func(t *testing.T) {
+		_, err := NewFileStore("")
+		assert.EqualError(t, err, "root not defined")
+	})
+}
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Given an initialised FileStore", func(t *testing.T) {
+		fs, err := NewFileStore(t.TempDir())
+		assert.NoError(t, err)
+
+		t.Run("When a blob is Put", func(t *testing.T) {
+			t.Run("Then it can be read back with Get", func(t *testing.T) {
+				assert.NoError(t, fs.Put(ctx, "2021/08/blob.jpg", strings.NewReader("contents")))
+
+				r, err := fs.Get(ctx, "2021/08/blob.jpg")
+				assert.NoError(t, err)
+				defer r.Close()
+
+				b, err := io.ReadAll(r)
+				assert.NoError(t, err)
+				assert.Equal(t, "contents", string(b))
+			})
+		})
+
+		t.Run("When a blob is Deleted", func(t *testing.T) {
+			t.Run("Then it can no longer be read", func(t *testing.T) {
+				assert.NoError(t, fs.Delete(ctx, "2021/08/blob.jpg"))
+
+				_, err := fs.Get(ctx, "2021/08/blob.jpg")
+				assert.Error(t, err)
+			})
+		})
+
+		t.Run("When a blob that doesn't exist is Deleted", func(t *testing.T) {
+			t.Run("Then no error is returned", func(t *testing.T) {
+				assert.NoError(t, fs.Delete(ctx, "missing"))
+			})
+		})
+
+		t.Run("When a key escapes the root", func(t *testing.T) {
+			t.Run("Then an error is returned", func(t *testing.T) {
+				assert.EqualError(t, fs.Put(ctx, "../escape", strings.NewReader("")), `invalid key "../escape"`)
+
+				_, err := fs.Get(ctx, "../../etc/passwd")
+				assert.EqualError(t, err, `invalid key "../../etc/passwd"`)
+			})
+		})
+	})
+}
@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// APIKeyHeader is the HTTP header API keys are sent in
+	APIKeyHeader = "X-API-Key"
+	// APIKeyMetadata is the gRPC metadata API keys are sent in
+	APIKeyMetadata = "x-api-key"
+	// APIKeyPrefix starts every API key, so they're easy to recognise, e.g. in leaked logs
+	APIKeyPrefix = "tmf_"
+)
+
+// KeyVerifier verifies an API key, returning the identity of the user it belongs to
+type KeyVerifier interface {
+	VerifyKey(ctx context.Context, key string) (Identity, error)
+}
+
+// Scope restricts what an API key can do to a single resource (e.g. "readings"), and at
+// most Permission on it. Setting TankID restricts it further to that tank, which only the
+// endpoints addressing a tank can enforce, so the key can't be used with any others.
+type Scope struct {
+	Resource   string
+	Permission Permission
+	TankID     int32
+}
+
+// Allows returns whether the scope allows permission p on resource. A nil scope allows
+// anything.
+func (s *Scope) Allows(resource string, p Permission) bool {
+	if s == nil {
+		return true
+	}
+
+	return s.Resource == resource && p <= s.Permission
+}
+
+// AllowsTank returns whether the scope allows the tank with the given id. A nil scope, or
+// one without a TankID, allows every tank.
+func (s *Scope) AllowsTank(id int32) bool {
+	return s == nil || s.TankID == 0 || s.TankID == id
+}
+
+var permissionNames = map[Permission]string{
+	PermissionRead:   "READ",
+	PermissionWrite:  "WRITE",
+	PermissionDelete: "DELETE",
+	PermissionManage: "MANAGE",
+}
+
+func (p Permission) String() string {
+	return permissionNames[p]
+}
+
+// ParsePermission returns the Permission named by s, ignoring case. Scopes can't grant
+// PermissionManage, so it can't be parsed.
+func ParsePermission(s string) (Permission, error) {
+	for p, name := range permissionNames {
+		if p != PermissionManage && strings.EqualFold(s, name) {
+			return p, nil
+		}
+	}
+
+	return 0, errors.Errorf("invalid permission %q, must be one of READ, WRITE or DELETE", s)
+}
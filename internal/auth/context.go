@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"context"
+	"strings"
+)
+
+type identityKey struct{}
+
+// NewContext returns a copy of ctx carrying id
+func NewContext(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// FromContext returns the identity of the authenticated user in ctx, if any
+func FromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+
+	return id, ok
+}
+
+// bearerToken returns the token from an "Authorization: Bearer <token>" value
+func bearerToken(v string) (string, bool) {
+	const prefix = "bearer "
+
+	if len(v) <= len(prefix) || !strings.EqualFold(v[:len(prefix)], prefix) {
+		return "", false
+	}
+
+	return strings.TrimSpace(v[len(prefix):]), true
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor rejects calls without a valid bearer token in the "authorization"
+// metadata, or API key in the "x-api-key" metadata, other than to publicMethods (full
+// method names, e.g. "/pkg.Service/Method"). keys may be nil if API keys aren't accepted.
+// The identity of the caller is added to the context of authenticated calls.
+func UnaryServerInterceptor(v Verifier, keys KeyVerifier, publicMethods ...string) grpc.UnaryServerInterceptor {
+	public := methodSet(publicMethods)
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if public[info.FullMethod] {
+			return handler(ctx, req)
+		}
+
+		ctx, err := authenticateRPC(ctx, v, keys)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor rejects streams the same way UnaryServerInterceptor rejects calls,
+// adding the identity of the caller to the context of the stream
+func StreamServerInterceptor(v Verifier, keys KeyVerifier, publicMethods ...string) grpc.StreamServerInterceptor {
+	public := methodSet(publicMethods)
+
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if public[info.FullMethod] {
+			return handler(srv, ss)
+		}
+
+		ctx, err := authenticateRPC(ss.Context(), v, keys)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, WithStreamContext(ctx, ss))
+	}
+}
+
+// WithStreamContext returns ss with its context replaced by ctx, e.g. to pass values to the
+// handler of the stream from an interceptor
+func WithStreamContext(ctx context.Context, ss grpc.ServerStream) grpc.ServerStream {
+	return &serverStream{ServerStream: ss, ctx: ctx}
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// authenticateRPC returns ctx with the identity of the caller of an RPC, or an
+// Unauthenticated error if it has no valid bearer token or API key
+func authenticateRPC(ctx context.Context, v Verifier, keys KeyVerifier) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	for _, value := range md.Get("authorization") {
+		token, ok := bearerToken(value)
+		if !ok {
+			continue
+		}
+
+		if id, err := v.Verify(token); err == nil {
+			return NewContext(ctx, id), nil
+		}
+	}
+
+	if keys != nil {
+		for _, key := range md.Get(APIKeyMetadata) {
+			if id, err := keys.VerifyKey(ctx, key); err == nil {
+				return NewContext(ctx, id), nil
+			}
+		}
+	}
+
+	return ctx, status.Error(codes.Unauthenticated, ErrUnauthenticated.Error())
+}
+
+func methodSet(methods []string) map[string]bool {
+	set := make(map[string]bool, len(methods))
+	for _, m := range methods {
+		set[m] = true
+	}
+
+	return set
+}
@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Middleware rejects requests without a valid bearer token in the Authorization header,
+// or API key in the X-API-Key header, with a 401 unless public returns true for the
+// request. keys may be nil if API keys aren't accepted. The identity of the caller is
+// added to the context of authenticated requests.
+func Middleware(v Verifier, keys KeyVerifier, public func(*http.Request) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token, ok := bearerToken(r.Header.Get("Authorization")); ok {
+				if id, err := v.Verify(token); err == nil {
+					next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), id)))
+					return
+				}
+			}
+
+			if key := r.Header.Get(APIKeyHeader); key != "" && keys != nil {
+				if id, err := keys.VerifyKey(r.Context(), key); err == nil {
+					next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), id)))
+					return
+				}
+			}
+
+			if public(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("WWW-Authenticate", `Bearer realm="trackmyfish"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": ErrUnauthenticated.Error()})
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var keyIdentity = Identity{UserID: 8, Username: "dory", HouseholdID: 2, APIKeyID: 1, Scope: &Scope{Resource: "tank-statistics", Permission: PermissionWrite}}
+
+type keyMock struct{}
+
+func (keyMock) VerifyKey(ctx context.Context, key string) (Identity, error) {
+	if key != "tmf_valid" {
+		return Identity{}, ErrUnauthenticated
+	}
+
+	return keyIdentity, nil
+}
+
+func TestMiddleware(t *testing.T) {
+	tm, err := NewTokenManager(testSecret, time.Hour)
+	assert.NoError(t, err)
+
+	token, _, err := tm.Issue(Identity{UserID: 7, Username: "nemo", HouseholdID: 2})
+	assert.NoError(t, err)
+
+	var got Identity
+	h := Middleware(tm, keyMock{}, func(r *http.Request) bool { return r.URL.Path == "/public" })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = FromContext(r.Context())
+	}))
+
+	testCases := []struct {
+		desc           string
+		path           string
+		authorization  string
+		apiKey         string
+		expectedStatus int
+		expectedID     Identity
+	}{
+		{desc: "No token is rejected", path: "/private", expectedStatus: http.StatusUnauthorized},
+		{desc: "An invalid token is rejected", path: "/private", authorization: "Bearer nope", expectedStatus: http.StatusUnauthorized},
+		{desc: "A non bearer token is rejected", path: "/private", authorization: "Basic " + token, expectedStatus: http.StatusUnauthorized},
+		{desc: "A valid token is accepted", path: "/private", authorization: "Bearer " + token, expectedStatus: http.StatusOK, expectedID: Identity{UserID: 7, Username: "nemo", HouseholdID: 2}},
+		{desc: "Public paths don't need a token", path: "/public", expectedStatus: http.StatusOK},
+		{desc: "An invalid API key is rejected", path: "/private", apiKey: "tmf_nope", expectedStatus: http.StatusUnauthorized},
+		{desc: "A valid API key is accepted", path: "/private", apiKey: "tmf_valid", expectedStatus: http.StatusOK, expectedID: keyIdentity},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got = Identity{}
+
+			req := httptest.NewRequest(http.MethodGet, tC.path, nil)
+			if tC.authorization != "" {
+				req.Header.Set("Authorization", tC.authorization)
+			}
+			if tC.apiKey != "" {
+				req.Header.Set(APIKeyHeader, tC.apiKey)
+			}
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			assert.Equal(t, tC.expectedStatus, rec.Code)
+			assert.Equal(t, tC.expectedID, got)
+		})
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	tm, err := NewTokenManager(testSecret, time.Hour)
+	assert.NoError(t, err)
+
+	token, _, err := tm.Issue(Identity{UserID: 7, Username: "nemo", HouseholdID: 2})
+	assert.NoError(t, err)
+
+	interceptor := UnaryServerInterceptor(tm, keyMock{}, "/svc/Public")
+
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		id, _ := FromContext(ctx)
+		return id, nil
+	}
+
+	testCases := []struct {
+		desc         string
+		method       string
+		md           metadata.MD
+		expectedCode codes.Code
+		expectedID   Identity
+	}{
+		{desc: "No metadata is rejected", method: "/svc/Private", expectedCode: codes.Unauthenticated},
+		{desc: "An invalid token is rejected", method: "/svc/Private", md: metadata.Pairs("authorization", "Bearer nope"), expectedCode: codes.Unauthenticated},
+		{desc: "A valid token is accepted", method: "/svc/Private", md: metadata.Pairs("authorization", "Bearer "+token), expectedCode: codes.OK, expectedID: Identity{UserID: 7, Username: "nemo", HouseholdID: 2}},
+		{desc: "Public methods don't need a token", method: "/svc/Public", expectedCode: codes.OK},
+		{desc: "An invalid API key is rejected", method: "/svc/Private", md: metadata.Pairs("x-api-key", "tmf_nope"), expectedCode: codes.Unauthenticated},
+		{desc: "A valid API key is accepted", method: "/svc/Private", md: metadata.Pairs("x-api-key", "tmf_valid"), expectedCode: codes.OK, expectedID: keyIdentity},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			ctx := context.Background()
+			if tC.md != nil {
+				ctx = metadata.NewIncomingContext(ctx, tC.md)
+			}
+
+			rsp, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: tC.method}, handler)
+
+			assert.Equal(t, tC.expectedCode, status.Code(err))
+			if err == nil {
+				assert.Equal(t, tC.expectedID, rsp)
+			}
+		})
+	}
+}
+
+type streamMock struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s streamMock) Context() context.Context {
+	return s.ctx
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	tm, err := NewTokenManager(testSecret, time.Hour)
+	assert.NoError(t, err)
+
+	token, _, err := tm.Issue(Identity{UserID: 7, Username: "nemo", HouseholdID: 2})
+	assert.NoError(t, err)
+
+	interceptor := StreamServerInterceptor(tm, keyMock{}, "/svc/Public")
+
+	testCases := []struct {
+		desc         string
+		method       string
+		md           metadata.MD
+		expectedCode codes.Code
+		expectedID   Identity
+	}{
+		{desc: "No metadata is rejected", method: "/svc/Private", expectedCode: codes.Unauthenticated},
+		{desc: "An invalid token is rejected", method: "/svc/Private", md: metadata.Pairs("authorization", "Bearer nope"), expectedCode: codes.Unauthenticated},
+		{desc: "A valid token is accepted", method: "/svc/Private", md: metadata.Pairs("authorization", "Bearer "+token), expectedCode: codes.OK, expectedID: Identity{UserID: 7, Username: "nemo", HouseholdID: 2}},
+		{desc: "Public methods don't need a token", method: "/svc/Public", expectedCode: codes.OK},
+		{desc: "A valid API key is accepted", method: "/svc/Private", md: metadata.Pairs("x-api-key", "tmf_valid"), expectedCode: codes.OK, expectedID: keyIdentity},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			ctx := context.Background()
+			if tC.md != nil {
+				ctx = metadata.NewIncomingContext(ctx, tC.md)
+			}
+
+			var id Identity
+			err := interceptor(nil, streamMock{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: tC.method}, func(srv interface{}, ss grpc.ServerStream) error {
+				id, _ = FromContext(ss.Context())
+				return nil
+			})
+
+			assert.Equal(t, tC.expectedCode, status.Code(err))
+			assert.Equal(t, tC.expectedID, id)
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+
+	"github.com/pkg/errors"
+)
+
+// opaqueTokenLength is the number of random bytes in an opaque token
+const opaqueTokenLength = 32
+
+// NewOpaqueToken returns a random, URL safe token, such as an invite code. Only its hash,
+// see HashOpaqueToken, should be stored.
+func NewOpaqueToken() (string, error) {
+	b := make([]byte, opaqueTokenLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "unable to generate token")
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashOpaqueToken returns the hex encoded SHA-256 hash of token. Opaque tokens are random
+// so, unlike passwords, don't need a slow hash.
+func HashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MinPasswordLength is the minimum length of a user's password
+const MinPasswordLength = 8
+
+// maxPasswordLength is the maximum length bcrypt will hash, anything longer is rejected
+// rather than silently truncated
+const maxPasswordLength = 72
+
+// dummyHash is compared against when a user doesn't exist, so that logging in as an
+// unknown user takes as long as using the wrong password
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("trackmyfish-dummy-password"), bcrypt.DefaultCost)
+
+// HashPassword returns the bcrypt hash of password
+func HashPassword(password string) (string, error) {
+	if len(password) < MinPasswordLength {
+		return "", errors.Errorf("password must be at least %d characters", MinPasswordLength)
+	}
+
+	if len(password) > maxPasswordLength {
+		return "", errors.Errorf("password must be at most %d characters", maxPasswordLength)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", errors.Wrap(err, "unable to hash password")
+	}
+
+	return string(hash), nil
+}
+
+// CheckPassword returns an error if password doesn't match hash. An empty hash, i.e. an
+// unknown user, never matches.
+func CheckPassword(hash, password string) error {
+	if hash == "" {
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+
+		return errors.New("invalid username or password")
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		return errors.New("invalid username or password")
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrForbidden is returned when the role of a user doesn't allow a request
+var ErrForbidden = errors.New("permission denied")
+
+// Role is the level of access a user has to the data of their household
+type Role string
+
+const (
+	// RoleOwner can do anything, including managing the household and its members
+	RoleOwner Role = "OWNER"
+	// RoleEditor can view and record data, but not delete it
+	RoleEditor Role = "EDITOR"
+	// RoleViewer can only view data
+	RoleViewer Role = "VIEWER"
+)
+
+// Permission is the level of access needed to make a request. Each permission includes
+// the ones before it.
+type Permission int
+
+const (
+	PermissionRead Permission = iota
+	PermissionWrite
+	PermissionDelete
+	PermissionManage
+)
+
+// ParseRole returns the Role named by s, ignoring case
+func ParseRole(s string) (Role, error) {
+	switch r := Role(strings.ToUpper(s)); r {
+	case RoleOwner, RoleEditor, RoleViewer:
+		return r, nil
+	default:
+		return "", errors.Errorf("invalid role %q, must be one of OWNER, EDITOR or VIEWER", s)
+	}
+}
+
+// Allows returns whether the role has permission p
+func (r Role) Allows(p Permission) bool {
+	switch r {
+	case RoleOwner:
+		return true
+	case RoleEditor:
+		return p <= PermissionWrite
+	case RoleViewer:
+		return p == PermissionRead
+	default:
+		return false
+	}
+}
@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRole(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		role        string
+		expected    Role
+		expectedErr bool
+	}{
+		{desc: "Roles are parsed", role: "EDITOR", expected: RoleEditor},
+		{desc: "Case is ignored", role: "viewer", expected: RoleViewer},
+		{desc: "Unknown roles are rejected", role: "ADMIN", expectedErr: true},
+		{desc: "Empty roles are rejected", role: "", expectedErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			r, err := ParseRole(tC.role)
+			if tC.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tC.expected, r)
+		})
+	}
+}
+
+func TestRoleAllows(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		role     Role
+		expected map[Permission]bool
+	}{
+		{
+			desc:     "Owners can do anything",
+			role:     RoleOwner,
+			expected: map[Permission]bool{PermissionRead: true, PermissionWrite: true, PermissionDelete: true, PermissionManage: true},
+		},
+		{
+			desc:     "Editors can read and write",
+			role:     RoleEditor,
+			expected: map[Permission]bool{PermissionRead: true, PermissionWrite: true, PermissionDelete: false, PermissionManage: false},
+		},
+		{
+			desc:     "Viewers can only read",
+			role:     RoleViewer,
+			expected: map[Permission]bool{PermissionRead: true, PermissionWrite: false, PermissionDelete: false, PermissionManage: false},
+		},
+		{
+			desc:     "Unknown roles can't do anything",
+			role:     Role("ADMIN"),
+			expected: map[Permission]bool{PermissionRead: false, PermissionWrite: false, PermissionDelete: false, PermissionManage: false},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			for p, expected := range tC.expected {
+				assert.Equal(t, expected, tC.role.Allows(p), "permission %d", p)
+			}
+		})
+	}
+}
+
+func TestScopeAllows(t *testing.T) {
+	scope := &Scope{Resource: "tank-statistics", Permission: PermissionWrite}
+
+	testCases := []struct {
+		desc       string
+		scope      *Scope
+		resource   string
+		permission Permission
+		expected   bool
+	}{
+		{desc: "No scope allows anything", resource: "tanks", permission: PermissionManage, expected: true},
+		{desc: "The resource is allowed up to the permission", scope: scope, resource: "tank-statistics", permission: PermissionRead, expected: true},
+		{desc: "The permission of the resource is allowed", scope: scope, resource: "tank-statistics", permission: PermissionWrite, expected: true},
+		{desc: "More than the permission isn't allowed", scope: scope, resource: "tank-statistics", permission: PermissionDelete, expected: false},
+		{desc: "Other resources aren't allowed", scope: scope, resource: "tanks", permission: PermissionRead, expected: false},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			assert.Equal(t, tC.expected, tC.scope.Allows(tC.resource, tC.permission))
+		})
+	}
+}
+
+func TestScopeAllowsTank(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		scope    *Scope
+		tankID   int32
+		expected bool
+	}{
+		{desc: "No scope allows every tank", tankID: 3, expected: true},
+		{desc: "A scope without a tank allows every tank", scope: &Scope{Resource: "readings", Permission: PermissionWrite}, tankID: 3, expected: true},
+		{desc: "A scope with a tank allows it", scope: &Scope{Resource: "readings", Permission: PermissionWrite, TankID: 3}, tankID: 3, expected: true},
+		{desc: "A scope with a tank doesn't allow others", scope: &Scope{Resource: "readings", Permission: PermissionWrite, TankID: 3}, tankID: 4, expected: false},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			assert.Equal(t, tC.expected, tC.scope.AllowsTank(tC.tankID))
+		})
+	}
+}
+
+func TestParsePermission(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		permission  string
+		expected    Permission
+		expectedErr bool
+	}{
+		{desc: "Permissions are parsed", permission: "WRITE", expected: PermissionWrite},
+		{desc: "Case is ignored", permission: "read", expected: PermissionRead},
+		{desc: "Manage can't be parsed", permission: "MANAGE", expectedErr: true},
+		{desc: "Unknown permissions are rejected", permission: "ADMIN", expectedErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			p, err := ParsePermission(tC.permission)
+			if tC.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tC.expected, p)
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"crypto/rand"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+// DefaultTokenTTL is how long an issued session token is valid for
+const DefaultTokenTTL = 24 * time.Hour
+
+// minSecretLength is the minimum length of the secret used to sign tokens
+const minSecretLength = 32
+
+const issuer = "trackmyfish"
+
+// ErrUnauthenticated is returned when a request has no, or invalid, credentials
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+// Identity is the authenticated user making a request, and the household it belongs to
+type Identity struct {
+	UserID      int32
+	Username    string
+	HouseholdID int32
+	// Role isn't part of the token, so changes apply immediately. It is only set once the
+	// request has been authorized.
+	Role Role
+	// APIKeyID is set when the request was authenticated with an API key, which may
+	// restrict it further to Scope
+	APIKeyID int32
+	Scope    *Scope
+}
+
+// Verifier verifies a credential presented with a request, returning the identity it belongs to
+type Verifier interface {
+	Verify(credential string) (Identity, error)
+}
+
+type claims struct {
+	Username  string `json:"username"`
+	Household int32  `json:"household"`
+	jwt.RegisteredClaims
+}
+
+// TokenManager issues and verifies signed session tokens (HS256 JWTs)
+type TokenManager struct {
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+// NewTokenManager returns a TokenManager signing tokens with secret. If secret is empty a
+// random one is generated, which means tokens don't survive a restart.
+func NewTokenManager(secret string, ttl time.Duration) (*TokenManager, error) {
+	key := []byte(secret)
+
+	if secret == "" {
+		key = make([]byte, minSecretLength)
+		if _, err := rand.Read(key); err != nil {
+			return nil, errors.Wrap(err, "unable to generate secret")
+		}
+	}
+
+	if len(key) < minSecretLength {
+		return nil, errors.Errorf("secret must be at least %d characters", minSecretLength)
+	}
+
+	if ttl <= 0 {
+		ttl = DefaultTokenTTL
+	}
+
+	return &TokenManager{secret: key, ttl: ttl, now: time.Now}, nil
+}
+
+// Issue returns a signed token for id and when it expires
+func (t *TokenManager) Issue(id Identity) (string, time.Time, error) {
+	now := t.now()
+	expires := now.Add(t.ttl)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims{
+		Username:  id.Username,
+		Household: id.HouseholdID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   strconv.Itoa(int(id.UserID)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expires),
+		},
+	})
+
+	signed, err := token.SignedString(t.secret)
+	if err != nil {
+		return "", time.Time{}, errors.Wrap(err, "unable to sign token")
+	}
+
+	return signed, expires, nil
+}
+
+// Verify checks the signature and expiry of token, returning the identity it was issued to
+func (t *TokenManager) Verify(token string) (Identity, error) {
+	c := claims{}
+
+	// the claims are validated below against t.now rather than the parser's clock
+	parser := jwt.Parser{ValidMethods: []string{jwt.SigningMethodHS256.Alg()}, SkipClaimsValidation: true}
+	if _, err := parser.ParseWithClaims(token, &c, func(*jwt.Token) (interface{}, error) {
+		return t.secret, nil
+	}); err != nil {
+		return Identity{}, ErrUnauthenticated
+	}
+
+	// tokens issued before households were introduced have no household
+	if !c.VerifyIssuer(issuer, true) || !c.VerifyExpiresAt(t.now(), true) || c.Household == 0 {
+		return Identity{}, ErrUnauthenticated
+	}
+
+	id, err := strconv.ParseInt(c.Subject, 10, 32)
+	if err != nil {
+		return Identity{}, ErrUnauthenticated
+	}
+
+	return Identity{UserID: int32(id), Username: c.Username, HouseholdID: c.Household}, nil
+}
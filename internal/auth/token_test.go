@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func TestNewTokenManager(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		secret      string
+		expectedErr bool
+	}{
+		{desc: "Short secrets are rejected", secret: "secret", expectedErr: true},
+		{desc: "An empty secret generates a random secret", secret: ""},
+		{desc: "Secrets of at least 32 characters are accepted", secret: testSecret},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			_, err := NewTokenManager(tC.secret, time.Hour)
+			if tC.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestToken(t *testing.T) {
+	tm, err := NewTokenManager(testSecret, time.Hour)
+	assert.NoError(t, err)
+
+	now := time.Date(2021, 8, 1, 12, 0, 0, 0, time.UTC)
+	tm.now = func() time.Time { return now }
+
+	token, expires, err := tm.Issue(Identity{UserID: 7, Username: "nemo", HouseholdID: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(time.Hour), expires)
+
+	t.Run("A valid token returns the identity", func(t *testing.T) {
+		id, err := tm.Verify(token)
+		assert.NoError(t, err)
+		assert.Equal(t, Identity{UserID: 7, Username: "nemo", HouseholdID: 2}, id)
+	})
+
+	t.Run("A tampered token is rejected", func(t *testing.T) {
+		_, err := tm.Verify(token[:len(token)-2] + "xx")
+		assert.Equal(t, ErrUnauthenticated, err)
+	})
+
+	t.Run("A token signed with another secret is rejected", func(t *testing.T) {
+		other, err := NewTokenManager("", time.Hour)
+		assert.NoError(t, err)
+
+		_, err = other.Verify(token)
+		assert.Equal(t, ErrUnauthenticated, err)
+	})
+
+	t.Run("An expired token is rejected", func(t *testing.T) {
+		tm.now = func() time.Time { return now.Add(2 * time.Hour) }
+		defer func() { tm.now = func() time.Time { return now } }()
+
+		_, err := tm.Verify(token)
+		assert.Equal(t, ErrUnauthenticated, err)
+	})
+
+	t.Run("A token without a household is rejected", func(t *testing.T) {
+		legacy, _, err := tm.Issue(Identity{UserID: 7, Username: "nemo"})
+		assert.NoError(t, err)
+
+		_, err = tm.Verify(legacy)
+		assert.Equal(t, ErrUnauthenticated, err)
+	})
+
+	t.Run("An unsigned token is rejected", func(t *testing.T) {
+		// {"alg":"none","typ":"JWT"}.{"sub":"7","iss":"trackmyfish"}.
+		_, err := tm.Verify("eyJhbGciOiJub25lIiwidHlwIjoiSldUIn0.eyJzdWIiOiI3IiwiaXNzIjoidHJhY2tteWZpc2gifQ.")
+		assert.Equal(t, ErrUnauthenticated, err)
+	})
+}
+
+func TestPassword(t *testing.T) {
+	hash, err := HashPassword("correct horse")
+	assert.NoError(t, err)
+
+	assert.NoError(t, CheckPassword(hash, "correct horse"))
+	assert.Error(t, CheckPassword(hash, "battery staple"))
+	assert.Error(t, CheckPassword("", "correct horse"))
+
+	_, err = HashPassword("short")
+	assert.Error(t, err)
+}
+
+func TestOpaqueToken(t *testing.T) {
+	a, err := NewOpaqueToken()
+	assert.NoError(t, err)
+
+	b, err := NewOpaqueToken()
+	assert.NoError(t, err)
+
+	assert.NotEqual(t, a, b)
+	assert.Len(t, HashOpaqueToken(a), 64)
+	assert.Equal(t, HashOpaqueToken(a), HashOpaqueToken(a))
+	assert.NotEqual(t, HashOpaqueToken(a), HashOpaqueToken(b))
+}
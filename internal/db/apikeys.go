@@ -0,0 +1,130 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// APIKey lets scripts and sensors authenticate as a user without logging in. Only a hash
+// of the key is stored, along with its first characters to recognise it by. A key with a
+// ScopeResource can only be used for that resource, with at most ScopePermission, and
+// only for the tank ScopeTankID if it's set.
+type APIKey struct {
+	ID              int32
+	UserID          int32
+	Name            string
+	Prefix          string
+	ScopeResource   string
+	ScopePermission string
+	ScopeTankID     *int32
+	LastUsedAt      *time.Time
+	CreatedAt       time.Time
+}
+
+const apiKeyColumns = "id, user_id, name, prefix, scope_resource, scope_permission, scope_tank_id, last_used_at, created_at"
+
+func scanAPIKey(row pgx.Row, k *APIKey) error {
+	return row.Scan(&k.ID, &k.UserID, &k.Name, &k.Prefix, &k.ScopeResource, &k.ScopePermission, &k.ScopeTankID, &k.LastUsedAt, &k.CreatedAt)
+}
+
+func (d *Manager) InsertAPIKey(ctx context.Context, key APIKey, keyHash string) (APIKey, error) {
+	k := APIKey{}
+
+	err := scanAPIKey(d.pool.QueryRow(
+		ctx,
+		"INSERT INTO api_keys(user_id, name, prefix, key_hash, scope_resource, scope_permission, scope_tank_id) VALUES($1, $2, $3, $4, $5, $6, $7) RETURNING "+apiKeyColumns,
+		key.UserID, key.Name, key.Prefix, keyHash, key.ScopeResource, key.ScopePermission, key.ScopeTankID,
+	), &k)
+	if err != nil {
+		return k, errors.Wrap(err, "unable to add api key")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id":     k.ID,
+		"userId": k.UserID,
+	}).Info("API key inserted successfully")
+
+	return k, nil
+}
+
+// ListAPIKeys returns the API keys of a user, newest first
+func (d *Manager) ListAPIKeys(ctx context.Context, userID int32) ([]APIKey, error) {
+	keys := make([]APIKey, 0)
+
+	rows, err := d.pool.Query(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE user_id=$1 ORDER BY created_at DESC, id DESC", userID)
+	if err != nil {
+		return keys, errors.Wrap(err, "unable to get api keys")
+	}
+
+	rowCount := 0
+	for rows.Next() {
+		k := APIKey{}
+
+		if err := scanAPIKey(rows, &k); err != nil {
+			return nil, errors.Wrap(err, "unable to scan row")
+		}
+
+		keys = append(keys, k)
+
+		rowCount++
+	}
+
+	if rows.Err() != nil {
+		return nil, errors.Wrap(rows.Err(), "erroring reading rows")
+	}
+
+	logrus.WithFields(logrus.Fields{"rowCount": rowCount}).Info("API keys queried successfully")
+
+	return keys, nil
+}
+
+// DeleteAPIKey revokes an API key of a user
+func (d *Manager) DeleteAPIKey(ctx context.Context, userID, id int32) (APIKey, error) {
+	k := APIKey{}
+
+	err := scanAPIKey(d.pool.QueryRow(ctx, "DELETE FROM api_keys WHERE user_id=$1 AND id=$2 RETURNING "+apiKeyColumns, userID, id), &k)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return k, &ErrNotFound{message: "api key not found"}
+		}
+
+		return k, errors.Wrap(err, "unable to delete api key")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id": k.ID,
+	}).Info("API key deleted successfully")
+
+	return k, nil
+}
+
+// UseAPIKey returns the API key with the hash and the user it belongs to, recording that
+// it has been used
+func (d *Manager) UseAPIKey(ctx context.Context, keyHash string) (APIKey, User, error) {
+	k, u := APIKey{}, User{}
+
+	err := d.pool.QueryRow(
+		ctx,
+		`WITH k AS (UPDATE api_keys SET last_used_at=NOW() WHERE key_hash=$1 RETURNING `+apiKeyColumns+`)
+		SELECT k.id, k.user_id, k.name, k.prefix, k.scope_resource, k.scope_permission, k.scope_tank_id, k.last_used_at, k.created_at,
+		  u.id, u.household_id, u.username, u.password_hash, u.role, u.created_at
+		FROM k JOIN users u ON u.id=k.user_id`,
+		keyHash,
+	).Scan(
+		&k.ID, &k.UserID, &k.Name, &k.Prefix, &k.ScopeResource, &k.ScopePermission, &k.ScopeTankID, &k.LastUsedAt, &k.CreatedAt,
+		&u.ID, &u.HouseholdID, &u.Username, &u.PasswordHash, &u.Role, &u.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return k, u, &ErrNotFound{message: "api key not found"}
+		}
+
+		return k, u, errors.Wrap(err, "unable to use api key")
+	}
+
+	return k, u, nil
+}
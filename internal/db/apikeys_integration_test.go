@@ -0,0 +1,82 @@
+//go:build integration
+// +build integration
+
+package db_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+func TestAPIKeys(t *testing.T) {
+	t.Run("Given an API key", func(t *testing.T) {
+		ctx := context.Background()
+
+		user, err := mgr.InsertUser(ctx, db.User{Username: "api-key-owner", PasswordHash: "hash"}, "API Keys")
+		assert.NoError(t, err)
+
+		key, err := mgr.InsertAPIKey(ctx, db.APIKey{UserID: user.ID, Name: "sensor", Prefix: "tmf_abcd", ScopeResource: "tank-statistics", ScopePermission: "WRITE"}, "key-hash")
+		assert.NoError(t, err)
+		assert.Nil(t, key.LastUsedAt)
+
+		t.Run("When it is used", func(t *testing.T) {
+			t.Run("Then the key and its user are returned and the use is recorded", func(t *testing.T) {
+				k, u, err := mgr.UseAPIKey(ctx, "key-hash")
+				assert.NoError(t, err)
+				assert.Equal(t, user, u)
+				assert.Equal(t, key.ID, k.ID)
+				assert.Equal(t, "tank-statistics", k.ScopeResource)
+				assert.NotNil(t, k.LastUsedAt)
+
+				keys, err := mgr.ListAPIKeys(ctx, user.ID)
+				assert.NoError(t, err)
+				assert.Len(t, keys, 1)
+				assert.Equal(t, k.LastUsedAt, keys[0].LastUsedAt)
+			})
+		})
+
+		t.Run("When a key is scoped to a tank", func(t *testing.T) {
+			t.Run("Then the tank is returned with the key", func(t *testing.T) {
+				tank, err := mgr.InsertTank(ctx, db.Tank{Name: "Scoped"})
+				assert.NoError(t, err)
+
+				_, err = mgr.InsertAPIKey(ctx, db.APIKey{UserID: user.ID, Name: "probe", Prefix: "tmf_efgh", ScopeResource: "readings", ScopePermission: "WRITE", ScopeTankID: &tank.ID}, "tank-key-hash")
+				assert.NoError(t, err)
+
+				k, _, err := mgr.UseAPIKey(ctx, "tank-key-hash")
+				assert.NoError(t, err)
+				assert.Equal(t, tank.ID, *k.ScopeTankID)
+
+				_, err = mgr.DeleteTank(ctx, tank.ID)
+				assert.NoError(t, err)
+			})
+		})
+
+		t.Run("When an unknown key is used", func(t *testing.T) {
+			t.Run("Then it isn't found", func(t *testing.T) {
+				_, _, err := mgr.UseAPIKey(ctx, "unknown-hash")
+				assert.IsType(t, &db.ErrNotFound{}, err)
+			})
+		})
+
+		t.Run("When another user revokes it", func(t *testing.T) {
+			t.Run("Then it isn't found", func(t *testing.T) {
+				_, err := mgr.DeleteAPIKey(ctx, user.ID+1000, key.ID)
+				assert.IsType(t, &db.ErrNotFound{}, err)
+			})
+		})
+
+		t.Run("When it is revoked", func(t *testing.T) {
+			t.Run("Then it can't be used", func(t *testing.T) {
+				_, err := mgr.DeleteAPIKey(ctx, user.ID, key.ID)
+				assert.NoError(t, err)
+
+				_, _, err = mgr.UseAPIKey(ctx, "key-hash")
+				assert.IsType(t, &db.ErrNotFound{}, err)
+			})
+		})
+	})
+}
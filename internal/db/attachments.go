@@ -0,0 +1,123 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Attachment is the metadata for a blob (e.g. a photo) linked to either a Tank or a Fish
+type Attachment struct {
+	ID           int32
+	TankID       *int32
+	FishID       *int32
+	Filename     string
+	ContentType  string
+	Size         int64
+	BlobKey      string
+	ThumbnailKey string
+	Caption      string
+	CreatedAt    time.Time
+}
+
+// AttachmentFilter restricts the attachments returned by ListAttachments. Nil fields are ignored.
+type AttachmentFilter struct {
+	TankID *int32
+	FishID *int32
+}
+
+const attachmentColumns = "id, tank_id, fish_id, filename, content_type, size, blob_key, thumbnail_key, caption, created_at"
+
+func scanAttachment(row pgx.Row, a *Attachment) error {
+	return row.Scan(&a.ID, &a.TankID, &a.FishID, &a.Filename, &a.ContentType, &a.Size, &a.BlobKey, &a.ThumbnailKey, &a.Caption, &a.CreatedAt)
+}
+
+func (d *Manager) InsertAttachment(ctx context.Context, attachment Attachment) (Attachment, error) {
+	a := Attachment{}
+
+	err := scanAttachment(d.pool.QueryRow(
+		ctx,
+		"INSERT INTO attachments(tank_id, fish_id, filename, content_type, size, blob_key, thumbnail_key, caption) VALUES($1, $2, $3, $4, $5, $6, $7, $8) RETURNING "+attachmentColumns,
+		attachment.TankID, attachment.FishID, attachment.Filename, attachment.ContentType, attachment.Size, attachment.BlobKey, attachment.ThumbnailKey, attachment.Caption,
+	), &a)
+	if err != nil {
+		return a, errors.Wrap(err, "unable to add attachment")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id": a.ID,
+	}).Info("Attachment inserted successfully")
+
+	return a, nil
+}
+
+func (d *Manager) GetAttachment(ctx context.Context, id int32) (Attachment, error) {
+	a := Attachment{}
+
+	err := scanAttachment(d.pool.QueryRow(ctx, "SELECT "+attachmentColumns+" FROM attachments WHERE id=$1", id), &a)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return a, &ErrNotFound{message: "attachment not found"}
+		}
+
+		return a, errors.Wrap(err, "unable to get attachment")
+	}
+
+	return a, nil
+}
+
+func (d *Manager) ListAttachments(ctx context.Context, filter AttachmentFilter) ([]Attachment, error) {
+	attachments := make([]Attachment, 0)
+
+	rows, err := d.pool.Query(
+		ctx,
+		"SELECT "+attachmentColumns+" FROM attachments WHERE ($1::INT IS NULL OR tank_id=$1) AND ($2::INT IS NULL OR fish_id=$2) ORDER BY created_at",
+		filter.TankID, filter.FishID,
+	)
+	if err != nil {
+		return attachments, errors.Wrap(err, "unable to get attachments")
+	}
+
+	rowCount := 0
+	for rows.Next() {
+		a := Attachment{}
+
+		if err := scanAttachment(rows, &a); err != nil {
+			return nil, errors.Wrap(err, "unable to scan row")
+		}
+
+		attachments = append(attachments, a)
+
+		rowCount++
+	}
+
+	if rows.Err() != nil {
+		return nil, errors.Wrap(rows.Err(), "erroring reading rows")
+	}
+
+	logrus.WithFields(logrus.Fields{"rowCount": rowCount}).Info("Attachments queried successfully")
+
+	return attachments, nil
+}
+
+func (d *Manager) DeleteAttachment(ctx context.Context, id int32) (Attachment, error) {
+	a := Attachment{}
+
+	err := scanAttachment(d.pool.QueryRow(ctx, "DELETE FROM attachments WHERE id=$1 RETURNING "+attachmentColumns, id), &a)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return a, &ErrNotFound{message: "attachment not found"}
+		}
+
+		return a, errors.Wrap(err, "unable to delete attachment")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id": a.ID,
+	}).Info("Attachment deleted successfully")
+
+	return a, nil
+}
@@ -0,0 +1,111 @@
+//go:build integration
+// +build integration
+
+package db_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+func TestAttachments(t *testing.T) {
+	t.Run("Given a valid Attachment object for a Tank", func(t *testing.T) {
+		var inserted db.Attachment
+		var err error
+
+		tank, err := mgr.InsertTank(context.Background(), db.Tank{Name: "Photographed"})
+		assert.NoError(t, err)
+
+		attachment := db.Attachment{
+			TankID:       &tank.ID,
+			Filename:     "tank.jpg",
+			ContentType:  "image/jpeg",
+			Size:         1024,
+			BlobKey:      "2021/08/abc.jpg",
+			ThumbnailKey: "2021/08/abc_thumb.jpg",
+			Caption:      "Freshly rescaped",
+		}
+
+		t.Run("When it is passed to InsertAttachment", func(t *testing.T) {
+			t.Run("Then it should create the record without error", func(t *testing.T) {
+				inserted, err = mgr.InsertAttachment(context.Background(), attachment)
+				assert.NoError(t, err)
+
+				assert.Equal(t, attachment.TankID, inserted.TankID)
+				assert.Nil(t, inserted.FishID)
+				assert.Equal(t, attachment.Filename, inserted.Filename)
+				assert.Equal(t, attachment.ContentType, inserted.ContentType)
+				assert.Equal(t, attachment.Size, inserted.Size)
+				assert.Equal(t, attachment.BlobKey, inserted.BlobKey)
+				assert.Equal(t, attachment.ThumbnailKey, inserted.ThumbnailKey)
+				assert.Equal(t, attachment.Caption, inserted.Caption)
+				assert.False(t, inserted.CreatedAt.IsZero())
+			})
+		})
+
+		t.Run("When it is linked to both a Tank and a Fish", func(t *testing.T) {
+			t.Run("Then an error is returned", func(t *testing.T) {
+				fish, err := mgr.InsertFish(context.Background(), db.Fish{Type: "Tetra"})
+				assert.NoError(t, err)
+
+				invalid := attachment
+				invalid.FishID = &fish.ID
+
+				_, err = mgr.InsertAttachment(context.Background(), invalid)
+				assert.Error(t, err)
+
+				_, err = mgr.DeleteFish(context.Background(), fish.ID)
+				assert.NoError(t, err)
+			})
+		})
+
+		t.Run("When ListAttachments is called with the Tank ID", func(t *testing.T) {
+			t.Run("Then the inserted Attachment should exist", func(t *testing.T) {
+				a, err := mgr.ListAttachments(context.Background(), db.AttachmentFilter{TankID: &tank.ID})
+				assert.NoError(t, err)
+
+				assert.Len(t, a, 1)
+				assert.Equal(t, inserted, a[0])
+			})
+		})
+
+		t.Run("When ListAttachments is called with another Tank ID", func(t *testing.T) {
+			t.Run("Then no Attachments are returned", func(t *testing.T) {
+				other := tank.ID + 1
+
+				a, err := mgr.ListAttachments(context.Background(), db.AttachmentFilter{TankID: &other})
+				assert.NoError(t, err)
+
+				assert.Len(t, a, 0)
+			})
+		})
+
+		t.Run("When GetAttachment is called", func(t *testing.T) {
+			t.Run("Then the inserted Attachment is returned", func(t *testing.T) {
+				a, err := mgr.GetAttachment(context.Background(), inserted.ID)
+				assert.NoError(t, err)
+
+				assert.Equal(t, inserted, a)
+			})
+		})
+
+		t.Run("When DeleteAttachment is called", func(t *testing.T) {
+			t.Run("Then the Attachment is deleted", func(t *testing.T) {
+				a, err := mgr.DeleteAttachment(context.Background(), inserted.ID)
+				assert.NoError(t, err)
+
+				assert.Equal(t, inserted, a)
+
+				// Make sure the attachment doesn't exist
+				_, err = mgr.GetAttachment(context.Background(), inserted.ID)
+				assert.IsType(t, &db.ErrNotFound{}, err)
+			})
+		})
+
+		_, err = mgr.DeleteTank(context.Background(), tank.ID)
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,104 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// AuditEvent records a change made through the API: who made it, how, and the entity it
+// was made to before and/or after the change as JSON. Audit events are append-only.
+type AuditEvent struct {
+	ID int32
+	// UserID, Username and APIKeyID identify the actor, and are empty for changes made
+	// without authenticating, e.g. signing up
+	UserID   *int32
+	Username string
+	APIKeyID *int32
+	// Operation is the RPC, e.g. /trackmyfish.v1alpha1.TrackMyFishService/AddFish, or the
+	// method and path of an HTTP request, e.g. DELETE /api/v1alpha1/journal/3
+	Operation  string
+	EntityType string
+	EntityID   *int32
+	Before     []byte
+	After      []byte
+	ClientIP   string
+	CreatedAt  time.Time
+}
+
+// AuditFilter restricts the audit events returned by ListAuditEvents. Empty fields are
+// ignored.
+type AuditFilter struct {
+	EntityType string
+	EntityID   *int32
+	From       *time.Time
+	To         *time.Time
+}
+
+const auditEventColumns = "id, user_id, username, api_key_id, operation, entity_type, entity_id, before, after, client_ip, created_at"
+
+func scanAuditEvent(row pgx.Row, e *AuditEvent) error {
+	return row.Scan(&e.ID, &e.UserID, &e.Username, &e.APIKeyID, &e.Operation, &e.EntityType, &e.EntityID, &e.Before, &e.After, &e.ClientIP, &e.CreatedAt)
+}
+
+func (d *Manager) InsertAuditEvent(ctx context.Context, event AuditEvent) (AuditEvent, error) {
+	e := AuditEvent{}
+
+	err := scanAuditEvent(d.pool.QueryRow(
+		ctx,
+		"INSERT INTO audit_events(user_id, username, api_key_id, operation, entity_type, entity_id, before, after, client_ip) VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING "+auditEventColumns,
+		event.UserID, event.Username, event.APIKeyID, event.Operation, event.EntityType, event.EntityID, event.Before, event.After, event.ClientIP,
+	), &e)
+	if err != nil {
+		return e, errors.Wrap(err, "unable to add audit event")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id":        e.ID,
+		"operation": e.Operation,
+	}).Info("Audit event inserted successfully")
+
+	return e, nil
+}
+
+// ListAuditEvents returns at most limit audit events matching filter, newest first
+func (d *Manager) ListAuditEvents(ctx context.Context, filter AuditFilter, limit int32) ([]AuditEvent, error) {
+	events := make([]AuditEvent, 0)
+
+	rows, err := d.pool.Query(
+		ctx,
+		`SELECT `+auditEventColumns+` FROM audit_events
+		WHERE ($1='' OR entity_type=$1) AND ($2::INT IS NULL OR entity_id=$2)
+		  AND ($3::TIMESTAMPTZ IS NULL OR created_at >= $3) AND ($4::TIMESTAMPTZ IS NULL OR created_at < $4)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $5`,
+		filter.EntityType, filter.EntityID, filter.From, filter.To, limit,
+	)
+	if err != nil {
+		return events, errors.Wrap(err, "unable to get audit events")
+	}
+
+	rowCount := 0
+	for rows.Next() {
+		e := AuditEvent{}
+
+		if err := scanAuditEvent(rows, &e); err != nil {
+			return nil, errors.Wrap(err, "unable to scan row")
+		}
+
+		events = append(events, e)
+
+		rowCount++
+	}
+
+	if rows.Err() != nil {
+		return nil, errors.Wrap(rows.Err(), "erroring reading rows")
+	}
+
+	logrus.WithFields(logrus.Fields{"rowCount": rowCount}).Info("Audit events queried successfully")
+
+	return events, nil
+}
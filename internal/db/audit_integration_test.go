@@ -0,0 +1,82 @@
+//go:build integration
+// +build integration
+
+package db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+func TestAuditEvents(t *testing.T) {
+	t.Run("Given audited changes in two households", func(t *testing.T) {
+		a, err := mgr.InsertUser(context.Background(), db.User{Username: "audit-a", PasswordHash: "hash"}, "Audit A")
+		assert.NoError(t, err)
+
+		b, err := mgr.InsertUser(context.Background(), db.User{Username: "audit-b", PasswordHash: "hash"}, "Audit B")
+		assert.NoError(t, err)
+
+		ctxA := db.WithHousehold(context.Background(), a.HouseholdID)
+		ctxB := db.WithHousehold(context.Background(), b.HouseholdID)
+
+		entityID := int32(3)
+
+		added, err := mgr.InsertAuditEvent(ctxA, db.AuditEvent{
+			UserID:     &a.ID,
+			Username:   a.Username,
+			Operation:  "/trackmyfish.v1alpha1.TrackMyFishService/AddTankStatistic",
+			EntityType: "tank-statistics",
+			EntityID:   &entityID,
+			After:      []byte(`{"id": 3, "ph": 7.2}`),
+			ClientIP:   "192.0.2.1",
+		})
+		assert.NoError(t, err)
+		assert.Nil(t, added.Before)
+		assert.JSONEq(t, `{"id": 3, "ph": 7.2}`, string(added.After))
+
+		deleted, err := mgr.InsertAuditEvent(ctxA, db.AuditEvent{
+			UserID:     &a.ID,
+			Username:   a.Username,
+			Operation:  "/trackmyfish.v1alpha1.TrackMyFishService/DeleteTankStatistic",
+			EntityType: "tank-statistics",
+			EntityID:   &entityID,
+			Before:     []byte(`{"id": 3, "ph": 7.2}`),
+		})
+		assert.NoError(t, err)
+
+		_, err = mgr.InsertAuditEvent(ctxA, db.AuditEvent{Operation: "POST /api/v1alpha1/journal", EntityType: "journal"})
+		assert.NoError(t, err)
+
+		t.Run("When they are filtered by entity", func(t *testing.T) {
+			t.Run("Then the events of the entity are returned newest first", func(t *testing.T) {
+				events, err := mgr.ListAuditEvents(ctxA, db.AuditFilter{EntityType: "tank-statistics", EntityID: &entityID}, 10)
+				assert.NoError(t, err)
+				assert.Len(t, events, 2)
+				assert.Equal(t, deleted.ID, events[0].ID)
+				assert.Equal(t, added.ID, events[1].ID)
+			})
+		})
+
+		t.Run("When they are filtered by time", func(t *testing.T) {
+			t.Run("Then only the events in the range are returned", func(t *testing.T) {
+				future := time.Now().Add(time.Hour)
+
+				events, err := mgr.ListAuditEvents(ctxA, db.AuditFilter{From: &future}, 10)
+				assert.NoError(t, err)
+				assert.Empty(t, events)
+			})
+		})
+
+		t.Run("When the other household lists them", func(t *testing.T) {
+			t.Run("Then none are returned", func(t *testing.T) {
+				events, err := mgr.ListAuditEvents(ctxB, db.AuditFilter{}, 10)
+				assert.NoError(t, err)
+				assert.Empty(t, events)
+			})
+		})
+	})
+}
@@ -0,0 +1,383 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// BackupVersion is the version of the backups written by Export. Import accepts backups of
+// this version or older.
+const BackupVersion = 1
+
+// Backup is a versioned copy of the data of a household, holding the rows of each table by
+// name. Rows are JSON objects keyed by column, so backups can be read and restored without
+// knowing every column, and IDs are only meaningful within the backup. Attachments aren't
+// included, as their blobs live outside the database.
+type Backup struct {
+	Version    int                          `json:"version"`
+	ExportedAt time.Time                    `json:"exportedAt"`
+	Tables     map[string][]json.RawMessage `json:"tables"`
+}
+
+// ImportOptions controls how a backup is restored
+type ImportOptions struct {
+	// SkipConflicts skips rows which conflict with existing rows, e.g. a species which
+	// already exists, instead of failing the import
+	SkipConflicts bool
+}
+
+// ImportResult is how many rows of each table were imported, and how many were skipped as
+// they conflicted with existing rows or referenced rows which weren't imported
+type ImportResult struct {
+	Imported map[string]int
+	Skipped  map[string]int
+}
+
+// backupRef is a column referencing another table in the backup, which is remapped to the
+// ID the referenced row is imported with
+type backupRef struct {
+	column string
+	table  string
+	// setNull clears the column when the referenced row isn't imported, otherwise the
+	// row is skipped, matching the foreign key's ON DELETE
+	setNull bool
+}
+
+// backupTable is a table included in backups. Rows are identified by key, which is
+// assigned again on import, or are identified by their references if key is empty.
+type backupTable struct {
+	name    string
+	key     string
+	columns []string
+	refs    []backupRef
+}
+
+// backupTables are the tables included in backups, in an order which imports referenced
+// rows before the rows referencing them. The household, generated columns and attachments
+// are left out.
+var backupTables = []backupTable{
+	{
+		name:    "tanks",
+		key:     "id",
+		columns: []string{"make", "model", "name", "location", "capacity_measurement", "capacity", "description", "role", "deleted_at", "created_at", "updated_at"},
+	},
+	{
+		name:    "fish",
+		key:     "id",
+		columns: []string{"tank_id", "type", "subtype", "color", "gender", "purchase_date", "count", "deleted_at", "created_at", "updated_at"},
+		refs:    []backupRef{{column: "tank_id", table: "tanks", setNull: true}},
+	},
+	{
+		name:    "tank_statistics",
+		key:     "id",
+		columns: []string{"test_date", "ph", "gh", "kh", "ammonia", "nitrite", "nitrate", "phosphate", "deleted_at", "created_at", "updated_at"},
+	},
+	{
+		name:    "journal_entries",
+		key:     "id",
+		columns: []string{"tank_id", "fish_id", "entry_date", "category", "title", "body", "created_at", "updated_at"},
+		refs:    []backupRef{{column: "tank_id", table: "tanks"}, {column: "fish_id", table: "fish"}},
+	},
+	{
+		name:    "treatments",
+		key:     "id",
+		columns: []string{"tank_id", "medication", "dose", "dose_unit", "dose_interval_hours", "start_date", "end_date", "notes", "created_at", "updated_at"},
+		refs:    []backupRef{{column: "tank_id", table: "tanks"}},
+	},
+	{
+		name:    "treatment_fish",
+		columns: []string{"treatment_id", "fish_id"},
+		refs:    []backupRef{{column: "treatment_id", table: "treatments"}, {column: "fish_id", table: "fish"}},
+	},
+	{
+		name:    "treatment_doses",
+		key:     "id",
+		columns: []string{"treatment_id", "due_at", "administered_at", "created_at", "updated_at"},
+		refs:    []backupRef{{column: "treatment_id", table: "treatments"}},
+	},
+	{
+		name:    "quarantines",
+		key:     "id",
+		columns: []string{"fish_id", "quarantine_tank_id", "target_tank_id", "start_date", "days", "released_at", "notes", "created_at", "updated_at"},
+		refs: []backupRef{
+			{column: "fish_id", table: "fish"},
+			{column: "quarantine_tank_id", table: "tanks"},
+			{column: "target_tank_id", table: "tanks"},
+		},
+	},
+	{
+		name:    "breeding_records",
+		key:     "id",
+		columns: []string{"tank_id", "mother_fish_id", "father_fish_id", "spawn_date", "estimated_fry_count", "notes", "created_at", "updated_at"},
+		refs: []backupRef{
+			{column: "tank_id", table: "tanks"},
+			{column: "mother_fish_id", table: "fish", setNull: true},
+			{column: "father_fish_id", table: "fish", setNull: true},
+		},
+	},
+	{
+		name:    "fry_counts",
+		key:     "id",
+		columns: []string{"breeding_id", "count_date", "count", "created_at", "updated_at"},
+		refs:    []backupRef{{column: "breeding_id", table: "breeding_records"}},
+	},
+	{
+		name:    "breeding_offspring",
+		columns: []string{"breeding_id", "fish_id"},
+		refs:    []backupRef{{column: "breeding_id", table: "breeding_records"}, {column: "fish_id", table: "fish"}},
+	},
+	{
+		name:    "fertiliser_products",
+		key:     "id",
+		columns: []string{"name", "manufacturer", "notes", "created_at", "updated_at"},
+	},
+	{
+		name:    "fertiliser_product_components",
+		columns: []string{"product_id", "parameter", "mg_per_ml"},
+		refs:    []backupRef{{column: "product_id", table: "fertiliser_products"}},
+	},
+	{
+		name:    "dosing_log",
+		key:     "id",
+		columns: []string{"tank_id", "product_id", "amount_ml", "dosed_at", "notes", "created_at", "updated_at"},
+		refs:    []backupRef{{column: "tank_id", table: "tanks"}, {column: "product_id", table: "fertiliser_products"}},
+	},
+	{
+		name:    "fish_profiles",
+		columns: []string{"fish_id", "name", "identifying_marks", "birth_date", "group_id", "merged_at", "created_at", "updated_at"},
+		refs:    []backupRef{{column: "fish_id", table: "fish"}, {column: "group_id", table: "fish", setNull: true}},
+	},
+	{
+		name:    "fish_measurements",
+		key:     "id",
+		columns: []string{"fish_id", "measured_at", "length_cm", "weight_g", "notes", "created_at", "updated_at"},
+		refs:    []backupRef{{column: "fish_id", table: "fish"}},
+	},
+	{
+		name:    "species",
+		key:     "id",
+		columns: []string{"type", "subtype", "adult_length_cm", "adult_weight_g", "notes", "created_at", "updated_at"},
+	},
+	{
+		name:    "sensor_readings",
+		columns: []string{"sensor_id", "sequence", "tank_id", "parameter", "value", "read_at", "created_at"},
+		refs:    []backupRef{{column: "tank_id", table: "tanks"}},
+	},
+}
+
+// Export returns a backup of every table in backupTables, including the items in the
+// trash. The tables are read in a single transaction, so the backup is consistent.
+func (d *Manager) Export(ctx context.Context) (Backup, error) {
+	b := Backup{Version: BackupVersion, ExportedAt: time.Now().UTC(), Tables: map[string][]json.RawMessage{}}
+
+	tx, err := d.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return b, errors.Wrap(err, "unable to begin transaction")
+	}
+	defer tx.Rollback(ctx) // #nosec G104 -- read only
+
+	rowCount := 0
+	for _, t := range backupTables {
+		columns := t.columns
+		if t.key != "" {
+			columns = append([]string{t.key}, columns...)
+		}
+
+		// #nosec G201 -- the table and columns are constants
+		rows, err := tx.Query(ctx, fmt.Sprintf("SELECT row_to_json(r) FROM (SELECT %s FROM %s ORDER BY %s) r", strings.Join(columns, ", "), t.name, columns[0]))
+		if err != nil {
+			return b, errors.Wrapf(err, "unable to get %s", t.name)
+		}
+
+		table := make([]json.RawMessage, 0)
+		for rows.Next() {
+			var row []byte
+			if err := rows.Scan(&row); err != nil {
+				return b, errors.Wrap(err, "unable to scan row")
+			}
+
+			table = append(table, json.RawMessage(row))
+
+			rowCount++
+		}
+
+		if rows.Err() != nil {
+			return b, errors.Wrap(rows.Err(), "erroring reading rows")
+		}
+
+		b.Tables[t.name] = table
+	}
+
+	logrus.WithFields(logrus.Fields{"rowCount": rowCount}).Info("Backup exported successfully")
+
+	return b, nil
+}
+
+// Import restores a backup alongside the existing data in a single transaction, so either
+// all of it is restored or none of it is. Rows are given new IDs, and their references
+// are remapped to match. Rows conflicting with existing rows fail the import with an
+// ErrConflict unless opts.SkipConflicts is set.
+func (d *Manager) Import(ctx context.Context, b Backup, opts ImportOptions) (ImportResult, error) {
+	result := ImportResult{Imported: map[string]int{}, Skipped: map[string]int{}}
+
+	if b.Version < 1 || b.Version > BackupVersion {
+		return result, errors.Errorf("unsupported backup version %d", b.Version)
+	}
+
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return result, errors.Wrap(err, "unable to begin transaction")
+	}
+	defer tx.Rollback(ctx) // #nosec G104 -- no-op after commit
+
+	// ids maps the IDs in the backup to the IDs of the imported rows, by table
+	ids := map[string]map[int64]int64{}
+
+	for _, t := range backupTables {
+		ids[t.name] = map[int64]int64{}
+
+		for i, raw := range b.Tables[t.name] {
+			row, ok, err := remapRow(t, raw, ids)
+			if err != nil {
+				return result, errors.Wrapf(err, "invalid %s row %d", t.name, i)
+			}
+
+			if !ok {
+				result.Skipped[t.name]++
+				continue
+			}
+
+			imported, err := importRow(ctx, tx, t, row, ids[t.name])
+			if err != nil {
+				return result, errors.Wrapf(err, "unable to import %s row %d", t.name, i)
+			}
+
+			if imported {
+				result.Imported[t.name]++
+				continue
+			}
+
+			if !opts.SkipConflicts {
+				return result, &ErrConflict{message: fmt.Sprintf("%s row %d conflicts with an existing row", t.name, i)}
+			}
+
+			result.Skipped[t.name]++
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return result, errors.Wrap(err, "unable to commit transaction")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"imported": result.Imported,
+		"skipped":  result.Skipped,
+	}).Info("Backup imported successfully")
+
+	return result, nil
+}
+
+// remapRow returns a row of t with only its known columns, and its references remapped
+// using ids. It returns false if the row should be skipped, as it references a row which
+// wasn't imported.
+func remapRow(t backupTable, raw json.RawMessage, ids map[string]map[int64]int64) (map[string]json.RawMessage, bool, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, false, err
+	}
+
+	row := map[string]json.RawMessage{}
+	for _, c := range t.columns {
+		if v, ok := fields[c]; ok {
+			row[c] = v
+		}
+	}
+
+	if t.key != "" {
+		if _, ok := fields[t.key]; !ok {
+			return nil, false, errors.Errorf("missing %s", t.key)
+		}
+
+		row[t.key] = fields[t.key]
+	}
+
+	for _, ref := range t.refs {
+		v, ok := row[ref.column]
+		if !ok || string(v) == "null" {
+			continue
+		}
+
+		var id int64
+		if err := json.Unmarshal(v, &id); err != nil {
+			return nil, false, errors.Errorf("invalid %s %s", ref.column, v)
+		}
+
+		newID, ok := ids[ref.table][id]
+		switch {
+		case ok:
+			row[ref.column] = json.RawMessage(fmt.Sprint(newID))
+		case ref.setNull:
+			row[ref.column] = json.RawMessage("null")
+		default:
+			return nil, false, nil
+		}
+	}
+
+	return row, true, nil
+}
+
+// importRow inserts a row of t, recording the ID it was given in ids. It returns false if
+// the row conflicts with an existing row, in which case nothing is inserted. Columns
+// missing from the row are given their default.
+func importRow(ctx context.Context, tx pgx.Tx, t backupTable, row map[string]json.RawMessage, ids map[int64]int64) (bool, error) {
+	columns := make([]string, 0, len(row))
+	for _, c := range t.columns {
+		if _, ok := row[c]; ok {
+			columns = append(columns, c)
+		}
+	}
+
+	b, err := json.Marshal(row)
+	if err != nil {
+		return false, err
+	}
+
+	// #nosec G201 -- the table and columns are constants
+	query := fmt.Sprintf(
+		"INSERT INTO %[1]s (%[2]s) SELECT %[2]s FROM json_populate_record(NULL::%[1]s, $1::JSON) ON CONFLICT DO NOTHING",
+		t.name, strings.Join(columns, ", "),
+	)
+
+	if t.key == "" {
+		tag, err := tx.Exec(ctx, query, string(b))
+		if err != nil {
+			return false, err
+		}
+
+		return tag.RowsAffected() > 0, nil
+	}
+
+	var oldID, newID int64
+	if err := json.Unmarshal(row[t.key], &oldID); err != nil {
+		return false, errors.Errorf("invalid %s %s", t.key, row[t.key])
+	}
+
+	if err := tx.QueryRow(ctx, query+" RETURNING "+t.key, string(b)).Scan(&newID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	ids[oldID] = newID
+
+	return true, nil
+}
@@ -0,0 +1,89 @@
+//go:build integration
+// +build integration
+
+package db_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+func TestBackup(t *testing.T) {
+	t.Run("Given a household with data", func(t *testing.T) {
+		a, err := mgr.InsertUser(context.Background(), db.User{Username: "backup-a", PasswordHash: "hash"}, "Backup A")
+		assert.NoError(t, err)
+
+		b, err := mgr.InsertUser(context.Background(), db.User{Username: "backup-b", PasswordHash: "hash"}, "Backup B")
+		assert.NoError(t, err)
+
+		ctxA := db.WithHousehold(context.Background(), a.HouseholdID)
+		ctxB := db.WithHousehold(context.Background(), b.HouseholdID)
+
+		tank, err := mgr.InsertTank(ctxA, db.Tank{Name: "Reef"})
+		assert.NoError(t, err)
+
+		_, err = mgr.InsertFish(ctxA, db.Fish{TankID: &tank.ID, Type: "Clownfish", Count: 2})
+		assert.NoError(t, err)
+
+		_, err = mgr.InsertTankStatistic(ctxA, db.TankStatistic{TestDate: "2021/08/06 10:00"})
+		assert.NoError(t, err)
+
+		_, err = mgr.InsertSpecies(ctxA, db.Species{Type: "Clownfish"})
+		assert.NoError(t, err)
+
+		backup, err := mgr.Export(ctxA)
+		assert.NoError(t, err)
+
+		t.Run("When it is exported", func(t *testing.T) {
+			t.Run("Then every table is included", func(t *testing.T) {
+				assert.Equal(t, db.BackupVersion, backup.Version)
+				assert.Len(t, backup.Tables["tanks"], 1)
+				assert.Len(t, backup.Tables["fish"], 1)
+				assert.Len(t, backup.Tables["tank_statistics"], 1)
+				assert.Len(t, backup.Tables["species"], 1)
+				assert.Empty(t, backup.Tables["journal_entries"])
+			})
+		})
+
+		t.Run("When it is imported into another household", func(t *testing.T) {
+			t.Run("Then the rows are copied with their references remapped", func(t *testing.T) {
+				result, err := mgr.Import(ctxB, backup, db.ImportOptions{})
+				assert.NoError(t, err)
+				assert.Equal(t, map[string]int{"tanks": 1, "fish": 1, "tank_statistics": 1, "species": 1}, result.Imported)
+
+				tanks, err := mgr.ListTanks(ctxB)
+				assert.NoError(t, err)
+				assert.Len(t, tanks, 1)
+				assert.NotEqual(t, tank.ID, tanks[0].ID)
+
+				fish, err := mgr.ListFish(ctxB)
+				assert.NoError(t, err)
+				assert.Len(t, fish, 1)
+				assert.Equal(t, &tanks[0].ID, fish[0].TankID)
+			})
+		})
+
+		t.Run("When it is imported again", func(t *testing.T) {
+			t.Run("Then conflicts fail the import without importing anything", func(t *testing.T) {
+				_, err := mgr.Import(ctxB, backup, db.ImportOptions{})
+				assert.IsType(t, &db.ErrConflict{}, err)
+
+				tanks, err := mgr.ListTanks(ctxB)
+				assert.NoError(t, err)
+				assert.Len(t, tanks, 1)
+			})
+			t.Run("Then conflicts can be skipped", func(t *testing.T) {
+				result, err := mgr.Import(ctxB, backup, db.ImportOptions{SkipConflicts: true})
+				assert.NoError(t, err)
+				assert.Equal(t, map[string]int{"species": 1}, result.Skipped)
+
+				tanks, err := mgr.ListTanks(ctxB)
+				assert.NoError(t, err)
+				assert.Len(t, tanks, 2)
+			})
+		})
+	})
+}
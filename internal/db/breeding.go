@@ -0,0 +1,296 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Breeding is a spawn within a Tank. Either parent may be unknown, and for livebearers
+// which breed within a group both parents can be the same Fish record.
+type Breeding struct {
+	ID                int32
+	TankID            int32
+	MotherFishID      *int32
+	FatherFishID      *int32
+	SpawnDate         time.Time
+	EstimatedFryCount int32
+	Notes             string
+	// LatestFryCount is the most recent FryCount, if any have been recorded
+	LatestFryCount *int32
+	// OffspringFishIDs are the fish records fry have been promoted into
+	OffspringFishIDs []int32
+}
+
+// BreedingFilter restricts the breedings returned by ListBreedings. Nil fields are ignored.
+type BreedingFilter struct {
+	TankID *int32
+	// ParentFishID returns breedings where the fish was either parent
+	ParentFishID *int32
+}
+
+// FryCount records how many fry from a Breeding were alive on a given date
+type FryCount struct {
+	ID         int32
+	BreedingID int32
+	CountDate  time.Time
+	Count      int32
+}
+
+// Ancestor is a Fish in the lineage of another, where Generation 1 is a parent,
+// 2 a grandparent and so on
+type Ancestor struct {
+	Generation int32
+	BreedingID int32
+	Fish       Fish
+}
+
+// maxLineageGenerations bounds the recursive lineage query in case of a cycle in the data
+const maxLineageGenerations = 50
+
+const breedingSelect = `SELECT b.id, b.tank_id, b.mother_fish_id, b.father_fish_id, b.spawn_date, b.estimated_fry_count, b.notes,
+	(SELECT c.count FROM fry_counts c WHERE c.breeding_id = b.id ORDER BY c.count_date DESC, c.id DESC LIMIT 1),
+	COALESCE((SELECT array_agg(o.fish_id ORDER BY o.fish_id) FROM breeding_offspring o WHERE o.breeding_id = b.id), '{}')
+FROM breeding_records b`
+
+func scanBreeding(row pgx.Row, b *Breeding) error {
+	return row.Scan(&b.ID, &b.TankID, &b.MotherFishID, &b.FatherFishID, &b.SpawnDate, &b.EstimatedFryCount, &b.Notes, &b.LatestFryCount, &b.OffspringFishIDs)
+}
+
+func (d *Manager) InsertBreeding(ctx context.Context, breeding Breeding) (Breeding, error) {
+	b := Breeding{}
+
+	var id int32
+	err := d.pool.QueryRow(
+		ctx,
+		"INSERT INTO breeding_records(tank_id, mother_fish_id, father_fish_id, spawn_date, estimated_fry_count, notes) VALUES($1, $2, $3, $4, $5, $6) RETURNING id",
+		breeding.TankID, breeding.MotherFishID, breeding.FatherFishID, breeding.SpawnDate, breeding.EstimatedFryCount, breeding.Notes,
+	).Scan(&id)
+	if err != nil {
+		return b, errors.Wrap(err, "unable to add breeding")
+	}
+
+	if b, err = d.GetBreeding(ctx, id); err != nil {
+		return b, err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id": b.ID,
+	}).Info("Breeding inserted successfully")
+
+	return b, nil
+}
+
+func (d *Manager) GetBreeding(ctx context.Context, id int32) (Breeding, error) {
+	b := Breeding{}
+
+	if err := scanBreeding(d.pool.QueryRow(ctx, breedingSelect+" WHERE b.id=$1", id), &b); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return b, &ErrNotFound{message: "breeding not found"}
+		}
+
+		return b, errors.Wrap(err, "unable to get breeding")
+	}
+
+	return b, nil
+}
+
+func (d *Manager) ListBreedings(ctx context.Context, filter BreedingFilter) ([]Breeding, error) {
+	breedings := make([]Breeding, 0)
+
+	rows, err := d.pool.Query(
+		ctx,
+		breedingSelect+" WHERE ($1::INT IS NULL OR b.tank_id=$1) AND ($2::INT IS NULL OR $2 IN (b.mother_fish_id, b.father_fish_id)) ORDER BY b.spawn_date DESC, b.id DESC",
+		filter.TankID, filter.ParentFishID,
+	)
+	if err != nil {
+		return breedings, errors.Wrap(err, "unable to get breedings")
+	}
+
+	rowCount := 0
+	for rows.Next() {
+		b := Breeding{}
+
+		if err := scanBreeding(rows, &b); err != nil {
+			return nil, errors.Wrap(err, "unable to scan row")
+		}
+
+		breedings = append(breedings, b)
+
+		rowCount++
+	}
+
+	if rows.Err() != nil {
+		return nil, errors.Wrap(rows.Err(), "erroring reading rows")
+	}
+
+	logrus.WithFields(logrus.Fields{"rowCount": rowCount}).Info("Breedings queried successfully")
+
+	return breedings, nil
+}
+
+// DeleteBreeding deletes a breeding and its fry counts. Fish promoted from the breeding
+// are kept, but lose their link to it.
+func (d *Manager) DeleteBreeding(ctx context.Context, id int32) (Breeding, error) {
+	b, err := d.GetBreeding(ctx, id)
+	if err != nil {
+		return b, err
+	}
+
+	if _, err := d.pool.Exec(ctx, "DELETE FROM breeding_records WHERE id=$1", id); err != nil {
+		return b, errors.Wrap(err, "unable to delete breeding")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id": b.ID,
+	}).Info("Breeding deleted successfully")
+
+	return b, nil
+}
+
+func (d *Manager) InsertFryCount(ctx context.Context, fryCount FryCount) (FryCount, error) {
+	c := FryCount{}
+
+	err := d.pool.QueryRow(
+		ctx,
+		"INSERT INTO fry_counts(breeding_id, count_date, count) VALUES($1, $2, $3) RETURNING id, breeding_id, count_date, count",
+		fryCount.BreedingID, fryCount.CountDate, fryCount.Count,
+	).Scan(&c.ID, &c.BreedingID, &c.CountDate, &c.Count)
+	if err != nil {
+		return c, errors.Wrap(err, "unable to add fry count")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id": c.ID,
+	}).Info("Fry Count inserted successfully")
+
+	return c, nil
+}
+
+func (d *Manager) ListFryCounts(ctx context.Context, breedingID int32) ([]FryCount, error) {
+	counts := make([]FryCount, 0)
+
+	rows, err := d.pool.Query(ctx, "SELECT id, breeding_id, count_date, count FROM fry_counts WHERE breeding_id=$1 ORDER BY count_date, id", breedingID)
+	if err != nil {
+		return counts, errors.Wrap(err, "unable to get fry counts")
+	}
+
+	rowCount := 0
+	for rows.Next() {
+		c := FryCount{}
+
+		if err := rows.Scan(&c.ID, &c.BreedingID, &c.CountDate, &c.Count); err != nil {
+			return nil, errors.Wrap(err, "unable to scan row")
+		}
+
+		counts = append(counts, c)
+
+		rowCount++
+	}
+
+	if rows.Err() != nil {
+		return nil, errors.Wrap(rows.Err(), "erroring reading rows")
+	}
+
+	logrus.WithFields(logrus.Fields{"rowCount": rowCount}).Info("Fry Counts queried successfully")
+
+	return counts, nil
+}
+
+// PromoteFry creates a new fish record for surviving fry of a breeding, in the breeding's
+// tank, and records it as offspring of the breeding so its lineage can be traced
+func (d *Manager) PromoteFry(ctx context.Context, breedingID int32, fish Fish) (Fish, error) {
+	f := Fish{}
+
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return f, errors.Wrap(err, "unable to begin transaction")
+	}
+	defer tx.Rollback(ctx) // #nosec G104 -- no-op after commit
+
+	var tankID int32
+	if err := tx.QueryRow(ctx, "SELECT tank_id FROM breeding_records WHERE id=$1 FOR UPDATE", breedingID).Scan(&tankID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return f, &ErrNotFound{message: "breeding not found"}
+		}
+
+		return f, errors.Wrap(err, "unable to get breeding")
+	}
+
+	err = tx.QueryRow(
+		ctx,
+		"INSERT INTO fish(tank_id, type, subtype, color, gender, purchase_date, count) VALUES($1, $2, $3, $4, $5, $6, $7) RETURNING id, tank_id, type, subtype, color, gender, purchase_date, count",
+		tankID, fish.Type, fish.Subtype, fish.Color, fish.Gender, fish.PurchaseDate, fish.Count,
+	).Scan(&f.ID, &f.TankID, &f.Type, &f.Subtype, &f.Color, &f.Gender, &f.PurchaseDate, &f.Count)
+	if err != nil {
+		return f, errors.Wrap(err, "unable to add fish")
+	}
+
+	if _, err := tx.Exec(ctx, "INSERT INTO breeding_offspring(breeding_id, fish_id) VALUES($1, $2)", breedingID, f.ID); err != nil {
+		return f, errors.Wrap(err, "unable to add breeding offspring")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return f, errors.Wrap(err, "unable to commit fry promotion")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id":         f.ID,
+		"breedingId": breedingID,
+	}).Info("Fry promoted successfully")
+
+	return f, nil
+}
+
+// ListAncestors returns the parents, grandparents and so on of a fish, nearest generation first
+func (d *Manager) ListAncestors(ctx context.Context, fishID int32) ([]Ancestor, error) {
+	ancestors := make([]Ancestor, 0)
+
+	rows, err := d.pool.Query(
+		ctx,
+		`WITH RECURSIVE lineage(fish_id, breeding_id, generation) AS (
+			SELECT $1::INT, NULL::INT, 0
+			UNION
+			SELECT p.parent_id, b.id, l.generation + 1
+			FROM lineage l
+			JOIN breeding_offspring o ON o.fish_id = l.fish_id
+			JOIN breeding_records b ON b.id = o.breeding_id
+			CROSS JOIN LATERAL (VALUES (b.mother_fish_id), (b.father_fish_id)) AS p(parent_id)
+			WHERE p.parent_id IS NOT NULL AND l.generation < $2
+		)
+		SELECT DISTINCT ON (l.generation, f.id) l.generation, l.breeding_id, f.id, f.tank_id, f.type, f.subtype, f.color, f.gender, f.purchase_date, f.count
+		FROM lineage l
+		JOIN fish f ON f.id = l.fish_id
+		WHERE l.generation > 0
+		ORDER BY l.generation, f.id`,
+		fishID, maxLineageGenerations,
+	)
+	if err != nil {
+		return ancestors, errors.Wrap(err, "unable to get ancestors")
+	}
+
+	rowCount := 0
+	for rows.Next() {
+		a := Ancestor{}
+		f := &a.Fish
+
+		if err := rows.Scan(&a.Generation, &a.BreedingID, &f.ID, &f.TankID, &f.Type, &f.Subtype, &f.Color, &f.Gender, &f.PurchaseDate, &f.Count); err != nil {
+			return nil, errors.Wrap(err, "unable to scan row")
+		}
+
+		ancestors = append(ancestors, a)
+
+		rowCount++
+	}
+
+	if rows.Err() != nil {
+		return nil, errors.Wrap(rows.Err(), "erroring reading rows")
+	}
+
+	logrus.WithFields(logrus.Fields{"rowCount": rowCount}).Info("Ancestors queried successfully")
+
+	return ancestors, nil
+}
@@ -0,0 +1,138 @@
+//go:build integration
+// +build integration
+
+package db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+func TestBreeding(t *testing.T) {
+	t.Run("Given a group of livebearers", func(t *testing.T) {
+		var (
+			breeding   db.Breeding
+			generation db.Fish
+		)
+
+		tank, err := mgr.InsertTank(context.Background(), db.Tank{Name: "Breeder", Role: db.TankRoleBreeding})
+		assert.NoError(t, err)
+		assert.Equal(t, db.TankRoleBreeding, tank.Role)
+
+		guppies, err := mgr.InsertFish(context.Background(), db.Fish{Type: "Guppy", Subtype: "Endler", Count: 6})
+		assert.NoError(t, err)
+
+		spawnDate := time.Date(2021, 8, 1, 0, 0, 0, 0, time.UTC)
+
+		t.Run("When InsertBreeding is called", func(t *testing.T) {
+			t.Run("Then the breeding is created without error", func(t *testing.T) {
+				breeding, err = mgr.InsertBreeding(context.Background(), db.Breeding{
+					TankID:            tank.ID,
+					MotherFishID:      &guppies.ID,
+					FatherFishID:      &guppies.ID,
+					SpawnDate:         spawnDate,
+					EstimatedFryCount: 20,
+				})
+				assert.NoError(t, err)
+
+				assert.Equal(t, tank.ID, breeding.TankID)
+				assert.Equal(t, guppies.ID, *breeding.MotherFishID)
+				assert.True(t, spawnDate.Equal(breeding.SpawnDate))
+				assert.Equal(t, int32(20), breeding.EstimatedFryCount)
+				assert.Nil(t, breeding.LatestFryCount)
+				assert.Empty(t, breeding.OffspringFishIDs)
+			})
+		})
+
+		t.Run("When fry counts are recorded", func(t *testing.T) {
+			t.Run("Then the survival over time is returned", func(t *testing.T) {
+				for i, c := range []int32{18, 15} {
+					_, err := mgr.InsertFryCount(context.Background(), db.FryCount{BreedingID: breeding.ID, CountDate: spawnDate.AddDate(0, 0, 7*(i+1)), Count: c})
+					assert.NoError(t, err)
+				}
+
+				counts, err := mgr.ListFryCounts(context.Background(), breeding.ID)
+				assert.NoError(t, err)
+				assert.Len(t, counts, 2)
+				assert.Equal(t, int32(18), counts[0].Count)
+				assert.Equal(t, int32(15), counts[1].Count)
+
+				b, err := mgr.GetBreeding(context.Background(), breeding.ID)
+				assert.NoError(t, err)
+				assert.Equal(t, int32(15), *b.LatestFryCount)
+			})
+		})
+
+		t.Run("When the fry are promoted", func(t *testing.T) {
+			t.Run("Then a new fish record is created in the breeding tank", func(t *testing.T) {
+				generation, err = mgr.PromoteFry(context.Background(), breeding.ID, db.Fish{Type: "Guppy", Subtype: "Endler", Count: 15})
+				assert.NoError(t, err)
+
+				assert.Equal(t, tank.ID, *generation.TankID)
+				assert.Equal(t, int32(15), generation.Count)
+
+				b, err := mgr.GetBreeding(context.Background(), breeding.ID)
+				assert.NoError(t, err)
+				assert.Equal(t, []int32{generation.ID}, b.OffspringFishIDs)
+			})
+		})
+
+		t.Run("When the promoted fry breed and their fry are promoted", func(t *testing.T) {
+			t.Run("Then the lineage can be traced back through both generations", func(t *testing.T) {
+				b, err := mgr.InsertBreeding(context.Background(), db.Breeding{TankID: tank.ID, MotherFishID: &generation.ID, SpawnDate: spawnDate.AddDate(0, 3, 0)})
+				assert.NoError(t, err)
+
+				grandchildren, err := mgr.PromoteFry(context.Background(), b.ID, db.Fish{Type: "Guppy", Count: 4})
+				assert.NoError(t, err)
+
+				ancestors, err := mgr.ListAncestors(context.Background(), grandchildren.ID)
+				assert.NoError(t, err)
+
+				assert.Len(t, ancestors, 2)
+				assert.Equal(t, int32(1), ancestors[0].Generation)
+				assert.Equal(t, generation.ID, ancestors[0].Fish.ID)
+				assert.Equal(t, b.ID, ancestors[0].BreedingID)
+				assert.Equal(t, int32(2), ancestors[1].Generation)
+				assert.Equal(t, guppies.ID, ancestors[1].Fish.ID)
+				assert.Equal(t, breeding.ID, ancestors[1].BreedingID)
+
+				_, err = mgr.DeleteFish(context.Background(), grandchildren.ID)
+				assert.NoError(t, err)
+			})
+		})
+
+		t.Run("When ListBreedings is called for a parent", func(t *testing.T) {
+			t.Run("Then the breedings it was a parent in are returned", func(t *testing.T) {
+				b, err := mgr.ListBreedings(context.Background(), db.BreedingFilter{ParentFishID: &guppies.ID})
+				assert.NoError(t, err)
+
+				assert.Len(t, b, 1)
+				assert.Equal(t, breeding.ID, b[0].ID)
+			})
+		})
+
+		t.Run("When DeleteBreeding is called", func(t *testing.T) {
+			t.Run("Then the breeding is deleted but the promoted fish are kept", func(t *testing.T) {
+				_, err := mgr.DeleteBreeding(context.Background(), breeding.ID)
+				assert.NoError(t, err)
+
+				_, err = mgr.GetBreeding(context.Background(), breeding.ID)
+				assert.IsType(t, &db.ErrNotFound{}, err)
+
+				_, err = mgr.GetFish(context.Background(), generation.ID)
+				assert.NoError(t, err)
+			})
+		})
+
+		_, err = mgr.DeleteFish(context.Background(), generation.ID)
+		assert.NoError(t, err)
+		_, err = mgr.DeleteFish(context.Background(), guppies.ID)
+		assert.NoError(t, err)
+		_, err = mgr.DeleteTank(context.Background(), tank.ID)
+		assert.NoError(t, err)
+	})
+}
@@ -3,7 +3,9 @@ package db
 import (
 	"context"
 	"fmt"
+	"time"
 
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -31,8 +33,32 @@ func (c *ErrNotFound) Error() string {
 	return c.message
 }
 
+var _ error = (*ErrConflict)(nil) // ensure ErrConflict implements error
+
+// ErrConflict is returned when a request can't be applied to the current state of a record,
+// e.g. releasing a quarantine which has already been released
+type ErrConflict struct {
+	message string
+}
+
+func (c *ErrConflict) Error() string {
+	return c.message
+}
+
+// foreignKeyViolation is the SQLSTATE of a row referencing a row which doesn't exist
+const foreignKeyViolation = "23503"
+
+// isForeignKeyViolation returns whether err is from a row referencing a row which doesn't
+// exist, e.g. a treatment of a tank which was deleted before it was added
+func isForeignKeyViolation(err error) bool {
+	var pgErr interface{ SQLState() string }
+
+	return errors.As(err, &pgErr) && pgErr.SQLState() == foreignKeyViolation
+}
+
 type Fish struct {
 	ID           int32
+	TankID       *int32
 	Type         string
 	Subtype      string
 	Color        string
@@ -62,8 +88,17 @@ type Tank struct {
 	CapacityMeasurement string
 	Capacity            *float32
 	Description         string
+	Role                string
 }
 
+// Tank roles
+const (
+	TankRoleDisplay    = "DISPLAY"
+	TankRoleQuarantine = "QUARANTINE"
+	TankRoleHospital   = "HOSPITAL"
+	TankRoleBreeding   = "BREEDING"
+)
+
 func New(c Config) (*Manager, error) {
 	if c.Host == "" {
 		return nil, errors.New("host not defined")
@@ -87,7 +122,14 @@ func New(c Config) (*Manager, error) {
 
 	dbURL := fmt.Sprintf("postgres://%s:%s@%s:%s/%s", c.Username, c.Password, c.Host, c.Port, c.Database)
 
-	pool, err := pgxpool.Connect(context.Background(), dbURL)
+	poolConfig, err := pgxpool.ParseConfig(dbURL)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing database url: %w", err)
+	}
+
+	poolConfig.BeforeAcquire = scopeConnection
+
+	pool, err := pgxpool.ConnectConfig(context.Background(), poolConfig)
 	if err != nil {
 		return nil, fmt.Errorf("error creating connection pool: %w", err)
 	}
@@ -99,14 +141,51 @@ func (d *Manager) Ping(ctx context.Context) error {
 	return d.pool.Ping(ctx)
 }
 
+// Close closes the connections in the pool, waiting for those in use to be released
+func (d *Manager) Close() {
+	d.pool.Close()
+}
+
+// PoolStats are the statistics of the connection pool
+type PoolStats struct {
+	AcquiredConns int32
+	IdleConns     int32
+	TotalConns    int32
+	MaxConns      int32
+	// AcquireCount is how many connections have been acquired, of which EmptyAcquireCount
+	// had to wait for a connection to be released or created
+	AcquireCount      int64
+	EmptyAcquireCount int64
+	// CanceledAcquireCount is how many acquires were cancelled before getting a connection
+	CanceledAcquireCount int64
+	// AcquireDuration is the total time spent acquiring connections
+	AcquireDuration time.Duration
+}
+
+// PoolStats returns the current statistics of the connection pool
+func (d *Manager) PoolStats() PoolStats {
+	s := d.pool.Stat()
+
+	return PoolStats{
+		AcquiredConns:        s.AcquiredConns(),
+		IdleConns:            s.IdleConns(),
+		TotalConns:           s.TotalConns(),
+		MaxConns:             s.MaxConns(),
+		AcquireCount:         s.AcquireCount(),
+		EmptyAcquireCount:    s.EmptyAcquireCount(),
+		CanceledAcquireCount: s.CanceledAcquireCount(),
+		AcquireDuration:      s.AcquireDuration(),
+	}
+}
+
 func (d *Manager) InsertFish(ctx context.Context, fish Fish) (Fish, error) {
 	f := Fish{}
 
 	err := d.pool.QueryRow(
 		ctx,
-		"INSERT INTO fish(type, subtype, color, gender, purchase_date, count) VALUES($1, $2, $3, $4, $5, $6) RETURNING id, type, subtype, color, gender, purchase_date, count",
-		fish.Type, fish.Subtype, fish.Color, fish.Gender, fish.PurchaseDate, fish.Count,
-	).Scan(&f.ID, &f.Type, &f.Subtype, &f.Color, &f.Gender, &f.PurchaseDate, &f.Count)
+		"INSERT INTO fish(tank_id, type, subtype, color, gender, purchase_date, count) VALUES($1, $2, $3, $4, $5, $6, $7) RETURNING id, tank_id, type, subtype, color, gender, purchase_date, count",
+		fish.TankID, fish.Type, fish.Subtype, fish.Color, fish.Gender, fish.PurchaseDate, fish.Count,
+	).Scan(&f.ID, &f.TankID, &f.Type, &f.Subtype, &f.Color, &f.Gender, &f.PurchaseDate, &f.Count)
 	if err != nil {
 		return f, errors.Wrap(err, "unable to add fish")
 	}
@@ -121,7 +200,7 @@ func (d *Manager) InsertFish(ctx context.Context, fish Fish) (Fish, error) {
 func (d *Manager) ListFish(ctx context.Context) ([]Fish, error) {
 	fish := make([]Fish, 0)
 
-	rows, err := d.pool.Query(ctx, "SELECT id, type, subtype, color, gender, purchase_date, count FROM fish")
+	rows, err := d.pool.Query(ctx, "SELECT id, tank_id, type, subtype, color, gender, purchase_date, count FROM fish WHERE deleted_at IS NULL")
 	if err != nil {
 		return fish, errors.Wrap(err, "unable to get fish")
 	}
@@ -130,7 +209,7 @@ func (d *Manager) ListFish(ctx context.Context) ([]Fish, error) {
 	for rows.Next() {
 		f := Fish{}
 
-		if err := rows.Scan(&f.ID, &f.Type, &f.Subtype, &f.Color, &f.Gender, &f.PurchaseDate, &f.Count); err != nil {
+		if err := rows.Scan(&f.ID, &f.TankID, &f.Type, &f.Subtype, &f.Color, &f.Gender, &f.PurchaseDate, &f.Count); err != nil {
 			return nil, errors.Wrap(err, "unable to scan row")
 		}
 
@@ -148,15 +227,39 @@ func (d *Manager) ListFish(ctx context.Context) ([]Fish, error) {
 	return fish, nil
 }
 
+func (d *Manager) GetFish(ctx context.Context, id int32) (Fish, error) {
+	f := Fish{}
+
+	err := d.pool.QueryRow(
+		ctx,
+		"SELECT id, tank_id, type, subtype, color, gender, purchase_date, count FROM fish WHERE id=$1 AND deleted_at IS NULL",
+		id,
+	).Scan(&f.ID, &f.TankID, &f.Type, &f.Subtype, &f.Color, &f.Gender, &f.PurchaseDate, &f.Count)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return f, &ErrNotFound{message: "fish not found"}
+		}
+
+		return f, errors.Wrap(err, "unable to get fish")
+	}
+
+	return f, nil
+}
+
+// DeleteFish moves a fish to the trash, from where it can be restored until it's purged
 func (d *Manager) DeleteFish(ctx context.Context, id int32) (Fish, error) {
 	f := Fish{}
 
 	err := d.pool.QueryRow(
 		ctx,
-		"DELETE FROM fish WHERE id=$1 RETURNING id, type, subtype, color, gender, purchase_date, count",
+		"UPDATE fish SET deleted_at=NOW(), updated_at=NOW() WHERE id=$1 AND deleted_at IS NULL RETURNING id, tank_id, type, subtype, color, gender, purchase_date, count",
 		id,
-	).Scan(&f.ID, &f.Type, &f.Subtype, &f.Color, &f.Gender, &f.PurchaseDate, &f.Count)
+	).Scan(&f.ID, &f.TankID, &f.Type, &f.Subtype, &f.Color, &f.Gender, &f.PurchaseDate, &f.Count)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return f, &ErrNotFound{message: "fish not found"}
+		}
+
 		return f, errors.Wrap(err, "unable to delete fish")
 	}
 
@@ -167,12 +270,14 @@ func (d *Manager) DeleteFish(ctx context.Context, id int32) (Fish, error) {
 	return f, nil
 }
 
+const insertTankStatisticQuery = "INSERT INTO tank_statistics(test_date, ph, gh, kh, ammonia, nitrite, nitrate, phosphate) VALUES($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, test_date, ph, gh, kh, ammonia, nitrite, nitrate, phosphate"
+
 func (d *Manager) InsertTankStatistic(ctx context.Context, tankStatistic TankStatistic) (TankStatistic, error) {
 	ts := TankStatistic{}
 
 	err := d.pool.QueryRow(
 		ctx,
-		"INSERT INTO tank_statistics(test_date, ph, gh, kh, ammonia, nitrite, nitrate, phosphate) VALUES($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, test_date, ph, gh, kh, ammonia, nitrite, nitrate, phosphate",
+		insertTankStatisticQuery,
 		tankStatistic.TestDate, tankStatistic.PH, tankStatistic.GH, tankStatistic.KH, tankStatistic.Ammonia, tankStatistic.Nitrite, tankStatistic.Nitrate, tankStatistic.Phosphate,
 	).Scan(&ts.ID, &ts.TestDate, &ts.PH, &ts.GH, &ts.KH, &ts.Ammonia, &ts.Nitrite, &ts.Nitrate, &ts.Phosphate)
 	if err != nil {
@@ -186,10 +291,55 @@ func (d *Manager) InsertTankStatistic(ctx context.Context, tankStatistic TankSta
 	return ts, nil
 }
 
+// InsertTankStatistics adds many tank statistics in a single transaction, so either all
+// of them are added or none are. The inserts are sent as one batch, rather than a round
+// trip each.
+func (d *Manager) InsertTankStatistics(ctx context.Context, tankStatistics []TankStatistic) ([]TankStatistic, error) {
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to begin transaction")
+	}
+	defer tx.Rollback(ctx) // #nosec G104 -- no-op after commit
+
+	batch := &pgx.Batch{}
+	for _, tankStatistic := range tankStatistics {
+		batch.Queue(
+			insertTankStatisticQuery,
+			tankStatistic.TestDate, tankStatistic.PH, tankStatistic.GH, tankStatistic.KH, tankStatistic.Ammonia, tankStatistic.Nitrite, tankStatistic.Nitrate, tankStatistic.Phosphate,
+		)
+	}
+
+	results := tx.SendBatch(ctx, batch)
+
+	inserted := make([]TankStatistic, len(tankStatistics))
+	for i := range inserted {
+		ts := &inserted[i]
+
+		if err := results.QueryRow().Scan(&ts.ID, &ts.TestDate, &ts.PH, &ts.GH, &ts.KH, &ts.Ammonia, &ts.Nitrite, &ts.Nitrate, &ts.Phosphate); err != nil {
+			results.Close() // #nosec G104 -- the transaction is rolled back
+			return nil, errors.Wrapf(err, "unable to add tank statistic %d", i)
+		}
+	}
+
+	if err := results.Close(); err != nil {
+		return nil, errors.Wrap(err, "unable to add tank statistics")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, errors.Wrap(err, "unable to commit tank statistics")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"rowCount": len(inserted),
+	}).Info("Tank Statistics inserted successfully")
+
+	return inserted, nil
+}
+
 func (d *Manager) ListTankStatistics(ctx context.Context) ([]TankStatistic, error) {
 	tankStats := make([]TankStatistic, 0)
 
-	rows, err := d.pool.Query(ctx, "SELECT id, test_date, ph, gh, kh, ammonia, nitrite, nitrate, phosphate FROM tank_statistics")
+	rows, err := d.pool.Query(ctx, "SELECT id, test_date, ph, gh, kh, ammonia, nitrite, nitrate, phosphate FROM tank_statistics WHERE deleted_at IS NULL")
 	if err != nil {
 		return tankStats, errors.Wrap(err, "unable to get tank statistics")
 	}
@@ -216,15 +366,21 @@ func (d *Manager) ListTankStatistics(ctx context.Context) ([]TankStatistic, erro
 	return tankStats, nil
 }
 
+// DeleteTankStatistic moves a tank statistic to the trash, from where it can be restored
+// until it's purged
 func (d *Manager) DeleteTankStatistic(ctx context.Context, id int32) (TankStatistic, error) {
 	ts := TankStatistic{}
 
 	err := d.pool.QueryRow(
 		ctx,
-		"DELETE FROM tank_statistics WHERE id=$1 RETURNING id, test_date, ph, gh, kh, ammonia, nitrite, nitrate, phosphate",
+		"UPDATE tank_statistics SET deleted_at=NOW(), updated_at=NOW() WHERE id=$1 AND deleted_at IS NULL RETURNING id, test_date, ph, gh, kh, ammonia, nitrite, nitrate, phosphate",
 		id,
 	).Scan(&ts.ID, &ts.TestDate, &ts.PH, &ts.GH, &ts.KH, &ts.Ammonia, &ts.Nitrite, &ts.Nitrate, &ts.Phosphate)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ts, &ErrNotFound{message: "tank statistic not found"}
+		}
+
 		return ts, errors.Wrap(err, "unable to delete tank statistic")
 	}
 
@@ -240,9 +396,9 @@ func (d *Manager) InsertTank(ctx context.Context, tank Tank) (Tank, error) {
 
 	err := d.pool.QueryRow(
 		ctx,
-		"INSERT INTO tanks(make, model, name, location, capacity_measurement, capacity, description) VALUES($1, $2, $3, $4, $5, $6, $7) RETURNING id, make, model, name, location, capacity_measurement, capacity, description",
-		tank.Make, tank.Model, tank.Name, tank.Location, tank.CapacityMeasurement, tank.Capacity, tank.Description,
-	).Scan(&ts.ID, &ts.Make, &ts.Model, &ts.Name, &ts.Location, &ts.CapacityMeasurement, &ts.Capacity, &ts.Description)
+		"INSERT INTO tanks(make, model, name, location, capacity_measurement, capacity, description, role) VALUES($1, $2, $3, $4, $5, $6, $7, COALESCE(NULLIF($8, ''), 'DISPLAY')) RETURNING id, make, model, name, location, capacity_measurement, capacity, description, role",
+		tank.Make, tank.Model, tank.Name, tank.Location, tank.CapacityMeasurement, tank.Capacity, tank.Description, tank.Role,
+	).Scan(&ts.ID, &ts.Make, &ts.Model, &ts.Name, &ts.Location, &ts.CapacityMeasurement, &ts.Capacity, &ts.Description, &ts.Role)
 	if err != nil {
 		return ts, errors.Wrap(err, "unable to add tank")
 	}
@@ -257,7 +413,7 @@ func (d *Manager) InsertTank(ctx context.Context, tank Tank) (Tank, error) {
 func (d *Manager) ListTanks(ctx context.Context) ([]Tank, error) {
 	tankStats := make([]Tank, 0)
 
-	rows, err := d.pool.Query(ctx, "SELECT id, make, model, name, location, capacity_measurement, capacity, description FROM tanks")
+	rows, err := d.pool.Query(ctx, "SELECT id, make, model, name, location, capacity_measurement, capacity, description, role FROM tanks WHERE deleted_at IS NULL")
 	if err != nil {
 		return tankStats, errors.Wrap(err, "unable to get tank")
 	}
@@ -266,7 +422,7 @@ func (d *Manager) ListTanks(ctx context.Context) ([]Tank, error) {
 	for rows.Next() {
 		ts := Tank{}
 
-		if err := rows.Scan(&ts.ID, &ts.Make, &ts.Model, &ts.Name, &ts.Location, &ts.CapacityMeasurement, &ts.Capacity, &ts.Description); err != nil {
+		if err := rows.Scan(&ts.ID, &ts.Make, &ts.Model, &ts.Name, &ts.Location, &ts.CapacityMeasurement, &ts.Capacity, &ts.Description, &ts.Role); err != nil {
 			return nil, errors.Wrap(err, "unable to scan row")
 		}
 
@@ -284,15 +440,40 @@ func (d *Manager) ListTanks(ctx context.Context) ([]Tank, error) {
 	return tankStats, nil
 }
 
+func (d *Manager) GetTank(ctx context.Context, id int32) (Tank, error) {
+	ts := Tank{}
+
+	err := d.pool.QueryRow(
+		ctx,
+		"SELECT id, make, model, name, location, capacity_measurement, capacity, description, role FROM tanks WHERE id=$1 AND deleted_at IS NULL",
+		id,
+	).Scan(&ts.ID, &ts.Make, &ts.Model, &ts.Name, &ts.Location, &ts.CapacityMeasurement, &ts.Capacity, &ts.Description, &ts.Role)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ts, &ErrNotFound{message: "tank not found"}
+		}
+
+		return ts, errors.Wrap(err, "unable to get tank")
+	}
+
+	return ts, nil
+}
+
+// DeleteTank moves a tank to the trash, from where it can be restored until it's purged.
+// The fish in it keep their tank until then.
 func (d *Manager) DeleteTank(ctx context.Context, id int32) (Tank, error) {
 	ts := Tank{}
 
 	err := d.pool.QueryRow(
 		ctx,
-		"DELETE FROM tanks WHERE id=$1 RETURNING id, make, model, name, location, capacity_measurement, capacity, description",
+		"UPDATE tanks SET deleted_at=NOW(), updated_at=NOW() WHERE id=$1 AND deleted_at IS NULL RETURNING id, make, model, name, location, capacity_measurement, capacity, description, role",
 		id,
-	).Scan(&ts.ID, &ts.Make, &ts.Model, &ts.Name, &ts.Location, &ts.CapacityMeasurement, &ts.Capacity, &ts.Description)
+	).Scan(&ts.ID, &ts.Make, &ts.Model, &ts.Name, &ts.Location, &ts.CapacityMeasurement, &ts.Capacity, &ts.Description, &ts.Role)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ts, &ErrNotFound{message: "tank not found"}
+		}
+
 		return ts, errors.Wrap(err, "unable to delete tank")
 	}
 
@@ -302,3 +483,27 @@ func (d *Manager) DeleteTank(ctx context.Context, id int32) (Tank, error) {
 
 	return ts, nil
 }
+
+func (d *Manager) SetTankRole(ctx context.Context, id int32, role string) (Tank, error) {
+	ts := Tank{}
+
+	err := d.pool.QueryRow(
+		ctx,
+		"UPDATE tanks SET role=$2, updated_at=NOW() WHERE id=$1 AND deleted_at IS NULL RETURNING id, make, model, name, location, capacity_measurement, capacity, description, role",
+		id, role,
+	).Scan(&ts.ID, &ts.Make, &ts.Model, &ts.Name, &ts.Location, &ts.CapacityMeasurement, &ts.Capacity, &ts.Description, &ts.Role)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ts, &ErrNotFound{message: "tank not found"}
+		}
+
+		return ts, errors.Wrap(err, "unable to set tank role")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id":   ts.ID,
+		"role": ts.Role,
+	}).Info("Tank role updated successfully")
+
+	return ts, nil
+}
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -75,10 +76,14 @@ func TestMain(m *testing.M) {
 		log.Fatalf("Could not create tables: %s", err)
 	}
 
+	if err := createAppRole(conn); err != nil {
+		log.Fatalf("Could not create role: %s", err)
+	}
+
 	mgr, err = db.New(db.Config{
 		Host:     "localhost",
 		Port:     resource.GetPort("5432/tcp"),
-		Username: "username",
+		Username: "trackmyfish",
 		Password: "secret",
 		Database: "dbname",
 	})
@@ -144,17 +149,461 @@ func createTables(conn *sql.DB) error {
   "capacity_measurement" VARCHAR(10) DEFAULT '',
   "capacity" FLOAT DEFAULT NULL,
   "description" VARCHAR(255) DEFAULT '',
+  "role" VARCHAR(20) NOT NULL DEFAULT 'DISPLAY',
+  "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  "updated_at" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);`
+
+	if _, err := conn.Exec(query); err != nil {
+		return err
+	}
+
+	// The tank a fish lives in, added once the tanks table exists
+	query = `ALTER TABLE "fish" ADD COLUMN IF NOT EXISTS "tank_id" INT DEFAULT NULL REFERENCES "tanks" ("id") ON DELETE SET NULL;`
+
+	if _, err := conn.Exec(query); err != nil {
+		return err
+	}
+
+	// Attachments table
+	query = `CREATE TABLE IF NOT EXISTS "attachments" (
+  "id" SERIAL PRIMARY KEY NOT NULL,
+  "tank_id" INT DEFAULT NULL REFERENCES "tanks" ("id") ON DELETE CASCADE,
+  "fish_id" INT DEFAULT NULL REFERENCES "fish" ("id") ON DELETE CASCADE,
+  "filename" VARCHAR(255) DEFAULT '',
+  "content_type" VARCHAR(40) NOT NULL,
+  "size" BIGINT NOT NULL,
+  "blob_key" VARCHAR(255) NOT NULL,
+  "thumbnail_key" VARCHAR(255) NOT NULL,
+  "caption" VARCHAR(255) DEFAULT '',
+  "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  "updated_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  CHECK (("tank_id" IS NULL) <> ("fish_id" IS NULL))
+	);`
+
+	if _, err := conn.Exec(query); err != nil {
+		return err
+	}
+
+	// Journal entries table, with a generated tsvector for full-text search
+	query = `CREATE TABLE IF NOT EXISTS "journal_entries" (
+  "id" SERIAL PRIMARY KEY NOT NULL,
+  "tank_id" INT DEFAULT NULL REFERENCES "tanks" ("id") ON DELETE CASCADE,
+  "fish_id" INT DEFAULT NULL REFERENCES "fish" ("id") ON DELETE CASCADE,
+  "entry_date" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  "category" VARCHAR(20) NOT NULL DEFAULT 'OBSERVATION',
+  "title" VARCHAR(255) DEFAULT '',
+  "body" TEXT DEFAULT '',
+  "search_vector" TSVECTOR GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', coalesce("title", '')), 'A') ||
+    setweight(to_tsvector('english', coalesce("body", '')), 'B')
+  ) STORED,
+  "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  "updated_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  CHECK (("tank_id" IS NULL) <> ("fish_id" IS NULL))
+	);
+	CREATE INDEX IF NOT EXISTS "journal_entries_search_idx" ON "journal_entries" USING GIN ("search_vector");`
+
+	if _, err := conn.Exec(query); err != nil {
+		return err
+	}
+
+	// Treatments tables
+	query = `CREATE TABLE IF NOT EXISTS "treatments" (
+  "id" SERIAL PRIMARY KEY NOT NULL,
+  "tank_id" INT NOT NULL REFERENCES "tanks" ("id") ON DELETE CASCADE,
+  "medication" VARCHAR(255) NOT NULL,
+  "dose" FLOAT NOT NULL DEFAULT 0,
+  "dose_unit" VARCHAR(20) DEFAULT '',
+  "dose_interval_hours" INT NOT NULL DEFAULT 0,
+  "start_date" TIMESTAMPTZ NOT NULL,
+  "end_date" TIMESTAMPTZ NOT NULL,
+  "notes" TEXT DEFAULT '',
+  "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  "updated_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  CHECK ("end_date" >= "start_date")
+	);
+	CREATE TABLE IF NOT EXISTS "treatment_fish" (
+  "treatment_id" INT NOT NULL REFERENCES "treatments" ("id") ON DELETE CASCADE,
+  "fish_id" INT NOT NULL REFERENCES "fish" ("id") ON DELETE CASCADE,
+  PRIMARY KEY ("treatment_id", "fish_id")
+	);
+	CREATE TABLE IF NOT EXISTS "treatment_doses" (
+  "id" SERIAL PRIMARY KEY NOT NULL,
+  "treatment_id" INT NOT NULL REFERENCES "treatments" ("id") ON DELETE CASCADE,
+  "due_at" TIMESTAMPTZ NOT NULL,
+  "administered_at" TIMESTAMPTZ DEFAULT NULL,
+  "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  "updated_at" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);
+	CREATE INDEX IF NOT EXISTS "treatment_doses_due_idx" ON "treatment_doses" ("due_at") WHERE "administered_at" IS NULL;`
+
+	if _, err := conn.Exec(query); err != nil {
+		return err
+	}
+
+	// Quarantines table
+	query = `CREATE TABLE IF NOT EXISTS "quarantines" (
+  "id" SERIAL PRIMARY KEY NOT NULL,
+  "fish_id" INT NOT NULL REFERENCES "fish" ("id") ON DELETE CASCADE,
+  "quarantine_tank_id" INT NOT NULL REFERENCES "tanks" ("id") ON DELETE CASCADE,
+  "target_tank_id" INT NOT NULL REFERENCES "tanks" ("id") ON DELETE CASCADE,
+  "start_date" TIMESTAMPTZ NOT NULL,
+  "days" INT NOT NULL,
+  "released_at" TIMESTAMPTZ DEFAULT NULL,
+  "notes" TEXT DEFAULT '',
+  "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  "updated_at" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);
+	CREATE UNIQUE INDEX IF NOT EXISTS "quarantines_active_fish_idx" ON "quarantines" ("fish_id") WHERE "released_at" IS NULL;`
+
+	if _, err := conn.Exec(query); err != nil {
+		return err
+	}
+
+	// Breeding tables
+	query = `CREATE TABLE IF NOT EXISTS "breeding_records" (
+  "id" SERIAL PRIMARY KEY NOT NULL,
+  "tank_id" INT NOT NULL REFERENCES "tanks" ("id") ON DELETE CASCADE,
+  "mother_fish_id" INT DEFAULT NULL REFERENCES "fish" ("id") ON DELETE SET NULL,
+  "father_fish_id" INT DEFAULT NULL REFERENCES "fish" ("id") ON DELETE SET NULL,
+  "spawn_date" TIMESTAMPTZ NOT NULL,
+  "estimated_fry_count" INT NOT NULL DEFAULT 0,
+  "notes" TEXT DEFAULT '',
   "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
   "updated_at" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);
+	CREATE TABLE IF NOT EXISTS "fry_counts" (
+  "id" SERIAL PRIMARY KEY NOT NULL,
+  "breeding_id" INT NOT NULL REFERENCES "breeding_records" ("id") ON DELETE CASCADE,
+  "count_date" TIMESTAMPTZ NOT NULL,
+  "count" INT NOT NULL CHECK ("count" >= 0),
+  "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  "updated_at" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);
+	CREATE TABLE IF NOT EXISTS "breeding_offspring" (
+  "breeding_id" INT NOT NULL REFERENCES "breeding_records" ("id") ON DELETE CASCADE,
+  "fish_id" INT NOT NULL REFERENCES "fish" ("id") ON DELETE CASCADE,
+  PRIMARY KEY ("breeding_id", "fish_id")
 	);`
 
 	if _, err := conn.Exec(query); err != nil {
 		return err
 	}
 
+	// Fertiliser dosing tables
+	query = `CREATE TABLE IF NOT EXISTS "fertiliser_products" (
+  "id" SERIAL PRIMARY KEY NOT NULL,
+  "name" VARCHAR(255) NOT NULL,
+  "manufacturer" VARCHAR(255) DEFAULT '',
+  "notes" TEXT DEFAULT '',
+  "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  "updated_at" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);
+	CREATE TABLE IF NOT EXISTS "fertiliser_product_components" (
+  "product_id" INT NOT NULL REFERENCES "fertiliser_products" ("id") ON DELETE CASCADE,
+  "parameter" VARCHAR(50) NOT NULL,
+  "mg_per_ml" REAL NOT NULL CHECK ("mg_per_ml" > 0),
+  PRIMARY KEY ("product_id", "parameter")
+	);
+	CREATE TABLE IF NOT EXISTS "dosing_log" (
+  "id" SERIAL PRIMARY KEY NOT NULL,
+  "tank_id" INT NOT NULL REFERENCES "tanks" ("id") ON DELETE CASCADE,
+  "product_id" INT NOT NULL REFERENCES "fertiliser_products" ("id") ON DELETE RESTRICT,
+  "amount_ml" REAL NOT NULL CHECK ("amount_ml" > 0),
+  "dosed_at" TIMESTAMPTZ NOT NULL,
+  "notes" TEXT DEFAULT '',
+  "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  "updated_at" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);
+	CREATE INDEX IF NOT EXISTS "dosing_log_tank_idx" ON "dosing_log" ("tank_id", "dosed_at");`
+
+	if _, err := conn.Exec(query); err != nil {
+		return err
+	}
+
+	// Individual fish tables
+	query = `CREATE TABLE IF NOT EXISTS "fish_profiles" (
+  "fish_id" INT PRIMARY KEY NOT NULL REFERENCES "fish" ("id") ON DELETE CASCADE,
+  "name" VARCHAR(255) NOT NULL,
+  "identifying_marks" TEXT DEFAULT '',
+  "birth_date" DATE DEFAULT NULL,
+  "photo_attachment_id" INT DEFAULT NULL REFERENCES "attachments" ("id") ON DELETE SET NULL,
+  "group_id" INT DEFAULT NULL REFERENCES "fish" ("id") ON DELETE SET NULL,
+  "merged_at" TIMESTAMPTZ DEFAULT NULL,
+  "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  "updated_at" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);
+	CREATE TABLE IF NOT EXISTS "fish_measurements" (
+  "id" SERIAL PRIMARY KEY NOT NULL,
+  "fish_id" INT NOT NULL REFERENCES "fish" ("id") ON DELETE CASCADE,
+  "measured_at" TIMESTAMPTZ NOT NULL,
+  "length_cm" REAL DEFAULT NULL CHECK ("length_cm" > 0),
+  "weight_g" REAL DEFAULT NULL CHECK ("weight_g" > 0),
+  "notes" TEXT DEFAULT '',
+  "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  "updated_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  CHECK ("length_cm" IS NOT NULL OR "weight_g" IS NOT NULL)
+	);
+	CREATE INDEX IF NOT EXISTS "fish_measurements_fish_idx" ON "fish_measurements" ("fish_id", "measured_at");`
+
+	if _, err := conn.Exec(query); err != nil {
+		return err
+	}
+
+	// Species reference table
+	query = `CREATE TABLE IF NOT EXISTS "species" (
+  "id" SERIAL PRIMARY KEY NOT NULL,
+  "type" VARCHAR(255) NOT NULL,
+  "subtype" VARCHAR(255) NOT NULL DEFAULT '',
+  "adult_length_cm" REAL DEFAULT NULL CHECK ("adult_length_cm" > 0),
+  "adult_weight_g" REAL DEFAULT NULL CHECK ("adult_weight_g" > 0),
+  "notes" TEXT DEFAULT '',
+  "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  "updated_at" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);
+	CREATE UNIQUE INDEX IF NOT EXISTS "species_type_subtype_idx" ON "species" (lower("type"), lower("subtype"));`
+
+	if _, err := conn.Exec(query); err != nil {
+		return err
+	}
+
+	// Users table
+	query = `CREATE TABLE IF NOT EXISTS "users" (
+  "id" SERIAL PRIMARY KEY NOT NULL,
+  "username" VARCHAR(64) NOT NULL,
+  "password_hash" VARCHAR(255) NOT NULL,
+  "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  "updated_at" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);
+	CREATE UNIQUE INDEX IF NOT EXISTS "users_username_idx" ON "users" (lower("username"));`
+
+	if _, err := conn.Exec(query); err != nil {
+		return err
+	}
+
+	// Households, which own every other table. Row-level security limits queries to the
+	// rows of the household set on the connection, or rows without a household if none is.
+	query = `CREATE TABLE IF NOT EXISTS "households" (
+  "id" SERIAL PRIMARY KEY NOT NULL,
+  "name" VARCHAR(255) NOT NULL,
+  "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  "updated_at" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);
+	ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "household_id" INT NOT NULL REFERENCES "households" ("id") ON DELETE CASCADE;
+	CREATE OR REPLACE FUNCTION current_household() RETURNS INT LANGUAGE SQL STABLE AS
+	$$ SELECT NULLIF(current_setting('trackmyfish.household_id', true), '')::INT $$;`
+
+	if _, err := conn.Exec(query); err != nil {
+		return err
+	}
+
+	for _, table := range []string{
+		"fish", "tank_statistics", "tanks", "attachments", "journal_entries",
+		"treatments", "treatment_fish", "treatment_doses", "quarantines",
+		"breeding_records", "fry_counts", "breeding_offspring",
+		"fertiliser_products", "fertiliser_product_components", "dosing_log",
+		"fish_profiles", "fish_measurements", "species",
+	} {
+		query = fmt.Sprintf(`ALTER TABLE %[1]q ADD COLUMN IF NOT EXISTS "household_id" INT DEFAULT current_household() REFERENCES "households" ("id") ON DELETE CASCADE;
+	CREATE INDEX IF NOT EXISTS "%[1]s_household_idx" ON %[1]q ("household_id");
+	ALTER TABLE %[1]q ENABLE ROW LEVEL SECURITY;
+	ALTER TABLE %[1]q FORCE ROW LEVEL SECURITY;
+	DROP POLICY IF EXISTS "household_isolation" ON %[1]q;
+	CREATE POLICY "household_isolation" ON %[1]q
+	  USING ("household_id" IS NOT DISTINCT FROM current_household())
+	  WITH CHECK ("household_id" IS NOT DISTINCT FROM current_household());`, table)
+
+		if _, err := conn.Exec(query); err != nil {
+			return err
+		}
+	}
+
+	// Species are unique within a household
+	query = `DROP INDEX IF EXISTS "species_type_subtype_idx";
+	CREATE UNIQUE INDEX IF NOT EXISTS "species_household_type_subtype_idx" ON "species" (COALESCE("household_id", 0), lower("type"), lower("subtype"));`
+
+	if _, err := conn.Exec(query); err != nil {
+		return err
+	}
+
+	// Roles of users within their household and invites granting them
+	query = `ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "role" VARCHAR(20) NOT NULL DEFAULT 'OWNER';
+	CREATE TABLE IF NOT EXISTS "invites" (
+  "id" SERIAL PRIMARY KEY NOT NULL,
+  "household_id" INT NOT NULL REFERENCES "households" ("id") ON DELETE CASCADE,
+  "role" VARCHAR(20) NOT NULL,
+  "code_hash" VARCHAR(64) NOT NULL UNIQUE,
+  "created_by" INT NOT NULL REFERENCES "users" ("id") ON DELETE CASCADE,
+  "expires_at" TIMESTAMPTZ NOT NULL,
+  "accepted_by" INT DEFAULT NULL REFERENCES "users" ("id") ON DELETE SET NULL,
+  "accepted_at" TIMESTAMPTZ DEFAULT NULL,
+  "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  "updated_at" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);`
+
+	if _, err := conn.Exec(query); err != nil {
+		return err
+	}
+
+	// API keys table
+	query = `CREATE TABLE IF NOT EXISTS "api_keys" (
+  "id" SERIAL PRIMARY KEY NOT NULL,
+  "user_id" INT NOT NULL REFERENCES "users" ("id") ON DELETE CASCADE,
+  "name" VARCHAR(255) NOT NULL,
+  "prefix" VARCHAR(20) NOT NULL,
+  "key_hash" VARCHAR(64) NOT NULL UNIQUE,
+  "scope_resource" VARCHAR(40) NOT NULL DEFAULT '',
+  "scope_permission" VARCHAR(20) NOT NULL DEFAULT '',
+  "scope_tank_id" INT DEFAULT NULL REFERENCES "tanks" ("id") ON DELETE CASCADE,
+  "last_used_at" TIMESTAMPTZ DEFAULT NULL,
+  "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  "updated_at" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);`
+
+	if _, err := conn.Exec(query); err != nil {
+		return err
+	}
+
+	// Tank shares, which are looked up by token before the household is known so are
+	// filtered by household explicitly instead of by row-level security
+	query = `CREATE TABLE IF NOT EXISTS "tank_shares" (
+  "id" SERIAL PRIMARY KEY NOT NULL,
+  "household_id" INT NOT NULL REFERENCES "households" ("id") ON DELETE CASCADE,
+  "tank_id" INT NOT NULL REFERENCES "tanks" ("id") ON DELETE CASCADE,
+  "prefix" VARCHAR(20) NOT NULL,
+  "token_hash" VARCHAR(64) NOT NULL UNIQUE,
+  "created_by" INT NOT NULL REFERENCES "users" ("id") ON DELETE CASCADE,
+  "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  "updated_at" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);`
+
+	if _, err := conn.Exec(query); err != nil {
+		return err
+	}
+
+	// Audit events, which outlive the users who made them so don't reference users. The
+	// application can't update or delete them, see createAppRole.
+	query = `CREATE TABLE IF NOT EXISTS "audit_events" (
+  "id" SERIAL PRIMARY KEY NOT NULL,
+  "household_id" INT DEFAULT current_household() REFERENCES "households" ("id") ON DELETE CASCADE,
+  "user_id" INT DEFAULT NULL,
+  "username" VARCHAR(64) NOT NULL DEFAULT '',
+  "api_key_id" INT DEFAULT NULL,
+  "operation" VARCHAR(255) NOT NULL,
+  "entity_type" VARCHAR(40) NOT NULL,
+  "entity_id" INT DEFAULT NULL,
+  "before" JSONB DEFAULT NULL,
+  "after" JSONB DEFAULT NULL,
+  "client_ip" VARCHAR(64) NOT NULL DEFAULT '',
+  "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);
+	CREATE INDEX IF NOT EXISTS "audit_events_household_idx" ON "audit_events" ("household_id", "created_at");
+	CREATE INDEX IF NOT EXISTS "audit_events_entity_idx" ON "audit_events" ("entity_type", "entity_id");
+	ALTER TABLE "audit_events" ENABLE ROW LEVEL SECURITY;
+	ALTER TABLE "audit_events" FORCE ROW LEVEL SECURITY;
+	DROP POLICY IF EXISTS "household_isolation" ON "audit_events";
+	CREATE POLICY "household_isolation" ON "audit_events"
+	  USING ("household_id" IS NOT DISTINCT FROM current_household())
+	  WITH CHECK ("household_id" IS NOT DISTINCT FROM current_household());`
+
+	if _, err := conn.Exec(query); err != nil {
+		return err
+	}
+
+	// Soft deletes, moving fish, tanks and tank statistics to the trash until they're purged
+	for _, table := range []string{"fish", "tanks", "tank_statistics"} {
+		query = fmt.Sprintf(`ALTER TABLE %[1]q ADD COLUMN IF NOT EXISTS "deleted_at" TIMESTAMPTZ DEFAULT NULL;
+	CREATE INDEX IF NOT EXISTS "%[1]s_deleted_idx" ON %[1]q ("deleted_at") WHERE "deleted_at" IS NOT NULL;`, table)
+
+		if _, err := conn.Exec(query); err != nil {
+			return err
+		}
+	}
+
+	// Sensor readings, which are appended in time order so are indexed by time with a
+	// BRIN index. Readings are unique by sensor and sequence so resending them is a no-op.
+	query = `CREATE TABLE IF NOT EXISTS "sensor_readings" (
+  "id" BIGSERIAL PRIMARY KEY NOT NULL,
+  "household_id" INT DEFAULT current_household() REFERENCES "households" ("id") ON DELETE CASCADE,
+  "sensor_id" VARCHAR(64) NOT NULL,
+  "sequence" BIGINT NOT NULL,
+  "tank_id" INT NOT NULL REFERENCES "tanks" ("id") ON DELETE CASCADE,
+  "parameter" VARCHAR(20) NOT NULL,
+  "value" DOUBLE PRECISION NOT NULL,
+  "read_at" TIMESTAMPTZ NOT NULL,
+  "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);
+	CREATE UNIQUE INDEX IF NOT EXISTS "sensor_readings_sensor_sequence_idx" ON "sensor_readings" (COALESCE("household_id", 0), "sensor_id", "sequence");
+	CREATE INDEX IF NOT EXISTS "sensor_readings_tank_idx" ON "sensor_readings" ("tank_id", "parameter", "read_at");
+	CREATE INDEX IF NOT EXISTS "sensor_readings_read_at_idx" ON "sensor_readings" USING BRIN ("read_at");
+	ALTER TABLE "sensor_readings" ENABLE ROW LEVEL SECURITY;
+	ALTER TABLE "sensor_readings" FORCE ROW LEVEL SECURITY;
+	DROP POLICY IF EXISTS "household_isolation" ON "sensor_readings";
+	CREATE POLICY "household_isolation" ON "sensor_readings"
+	  USING ("household_id" IS NOT DISTINCT FROM current_household())
+	  WITH CHECK ("household_id" IS NOT DISTINCT FROM current_household());`
+
+	if _, err := conn.Exec(query); err != nil {
+		return err
+	}
+
+	// Tank events, notified to every replica so they can be pushed to the clients watching
+	// the tanks. Moving fish to or from the trash is notified as a DELETE or RESTORE, and
+	// purging them isn't notified again.
+	query = `CREATE OR REPLACE FUNCTION "notify_tank_event"() RETURNS TRIGGER AS $$
+	DECLARE
+	  "old_row" JSONB := CASE WHEN TG_OP <> 'INSERT' THEN to_jsonb(OLD) END;
+	  "new_row" JSONB := CASE WHEN TG_OP <> 'DELETE' THEN to_jsonb(NEW) END;
+	  "operation" TEXT := TG_OP;
+	BEGIN
+	  IF TG_OP = 'UPDATE' AND "old_row"->>'deleted_at' IS NULL AND "new_row"->>'deleted_at' IS NOT NULL THEN
+	    "operation" := 'DELETE';
+	  ELSIF TG_OP = 'UPDATE' AND "old_row"->>'deleted_at' IS NOT NULL AND "new_row"->>'deleted_at' IS NULL THEN
+	    "operation" := 'RESTORE';
+	  ELSIF TG_OP = 'DELETE' AND "old_row"->>'deleted_at' IS NOT NULL THEN
+	    RETURN NULL;
+	  END IF;
+
+	  PERFORM pg_notify('tank_events', jsonb_build_object(
+	    'type', TG_ARGV[0],
+	    'operation', "operation",
+	    'householdId', COALESCE("new_row", "old_row")->'household_id',
+	    'tankIds', (SELECT COALESCE(jsonb_agg(DISTINCT "t"), '[]') FROM (VALUES ("old_row"->'tank_id'), ("new_row"->'tank_id')) AS "v"("t") WHERE "t" IS NOT NULL AND "t" <> 'null'),
+	    'entity', COALESCE("new_row", "old_row")
+	  )::TEXT);
+
+	  RETURN NULL;
+	END;
+	$$ LANGUAGE plpgsql;
+	DROP TRIGGER IF EXISTS "sensor_readings_notify" ON "sensor_readings";
+	CREATE TRIGGER "sensor_readings_notify" AFTER INSERT ON "sensor_readings" FOR EACH ROW EXECUTE FUNCTION "notify_tank_event"('reading');
+	DROP TRIGGER IF EXISTS "tank_statistics_notify" ON "tank_statistics";
+	CREATE TRIGGER "tank_statistics_notify" AFTER INSERT OR UPDATE OR DELETE ON "tank_statistics" FOR EACH ROW EXECUTE FUNCTION "notify_tank_event"('tank-statistic');
+	DROP TRIGGER IF EXISTS "fish_notify" ON "fish";
+	CREATE TRIGGER "fish_notify" AFTER INSERT OR UPDATE OR DELETE ON "fish" FOR EACH ROW EXECUTE FUNCTION "notify_tank_event"('fish');`
+
+	if _, err := conn.Exec(query); err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// createAppRole creates the role the tests connect as. Row-level security doesn't apply to
+// superusers, so like a deployment the application mustn't connect as one. Audit events
+// are append-only, so can't be updated or deleted by the application.
+func createAppRole(conn *sql.DB) error {
+	query := `CREATE ROLE "trackmyfish" LOGIN PASSWORD 'secret';
+	GRANT SELECT, INSERT, UPDATE, DELETE ON ALL TABLES IN SCHEMA public TO "trackmyfish";
+	GRANT USAGE ON ALL SEQUENCES IN SCHEMA public TO "trackmyfish";
+	REVOKE UPDATE, DELETE ON "audit_events" FROM "trackmyfish";`
+
+	_, err := conn.Exec(query)
+
+	return err
+}
+
 func TestPing(t *testing.T) {
 	t.Run("Given a initialised db manager", func(t *testing.T) {
 		t.Run("When ping is called", func(t *testing.T) {
@@ -304,6 +753,43 @@ func TestTankStatistics(t *testing.T) {
 			})
 		})
 	})
+
+	t.Run("Given several TankStatistics", func(t *testing.T) {
+		user, err := mgr.InsertUser(context.Background(), db.User{Username: "bulk-statistics", PasswordHash: "hash"}, "Bulk")
+		assert.NoError(t, err)
+
+		ctx := db.WithHousehold(context.Background(), user.HouseholdID)
+
+		t.Run("When they are passed to InsertTankStatistics", func(t *testing.T) {
+			t.Run("Then they are all created", func(t *testing.T) {
+				inserted, err := mgr.InsertTankStatistics(ctx, []db.TankStatistic{
+					{TestDate: "2021/08/06 10:00", PH: pointy.Float32(7.2)},
+					{TestDate: "2021/08/07 10:00", Nitrate: pointy.Float32(10)},
+				})
+				assert.NoError(t, err)
+				assert.Len(t, inserted, 2)
+				assert.NotEqual(t, inserted[0].ID, inserted[1].ID)
+
+				ts, err := mgr.ListTankStatistics(ctx)
+				assert.NoError(t, err)
+				assert.Len(t, ts, 2)
+			})
+		})
+
+		t.Run("When one of them can't be created", func(t *testing.T) {
+			t.Run("Then none are created", func(t *testing.T) {
+				_, err := mgr.InsertTankStatistics(ctx, []db.TankStatistic{
+					{TestDate: "2021/08/08 10:00"},
+					{TestDate: strings.Repeat("9", 256)},
+				})
+				assert.Error(t, err)
+
+				ts, err := mgr.ListTankStatistics(ctx)
+				assert.NoError(t, err)
+				assert.Len(t, ts, 2)
+			})
+		})
+	})
 }
 
 func TestTanks(t *testing.T) {
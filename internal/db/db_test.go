@@ -1,8 +1,11 @@
 package db
 
 import (
+	"encoding/json"
 	"testing"
+	"time"
 
+	"github.com/openlyinc/pointy"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -45,3 +48,109 @@ func TestNew(t *testing.T) {
 		})
 	}
 }
+
+func TestRemapRow(t *testing.T) {
+	fish := backupTable{
+		name:    "fish",
+		key:     "id",
+		columns: []string{"tank_id", "type"},
+		refs:    []backupRef{{column: "tank_id", table: "tanks", setNull: true}},
+	}
+	measurements := backupTable{
+		name:    "fish_measurements",
+		key:     "id",
+		columns: []string{"fish_id"},
+		refs:    []backupRef{{column: "fish_id", table: "fish"}},
+	}
+	ids := map[string]map[int64]int64{"tanks": {1: 10}, "fish": {}}
+
+	testCases := []struct {
+		desc        string
+		table       backupTable
+		row         string
+		expected    string
+		skipped     bool
+		expectedErr string
+	}{
+		{desc: "References are remapped and unknown columns dropped", table: fish, row: `{"id": 1, "tank_id": 1, "type": "Guppy", "extra": true}`, expected: `{"id": 1, "tank_id": 10, "type": "Guppy"}`},
+		{desc: "Null references are kept", table: fish, row: `{"id": 1, "tank_id": null}`, expected: `{"id": 1, "tank_id": null}`},
+		{desc: "Missing optional references are cleared", table: fish, row: `{"id": 1, "tank_id": 2}`, expected: `{"id": 1, "tank_id": null}`},
+		{desc: "Missing required references skip the row", table: measurements, row: `{"id": 1, "fish_id": 2}`, skipped: true},
+		{desc: "Rows without a key are invalid", table: fish, row: `{"type": "Guppy"}`, expectedErr: "missing id"},
+		{desc: "Invalid references are invalid", table: fish, row: `{"id": 1, "tank_id": "one"}`, expectedErr: `invalid tank_id "one"`},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			row, ok, err := remapRow(tC.table, []byte(tC.row), ids)
+
+			if tC.expectedErr != "" {
+				assert.EqualError(t, err, tC.expectedErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, !tC.skipped, ok)
+
+			if !tC.skipped {
+				b, err := json.Marshal(row)
+				assert.NoError(t, err)
+				assert.JSONEq(t, tC.expected, string(b))
+			}
+		})
+	}
+}
+
+func TestParseTankEvent(t *testing.T) {
+	tankID := int32(3)
+
+	testCases := []struct {
+		desc     string
+		payload  string
+		expected TankEvent
+	}{
+		{
+			desc:    "a sensor reading",
+			payload: `{"type": "reading", "operation": "INSERT", "householdId": 2, "tankIds": [3], "entity": {"id": 9, "household_id": 2, "sensor_id": "probe-1", "sequence": 4, "tank_id": 3, "parameter": "ph", "value": 8.1, "read_at": "2021-08-06T10:00:00+00:00"}}`,
+			expected: TankEvent{
+				Type: TankEventReading, Operation: "INSERT", HouseholdID: 2, TankIDs: []int32{3},
+				Reading: &SensorReading{ID: 9, SensorID: "probe-1", Sequence: 4, TankID: 3, Parameter: "ph", Value: 8.1, ReadAt: time.Date(2021, 8, 6, 10, 0, 0, 0, time.UTC)},
+			},
+		},
+		{
+			desc:    "a fish moved to the trash",
+			payload: `{"type": "fish", "operation": "DELETE", "householdId": null, "tankIds": [3], "entity": {"id": 5, "tank_id": 3, "type": "Shrimp", "subtype": "Cherry", "count": 10, "deleted_at": "2021-08-06T10:00:00+00:00"}}`,
+			expected: TankEvent{
+				Type: TankEventFish, Operation: "DELETE", TankIDs: []int32{3},
+				Fish: &Fish{ID: 5, TankID: &tankID, Type: "Shrimp", Subtype: "Cherry", Count: 10},
+			},
+		},
+		{
+			desc:    "a tank statistic",
+			payload: `{"type": "tank-statistic", "operation": "INSERT", "householdId": 2, "tankIds": [], "entity": {"id": 6, "test_date": "2021/08/06 10:00", "ph": 7.2, "gh": null}}`,
+			expected: TankEvent{
+				Type: TankEventTankStatistic, Operation: "INSERT", HouseholdID: 2, TankIDs: []int32{},
+				TankStatistic: &TankStatistic{ID: 6, TestDate: "2021/08/06 10:00", PH: pointy.Float32(7.2)},
+			},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run("Given a notification of "+tC.desc, func(t *testing.T) {
+			t.Run("When it is parsed", func(t *testing.T) {
+				t.Run("Then the tank event is returned", func(t *testing.T) {
+					e, err := parseTankEvent([]byte(tC.payload))
+					assert.NoError(t, err)
+					assert.Equal(t, tC.expected, e)
+				})
+			})
+		})
+	}
+
+	t.Run("Given a notification of an unknown type", func(t *testing.T) {
+		t.Run("When it is parsed", func(t *testing.T) {
+			t.Run("Then an error is returned", func(t *testing.T) {
+				_, err := parseTankEvent([]byte(`{"type": "tank", "operation": "INSERT", "entity": {}}`))
+				assert.EqualError(t, err, `unknown tank event type "tank"`)
+			})
+		})
+	})
+}
@@ -0,0 +1,295 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// FertiliserProduct is a fertiliser or additive in the product catalogue, e.g. a macro
+// mix, a micro mix or a KH buffer
+type FertiliserProduct struct {
+	ID           int32
+	Name         string
+	Manufacturer string
+	Notes        string
+	// Components is the concentration of each parameter the product raises, in mg per ml
+	Components []ProductComponent
+}
+
+// ProductComponent is the concentration of a single parameter (e.g. NITRATE) in a product
+type ProductComponent struct {
+	Parameter string
+	MgPerMl   float32
+}
+
+// DosingEntry is a record of a product being added to a Tank
+type DosingEntry struct {
+	ID          int32
+	TankID      int32
+	ProductID   int32
+	ProductName string
+	// AmountMl is the amount of product added, in ml
+	AmountMl float32
+	DosedAt  time.Time
+	Notes    string
+}
+
+// DosingFilter restricts the entries returned by ListDosingEntries. Nil fields are ignored.
+type DosingFilter struct {
+	TankID    *int32
+	ProductID *int32
+	From      *time.Time
+	To        *time.Time
+}
+
+const fertiliserProductSelect = `SELECT p.id, p.name, p.manufacturer, p.notes,
+	COALESCE(array_agg(c.parameter ORDER BY c.parameter) FILTER (WHERE c.parameter IS NOT NULL), '{}'),
+	COALESCE(array_agg(c.mg_per_ml ORDER BY c.parameter) FILTER (WHERE c.parameter IS NOT NULL), '{}')
+FROM fertiliser_products p
+LEFT JOIN fertiliser_product_components c ON c.product_id = p.id`
+
+const dosingEntrySelect = `SELECT d.id, d.tank_id, d.product_id, p.name, d.amount_ml, d.dosed_at, d.notes
+FROM dosing_log d
+JOIN fertiliser_products p ON p.id = d.product_id`
+
+func scanFertiliserProduct(row pgx.Row, p *FertiliserProduct) error {
+	var (
+		parameters []string
+		mgPerMl    []float32
+	)
+
+	if err := row.Scan(&p.ID, &p.Name, &p.Manufacturer, &p.Notes, &parameters, &mgPerMl); err != nil {
+		return err
+	}
+
+	p.Components = make([]ProductComponent, len(parameters))
+	for i := range parameters {
+		p.Components[i] = ProductComponent{Parameter: parameters[i], MgPerMl: mgPerMl[i]}
+	}
+
+	return nil
+}
+
+func scanDosingEntry(row pgx.Row, e *DosingEntry) error {
+	return row.Scan(&e.ID, &e.TankID, &e.ProductID, &e.ProductName, &e.AmountMl, &e.DosedAt, &e.Notes)
+}
+
+// InsertFertiliserProduct adds a product and its components within a single transaction
+func (d *Manager) InsertFertiliserProduct(ctx context.Context, product FertiliserProduct) (FertiliserProduct, error) {
+	p := FertiliserProduct{}
+
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return p, errors.Wrap(err, "unable to begin transaction")
+	}
+	defer tx.Rollback(ctx) // #nosec G104 -- no-op after commit
+
+	var id int32
+	err = tx.QueryRow(
+		ctx,
+		"INSERT INTO fertiliser_products(name, manufacturer, notes) VALUES($1, $2, $3) RETURNING id",
+		product.Name, product.Manufacturer, product.Notes,
+	).Scan(&id)
+	if err != nil {
+		return p, errors.Wrap(err, "unable to add fertiliser product")
+	}
+
+	parameters := make([]string, len(product.Components))
+	mgPerMl := make([]float32, len(product.Components))
+	for i, c := range product.Components {
+		parameters[i], mgPerMl[i] = c.Parameter, c.MgPerMl
+	}
+
+	if _, err := tx.Exec(
+		ctx,
+		"INSERT INTO fertiliser_product_components(product_id, parameter, mg_per_ml) SELECT $1, c.parameter, c.mg_per_ml FROM unnest($2::TEXT[], $3::REAL[]) AS c(parameter, mg_per_ml)",
+		id, parameters, mgPerMl,
+	); err != nil {
+		return p, errors.Wrap(err, "unable to add fertiliser product components")
+	}
+
+	if err := scanFertiliserProduct(tx.QueryRow(ctx, fertiliserProductSelect+" WHERE p.id=$1 GROUP BY p.id", id), &p); err != nil {
+		return p, errors.Wrap(err, "unable to get fertiliser product")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return p, errors.Wrap(err, "unable to commit fertiliser product")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id": p.ID,
+	}).Info("Fertiliser product inserted successfully")
+
+	return p, nil
+}
+
+func (d *Manager) GetFertiliserProduct(ctx context.Context, id int32) (FertiliserProduct, error) {
+	p := FertiliserProduct{}
+
+	if err := scanFertiliserProduct(d.pool.QueryRow(ctx, fertiliserProductSelect+" WHERE p.id=$1 GROUP BY p.id", id), &p); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return p, &ErrNotFound{message: "fertiliser product not found"}
+		}
+
+		return p, errors.Wrap(err, "unable to get fertiliser product")
+	}
+
+	return p, nil
+}
+
+func (d *Manager) ListFertiliserProducts(ctx context.Context) ([]FertiliserProduct, error) {
+	products := make([]FertiliserProduct, 0)
+
+	rows, err := d.pool.Query(ctx, fertiliserProductSelect+" GROUP BY p.id ORDER BY p.name")
+	if err != nil {
+		return products, errors.Wrap(err, "unable to get fertiliser products")
+	}
+
+	rowCount := 0
+	for rows.Next() {
+		p := FertiliserProduct{}
+
+		if err := scanFertiliserProduct(rows, &p); err != nil {
+			return nil, errors.Wrap(err, "unable to scan row")
+		}
+
+		products = append(products, p)
+
+		rowCount++
+	}
+
+	if rows.Err() != nil {
+		return nil, errors.Wrap(rows.Err(), "erroring reading rows")
+	}
+
+	logrus.WithFields(logrus.Fields{"rowCount": rowCount}).Info("Fertiliser products queried successfully")
+
+	return products, nil
+}
+
+// DeleteFertiliserProduct removes a product from the catalogue. Products which have been
+// dosed can't be deleted as that would remove them from the dosing log.
+func (d *Manager) DeleteFertiliserProduct(ctx context.Context, id int32) (FertiliserProduct, error) {
+	p, err := d.GetFertiliserProduct(ctx, id)
+	if err != nil {
+		return p, err
+	}
+
+	var used bool
+	if err := d.pool.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM dosing_log WHERE product_id=$1)", id).Scan(&used); err != nil {
+		return p, errors.Wrap(err, "unable to check dosing log")
+	}
+
+	if used {
+		return p, &ErrConflict{message: "fertiliser product has been dosed"}
+	}
+
+	if _, err := d.pool.Exec(ctx, "DELETE FROM fertiliser_products WHERE id=$1", id); err != nil {
+		return p, errors.Wrap(err, "unable to delete fertiliser product")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id": p.ID,
+	}).Info("Fertiliser product deleted successfully")
+
+	return p, nil
+}
+
+// InsertDosingEntry adds a dose of a product to the dosing log. The product is selected
+// rather than referenced directly, so a product which isn't visible to the household
+// isn't found instead of being dosed.
+func (d *Manager) InsertDosingEntry(ctx context.Context, entry DosingEntry) (DosingEntry, error) {
+	e := DosingEntry{}
+
+	err := scanDosingEntry(d.pool.QueryRow(
+		ctx,
+		`WITH d AS (
+			INSERT INTO dosing_log(tank_id, product_id, amount_ml, dosed_at, notes)
+			SELECT $1, id, $3, $4, $5 FROM fertiliser_products WHERE id=$2
+			RETURNING id, tank_id, product_id, amount_ml, dosed_at, notes
+		)
+		SELECT d.id, d.tank_id, d.product_id, p.name, d.amount_ml, d.dosed_at, d.notes FROM d JOIN fertiliser_products p ON p.id = d.product_id`,
+		entry.TankID, entry.ProductID, entry.AmountMl, entry.DosedAt, entry.Notes,
+	), &e)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return e, &ErrNotFound{message: "fertiliser product not found"}
+		}
+
+		if isForeignKeyViolation(err) {
+			return e, &ErrNotFound{message: "tank not found"}
+		}
+
+		return e, errors.Wrap(err, "unable to add dosing entry")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id": e.ID,
+	}).Info("Dosing entry inserted successfully")
+
+	return e, nil
+}
+
+func (d *Manager) ListDosingEntries(ctx context.Context, filter DosingFilter) ([]DosingEntry, error) {
+	entries := make([]DosingEntry, 0)
+
+	rows, err := d.pool.Query(
+		ctx,
+		dosingEntrySelect+` WHERE ($1::INT IS NULL OR d.tank_id=$1) AND ($2::INT IS NULL OR d.product_id=$2)
+		AND ($3::TIMESTAMPTZ IS NULL OR d.dosed_at >= $3) AND ($4::TIMESTAMPTZ IS NULL OR d.dosed_at < $4)
+		ORDER BY d.dosed_at DESC`,
+		filter.TankID, filter.ProductID, filter.From, filter.To,
+	)
+	if err != nil {
+		return entries, errors.Wrap(err, "unable to get dosing entries")
+	}
+
+	rowCount := 0
+	for rows.Next() {
+		e := DosingEntry{}
+
+		if err := scanDosingEntry(rows, &e); err != nil {
+			return nil, errors.Wrap(err, "unable to scan row")
+		}
+
+		entries = append(entries, e)
+
+		rowCount++
+	}
+
+	if rows.Err() != nil {
+		return nil, errors.Wrap(rows.Err(), "erroring reading rows")
+	}
+
+	logrus.WithFields(logrus.Fields{"rowCount": rowCount}).Info("Dosing entries queried successfully")
+
+	return entries, nil
+}
+
+func (d *Manager) DeleteDosingEntry(ctx context.Context, id int32) (DosingEntry, error) {
+	e := DosingEntry{}
+
+	err := scanDosingEntry(d.pool.QueryRow(
+		ctx,
+		`WITH d AS (DELETE FROM dosing_log WHERE id=$1 RETURNING id, tank_id, product_id, amount_ml, dosed_at, notes)
+		SELECT d.id, d.tank_id, d.product_id, p.name, d.amount_ml, d.dosed_at, d.notes FROM d JOIN fertiliser_products p ON p.id = d.product_id`,
+		id,
+	), &e)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return e, &ErrNotFound{message: "dosing entry not found"}
+		}
+
+		return e, errors.Wrap(err, "unable to delete dosing entry")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id": e.ID,
+	}).Info("Dosing entry deleted successfully")
+
+	return e, nil
+}
@@ -0,0 +1,118 @@
+//go:build integration
+// +build integration
+
+package db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/openlyinc/pointy"
+	"github.com/stretchr/testify/assert"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+func TestDosing(t *testing.T) {
+	t.Run("Given a planted tank", func(t *testing.T) {
+		var (
+			product db.FertiliserProduct
+			entry   db.DosingEntry
+		)
+
+		tank, err := mgr.InsertTank(context.Background(), db.Tank{Name: "Planted", CapacityMeasurement: "LITRES", Capacity: pointy.Float32(120)})
+		assert.NoError(t, err)
+
+		t.Run("When GetTank is called", func(t *testing.T) {
+			t.Run("Then the tank's capacity is returned", func(t *testing.T) {
+				tk, err := mgr.GetTank(context.Background(), tank.ID)
+				assert.NoError(t, err)
+
+				assert.Equal(t, float32(120), *tk.Capacity)
+			})
+		})
+
+		t.Run("When InsertFertiliserProduct is called", func(t *testing.T) {
+			t.Run("Then the product and its components are created", func(t *testing.T) {
+				product, err = mgr.InsertFertiliserProduct(context.Background(), db.FertiliserProduct{
+					Name: "Macro Mix",
+					Components: []db.ProductComponent{
+						{Parameter: "NITRATE", MgPerMl: 12.5},
+						{Parameter: "PHOSPHATE", MgPerMl: 1.25},
+					},
+				})
+				assert.NoError(t, err)
+
+				assert.Equal(t, "Macro Mix", product.Name)
+				assert.Equal(t, []db.ProductComponent{{Parameter: "NITRATE", MgPerMl: 12.5}, {Parameter: "PHOSPHATE", MgPerMl: 1.25}}, product.Components)
+
+				products, err := mgr.ListFertiliserProducts(context.Background())
+				assert.NoError(t, err)
+				assert.Contains(t, products, product)
+			})
+		})
+
+		t.Run("When InsertDosingEntry is called", func(t *testing.T) {
+			t.Run("Then the dose is logged against the tank", func(t *testing.T) {
+				entry, err = mgr.InsertDosingEntry(context.Background(), db.DosingEntry{TankID: tank.ID, ProductID: product.ID, AmountMl: 96, DosedAt: time.Now()})
+				assert.NoError(t, err)
+
+				assert.Equal(t, "Macro Mix", entry.ProductName)
+
+				entries, err := mgr.ListDosingEntries(context.Background(), db.DosingFilter{TankID: &tank.ID})
+				assert.NoError(t, err)
+				assert.Len(t, entries, 1)
+				assert.Equal(t, entry.ID, entries[0].ID)
+			})
+		})
+
+		t.Run("When InsertDosingEntry is called for a product which isn't visible to the household", func(t *testing.T) {
+			t.Run("Then it isn't found and nothing is logged", func(t *testing.T) {
+				other, err := mgr.InsertUser(context.Background(), db.User{Username: "dosing-other", PasswordHash: "hash"}, "Dosing Other")
+				assert.NoError(t, err)
+
+				ctx := db.WithHousehold(context.Background(), other.HouseholdID)
+
+				otherTank, err := mgr.InsertTank(ctx, db.Tank{Name: "Other"})
+				assert.NoError(t, err)
+
+				_, err = mgr.InsertDosingEntry(ctx, db.DosingEntry{TankID: otherTank.ID, ProductID: product.ID, AmountMl: 10, DosedAt: time.Now()})
+				assert.IsType(t, &db.ErrNotFound{}, err)
+
+				entries, err := mgr.ListDosingEntries(context.Background(), db.DosingFilter{ProductID: &product.ID})
+				assert.NoError(t, err)
+				assert.Len(t, entries, 1)
+			})
+		})
+
+		t.Run("When InsertDosingEntry is called for a tank which doesn't exist", func(t *testing.T) {
+			t.Run("Then it isn't found", func(t *testing.T) {
+				_, err := mgr.InsertDosingEntry(context.Background(), db.DosingEntry{TankID: -1, ProductID: product.ID, AmountMl: 10, DosedAt: time.Now()})
+				assert.IsType(t, &db.ErrNotFound{}, err)
+			})
+		})
+
+		t.Run("When a dosed product is deleted", func(t *testing.T) {
+			t.Run("Then a conflict is returned", func(t *testing.T) {
+				_, err := mgr.DeleteFertiliserProduct(context.Background(), product.ID)
+				assert.IsType(t, &db.ErrConflict{}, err)
+			})
+		})
+
+		t.Run("When the dose is deleted", func(t *testing.T) {
+			t.Run("Then the product can be deleted", func(t *testing.T) {
+				_, err := mgr.DeleteDosingEntry(context.Background(), entry.ID)
+				assert.NoError(t, err)
+
+				_, err = mgr.DeleteFertiliserProduct(context.Background(), product.ID)
+				assert.NoError(t, err)
+
+				_, err = mgr.GetFertiliserProduct(context.Background(), product.ID)
+				assert.IsType(t, &db.ErrNotFound{}, err)
+			})
+		})
+
+		_, err = mgr.DeleteTank(context.Background(), tank.ID)
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,165 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// tankEventsChannel is the channel the notify_tank_event trigger notifies changes on
+const tankEventsChannel = "tank_events"
+
+// Types of TankEvent
+const (
+	TankEventReading       = "reading"
+	TankEventTankStatistic = "tank-statistic"
+	TankEventFish          = "fish"
+)
+
+// TankEvent is a change which is pushed to the clients watching a tank: a new sensor
+// reading, or a tank statistic or fish being added, changed or deleted. Tank statistics
+// aren't recorded per tank, so they're pushed to the clients watching any tank in the
+// household.
+type TankEvent struct {
+	Type string
+	// Operation is INSERT, UPDATE or DELETE, or RESTORE for items restored from the trash.
+	// Moving an item to the trash is a DELETE.
+	Operation string
+	// HouseholdID is 0 for data without a household
+	HouseholdID int32
+	// TankIDs are the tanks changed, which are both tanks when a fish is moved between them
+	TankIDs []int32
+
+	// Only the entity of the Type is set
+	Reading       *SensorReading
+	TankStatistic *TankStatistic
+	Fish          *Fish
+}
+
+// tankEventNotification is the payload of a notification on tankEventsChannel. The entity
+// is the changed row.
+type tankEventNotification struct {
+	Type        string          `json:"type"`
+	Operation   string          `json:"operation"`
+	HouseholdID *int32          `json:"householdId"`
+	TankIDs     []int32         `json:"tankIds"`
+	Entity      json.RawMessage `json:"entity"`
+}
+
+// ListenTankEvents calls handle with every TankEvent notified by the database, including
+// those caused by other replicas, until ctx is done or the connection is lost. Events are
+// only notified while listening, and aren't scoped to a household.
+func (d *Manager) ListenTankEvents(ctx context.Context, handle func(TankEvent)) error {
+	conn, err := d.pool.Acquire(ctx)
+	if err != nil {
+		return errors.Wrap(err, "unable to acquire connection")
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "LISTEN "+tankEventsChannel); err != nil {
+		return errors.Wrap(err, "unable to listen for tank events")
+	}
+
+	defer func() {
+		// stop listening before the connection is returned to the pool, unless it was
+		// closed when ctx was done
+		if !conn.Conn().IsClosed() {
+			unlistenCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			if _, err := conn.Exec(unlistenCtx, "UNLISTEN "+tankEventsChannel); err != nil {
+				logrus.WithError(err).Warn("Unable to stop listening for tank events")
+			}
+		}
+	}()
+
+	logrus.Info("Listening for tank events")
+
+	for {
+		n, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			return errors.Wrap(err, "unable to wait for tank events")
+		}
+
+		e, err := parseTankEvent([]byte(n.Payload))
+		if err != nil {
+			logrus.WithError(err).Warn("Ignoring invalid tank event")
+			continue
+		}
+
+		handle(e)
+	}
+}
+
+// parseTankEvent parses the payload of a notification on tankEventsChannel
+func parseTankEvent(payload []byte) (TankEvent, error) {
+	var n tankEventNotification
+	if err := json.Unmarshal(payload, &n); err != nil {
+		return TankEvent{}, errors.Wrap(err, "unable to parse tank event")
+	}
+
+	e := TankEvent{Type: n.Type, Operation: n.Operation, TankIDs: n.TankIDs}
+	if n.HouseholdID != nil {
+		e.HouseholdID = *n.HouseholdID
+	}
+
+	var err error
+	switch n.Type {
+	case TankEventReading:
+		var row struct {
+			ID        int64     `json:"id"`
+			SensorID  string    `json:"sensor_id"`
+			Sequence  int64     `json:"sequence"`
+			TankID    int32     `json:"tank_id"`
+			Parameter string    `json:"parameter"`
+			Value     float64   `json:"value"`
+			ReadAt    time.Time `json:"read_at"`
+		}
+
+		if err = json.Unmarshal(n.Entity, &row); err == nil {
+			e.Reading = &SensorReading{ID: row.ID, SensorID: row.SensorID, Sequence: row.Sequence, TankID: row.TankID, Parameter: row.Parameter, Value: row.Value, ReadAt: row.ReadAt.UTC()}
+		}
+	case TankEventTankStatistic:
+		var row struct {
+			ID        int32    `json:"id"`
+			TestDate  string   `json:"test_date"`
+			PH        *float32 `json:"ph"`
+			GH        *float32 `json:"gh"`
+			KH        *float32 `json:"kh"`
+			Ammonia   *float32 `json:"ammonia"`
+			Nitrite   *float32 `json:"nitrite"`
+			Nitrate   *float32 `json:"nitrate"`
+			Phosphate *float32 `json:"phosphate"`
+		}
+
+		if err = json.Unmarshal(n.Entity, &row); err == nil {
+			e.TankStatistic = &TankStatistic{ID: row.ID, TestDate: row.TestDate, PH: row.PH, GH: row.GH, KH: row.KH, Ammonia: row.Ammonia, Nitrite: row.Nitrite, Nitrate: row.Nitrate, Phosphate: row.Phosphate}
+		}
+	case TankEventFish:
+		var row struct {
+			ID           int32  `json:"id"`
+			TankID       *int32 `json:"tank_id"`
+			Type         string `json:"type"`
+			Subtype      string `json:"subtype"`
+			Color        string `json:"color"`
+			Gender       string `json:"gender"`
+			PurchaseDate string `json:"purchase_date"`
+			Count        int32  `json:"count"`
+		}
+
+		if err = json.Unmarshal(n.Entity, &row); err == nil {
+			e.Fish = &Fish{ID: row.ID, TankID: row.TankID, Type: row.Type, Subtype: row.Subtype, Color: row.Color, Gender: row.Gender, PurchaseDate: row.PurchaseDate, Count: row.Count}
+		}
+	default:
+		return e, errors.Errorf("unknown tank event type %q", n.Type)
+	}
+
+	if err != nil {
+		return e, errors.Wrapf(err, "unable to parse %s", n.Type)
+	}
+
+	return e, nil
+}
@@ -0,0 +1,94 @@
+//go:build integration
+// +build integration
+
+package db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+func TestListenTankEvents(t *testing.T) {
+	t.Run("Given a listener for tank events", func(t *testing.T) {
+		user, err := mgr.InsertUser(context.Background(), db.User{Username: "events-owner", PasswordHash: "hash"}, "Events")
+		assert.NoError(t, err)
+
+		ctx := db.WithHousehold(context.Background(), user.HouseholdID)
+
+		tank, err := mgr.InsertTank(ctx, db.Tank{Name: "Reef"})
+		assert.NoError(t, err)
+
+		listenCtx, cancel := context.WithCancel(context.Background())
+		events := make(chan db.TankEvent, 10)
+		done := make(chan error)
+
+		go func() {
+			done <- mgr.ListenTankEvents(listenCtx, func(e db.TankEvent) {
+				if e.HouseholdID == user.HouseholdID {
+					events <- e
+				}
+			})
+		}()
+
+		// give the listener time to start listening
+		time.Sleep(time.Second)
+
+		next := func() db.TankEvent {
+			select {
+			case e := <-events:
+				return e
+			case <-time.After(5 * time.Second):
+				t.Fatal("no tank event was notified")
+				return db.TankEvent{}
+			}
+		}
+
+		t.Run("When a reading is added to a tank", func(t *testing.T) {
+			t.Run("Then it is notified", func(t *testing.T) {
+				_, err := mgr.InsertSensorReadings(ctx, []db.SensorReading{{SensorID: "probe-1", Sequence: 1, TankID: tank.ID, Parameter: "ph", Value: 8.1, ReadAt: time.Now()}})
+				assert.NoError(t, err)
+
+				e := next()
+				assert.Equal(t, db.TankEventReading, e.Type)
+				assert.Equal(t, "INSERT", e.Operation)
+				assert.Equal(t, []int32{tank.ID}, e.TankIDs)
+				assert.Equal(t, 8.1, e.Reading.Value)
+			})
+		})
+
+		t.Run("When a fish in the tank is moved to the trash", func(t *testing.T) {
+			t.Run("Then its addition and deletion are notified", func(t *testing.T) {
+				fish, err := mgr.InsertFish(ctx, db.Fish{TankID: &tank.ID, Type: "Shrimp", Subtype: "Cherry", Count: 10})
+				assert.NoError(t, err)
+
+				_, err = mgr.DeleteFish(ctx, fish.ID)
+				assert.NoError(t, err)
+
+				for _, op := range []string{"INSERT", "DELETE"} {
+					e := next()
+					assert.Equal(t, db.TankEventFish, e.Type)
+					assert.Equal(t, op, e.Operation)
+					assert.Equal(t, []int32{tank.ID}, e.TankIDs)
+					assert.Equal(t, fish.ID, e.Fish.ID)
+				}
+			})
+		})
+
+		t.Run("When the listener is stopped", func(t *testing.T) {
+			t.Run("Then it returns", func(t *testing.T) {
+				cancel()
+
+				select {
+				case err := <-done:
+					assert.Error(t, err)
+				case <-time.After(5 * time.Second):
+					t.Fatal("listener didn't stop")
+				}
+			})
+		})
+	})
+}
@@ -0,0 +1,131 @@
+package db
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// householdSetting is the Postgres setting holding the household of a connection, which
+// the row-level security policies of every household owned table compare against
+const householdSetting = "trackmyfish.household_id"
+
+// Household owns tanks, fish and everything recorded about them. Queries only see the
+// data of the household in their context, see WithHousehold.
+type Household struct {
+	ID        int32
+	Name      string
+	CreatedAt time.Time
+}
+
+type householdKey struct{}
+
+// WithHousehold returns a copy of ctx scoping every query made with it to the household
+func WithHousehold(ctx context.Context, id int32) context.Context {
+	return context.WithValue(ctx, householdKey{}, id)
+}
+
+// HouseholdFromContext returns the household queries made with ctx are scoped to, if any
+func HouseholdFromContext(ctx context.Context) (int32, bool) {
+	id, ok := ctx.Value(householdKey{}).(int32)
+
+	return id, ok
+}
+
+// scopeConnection sets the household of a connection each time it's acquired from the
+// pool, so the scope of one query can't leak into the next. Queries made without a
+// household only see data which doesn't belong to one.
+func scopeConnection(ctx context.Context, conn *pgx.Conn) bool {
+	household := ""
+	if id, ok := HouseholdFromContext(ctx); ok {
+		household = strconv.Itoa(int(id))
+	}
+
+	if _, err := conn.Exec(ctx, "SELECT set_config($1, $2, false)", householdSetting, household); err != nil {
+		logrus.WithError(err).Error("Unable to set household of connection")
+
+		// the connection is destroyed and another acquired
+		return false
+	}
+
+	return true
+}
+
+// householdScopes returns ctx scoped to each household in turn, after ctx itself, so
+// queries made with them see the data of every household followed by the data which
+// doesn't belong to one. A ctx which is already scoped to a household is returned alone.
+func (d *Manager) householdScopes(ctx context.Context) ([]context.Context, error) {
+	if _, ok := HouseholdFromContext(ctx); ok {
+		return []context.Context{ctx}, nil
+	}
+
+	rows, err := d.pool.Query(ctx, "SELECT id FROM households ORDER BY id")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get households")
+	}
+	defer rows.Close()
+
+	scopes := []context.Context{ctx}
+	for rows.Next() {
+		var id int32
+		if err := rows.Scan(&id); err != nil {
+			return nil, errors.Wrap(err, "unable to scan row")
+		}
+
+		scopes = append(scopes, WithHousehold(ctx, id))
+	}
+
+	if rows.Err() != nil {
+		return nil, errors.Wrap(rows.Err(), "erroring reading rows")
+	}
+
+	return scopes, nil
+}
+
+const householdColumns = "id, name, created_at"
+
+func scanHousehold(row pgx.Row, h *Household) error {
+	return row.Scan(&h.ID, &h.Name, &h.CreatedAt)
+}
+
+func (d *Manager) GetHousehold(ctx context.Context, id int32) (Household, error) {
+	h := Household{}
+
+	if err := scanHousehold(d.pool.QueryRow(ctx, "SELECT "+householdColumns+" FROM households WHERE id=$1", id), &h); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return h, &ErrNotFound{message: "household not found"}
+		}
+
+		return h, errors.Wrap(err, "unable to get household")
+	}
+
+	return h, nil
+}
+
+// RenameHousehold updates the name of a household
+func (d *Manager) RenameHousehold(ctx context.Context, id int32, name string) (Household, error) {
+	h := Household{}
+
+	err := scanHousehold(d.pool.QueryRow(
+		ctx,
+		"UPDATE households SET name=$2, updated_at=NOW() WHERE id=$1 RETURNING "+householdColumns,
+		id, name,
+	), &h)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return h, &ErrNotFound{message: "household not found"}
+		}
+
+		return h, errors.Wrap(err, "unable to rename household")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id": h.ID,
+	}).Info("Household updated successfully")
+
+	return h, nil
+}
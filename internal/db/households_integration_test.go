@@ -0,0 +1,72 @@
+//go:build integration
+// +build integration
+
+package db_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+func TestHouseholds(t *testing.T) {
+	t.Run("Given two households", func(t *testing.T) {
+		a, err := mgr.InsertUser(context.Background(), db.User{Username: "household-a", PasswordHash: "hash"}, "A")
+		assert.NoError(t, err)
+
+		b, err := mgr.InsertUser(context.Background(), db.User{Username: "household-b", PasswordHash: "hash"}, "B")
+		assert.NoError(t, err)
+
+		ctxA := db.WithHousehold(context.Background(), a.HouseholdID)
+		ctxB := db.WithHousehold(context.Background(), b.HouseholdID)
+
+		tank, err := mgr.InsertTank(ctxA, db.Tank{Name: "Reef"})
+		assert.NoError(t, err)
+
+		fish, err := mgr.InsertFish(ctxA, db.Fish{TankID: &tank.ID, Type: "Clownfish", Count: 2})
+		assert.NoError(t, err)
+
+		t.Run("When the other household lists its data", func(t *testing.T) {
+			t.Run("Then the data of the first household isn't returned", func(t *testing.T) {
+				tanks, err := mgr.ListTanks(ctxB)
+				assert.NoError(t, err)
+				assert.NotContains(t, tanks, tank)
+
+				allFish, err := mgr.ListFish(ctxB)
+				assert.NoError(t, err)
+				assert.NotContains(t, allFish, fish)
+			})
+		})
+
+		t.Run("When the other household gets or deletes the data", func(t *testing.T) {
+			t.Run("Then it isn't found", func(t *testing.T) {
+				_, err := mgr.GetTank(ctxB, tank.ID)
+				assert.IsType(t, &db.ErrNotFound{}, err)
+
+				_, err = mgr.DeleteFish(ctxB, fish.ID)
+				assert.Error(t, err)
+
+				got, err := mgr.GetFish(ctxA, fish.ID)
+				assert.NoError(t, err)
+				assert.Equal(t, fish, got)
+			})
+		})
+
+		t.Run("When data is queried without a household", func(t *testing.T) {
+			t.Run("Then the data of the household isn't returned", func(t *testing.T) {
+				_, err := mgr.GetTank(context.Background(), tank.ID)
+				assert.IsType(t, &db.ErrNotFound{}, err)
+			})
+		})
+
+		t.Run("When the household lists its data", func(t *testing.T) {
+			t.Run("Then its data is returned", func(t *testing.T) {
+				tanks, err := mgr.ListTanks(ctxA)
+				assert.NoError(t, err)
+				assert.Equal(t, []db.Tank{tank}, tanks)
+			})
+		})
+	})
+}
@@ -0,0 +1,361 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Individual is a Fish which is tracked on its own rather than as part of a group, e.g. a
+// betta or a cichlid. Its Fish record always has a Count of one until it is merged back
+// into a group.
+type Individual struct {
+	Fish             Fish
+	Name             string
+	IdentifyingMarks string
+	BirthDate        *time.Time
+	// PhotoAttachmentID is the attachment used as the profile photo of the individual
+	PhotoAttachmentID *int32
+	// GroupID is the group the individual was split from, or merged into
+	GroupID  *int32
+	MergedAt *time.Time
+}
+
+// IndividualFilter restricts the individuals returned by ListIndividuals. Nil fields are ignored.
+type IndividualFilter struct {
+	TankID        *int32
+	GroupID       *int32
+	IncludeMerged bool
+}
+
+const individualSelect = `SELECT f.id, f.tank_id, f.type, f.subtype, f.color, f.gender, f.purchase_date, f.count,
+	p.name, p.identifying_marks, p.birth_date, p.photo_attachment_id, p.group_id, p.merged_at
+FROM fish f
+JOIN fish_profiles p ON p.fish_id = f.id`
+
+func scanIndividual(row pgx.Row, i *Individual) error {
+	return row.Scan(
+		&i.Fish.ID, &i.Fish.TankID, &i.Fish.Type, &i.Fish.Subtype, &i.Fish.Color, &i.Fish.Gender, &i.Fish.PurchaseDate, &i.Fish.Count,
+		&i.Name, &i.IdentifyingMarks, &i.BirthDate, &i.PhotoAttachmentID, &i.GroupID, &i.MergedAt,
+	)
+}
+
+// insertIndividual adds the fish record and profile of an individual within tx
+func insertIndividual(ctx context.Context, tx pgx.Tx, individual Individual) (Individual, error) {
+	i := Individual{}
+
+	var id int32
+	err := tx.QueryRow(
+		ctx,
+		"INSERT INTO fish(tank_id, type, subtype, color, gender, purchase_date, count) VALUES($1, $2, $3, $4, $5, $6, 1) RETURNING id",
+		individual.Fish.TankID, individual.Fish.Type, individual.Fish.Subtype, individual.Fish.Color, individual.Fish.Gender, individual.Fish.PurchaseDate,
+	).Scan(&id)
+	if err != nil {
+		return i, errors.Wrap(err, "unable to add fish")
+	}
+
+	if _, err := tx.Exec(
+		ctx,
+		"INSERT INTO fish_profiles(fish_id, name, identifying_marks, birth_date, group_id) VALUES($1, $2, $3, $4, $5)",
+		id, individual.Name, individual.IdentifyingMarks, individual.BirthDate, individual.GroupID,
+	); err != nil {
+		return i, errors.Wrap(err, "unable to add fish profile")
+	}
+
+	if err := scanIndividual(tx.QueryRow(ctx, individualSelect+" WHERE f.id=$1", id), &i); err != nil {
+		return i, errors.Wrap(err, "unable to get individual")
+	}
+
+	return i, nil
+}
+
+func (d *Manager) InsertIndividual(ctx context.Context, individual Individual) (Individual, error) {
+	i := Individual{}
+
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return i, errors.Wrap(err, "unable to begin transaction")
+	}
+	defer tx.Rollback(ctx) // #nosec G104 -- no-op after commit
+
+	if i, err = insertIndividual(ctx, tx, individual); err != nil {
+		return i, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return i, errors.Wrap(err, "unable to commit individual")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id": i.Fish.ID,
+	}).Info("Individual inserted successfully")
+
+	return i, nil
+}
+
+func (d *Manager) GetIndividual(ctx context.Context, id int32) (Individual, error) {
+	i := Individual{}
+
+	if err := scanIndividual(d.pool.QueryRow(ctx, individualSelect+" WHERE f.id=$1 AND f.deleted_at IS NULL", id), &i); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return i, &ErrNotFound{message: "individual not found"}
+		}
+
+		return i, errors.Wrap(err, "unable to get individual")
+	}
+
+	return i, nil
+}
+
+func (d *Manager) ListIndividuals(ctx context.Context, filter IndividualFilter) ([]Individual, error) {
+	individuals := make([]Individual, 0)
+
+	rows, err := d.pool.Query(
+		ctx,
+		individualSelect+` WHERE f.deleted_at IS NULL AND ($1::INT IS NULL OR f.tank_id=$1) AND ($2::INT IS NULL OR p.group_id=$2) AND ($3 OR p.merged_at IS NULL)
+		ORDER BY p.name, f.id`,
+		filter.TankID, filter.GroupID, filter.IncludeMerged,
+	)
+	if err != nil {
+		return individuals, errors.Wrap(err, "unable to get individuals")
+	}
+
+	rowCount := 0
+	for rows.Next() {
+		i := Individual{}
+
+		if err := scanIndividual(rows, &i); err != nil {
+			return nil, errors.Wrap(err, "unable to scan row")
+		}
+
+		individuals = append(individuals, i)
+
+		rowCount++
+	}
+
+	if rows.Err() != nil {
+		return nil, errors.Wrap(rows.Err(), "erroring reading rows")
+	}
+
+	logrus.WithFields(logrus.Fields{"rowCount": rowCount}).Info("Individuals queried successfully")
+
+	return individuals, nil
+}
+
+// UpdateIndividual updates the profile of an individual. The photo must be an attachment
+// of the individual.
+func (d *Manager) UpdateIndividual(ctx context.Context, individual Individual) (Individual, error) {
+	i := Individual{}
+
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return i, errors.Wrap(err, "unable to begin transaction")
+	}
+	defer tx.Rollback(ctx) // #nosec G104 -- no-op after commit
+
+	if individual.PhotoAttachmentID != nil {
+		var ok bool
+		if err := tx.QueryRow(
+			ctx,
+			"SELECT EXISTS(SELECT 1 FROM attachments WHERE id=$1 AND fish_id=$2)",
+			individual.PhotoAttachmentID, individual.Fish.ID,
+		).Scan(&ok); err != nil {
+			return i, errors.Wrap(err, "unable to get photo attachment")
+		}
+
+		if !ok {
+			return i, &ErrConflict{message: "photo is not an attachment of the individual"}
+		}
+	}
+
+	tag, err := tx.Exec(
+		ctx,
+		"UPDATE fish_profiles SET name=$2, identifying_marks=$3, birth_date=$4, photo_attachment_id=$5, updated_at=NOW() WHERE fish_id=$1",
+		individual.Fish.ID, individual.Name, individual.IdentifyingMarks, individual.BirthDate, individual.PhotoAttachmentID,
+	)
+	if err != nil {
+		return i, errors.Wrap(err, "unable to update individual")
+	}
+
+	if tag.RowsAffected() == 0 {
+		return i, &ErrNotFound{message: "individual not found"}
+	}
+
+	if err := scanIndividual(tx.QueryRow(ctx, individualSelect+" WHERE f.id=$1", individual.Fish.ID), &i); err != nil {
+		return i, errors.Wrap(err, "unable to get individual")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return i, errors.Wrap(err, "unable to commit individual")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id": i.Fish.ID,
+	}).Info("Individual updated successfully")
+
+	return i, nil
+}
+
+// lockGroup returns the group with the given id, locking it for the rest of tx. Individuals
+// aren't groups so can't be split or merged into.
+func lockGroup(ctx context.Context, tx pgx.Tx, id int32) (Fish, error) {
+	f := Fish{}
+
+	var individual bool
+	err := tx.QueryRow(
+		ctx,
+		`SELECT id, tank_id, type, subtype, color, gender, purchase_date, count, EXISTS(SELECT 1 FROM fish_profiles WHERE fish_id=fish.id)
+		FROM fish WHERE id=$1 AND deleted_at IS NULL FOR UPDATE`,
+		id,
+	).Scan(&f.ID, &f.TankID, &f.Type, &f.Subtype, &f.Color, &f.Gender, &f.PurchaseDate, &f.Count, &individual)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return f, &ErrNotFound{message: "fish not found"}
+		}
+
+		return f, errors.Wrap(err, "unable to get fish")
+	}
+
+	if individual {
+		return f, &ErrConflict{message: "fish is an individual, not a group"}
+	}
+
+	return f, nil
+}
+
+// SplitFish creates an individual for each of individuals from the group, reducing the
+// count of the group accordingly. The individuals inherit the tank, type, subtype, color,
+// purchase date and, unless provided, gender of the group.
+func (d *Manager) SplitFish(ctx context.Context, groupID int32, individuals []Individual) ([]Individual, error) {
+	split := make([]Individual, 0, len(individuals))
+
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to begin transaction")
+	}
+	defer tx.Rollback(ctx) // #nosec G104 -- no-op after commit
+
+	group, err := lockGroup(ctx, tx, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	if int(group.Count) < len(individuals) {
+		return nil, &ErrConflict{message: "group doesn't contain enough fish"}
+	}
+
+	for _, individual := range individuals {
+		f := group
+		if individual.Fish.Gender != "" {
+			f.Gender = individual.Fish.Gender
+		}
+
+		individual.Fish = f
+		individual.GroupID = &group.ID
+
+		i, err := insertIndividual(ctx, tx, individual)
+		if err != nil {
+			return nil, err
+		}
+
+		split = append(split, i)
+	}
+
+	if _, err := tx.Exec(ctx, "UPDATE fish SET count=count-$2, updated_at=NOW() WHERE id=$1", groupID, len(individuals)); err != nil {
+		return nil, errors.Wrap(err, "unable to update group count")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, errors.Wrap(err, "unable to commit split")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id":       groupID,
+		"rowCount": len(split),
+	}).Info("Fish split successfully")
+
+	return split, nil
+}
+
+// lockIndividuals locks those of the individuals which haven't been deleted or merged and
+// are of the same type and subtype as the group for the rest of tx, returning how many
+// there are. Locking them stops them being merged again by a concurrent merge.
+func lockIndividuals(ctx context.Context, tx pgx.Tx, group Fish, individualIDs []int32) (int, error) {
+	rows, err := tx.Query(
+		ctx,
+		`SELECT f.id FROM fish f JOIN fish_profiles p ON p.fish_id = f.id
+		WHERE f.id = ANY($1) AND f.deleted_at IS NULL AND p.merged_at IS NULL AND f.type=$2 AND f.subtype=$3
+		FOR UPDATE`,
+		individualIDs, group.Type, group.Subtype,
+	)
+	if err != nil {
+		return 0, errors.Wrap(err, "unable to get individuals")
+	}
+	defer rows.Close()
+
+	matched := 0
+	for rows.Next() {
+		matched++
+	}
+
+	if rows.Err() != nil {
+		return 0, errors.Wrap(rows.Err(), "unable to get individuals")
+	}
+
+	return matched, nil
+}
+
+// MergeFish merges the individuals back into the group, increasing its count. The
+// individuals are kept, with a count of zero, so their history isn't lost.
+func (d *Manager) MergeFish(ctx context.Context, groupID int32, individualIDs []int32) (Fish, error) {
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return Fish{}, errors.Wrap(err, "unable to begin transaction")
+	}
+	defer tx.Rollback(ctx) // #nosec G104 -- no-op after commit
+
+	group, err := lockGroup(ctx, tx, groupID)
+	if err != nil {
+		return group, err
+	}
+
+	matched, err := lockIndividuals(ctx, tx, group, individualIDs)
+	if err != nil {
+		return group, err
+	}
+
+	if matched != len(individualIDs) {
+		return group, &ErrConflict{message: "individuals must exist, be unmerged and be of the same type and subtype as the group"}
+	}
+
+	if _, err := tx.Exec(ctx, "UPDATE fish SET count=0, updated_at=NOW() WHERE id = ANY($1)", individualIDs); err != nil {
+		return group, errors.Wrap(err, "unable to update individuals")
+	}
+
+	if _, err := tx.Exec(ctx, "UPDATE fish_profiles SET group_id=$2, merged_at=NOW(), updated_at=NOW() WHERE fish_id = ANY($1)", individualIDs, groupID); err != nil {
+		return group, errors.Wrap(err, "unable to update individual profiles")
+	}
+
+	err = tx.QueryRow(
+		ctx,
+		"UPDATE fish SET count=count+$2, updated_at=NOW() WHERE id=$1 RETURNING count",
+		groupID, len(individualIDs),
+	).Scan(&group.Count)
+	if err != nil {
+		return group, errors.Wrap(err, "unable to update group count")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return group, errors.Wrap(err, "unable to commit merge")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id":       groupID,
+		"rowCount": len(individualIDs),
+	}).Info("Fish merged successfully")
+
+	return group, nil
+}
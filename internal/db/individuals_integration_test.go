@@ -0,0 +1,169 @@
+//go:build integration
+// +build integration
+
+package db_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openlyinc/pointy"
+	"github.com/stretchr/testify/assert"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+func TestIndividuals(t *testing.T) {
+	t.Run("Given a group of cichlids", func(t *testing.T) {
+		var split []db.Individual
+
+		tank, err := mgr.InsertTank(context.Background(), db.Tank{Name: "Cichlids"})
+		assert.NoError(t, err)
+
+		group, err := mgr.InsertFish(context.Background(), db.Fish{TankID: &tank.ID, Type: "Cichlid", Subtype: "Yellow Lab", Gender: "UNSPECIFIED", Count: 3})
+		assert.NoError(t, err)
+
+		t.Run("When the group is split into more individuals than it contains", func(t *testing.T) {
+			t.Run("Then a conflict is returned", func(t *testing.T) {
+				_, err := mgr.SplitFish(context.Background(), group.ID, make([]db.Individual, 4))
+				assert.IsType(t, &db.ErrConflict{}, err)
+			})
+		})
+
+		t.Run("When SplitFish is called", func(t *testing.T) {
+			t.Run("Then individuals are created from the group", func(t *testing.T) {
+				split, err = mgr.SplitFish(context.Background(), group.ID, []db.Individual{
+					{Name: "Sunny", IdentifyingMarks: "Notch in dorsal fin", Fish: db.Fish{Gender: "MALE"}},
+					{Name: "Lemon"},
+				})
+				assert.NoError(t, err)
+
+				assert.Len(t, split, 2)
+				assert.Equal(t, "Sunny", split[0].Name)
+				assert.Equal(t, "MALE", split[0].Fish.Gender)
+				assert.Equal(t, "UNSPECIFIED", split[1].Fish.Gender)
+				assert.Equal(t, "Yellow Lab", split[1].Fish.Subtype)
+				assert.Equal(t, tank.ID, *split[1].Fish.TankID)
+				assert.Equal(t, int32(1), split[1].Fish.Count)
+				assert.Equal(t, group.ID, *split[1].GroupID)
+
+				g, err := mgr.GetFish(context.Background(), group.ID)
+				assert.NoError(t, err)
+				assert.Equal(t, int32(1), g.Count)
+			})
+		})
+
+		t.Run("When an individual is split", func(t *testing.T) {
+			t.Run("Then a conflict is returned", func(t *testing.T) {
+				_, err := mgr.SplitFish(context.Background(), split[0].Fish.ID, []db.Individual{{Name: "Sunny Jr"}})
+				assert.IsType(t, &db.ErrConflict{}, err)
+			})
+		})
+
+		t.Run("When UpdateIndividual is called with a photo of another fish", func(t *testing.T) {
+			t.Run("Then a conflict is returned", func(t *testing.T) {
+				a, err := mgr.InsertAttachment(context.Background(), db.Attachment{FishID: &split[1].Fish.ID, ContentType: "image/jpeg", BlobKey: "a", ThumbnailKey: "b"})
+				assert.NoError(t, err)
+
+				_, err = mgr.UpdateIndividual(context.Background(), db.Individual{Fish: db.Fish{ID: split[0].Fish.ID}, Name: "Sunny", PhotoAttachmentID: &a.ID})
+				assert.IsType(t, &db.ErrConflict{}, err)
+
+				i, err := mgr.UpdateIndividual(context.Background(), db.Individual{Fish: db.Fish{ID: split[1].Fish.ID}, Name: "Lemon", PhotoAttachmentID: &a.ID})
+				assert.NoError(t, err)
+				assert.Equal(t, a.ID, *i.PhotoAttachmentID)
+			})
+		})
+
+		t.Run("When measurements are recorded", func(t *testing.T) {
+			t.Run("Then they are returned oldest first", func(t *testing.T) {
+				_, err := mgr.InsertMeasurement(context.Background(), db.Measurement{FishID: split[0].Fish.ID, MeasuredAt: time.Now(), LengthCm: pointy.Float32(6.5)})
+				assert.NoError(t, err)
+				_, err = mgr.InsertMeasurement(context.Background(), db.Measurement{FishID: split[0].Fish.ID, MeasuredAt: time.Now().AddDate(0, -1, 0), LengthCm: pointy.Float32(5), WeightG: pointy.Float32(4)})
+				assert.NoError(t, err)
+
+				m, err := mgr.ListMeasurements(context.Background(), split[0].Fish.ID)
+				assert.NoError(t, err)
+				assert.Len(t, m, 2)
+				assert.Equal(t, float32(5), *m[0].LengthCm)
+				assert.Nil(t, m[1].WeightG)
+			})
+		})
+
+		t.Run("When MergeFish is called", func(t *testing.T) {
+			t.Run("Then the individuals are merged back into the group", func(t *testing.T) {
+				g, err := mgr.MergeFish(context.Background(), group.ID, []int32{split[0].Fish.ID, split[1].Fish.ID})
+				assert.NoError(t, err)
+				assert.Equal(t, int32(3), g.Count)
+
+				i, err := mgr.ListIndividuals(context.Background(), db.IndividualFilter{GroupID: &group.ID})
+				assert.NoError(t, err)
+				assert.Empty(t, i)
+
+				i, err = mgr.ListIndividuals(context.Background(), db.IndividualFilter{GroupID: &group.ID, IncludeMerged: true})
+				assert.NoError(t, err)
+				assert.Len(t, i, 2)
+				assert.NotNil(t, i[0].MergedAt)
+				assert.Equal(t, int32(0), i[0].Fish.Count)
+
+				m, err := mgr.ListMeasurements(context.Background(), split[0].Fish.ID)
+				assert.NoError(t, err)
+				assert.Len(t, m, 2)
+			})
+		})
+
+		t.Run("When an individual is merged twice", func(t *testing.T) {
+			t.Run("Then a conflict is returned", func(t *testing.T) {
+				_, err := mgr.MergeFish(context.Background(), group.ID, []int32{split[0].Fish.ID})
+				assert.IsType(t, &db.ErrConflict{}, err)
+			})
+		})
+
+		t.Run("When a deleted individual is merged", func(t *testing.T) {
+			t.Run("Then a conflict is returned", func(t *testing.T) {
+				deleted, err := mgr.SplitFish(context.Background(), group.ID, []db.Individual{{Name: "Gone"}})
+				assert.NoError(t, err)
+
+				_, err = mgr.DeleteFish(context.Background(), deleted[0].Fish.ID)
+				assert.NoError(t, err)
+
+				_, err = mgr.MergeFish(context.Background(), group.ID, []int32{deleted[0].Fish.ID})
+				assert.IsType(t, &db.ErrConflict{}, err)
+			})
+		})
+
+		t.Run("When an individual is merged concurrently", func(t *testing.T) {
+			t.Run("Then it's only merged once", func(t *testing.T) {
+				individual, err := mgr.SplitFish(context.Background(), group.ID, []db.Individual{{Name: "Twice"}})
+				assert.NoError(t, err)
+				split = append(split, individual...)
+
+				var wg sync.WaitGroup
+				errs := make([]error, 2)
+				for n := range errs {
+					wg.Add(1)
+					go func(n int) {
+						defer wg.Done()
+						_, errs[n] = mgr.MergeFish(context.Background(), group.ID, []int32{individual[0].Fish.ID})
+					}(n)
+				}
+				wg.Wait()
+
+				assert.True(t, (errs[0] == nil) != (errs[1] == nil))
+
+				g, err := mgr.GetFish(context.Background(), group.ID)
+				assert.NoError(t, err)
+				assert.Equal(t, int32(2), g.Count)
+			})
+		})
+
+		for _, i := range split {
+			_, err = mgr.DeleteFish(context.Background(), i.Fish.ID)
+			assert.NoError(t, err)
+		}
+		_, err = mgr.DeleteFish(context.Background(), group.ID)
+		assert.NoError(t, err)
+		_, err = mgr.DeleteTank(context.Background(), tank.ID)
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,149 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Invite grants a role in a household to whoever signs up with its code. Only a hash of
+// the code is stored.
+type Invite struct {
+	ID          int32
+	HouseholdID int32
+	Role        string
+	CreatedBy   int32
+	ExpiresAt   time.Time
+	AcceptedBy  *int32
+	AcceptedAt  *time.Time
+	CreatedAt   time.Time
+}
+
+const inviteColumns = "id, household_id, role, created_by, expires_at, accepted_by, accepted_at, created_at"
+
+func scanInvite(row pgx.Row, i *Invite) error {
+	return row.Scan(&i.ID, &i.HouseholdID, &i.Role, &i.CreatedBy, &i.ExpiresAt, &i.AcceptedBy, &i.AcceptedAt, &i.CreatedAt)
+}
+
+func (d *Manager) InsertInvite(ctx context.Context, invite Invite, codeHash string) (Invite, error) {
+	i := Invite{}
+
+	err := scanInvite(d.pool.QueryRow(
+		ctx,
+		"INSERT INTO invites(household_id, role, created_by, expires_at, code_hash) VALUES($1, $2, $3, $4, $5) RETURNING "+inviteColumns,
+		invite.HouseholdID, invite.Role, invite.CreatedBy, invite.ExpiresAt, codeHash,
+	), &i)
+	if err != nil {
+		return i, errors.Wrap(err, "unable to add invite")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id":          i.ID,
+		"householdId": i.HouseholdID,
+		"role":        i.Role,
+	}).Info("Invite inserted successfully")
+
+	return i, nil
+}
+
+// ListInvites returns the invites of a household, newest first
+func (d *Manager) ListInvites(ctx context.Context, householdID int32) ([]Invite, error) {
+	invites := make([]Invite, 0)
+
+	rows, err := d.pool.Query(ctx, "SELECT "+inviteColumns+" FROM invites WHERE household_id=$1 ORDER BY created_at DESC, id DESC", householdID)
+	if err != nil {
+		return invites, errors.Wrap(err, "unable to get invites")
+	}
+
+	rowCount := 0
+	for rows.Next() {
+		i := Invite{}
+
+		if err := scanInvite(rows, &i); err != nil {
+			return nil, errors.Wrap(err, "unable to scan row")
+		}
+
+		invites = append(invites, i)
+
+		rowCount++
+	}
+
+	if rows.Err() != nil {
+		return nil, errors.Wrap(rows.Err(), "erroring reading rows")
+	}
+
+	logrus.WithFields(logrus.Fields{"rowCount": rowCount}).Info("Invites queried successfully")
+
+	return invites, nil
+}
+
+// DeleteInvite revokes an invite of a household
+func (d *Manager) DeleteInvite(ctx context.Context, householdID, id int32) (Invite, error) {
+	i := Invite{}
+
+	err := scanInvite(d.pool.QueryRow(ctx, "DELETE FROM invites WHERE household_id=$1 AND id=$2 RETURNING "+inviteColumns, householdID, id), &i)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return i, &ErrNotFound{message: "invite not found"}
+		}
+
+		return i, errors.Wrap(err, "unable to delete invite")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id": i.ID,
+	}).Info("Invite deleted successfully")
+
+	return i, nil
+}
+
+// AcceptInvite adds user to the household of the unexpired, unaccepted invite with the
+// code hash, with the role of the invite. An invite can only be accepted once.
+func (d *Manager) AcceptInvite(ctx context.Context, codeHash string, user User) (User, error) {
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return User{}, errors.Wrap(err, "unable to begin transaction")
+	}
+	defer tx.Rollback(ctx) // #nosec G104 -- no-op after commit
+
+	i := Invite{}
+
+	err = scanInvite(tx.QueryRow(
+		ctx,
+		"SELECT "+inviteColumns+" FROM invites WHERE code_hash=$1 AND accepted_at IS NULL AND expires_at > NOW() FOR UPDATE",
+		codeHash,
+	), &i)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return User{}, &ErrNotFound{message: "invite not found or expired"}
+		}
+
+		return User{}, errors.Wrap(err, "unable to get invite")
+	}
+
+	user.HouseholdID, user.Role = i.HouseholdID, i.Role
+
+	u, err := insertUser(ctx, tx, user)
+	if err != nil {
+		return u, err
+	}
+
+	if _, err := tx.Exec(ctx, "UPDATE invites SET accepted_by=$2, accepted_at=NOW(), updated_at=NOW() WHERE id=$1", i.ID, u.ID); err != nil {
+		return User{}, errors.Wrap(err, "unable to accept invite")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return User{}, errors.Wrap(err, "unable to commit transaction")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id":          u.ID,
+		"householdId": u.HouseholdID,
+		"inviteId":    i.ID,
+	}).Info("Invite accepted successfully")
+
+	return u, nil
+}
@@ -0,0 +1,100 @@
+//go:build integration
+// +build integration
+
+package db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+func TestInvites(t *testing.T) {
+	t.Run("Given a household with an invite", func(t *testing.T) {
+		ctx := context.Background()
+
+		owner, err := mgr.InsertUser(ctx, db.User{Username: "invite-owner", PasswordHash: "hash"}, "Invites")
+		assert.NoError(t, err)
+
+		invite, err := mgr.InsertInvite(ctx, db.Invite{HouseholdID: owner.HouseholdID, Role: "EDITOR", CreatedBy: owner.ID, ExpiresAt: time.Now().Add(time.Hour)}, "valid-hash")
+		assert.NoError(t, err)
+
+		_, err = mgr.InsertInvite(ctx, db.Invite{HouseholdID: owner.HouseholdID, Role: "VIEWER", CreatedBy: owner.ID, ExpiresAt: time.Now().Add(-time.Hour)}, "expired-hash")
+		assert.NoError(t, err)
+
+		var editor db.User
+
+		t.Run("When it is accepted", func(t *testing.T) {
+			t.Run("Then the user is added to the household with the role of the invite", func(t *testing.T) {
+				editor, err = mgr.AcceptInvite(ctx, "valid-hash", db.User{Username: "invite-editor", PasswordHash: "hash"})
+				assert.NoError(t, err)
+				assert.Equal(t, owner.HouseholdID, editor.HouseholdID)
+				assert.Equal(t, "EDITOR", editor.Role)
+
+				invites, err := mgr.ListInvites(ctx, owner.HouseholdID)
+				assert.NoError(t, err)
+				assert.Len(t, invites, 2)
+				assert.Equal(t, &editor.ID, invites[1].AcceptedBy)
+			})
+		})
+
+		t.Run("When it is accepted again", func(t *testing.T) {
+			t.Run("Then it isn't found", func(t *testing.T) {
+				_, err := mgr.AcceptInvite(ctx, "valid-hash", db.User{Username: "invite-again", PasswordHash: "hash"})
+				assert.IsType(t, &db.ErrNotFound{}, err)
+			})
+		})
+
+		t.Run("When an expired invite is accepted", func(t *testing.T) {
+			t.Run("Then it isn't found", func(t *testing.T) {
+				_, err := mgr.AcceptInvite(ctx, "expired-hash", db.User{Username: "invite-expired", PasswordHash: "hash"})
+				assert.IsType(t, &db.ErrNotFound{}, err)
+			})
+		})
+
+		t.Run("When the only owner is demoted or deleted", func(t *testing.T) {
+			t.Run("Then a conflict is returned", func(t *testing.T) {
+				_, err := mgr.UpdateUserRole(ctx, owner.HouseholdID, owner.ID, "VIEWER")
+				assert.IsType(t, &db.ErrConflict{}, err)
+
+				_, err = mgr.DeleteUser(ctx, owner.HouseholdID, owner.ID)
+				assert.IsType(t, &db.ErrConflict{}, err)
+			})
+		})
+
+		t.Run("When another user is made an owner", func(t *testing.T) {
+			t.Run("Then the original owner can be demoted", func(t *testing.T) {
+				_, err := mgr.UpdateUserRole(ctx, owner.HouseholdID, editor.ID, "OWNER")
+				assert.NoError(t, err)
+
+				u, err := mgr.UpdateUserRole(ctx, owner.HouseholdID, owner.ID, "VIEWER")
+				assert.NoError(t, err)
+				assert.Equal(t, "VIEWER", u.Role)
+
+				users, err := mgr.ListUsers(ctx, owner.HouseholdID)
+				assert.NoError(t, err)
+				assert.Len(t, users, 2)
+			})
+		})
+
+		t.Run("When a user of another household is deleted", func(t *testing.T) {
+			t.Run("Then it isn't found", func(t *testing.T) {
+				_, err := mgr.DeleteUser(ctx, owner.HouseholdID+1000, editor.ID)
+				assert.Error(t, err)
+			})
+		})
+
+		t.Run("When the invite is revoked", func(t *testing.T) {
+			t.Run("Then it is deleted", func(t *testing.T) {
+				_, err := mgr.DeleteInvite(ctx, owner.HouseholdID, invite.ID)
+				assert.NoError(t, err)
+
+				_, err = mgr.DeleteInvite(ctx, owner.HouseholdID, invite.ID)
+				assert.IsType(t, &db.ErrNotFound{}, err)
+			})
+		})
+	})
+}
@@ -0,0 +1,165 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// JournalEntry is a dated, free-text note about either a Tank or a Fish, such as an
+// observation, treatment or rescape
+type JournalEntry struct {
+	ID        int32
+	TankID    *int32
+	FishID    *int32
+	EntryDate time.Time
+	Category  string
+	Title     string
+	Body      string
+	CreatedAt time.Time
+}
+
+// JournalFilter restricts the journal entries returned by ListJournalEntries and SearchNotes.
+// Nil fields are ignored.
+type JournalFilter struct {
+	TankID *int32
+	FishID *int32
+}
+
+// NoteHit is a single result from SearchNotes
+type NoteHit struct {
+	Entry JournalEntry
+	// Rank is the relevance of the entry to the query, higher is more relevant
+	Rank float32
+	// Snippet is an HTML escaped extract of the body with matching terms wrapped in
+	// <mark></mark>, so it can be rendered as HTML
+	Snippet string
+}
+
+const journalColumns = "id, tank_id, fish_id, entry_date, category, title, body, created_at"
+
+// escapedBody is the body of a journal entry with the HTML special characters escaped,
+// so the only markup in a snippet highlighted by ts_headline is its own <mark></mark>
+const escapedBody = `replace(replace(replace(replace(replace(body, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&quot;'), '''', '&#39;')`
+
+func scanJournalEntry(row pgx.Row, j *JournalEntry, extra ...interface{}) error {
+	return row.Scan(append([]interface{}{&j.ID, &j.TankID, &j.FishID, &j.EntryDate, &j.Category, &j.Title, &j.Body, &j.CreatedAt}, extra...)...)
+}
+
+func (d *Manager) InsertJournalEntry(ctx context.Context, entry JournalEntry) (JournalEntry, error) {
+	j := JournalEntry{}
+
+	err := scanJournalEntry(d.pool.QueryRow(
+		ctx,
+		"INSERT INTO journal_entries(tank_id, fish_id, entry_date, category, title, body) VALUES($1, $2, $3, $4, $5, $6) RETURNING "+journalColumns,
+		entry.TankID, entry.FishID, entry.EntryDate, entry.Category, entry.Title, entry.Body,
+	), &j)
+	if err != nil {
+		return j, errors.Wrap(err, "unable to add journal entry")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id": j.ID,
+	}).Info("Journal Entry inserted successfully")
+
+	return j, nil
+}
+
+func (d *Manager) ListJournalEntries(ctx context.Context, filter JournalFilter) ([]JournalEntry, error) {
+	entries := make([]JournalEntry, 0)
+
+	rows, err := d.pool.Query(
+		ctx,
+		"SELECT "+journalColumns+" FROM journal_entries WHERE ($1::INT IS NULL OR tank_id=$1) AND ($2::INT IS NULL OR fish_id=$2) ORDER BY entry_date DESC, id DESC",
+		filter.TankID, filter.FishID,
+	)
+	if err != nil {
+		return entries, errors.Wrap(err, "unable to get journal entries")
+	}
+
+	rowCount := 0
+	for rows.Next() {
+		j := JournalEntry{}
+
+		if err := scanJournalEntry(rows, &j); err != nil {
+			return nil, errors.Wrap(err, "unable to scan row")
+		}
+
+		entries = append(entries, j)
+
+		rowCount++
+	}
+
+	if rows.Err() != nil {
+		return nil, errors.Wrap(rows.Err(), "erroring reading rows")
+	}
+
+	logrus.WithFields(logrus.Fields{"rowCount": rowCount}).Info("Journal Entries queried successfully")
+
+	return entries, nil
+}
+
+func (d *Manager) DeleteJournalEntry(ctx context.Context, id int32) (JournalEntry, error) {
+	j := JournalEntry{}
+
+	err := scanJournalEntry(d.pool.QueryRow(ctx, "DELETE FROM journal_entries WHERE id=$1 RETURNING "+journalColumns, id), &j)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return j, &ErrNotFound{message: "journal entry not found"}
+		}
+
+		return j, errors.Wrap(err, "unable to delete journal entry")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id": j.ID,
+	}).Info("Journal Entry deleted successfully")
+
+	return j, nil
+}
+
+// SearchNotes performs a full-text search of journal entry titles and bodies, returning
+// at most limit hits ordered by relevance. The query supports the web search syntax of
+// websearch_to_tsquery, e.g. quoted phrases, "or" and -exclusions.
+func (d *Manager) SearchNotes(ctx context.Context, query string, filter JournalFilter, limit int32) ([]NoteHit, error) {
+	hits := make([]NoteHit, 0)
+
+	rows, err := d.pool.Query(
+		ctx,
+		`SELECT `+journalColumns+`,
+			ts_rank(search_vector, q) AS rank,
+			ts_headline('english', `+escapedBody+`, q, 'StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=30, MinWords=10')
+		FROM journal_entries, websearch_to_tsquery('english', $1) q
+		WHERE search_vector @@ q AND ($2::INT IS NULL OR tank_id=$2) AND ($3::INT IS NULL OR fish_id=$3)
+		ORDER BY rank DESC, entry_date DESC
+		LIMIT $4`,
+		query, filter.TankID, filter.FishID, limit,
+	)
+	if err != nil {
+		return hits, errors.Wrap(err, "unable to search notes")
+	}
+
+	rowCount := 0
+	for rows.Next() {
+		h := NoteHit{}
+
+		if err := scanJournalEntry(rows, &h.Entry, &h.Rank, &h.Snippet); err != nil {
+			return nil, errors.Wrap(err, "unable to scan row")
+		}
+
+		hits = append(hits, h)
+
+		rowCount++
+	}
+
+	if rows.Err() != nil {
+		return nil, errors.Wrap(rows.Err(), "erroring reading rows")
+	}
+
+	logrus.WithFields(logrus.Fields{"rowCount": rowCount}).Info("Notes searched successfully")
+
+	return hits, nil
+}
@@ -0,0 +1,134 @@
+//go:build integration
+// +build integration
+
+package db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+func TestJournal(t *testing.T) {
+	t.Run("Given Journal Entries for a Tank", func(t *testing.T) {
+		tank, err := mgr.InsertTank(context.Background(), db.Tank{Name: "Journaled"})
+		assert.NoError(t, err)
+
+		entries := []db.JournalEntry{
+			{
+				TankID:    &tank.ID,
+				EntryDate: time.Date(2021, 8, 1, 0, 0, 0, 0, time.UTC),
+				Category:  "OBSERVATION",
+				Title:     "White spots",
+				Body:      "Noticed white spots on the fins of two of the tetras, possibly ich.",
+			},
+			{
+				TankID:    &tank.ID,
+				EntryDate: time.Date(2021, 8, 2, 0, 0, 0, 0, time.UTC),
+				Category:  "TREATMENT",
+				Title:     "Started ich treatment",
+				Body:      "Raised the temperature and started a course of medication.",
+			},
+			{
+				TankID:    &tank.ID,
+				EntryDate: time.Date(2021, 8, 10, 0, 0, 0, 0, time.UTC),
+				Category:  "RESCAPE",
+				Title:     "Rescape",
+				Body:      "Moved the driftwood and added more plants.",
+			},
+		}
+
+		inserted := make([]db.JournalEntry, len(entries))
+
+		t.Run("When they are passed to InsertJournalEntry", func(t *testing.T) {
+			t.Run("Then the records are created without error", func(t *testing.T) {
+				for i, e := range entries {
+					inserted[i], err = mgr.InsertJournalEntry(context.Background(), e)
+					assert.NoError(t, err)
+
+					assert.Equal(t, e.TankID, inserted[i].TankID)
+					assert.True(t, e.EntryDate.Equal(inserted[i].EntryDate))
+					assert.Equal(t, e.Category, inserted[i].Category)
+					assert.Equal(t, e.Title, inserted[i].Title)
+					assert.Equal(t, e.Body, inserted[i].Body)
+				}
+			})
+		})
+
+		t.Run("When ListJournalEntries is called", func(t *testing.T) {
+			t.Run("Then the entries are returned newest first", func(t *testing.T) {
+				j, err := mgr.ListJournalEntries(context.Background(), db.JournalFilter{TankID: &tank.ID})
+				assert.NoError(t, err)
+
+				assert.Len(t, j, 3)
+				assert.Equal(t, inserted[2].ID, j[0].ID)
+				assert.Equal(t, inserted[1].ID, j[1].ID)
+				assert.Equal(t, inserted[0].ID, j[2].ID)
+			})
+		})
+
+		t.Run("When SearchNotes is called", func(t *testing.T) {
+			t.Run("Then the matching entries are returned ranked with highlighted snippets", func(t *testing.T) {
+				hits, err := mgr.SearchNotes(context.Background(), "ich", db.JournalFilter{TankID: &tank.ID}, 10)
+				assert.NoError(t, err)
+
+				assert.Len(t, hits, 2)
+
+				// The title match is weighted higher than the body match
+				assert.Equal(t, inserted[1].ID, hits[0].Entry.ID)
+				assert.Equal(t, inserted[0].ID, hits[1].Entry.ID)
+				assert.GreaterOrEqual(t, hits[0].Rank, hits[1].Rank)
+				assert.Contains(t, hits[1].Snippet, "<mark>ich</mark>")
+			})
+		})
+
+		t.Run("When SearchNotes matches an entry containing HTML", func(t *testing.T) {
+			t.Run("Then the snippet is escaped", func(t *testing.T) {
+				e, err := mgr.InsertJournalEntry(context.Background(), db.JournalEntry{
+					TankID:    &tank.ID,
+					EntryDate: time.Date(2021, 8, 11, 0, 0, 0, 0, time.UTC),
+					Category:  "OBSERVATION",
+					Title:     "Snails",
+					Body:      `Found snails <script>alert("snails")</script> & 'more' snails`,
+				})
+				assert.NoError(t, err)
+				defer func() { _, _ = mgr.DeleteJournalEntry(context.Background(), e.ID) }()
+
+				hits, err := mgr.SearchNotes(context.Background(), "alert", db.JournalFilter{TankID: &tank.ID}, 10)
+				assert.NoError(t, err)
+
+				assert.Len(t, hits, 1)
+				assert.NotContains(t, hits[0].Snippet, "<script>")
+				assert.Contains(t, hits[0].Snippet, "<mark>alert</mark>")
+				assert.Contains(t, hits[0].Snippet, "&lt;script&gt;")
+				assert.Contains(t, hits[0].Snippet, "&amp;")
+			})
+		})
+
+		t.Run("When SearchNotes is called with no matches", func(t *testing.T) {
+			t.Run("Then no hits are returned", func(t *testing.T) {
+				hits, err := mgr.SearchNotes(context.Background(), "snails", db.JournalFilter{}, 10)
+				assert.NoError(t, err)
+
+				assert.Len(t, hits, 0)
+			})
+		})
+
+		t.Run("When DeleteJournalEntry is called", func(t *testing.T) {
+			t.Run("Then the entry is deleted", func(t *testing.T) {
+				j, err := mgr.DeleteJournalEntry(context.Background(), inserted[2].ID)
+				assert.NoError(t, err)
+				assert.Equal(t, inserted[2].ID, j.ID)
+
+				_, err = mgr.DeleteJournalEntry(context.Background(), inserted[2].ID)
+				assert.IsType(t, &db.ErrNotFound{}, err)
+			})
+		})
+
+		_, err = mgr.DeleteTank(context.Background(), tank.ID)
+		assert.NoError(t, err)
+	})
+}
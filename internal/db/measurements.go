@@ -0,0 +1,96 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Measurement is the length and/or weight of a Fish at a point in time. For groups it is
+// the average of the group.
+type Measurement struct {
+	ID         int32
+	FishID     int32
+	MeasuredAt time.Time
+	LengthCm   *float32
+	WeightG    *float32
+	Notes      string
+}
+
+const measurementColumns = "id, fish_id, measured_at, length_cm, weight_g, notes"
+
+func scanMeasurement(row pgx.Row, m *Measurement) error {
+	return row.Scan(&m.ID, &m.FishID, &m.MeasuredAt, &m.LengthCm, &m.WeightG, &m.Notes)
+}
+
+func (d *Manager) InsertMeasurement(ctx context.Context, measurement Measurement) (Measurement, error) {
+	m := Measurement{}
+
+	err := scanMeasurement(d.pool.QueryRow(
+		ctx,
+		"INSERT INTO fish_measurements(fish_id, measured_at, length_cm, weight_g, notes) VALUES($1, $2, $3, $4, $5) RETURNING "+measurementColumns,
+		measurement.FishID, measurement.MeasuredAt, measurement.LengthCm, measurement.WeightG, measurement.Notes,
+	), &m)
+	if err != nil {
+		return m, errors.Wrap(err, "unable to add measurement")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id": m.ID,
+	}).Info("Measurement inserted successfully")
+
+	return m, nil
+}
+
+// ListMeasurements returns the measurements of a fish, oldest first
+func (d *Manager) ListMeasurements(ctx context.Context, fishID int32) ([]Measurement, error) {
+	measurements := make([]Measurement, 0)
+
+	rows, err := d.pool.Query(ctx, "SELECT "+measurementColumns+" FROM fish_measurements WHERE fish_id=$1 ORDER BY measured_at", fishID)
+	if err != nil {
+		return measurements, errors.Wrap(err, "unable to get measurements")
+	}
+
+	rowCount := 0
+	for rows.Next() {
+		m := Measurement{}
+
+		if err := scanMeasurement(rows, &m); err != nil {
+			return nil, errors.Wrap(err, "unable to scan row")
+		}
+
+		measurements = append(measurements, m)
+
+		rowCount++
+	}
+
+	if rows.Err() != nil {
+		return nil, errors.Wrap(rows.Err(), "erroring reading rows")
+	}
+
+	logrus.WithFields(logrus.Fields{"rowCount": rowCount}).Info("Measurements queried successfully")
+
+	return measurements, nil
+}
+
+func (d *Manager) DeleteMeasurement(ctx context.Context, id int32) (Measurement, error) {
+	m := Measurement{}
+
+	err := scanMeasurement(d.pool.QueryRow(ctx, "DELETE FROM fish_measurements WHERE id=$1 RETURNING "+measurementColumns, id), &m)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return m, &ErrNotFound{message: "measurement not found"}
+		}
+
+		return m, errors.Wrap(err, "unable to delete measurement")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id": m.ID,
+	}).Info("Measurement deleted successfully")
+
+	return m, nil
+}
@@ -0,0 +1,216 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Quarantine tracks a batch of Fish (a single fish record) through a quarantine tank
+// before they are released into their target tank
+type Quarantine struct {
+	ID               int32
+	FishID           int32
+	QuarantineTankID int32
+	TargetTankID     int32
+	StartDate        time.Time
+	// Days is the planned length of the quarantine
+	Days       int32
+	ReleasedAt *time.Time
+	Notes      string
+	// Fish is the batch being quarantined, as it is now
+	Fish Fish
+}
+
+// EndDate is when the planned quarantine period finishes
+func (q Quarantine) EndDate() time.Time {
+	return q.StartDate.AddDate(0, 0, int(q.Days))
+}
+
+const quarantineSelect = `SELECT q.id, q.fish_id, q.quarantine_tank_id, q.target_tank_id, q.start_date, q.days, q.released_at, q.notes,
+	f.id, f.tank_id, f.type, f.subtype, f.color, f.gender, f.purchase_date, f.count
+FROM quarantines q
+JOIN fish f ON f.id = q.fish_id`
+
+func scanQuarantine(row pgx.Row, q *Quarantine) error {
+	f := &q.Fish
+
+	return row.Scan(
+		&q.ID, &q.FishID, &q.QuarantineTankID, &q.TargetTankID, &q.StartDate, &q.Days, &q.ReleasedAt, &q.Notes,
+		&f.ID, &f.TankID, &f.Type, &f.Subtype, &f.Color, &f.Gender, &f.PurchaseDate, &f.Count,
+	)
+}
+
+// StartQuarantine moves the fish into the quarantine tank and records the quarantine. The
+// quarantine tank must have the QUARANTINE role and the fish can't already be in quarantine.
+func (d *Manager) StartQuarantine(ctx context.Context, quarantine Quarantine) (Quarantine, error) {
+	q := Quarantine{}
+
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return q, errors.Wrap(err, "unable to begin transaction")
+	}
+	defer tx.Rollback(ctx) // #nosec G104 -- no-op after commit
+
+	var role string
+	if err := tx.QueryRow(ctx, "SELECT role FROM tanks WHERE id=$1 AND deleted_at IS NULL", quarantine.QuarantineTankID).Scan(&role); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return q, &ErrNotFound{message: "quarantine tank not found"}
+		}
+
+		return q, errors.Wrap(err, "unable to get quarantine tank")
+	}
+
+	if role != TankRoleQuarantine {
+		return q, &ErrConflict{message: "tank does not have the QUARANTINE role"}
+	}
+
+	// Lock the fish so it can't be put into two quarantines concurrently
+	if err := tx.QueryRow(ctx, "SELECT id FROM fish WHERE id=$1 AND deleted_at IS NULL FOR UPDATE", quarantine.FishID).Scan(new(int32)); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return q, &ErrNotFound{message: "fish not found"}
+		}
+
+		return q, errors.Wrap(err, "unable to get fish")
+	}
+
+	var active bool
+	if err := tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM quarantines WHERE fish_id=$1 AND released_at IS NULL)", quarantine.FishID).Scan(&active); err != nil {
+		return q, errors.Wrap(err, "unable to check existing quarantines")
+	}
+
+	if active {
+		return q, &ErrConflict{message: "fish is already in quarantine"}
+	}
+
+	var id int32
+	err = tx.QueryRow(
+		ctx,
+		"INSERT INTO quarantines(fish_id, quarantine_tank_id, target_tank_id, start_date, days, notes) VALUES($1, $2, $3, $4, $5, $6) RETURNING id",
+		quarantine.FishID, quarantine.QuarantineTankID, quarantine.TargetTankID, quarantine.StartDate, quarantine.Days, quarantine.Notes,
+	).Scan(&id)
+	if err != nil {
+		return q, errors.Wrap(err, "unable to add quarantine")
+	}
+
+	if _, err := tx.Exec(ctx, "UPDATE fish SET tank_id=$2, updated_at=NOW() WHERE id=$1", quarantine.FishID, quarantine.QuarantineTankID); err != nil {
+		return q, errors.Wrap(err, "unable to move fish to quarantine tank")
+	}
+
+	if err := scanQuarantine(tx.QueryRow(ctx, quarantineSelect+" WHERE q.id=$1", id), &q); err != nil {
+		return q, errors.Wrap(err, "unable to get quarantine")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return q, errors.Wrap(err, "unable to commit quarantine")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id":     q.ID,
+		"fishId": q.FishID,
+	}).Info("Quarantine started successfully")
+
+	return q, nil
+}
+
+func (d *Manager) GetQuarantine(ctx context.Context, id int32) (Quarantine, error) {
+	q := Quarantine{}
+
+	if err := scanQuarantine(d.pool.QueryRow(ctx, quarantineSelect+" WHERE q.id=$1", id), &q); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return q, &ErrNotFound{message: "quarantine not found"}
+		}
+
+		return q, errors.Wrap(err, "unable to get quarantine")
+	}
+
+	return q, nil
+}
+
+// ListQuarantines returns quarantines, most recent first. If activeOnly is true only fish
+// which are still in quarantine are returned.
+func (d *Manager) ListQuarantines(ctx context.Context, activeOnly bool) ([]Quarantine, error) {
+	quarantines := make([]Quarantine, 0)
+
+	rows, err := d.pool.Query(ctx, quarantineSelect+" WHERE NOT $1 OR q.released_at IS NULL ORDER BY q.start_date DESC, q.id DESC", activeOnly)
+	if err != nil {
+		return quarantines, errors.Wrap(err, "unable to get quarantines")
+	}
+
+	rowCount := 0
+	for rows.Next() {
+		q := Quarantine{}
+
+		if err := scanQuarantine(rows, &q); err != nil {
+			return nil, errors.Wrap(err, "unable to scan row")
+		}
+
+		quarantines = append(quarantines, q)
+
+		rowCount++
+	}
+
+	if rows.Err() != nil {
+		return nil, errors.Wrap(rows.Err(), "erroring reading rows")
+	}
+
+	logrus.WithFields(logrus.Fields{"rowCount": rowCount}).Info("Quarantines queried successfully")
+
+	return quarantines, nil
+}
+
+// ReleaseQuarantine ends a quarantine, transferring the fish to the target tank
+func (d *Manager) ReleaseQuarantine(ctx context.Context, id int32, at time.Time) (Quarantine, error) {
+	q := Quarantine{}
+
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return q, errors.Wrap(err, "unable to begin transaction")
+	}
+	defer tx.Rollback(ctx) // #nosec G104 -- no-op after commit
+
+	var (
+		fishID, targetTankID int32
+		releasedAt           *time.Time
+	)
+
+	err = tx.QueryRow(ctx, "SELECT fish_id, target_tank_id, released_at FROM quarantines WHERE id=$1 FOR UPDATE", id).Scan(&fishID, &targetTankID, &releasedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return q, &ErrNotFound{message: "quarantine not found"}
+		}
+
+		return q, errors.Wrap(err, "unable to get quarantine")
+	}
+
+	if releasedAt != nil {
+		return q, &ErrConflict{message: "quarantine has already been released"}
+	}
+
+	if _, err := tx.Exec(ctx, "UPDATE quarantines SET released_at=$2, updated_at=NOW() WHERE id=$1", id, at); err != nil {
+		return q, errors.Wrap(err, "unable to release quarantine")
+	}
+
+	if _, err := tx.Exec(ctx, "UPDATE fish SET tank_id=$2, updated_at=NOW() WHERE id=$1", fishID, targetTankID); err != nil {
+		return q, errors.Wrap(err, "unable to move fish to target tank")
+	}
+
+	if err := scanQuarantine(tx.QueryRow(ctx, quarantineSelect+" WHERE q.id=$1", id), &q); err != nil {
+		return q, errors.Wrap(err, "unable to get quarantine")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return q, errors.Wrap(err, "unable to commit quarantine release")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id":     q.ID,
+		"fishId": q.FishID,
+		"tankId": targetTankID,
+	}).Info("Quarantine released successfully")
+
+	return q, nil
+}
@@ -0,0 +1,120 @@
+//go:build integration
+// +build integration
+
+package db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+func TestQuarantine(t *testing.T) {
+	t.Run("Given a quarantine tank, a display tank and a batch of fish", func(t *testing.T) {
+		var started db.Quarantine
+
+		display, err := mgr.InsertTank(context.Background(), db.Tank{Name: "Display"})
+		assert.NoError(t, err)
+		assert.Equal(t, db.TankRoleDisplay, display.Role)
+
+		qt, err := mgr.InsertTank(context.Background(), db.Tank{Name: "QT"})
+		assert.NoError(t, err)
+
+		fish, err := mgr.InsertFish(context.Background(), db.Fish{Type: "Rasbora", Count: 12})
+		assert.NoError(t, err)
+		assert.Nil(t, fish.TankID)
+
+		quarantine := db.Quarantine{
+			FishID:           fish.ID,
+			QuarantineTankID: qt.ID,
+			TargetTankID:     display.ID,
+			StartDate:        time.Date(2021, 8, 1, 0, 0, 0, 0, time.UTC),
+			Days:             28,
+			Notes:            "From the local fish store",
+		}
+
+		t.Run("When a quarantine is started in a tank without the QUARANTINE role", func(t *testing.T) {
+			t.Run("Then a conflict is returned", func(t *testing.T) {
+				_, err := mgr.StartQuarantine(context.Background(), quarantine)
+				assert.IsType(t, &db.ErrConflict{}, err)
+			})
+		})
+
+		t.Run("When the tank role is set to QUARANTINE", func(t *testing.T) {
+			t.Run("Then the role is updated", func(t *testing.T) {
+				tank, err := mgr.SetTankRole(context.Background(), qt.ID, db.TankRoleQuarantine)
+				assert.NoError(t, err)
+				assert.Equal(t, db.TankRoleQuarantine, tank.Role)
+			})
+		})
+
+		t.Run("When StartQuarantine is called", func(t *testing.T) {
+			t.Run("Then the fish are moved into the quarantine tank", func(t *testing.T) {
+				started, err = mgr.StartQuarantine(context.Background(), quarantine)
+				assert.NoError(t, err)
+
+				assert.Equal(t, fish.ID, started.FishID)
+				assert.Equal(t, qt.ID, started.QuarantineTankID)
+				assert.Equal(t, display.ID, started.TargetTankID)
+				assert.Equal(t, quarantine.Days, started.Days)
+				assert.Nil(t, started.ReleasedAt)
+				assert.Equal(t, qt.ID, *started.Fish.TankID)
+				assert.Equal(t, int32(12), started.Fish.Count)
+			})
+		})
+
+		t.Run("When StartQuarantine is called again for the same fish", func(t *testing.T) {
+			t.Run("Then a conflict is returned", func(t *testing.T) {
+				_, err := mgr.StartQuarantine(context.Background(), quarantine)
+				assert.IsType(t, &db.ErrConflict{}, err)
+			})
+		})
+
+		t.Run("When ListQuarantines is called for active quarantines", func(t *testing.T) {
+			t.Run("Then the fish in quarantine are returned", func(t *testing.T) {
+				q, err := mgr.ListQuarantines(context.Background(), true)
+				assert.NoError(t, err)
+
+				assert.Len(t, q, 1)
+				assert.Equal(t, started.ID, q[0].ID)
+			})
+		})
+
+		t.Run("When ReleaseQuarantine is called", func(t *testing.T) {
+			t.Run("Then the fish are transferred to the target tank", func(t *testing.T) {
+				releasedAt := time.Date(2021, 8, 29, 0, 0, 0, 0, time.UTC)
+
+				q, err := mgr.ReleaseQuarantine(context.Background(), started.ID, releasedAt)
+				assert.NoError(t, err)
+
+				assert.True(t, releasedAt.Equal(*q.ReleasedAt))
+				assert.Equal(t, display.ID, *q.Fish.TankID)
+
+				active, err := mgr.ListQuarantines(context.Background(), true)
+				assert.NoError(t, err)
+				assert.Len(t, active, 0)
+
+				all, err := mgr.ListQuarantines(context.Background(), false)
+				assert.NoError(t, err)
+				assert.Len(t, all, 1)
+			})
+		})
+
+		t.Run("When ReleaseQuarantine is called again", func(t *testing.T) {
+			t.Run("Then a conflict is returned", func(t *testing.T) {
+				_, err := mgr.ReleaseQuarantine(context.Background(), started.ID, time.Now())
+				assert.IsType(t, &db.ErrConflict{}, err)
+			})
+		})
+
+		_, err = mgr.DeleteFish(context.Background(), fish.ID)
+		assert.NoError(t, err)
+		_, err = mgr.DeleteTank(context.Background(), qt.ID)
+		assert.NoError(t, err)
+		_, err = mgr.DeleteTank(context.Background(), display.ID)
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,183 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// SensorReading is a measurement of a parameter of a tank, e.g. its pH, taken by a sensor.
+// Each sensor numbers its readings with an increasing Sequence, so a reading which is sent
+// again, e.g. after reconnecting, is recognised as a duplicate.
+type SensorReading struct {
+	ID        int64
+	SensorID  string
+	Sequence  int64
+	TankID    int32
+	Parameter string
+	Value     float64
+	ReadAt    time.Time
+}
+
+// SensorReadingFilter restricts the sensor readings returned by ListSensorReadings. Empty
+// fields are ignored.
+type SensorReadingFilter struct {
+	TankID    *int32
+	Parameter string
+	SensorID  string
+	From      *time.Time
+	To        *time.Time
+}
+
+const sensorReadingColumns = "id, sensor_id, sequence, tank_id, parameter, value, read_at"
+
+func scanSensorReading(row pgx.Row, r *SensorReading) error {
+	return row.Scan(&r.ID, &r.SensorID, &r.Sequence, &r.TankID, &r.Parameter, &r.Value, &r.ReadAt)
+}
+
+// InsertSensorReadings adds many sensor readings in a single transaction, returning how
+// many were added. Readings which have already been added, i.e. with the same sensor and
+// sequence, are skipped.
+func (d *Manager) InsertSensorReadings(ctx context.Context, readings []SensorReading) (int64, error) {
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "unable to begin transaction")
+	}
+	defer tx.Rollback(ctx) // #nosec G104 -- no-op after commit
+
+	batch := &pgx.Batch{}
+	for _, r := range readings {
+		batch.Queue(
+			"INSERT INTO sensor_readings(sensor_id, sequence, tank_id, parameter, value, read_at) VALUES($1, $2, $3, $4, $5, $6) ON CONFLICT DO NOTHING",
+			r.SensorID, r.Sequence, r.TankID, r.Parameter, r.Value, r.ReadAt,
+		)
+	}
+
+	results := tx.SendBatch(ctx, batch)
+
+	var inserted int64
+	for i := range readings {
+		tag, err := results.Exec()
+		if err != nil {
+			results.Close() // #nosec G104 -- the transaction is rolled back
+			return 0, errors.Wrapf(err, "unable to add sensor reading %d", i)
+		}
+
+		inserted += tag.RowsAffected()
+	}
+
+	if err := results.Close(); err != nil {
+		return 0, errors.Wrap(err, "unable to add sensor readings")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, errors.Wrap(err, "unable to commit sensor readings")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"rowCount":   inserted,
+		"duplicates": int64(len(readings)) - inserted,
+	}).Info("Sensor readings inserted successfully")
+
+	return inserted, nil
+}
+
+// ListSensorReadings returns at most limit sensor readings matching filter, most recent
+// first
+func (d *Manager) ListSensorReadings(ctx context.Context, filter SensorReadingFilter, limit int32) ([]SensorReading, error) {
+	readings := make([]SensorReading, 0)
+
+	rows, err := d.pool.Query(
+		ctx,
+		`SELECT `+sensorReadingColumns+` FROM sensor_readings
+		WHERE ($1::INT IS NULL OR tank_id=$1) AND ($2='' OR parameter=$2) AND ($3='' OR sensor_id=$3)
+		  AND ($4::TIMESTAMPTZ IS NULL OR read_at >= $4) AND ($5::TIMESTAMPTZ IS NULL OR read_at < $5)
+		ORDER BY read_at DESC, id DESC
+		LIMIT $6`,
+		filter.TankID, filter.Parameter, filter.SensorID, filter.From, filter.To, limit,
+	)
+	if err != nil {
+		return readings, errors.Wrap(err, "unable to get sensor readings")
+	}
+
+	rowCount := 0
+	for rows.Next() {
+		r := SensorReading{}
+
+		if err := scanSensorReading(rows, &r); err != nil {
+			return nil, errors.Wrap(err, "unable to scan row")
+		}
+
+		readings = append(readings, r)
+
+		rowCount++
+	}
+
+	if rows.Err() != nil {
+		return nil, errors.Wrap(rows.Err(), "erroring reading rows")
+	}
+
+	logrus.WithFields(logrus.Fields{"rowCount": rowCount}).Info("Sensor readings queried successfully")
+
+	return readings, nil
+}
+
+// LatestSensorReading is the most recent reading of a parameter of a tank
+type LatestSensorReading struct {
+	// HouseholdID is 0 for tanks without a household
+	HouseholdID int32
+	TankID      int32
+	TankName    string
+	Parameter   string
+	Value       float64
+	ReadAt      time.Time
+}
+
+// LatestSensorReadings returns the most recent reading of each parameter of each tank in
+// every household, unless ctx is scoped to one, ignoring parameters which haven't been
+// read since the given time and tanks in the trash
+func (d *Manager) LatestSensorReadings(ctx context.Context, since time.Time) ([]LatestSensorReading, error) {
+	scopes, err := d.householdScopes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	readings := make([]LatestSensorReading, 0)
+	for _, scoped := range scopes {
+		household, _ := HouseholdFromContext(scoped)
+
+		rows, err := d.pool.Query(
+			scoped,
+			`SELECT DISTINCT ON (r.tank_id, r.parameter) r.tank_id, t.name, r.parameter, r.value, r.read_at
+			FROM sensor_readings r JOIN tanks t ON t.id = r.tank_id
+			WHERE r.read_at >= $1 AND t.deleted_at IS NULL
+			ORDER BY r.tank_id, r.parameter, r.read_at DESC`,
+			since,
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to get latest sensor readings")
+		}
+
+		for rows.Next() {
+			r := LatestSensorReading{HouseholdID: household}
+
+			if err := rows.Scan(&r.TankID, &r.TankName, &r.Parameter, &r.Value, &r.ReadAt); err != nil {
+				rows.Close()
+				return nil, errors.Wrap(err, "unable to scan row")
+			}
+
+			readings = append(readings, r)
+		}
+
+		if rows.Err() != nil {
+			return nil, errors.Wrap(rows.Err(), "erroring reading rows")
+		}
+	}
+
+	logrus.WithFields(logrus.Fields{"rowCount": len(readings)}).Debug("Latest sensor readings queried successfully")
+
+	return readings, nil
+}
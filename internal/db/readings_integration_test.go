@@ -0,0 +1,96 @@
+//go:build integration
+// +build integration
+
+package db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+func TestSensorReadings(t *testing.T) {
+	t.Run("Given a tank with a pH probe", func(t *testing.T) {
+		user, err := mgr.InsertUser(context.Background(), db.User{Username: "readings-owner", PasswordHash: "hash"}, "Readings")
+		assert.NoError(t, err)
+
+		ctx := db.WithHousehold(context.Background(), user.HouseholdID)
+
+		tank, err := mgr.InsertTank(ctx, db.Tank{Name: "Reef"})
+		assert.NoError(t, err)
+
+		readAt := time.Date(2021, 8, 6, 10, 0, 0, 0, time.UTC)
+		readings := []db.SensorReading{
+			{SensorID: "probe-1", Sequence: 1, TankID: tank.ID, Parameter: "ph", Value: 8.1, ReadAt: readAt},
+			{SensorID: "probe-1", Sequence: 2, TankID: tank.ID, Parameter: "ph", Value: 8.2, ReadAt: readAt.Add(time.Minute)},
+		}
+
+		t.Run("When its readings are added", func(t *testing.T) {
+			t.Run("Then they are all added", func(t *testing.T) {
+				inserted, err := mgr.InsertSensorReadings(ctx, readings)
+				assert.NoError(t, err)
+				assert.Equal(t, int64(2), inserted)
+			})
+		})
+
+		t.Run("When its readings are sent again after reconnecting", func(t *testing.T) {
+			t.Run("Then only the new readings are added", func(t *testing.T) {
+				inserted, err := mgr.InsertSensorReadings(ctx, append(readings, db.SensorReading{SensorID: "probe-1", Sequence: 3, TankID: tank.ID, Parameter: "ph", Value: 8.3, ReadAt: readAt.Add(2 * time.Minute)}))
+				assert.NoError(t, err)
+				assert.Equal(t, int64(1), inserted)
+			})
+		})
+
+		t.Run("When the readings of the tank are listed", func(t *testing.T) {
+			t.Run("Then they are returned most recent first", func(t *testing.T) {
+				listed, err := mgr.ListSensorReadings(ctx, db.SensorReadingFilter{TankID: &tank.ID, Parameter: "ph"}, 10)
+				assert.NoError(t, err)
+				assert.Len(t, listed, 3)
+				assert.Equal(t, int64(3), listed[0].Sequence)
+				assert.Equal(t, 8.3, listed[0].Value)
+				assert.True(t, readAt.Add(2*time.Minute).Equal(listed[0].ReadAt))
+			})
+		})
+
+		t.Run("When the readings are listed by another household", func(t *testing.T) {
+			t.Run("Then none are returned", func(t *testing.T) {
+				other, err := mgr.InsertUser(context.Background(), db.User{Username: "readings-other", PasswordHash: "hash"}, "Other")
+				assert.NoError(t, err)
+
+				listed, err := mgr.ListSensorReadings(db.WithHousehold(context.Background(), other.HouseholdID), db.SensorReadingFilter{}, 10)
+				assert.NoError(t, err)
+				assert.Empty(t, listed)
+			})
+		})
+
+		t.Run("When the latest readings of every household are queried", func(t *testing.T) {
+			t.Run("Then the most recent reading of the tank is returned", func(t *testing.T) {
+				latest, err := mgr.LatestSensorReadings(context.Background(), readAt)
+				assert.NoError(t, err)
+
+				found := false
+				for _, r := range latest {
+					if r.HouseholdID == user.HouseholdID {
+						found = true
+						assert.Equal(t, tank.ID, r.TankID)
+						assert.Equal(t, "Reef", r.TankName)
+						assert.Equal(t, "ph", r.Parameter)
+						assert.Equal(t, 8.3, r.Value)
+					}
+				}
+				assert.True(t, found)
+			})
+		})
+
+		t.Run("When the latest readings since after the tank was read are queried", func(t *testing.T) {
+			t.Run("Then none of the tank are returned", func(t *testing.T) {
+				latest, err := mgr.LatestSensorReadings(ctx, readAt.Add(time.Hour))
+				assert.NoError(t, err)
+				assert.Empty(t, latest)
+			})
+		})
+	})
+}
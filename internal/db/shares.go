@@ -0,0 +1,115 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// TankShare lets anyone with its token view a read-only showcase of a tank, until it's
+// revoked. Only a hash of the token is stored, along with its first characters to
+// recognise it by.
+type TankShare struct {
+	ID          int32
+	HouseholdID int32
+	TankID      int32
+	Prefix      string
+	CreatedBy   int32
+	CreatedAt   time.Time
+}
+
+const tankShareColumns = "id, household_id, tank_id, prefix, created_by, created_at"
+
+func scanTankShare(row pgx.Row, s *TankShare) error {
+	return row.Scan(&s.ID, &s.HouseholdID, &s.TankID, &s.Prefix, &s.CreatedBy, &s.CreatedAt)
+}
+
+func (d *Manager) InsertTankShare(ctx context.Context, share TankShare, tokenHash string) (TankShare, error) {
+	s := TankShare{}
+
+	err := scanTankShare(d.pool.QueryRow(
+		ctx,
+		"INSERT INTO tank_shares(household_id, tank_id, prefix, token_hash, created_by) VALUES($1, $2, $3, $4, $5) RETURNING "+tankShareColumns,
+		share.HouseholdID, share.TankID, share.Prefix, tokenHash, share.CreatedBy,
+	), &s)
+	if err != nil {
+		return s, errors.Wrap(err, "unable to add tank share")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id":          s.ID,
+		"householdId": s.HouseholdID,
+		"tankId":      s.TankID,
+	}).Info("Tank share inserted successfully")
+
+	return s, nil
+}
+
+// ListTankShares returns the tank shares of a household, newest first
+func (d *Manager) ListTankShares(ctx context.Context, householdID int32) ([]TankShare, error) {
+	shares := make([]TankShare, 0)
+
+	rows, err := d.pool.Query(ctx, "SELECT "+tankShareColumns+" FROM tank_shares WHERE household_id=$1 ORDER BY created_at DESC, id DESC", householdID)
+	if err != nil {
+		return shares, errors.Wrap(err, "unable to get tank shares")
+	}
+
+	rowCount := 0
+	for rows.Next() {
+		s := TankShare{}
+
+		if err := scanTankShare(rows, &s); err != nil {
+			return nil, errors.Wrap(err, "unable to scan row")
+		}
+
+		shares = append(shares, s)
+
+		rowCount++
+	}
+
+	if rows.Err() != nil {
+		return nil, errors.Wrap(rows.Err(), "erroring reading rows")
+	}
+
+	logrus.WithFields(logrus.Fields{"rowCount": rowCount}).Info("Tank shares queried successfully")
+
+	return shares, nil
+}
+
+// GetTankShare returns the tank share with the token hash, of any household
+func (d *Manager) GetTankShare(ctx context.Context, tokenHash string) (TankShare, error) {
+	s := TankShare{}
+
+	if err := scanTankShare(d.pool.QueryRow(ctx, "SELECT "+tankShareColumns+" FROM tank_shares WHERE token_hash=$1", tokenHash), &s); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return s, &ErrNotFound{message: "tank share not found"}
+		}
+
+		return s, errors.Wrap(err, "unable to get tank share")
+	}
+
+	return s, nil
+}
+
+// DeleteTankShare revokes a tank share of a household
+func (d *Manager) DeleteTankShare(ctx context.Context, householdID, id int32) (TankShare, error) {
+	s := TankShare{}
+
+	err := scanTankShare(d.pool.QueryRow(ctx, "DELETE FROM tank_shares WHERE household_id=$1 AND id=$2 RETURNING "+tankShareColumns, householdID, id), &s)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return s, &ErrNotFound{message: "tank share not found"}
+		}
+
+		return s, errors.Wrap(err, "unable to delete tank share")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id": s.ID,
+	}).Info("Tank share deleted successfully")
+
+	return s, nil
+}
@@ -0,0 +1,57 @@
+//go:build integration
+// +build integration
+
+package db_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+func TestTankShares(t *testing.T) {
+	t.Run("Given a shared tank", func(t *testing.T) {
+		user, err := mgr.InsertUser(context.Background(), db.User{Username: "share-owner", PasswordHash: "hash"}, "Shares")
+		assert.NoError(t, err)
+
+		ctx := db.WithHousehold(context.Background(), user.HouseholdID)
+
+		tank, err := mgr.InsertTank(ctx, db.Tank{Name: "Showcase"})
+		assert.NoError(t, err)
+
+		share, err := mgr.InsertTankShare(ctx, db.TankShare{HouseholdID: user.HouseholdID, TankID: tank.ID, Prefix: "abcd", CreatedBy: user.ID}, "share-hash")
+		assert.NoError(t, err)
+
+		t.Run("When it is looked up by token without a household", func(t *testing.T) {
+			t.Run("Then the share and its household are returned", func(t *testing.T) {
+				s, err := mgr.GetTankShare(context.Background(), "share-hash")
+				assert.NoError(t, err)
+				assert.Equal(t, share, s)
+				assert.Equal(t, user.HouseholdID, s.HouseholdID)
+
+				shares, err := mgr.ListTankShares(ctx, user.HouseholdID)
+				assert.NoError(t, err)
+				assert.Equal(t, []db.TankShare{share}, shares)
+			})
+		})
+
+		t.Run("When another household revokes it", func(t *testing.T) {
+			t.Run("Then it isn't found", func(t *testing.T) {
+				_, err := mgr.DeleteTankShare(ctx, user.HouseholdID+1000, share.ID)
+				assert.IsType(t, &db.ErrNotFound{}, err)
+			})
+		})
+
+		t.Run("When it is revoked", func(t *testing.T) {
+			t.Run("Then its token is no longer found", func(t *testing.T) {
+				_, err := mgr.DeleteTankShare(ctx, user.HouseholdID, share.ID)
+				assert.NoError(t, err)
+
+				_, err = mgr.GetTankShare(context.Background(), "share-hash")
+				assert.IsType(t, &db.ErrNotFound{}, err)
+			})
+		})
+	})
+}
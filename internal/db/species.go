@@ -0,0 +1,170 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Species is the reference data for a type (and optionally subtype) of fish, used to
+// compare the growth of fish against their expected adult size. An empty Subtype applies
+// to every subtype of the Type.
+type Species struct {
+	ID            int32
+	Type          string
+	Subtype       string
+	AdultLengthCm *float32
+	AdultWeightG  *float32
+	Notes         string
+}
+
+// GrowthPoint is the average size of a fish on a day. For groups it includes the
+// measurements of individuals split from the group.
+type GrowthPoint struct {
+	Date     time.Time
+	LengthCm *float32
+	WeightG  *float32
+	Samples  int32
+}
+
+const speciesColumns = "id, type, subtype, adult_length_cm, adult_weight_g, notes"
+
+func scanSpecies(row pgx.Row, s *Species) error {
+	return row.Scan(&s.ID, &s.Type, &s.Subtype, &s.AdultLengthCm, &s.AdultWeightG, &s.Notes)
+}
+
+func (d *Manager) InsertSpecies(ctx context.Context, species Species) (Species, error) {
+	s := Species{}
+
+	err := scanSpecies(d.pool.QueryRow(
+		ctx,
+		"INSERT INTO species(type, subtype, adult_length_cm, adult_weight_g, notes) VALUES($1, $2, $3, $4, $5) ON CONFLICT DO NOTHING RETURNING "+speciesColumns,
+		species.Type, species.Subtype, species.AdultLengthCm, species.AdultWeightG, species.Notes,
+	), &s)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return s, &ErrConflict{message: "species already exists"}
+		}
+
+		return s, errors.Wrap(err, "unable to add species")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id": s.ID,
+	}).Info("Species inserted successfully")
+
+	return s, nil
+}
+
+func (d *Manager) ListSpecies(ctx context.Context) ([]Species, error) {
+	species := make([]Species, 0)
+
+	rows, err := d.pool.Query(ctx, "SELECT "+speciesColumns+" FROM species ORDER BY type, subtype")
+	if err != nil {
+		return species, errors.Wrap(err, "unable to get species")
+	}
+
+	rowCount := 0
+	for rows.Next() {
+		s := Species{}
+
+		if err := scanSpecies(rows, &s); err != nil {
+			return nil, errors.Wrap(err, "unable to scan row")
+		}
+
+		species = append(species, s)
+
+		rowCount++
+	}
+
+	if rows.Err() != nil {
+		return nil, errors.Wrap(rows.Err(), "erroring reading rows")
+	}
+
+	logrus.WithFields(logrus.Fields{"rowCount": rowCount}).Info("Species queried successfully")
+
+	return species, nil
+}
+
+// GetSpeciesFor returns the species matching the type and subtype of a fish, preferring
+// an exact match of the subtype over a species which applies to every subtype
+func (d *Manager) GetSpeciesFor(ctx context.Context, fishType, subtype string) (Species, error) {
+	s := Species{}
+
+	err := scanSpecies(d.pool.QueryRow(
+		ctx,
+		"SELECT "+speciesColumns+" FROM species WHERE lower(type)=lower($1) AND (lower(subtype)=lower($2) OR subtype='') ORDER BY subtype='' LIMIT 1",
+		fishType, subtype,
+	), &s)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return s, &ErrNotFound{message: "species not found"}
+		}
+
+		return s, errors.Wrap(err, "unable to get species")
+	}
+
+	return s, nil
+}
+
+func (d *Manager) DeleteSpecies(ctx context.Context, id int32) (Species, error) {
+	s := Species{}
+
+	err := scanSpecies(d.pool.QueryRow(ctx, "DELETE FROM species WHERE id=$1 RETURNING "+speciesColumns, id), &s)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return s, &ErrNotFound{message: "species not found"}
+		}
+
+		return s, errors.Wrap(err, "unable to delete species")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id": s.ID,
+	}).Info("Species deleted successfully")
+
+	return s, nil
+}
+
+// ListGrowth returns the growth curve of a fish, averaging the measurements taken on each
+// day. For a group this includes the measurements of the individuals split from it.
+func (d *Manager) ListGrowth(ctx context.Context, fishID int32) ([]GrowthPoint, error) {
+	points := make([]GrowthPoint, 0)
+
+	rows, err := d.pool.Query(
+		ctx,
+		`SELECT date_trunc('day', measured_at) AS day, AVG(length_cm)::REAL, AVG(weight_g)::REAL, COUNT(*)
+		FROM fish_measurements
+		WHERE fish_id=$1 OR fish_id IN (SELECT fish_id FROM fish_profiles WHERE group_id=$1)
+		GROUP BY day
+		ORDER BY day`,
+		fishID,
+	)
+	if err != nil {
+		return points, errors.Wrap(err, "unable to get growth")
+	}
+
+	rowCount := 0
+	for rows.Next() {
+		p := GrowthPoint{}
+
+		if err := rows.Scan(&p.Date, &p.LengthCm, &p.WeightG, &p.Samples); err != nil {
+			return nil, errors.Wrap(err, "unable to scan row")
+		}
+
+		points = append(points, p)
+
+		rowCount++
+	}
+
+	if rows.Err() != nil {
+		return nil, errors.Wrap(rows.Err(), "erroring reading rows")
+	}
+
+	logrus.WithFields(logrus.Fields{"rowCount": rowCount}).Info("Growth queried successfully")
+
+	return points, nil
+}
@@ -0,0 +1,101 @@
+//go:build integration
+// +build integration
+
+package db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/openlyinc/pointy"
+	"github.com/stretchr/testify/assert"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+func TestSpecies(t *testing.T) {
+	t.Run("Given a species reference", func(t *testing.T) {
+		cichlid, err := mgr.InsertSpecies(context.Background(), db.Species{Type: "Cichlid", AdultLengthCm: pointy.Float32(12)})
+		assert.NoError(t, err)
+
+		lab, err := mgr.InsertSpecies(context.Background(), db.Species{Type: "Cichlid", Subtype: "Yellow Lab", AdultLengthCm: pointy.Float32(10)})
+		assert.NoError(t, err)
+
+		t.Run("When a duplicate species is added", func(t *testing.T) {
+			t.Run("Then a conflict is returned", func(t *testing.T) {
+				_, err := mgr.InsertSpecies(context.Background(), db.Species{Type: "cichlid", Subtype: "yellow lab", AdultLengthCm: pointy.Float32(9)})
+				assert.IsType(t, &db.ErrConflict{}, err)
+			})
+		})
+
+		t.Run("When GetSpeciesFor is called", func(t *testing.T) {
+			t.Run("Then an exact subtype match is preferred", func(t *testing.T) {
+				s, err := mgr.GetSpeciesFor(context.Background(), "cichlid", "Yellow Lab")
+				assert.NoError(t, err)
+				assert.Equal(t, lab.ID, s.ID)
+
+				s, err = mgr.GetSpeciesFor(context.Background(), "Cichlid", "Electric Blue")
+				assert.NoError(t, err)
+				assert.Equal(t, cichlid.ID, s.ID)
+
+				_, err = mgr.GetSpeciesFor(context.Background(), "Guppy", "")
+				assert.IsType(t, &db.ErrNotFound{}, err)
+			})
+		})
+
+		_, err = mgr.DeleteSpecies(context.Background(), cichlid.ID)
+		assert.NoError(t, err)
+		_, err = mgr.DeleteSpecies(context.Background(), lab.ID)
+		assert.NoError(t, err)
+	})
+}
+
+func TestListGrowth(t *testing.T) {
+	t.Run("Given a group with individuals split from it", func(t *testing.T) {
+		group, err := mgr.InsertFish(context.Background(), db.Fish{Type: "Cichlid", Count: 3})
+		assert.NoError(t, err)
+
+		split, err := mgr.SplitFish(context.Background(), group.ID, []db.Individual{{Name: "Sunny"}, {Name: "Lemon"}})
+		assert.NoError(t, err)
+
+		day := time.Date(2021, 8, 1, 10, 0, 0, 0, time.UTC)
+		for _, m := range []db.Measurement{
+			{FishID: group.ID, MeasuredAt: day, LengthCm: pointy.Float32(4)},
+			{FishID: split[0].Fish.ID, MeasuredAt: day.Add(time.Hour), LengthCm: pointy.Float32(6)},
+			{FishID: split[1].Fish.ID, MeasuredAt: day.AddDate(0, 1, 0), LengthCm: pointy.Float32(7), WeightG: pointy.Float32(5)},
+		} {
+			_, err := mgr.InsertMeasurement(context.Background(), m)
+			assert.NoError(t, err)
+		}
+
+		t.Run("When ListGrowth is called for the group", func(t *testing.T) {
+			t.Run("Then the measurements of the group and individuals are averaged per day", func(t *testing.T) {
+				points, err := mgr.ListGrowth(context.Background(), group.ID)
+				assert.NoError(t, err)
+
+				assert.Len(t, points, 2)
+				assert.Equal(t, float32(5), *points[0].LengthCm)
+				assert.Nil(t, points[0].WeightG)
+				assert.Equal(t, int32(2), points[0].Samples)
+				assert.Equal(t, float32(7), *points[1].LengthCm)
+			})
+		})
+
+		t.Run("When ListGrowth is called for an individual", func(t *testing.T) {
+			t.Run("Then only its measurements are returned", func(t *testing.T) {
+				points, err := mgr.ListGrowth(context.Background(), split[0].Fish.ID)
+				assert.NoError(t, err)
+
+				assert.Len(t, points, 1)
+				assert.Equal(t, float32(6), *points[0].LengthCm)
+			})
+		})
+
+		for _, i := range split {
+			_, err = mgr.DeleteFish(context.Background(), i.Fish.ID)
+			assert.NoError(t, err)
+		}
+		_, err = mgr.DeleteFish(context.Background(), group.ID)
+		assert.NoError(t, err)
+	})
+}
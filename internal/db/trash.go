@@ -0,0 +1,226 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Types of the items in the trash, which match the resources they're served as
+const (
+	TrashTypeFish          = "fish"
+	TrashTypeTank          = "tanks"
+	TrashTypeTankStatistic = "tank-statistics"
+)
+
+// trashTables are the tables which are soft deleted, in the order they're purged
+var trashTables = []string{"tank_statistics", "fish", "tanks"}
+
+// TrashItem is a deleted fish, tank or tank statistic which can be restored until it's
+// purged. Name describes the item, e.g. the name of a tank or the test date of a tank
+// statistic.
+type TrashItem struct {
+	Type      string
+	ID        int32
+	Name      string
+	DeletedAt time.Time
+}
+
+// ListTrash returns the deleted fish, tanks and tank statistics, most recently deleted first
+func (d *Manager) ListTrash(ctx context.Context) ([]TrashItem, error) {
+	items := make([]TrashItem, 0)
+
+	rows, err := d.pool.Query(
+		ctx,
+		`SELECT $1::TEXT, id, concat_ws(' ', NULLIF(type, ''), NULLIF(subtype, '')), deleted_at FROM fish WHERE deleted_at IS NOT NULL
+		UNION ALL
+		SELECT $2::TEXT, id, COALESCE(name, ''), deleted_at FROM tanks WHERE deleted_at IS NOT NULL
+		UNION ALL
+		SELECT $3::TEXT, id, COALESCE(test_date, ''), deleted_at FROM tank_statistics WHERE deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC, id DESC`,
+		TrashTypeFish, TrashTypeTank, TrashTypeTankStatistic,
+	)
+	if err != nil {
+		return items, errors.Wrap(err, "unable to get trash")
+	}
+
+	rowCount := 0
+	for rows.Next() {
+		i := TrashItem{}
+
+		if err := rows.Scan(&i.Type, &i.ID, &i.Name, &i.DeletedAt); err != nil {
+			return nil, errors.Wrap(err, "unable to scan row")
+		}
+
+		items = append(items, i)
+
+		rowCount++
+	}
+
+	if rows.Err() != nil {
+		return nil, errors.Wrap(rows.Err(), "erroring reading rows")
+	}
+
+	logrus.WithFields(logrus.Fields{"rowCount": rowCount}).Info("Trash queried successfully")
+
+	return items, nil
+}
+
+// RestoreFish moves a fish out of the trash
+func (d *Manager) RestoreFish(ctx context.Context, id int32) (Fish, error) {
+	f := Fish{}
+
+	err := d.pool.QueryRow(
+		ctx,
+		"UPDATE fish SET deleted_at=NULL, updated_at=NOW() WHERE id=$1 AND deleted_at IS NOT NULL RETURNING id, tank_id, type, subtype, color, gender, purchase_date, count",
+		id,
+	).Scan(&f.ID, &f.TankID, &f.Type, &f.Subtype, &f.Color, &f.Gender, &f.PurchaseDate, &f.Count)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return f, &ErrNotFound{message: "fish not found in trash"}
+		}
+
+		return f, errors.Wrap(err, "unable to restore fish")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id": f.ID,
+	}).Info("Fish restored successfully")
+
+	return f, nil
+}
+
+// RestoreTank moves a tank out of the trash
+func (d *Manager) RestoreTank(ctx context.Context, id int32) (Tank, error) {
+	ts := Tank{}
+
+	err := d.pool.QueryRow(
+		ctx,
+		"UPDATE tanks SET deleted_at=NULL, updated_at=NOW() WHERE id=$1 AND deleted_at IS NOT NULL RETURNING id, make, model, name, location, capacity_measurement, capacity, description, role",
+		id,
+	).Scan(&ts.ID, &ts.Make, &ts.Model, &ts.Name, &ts.Location, &ts.CapacityMeasurement, &ts.Capacity, &ts.Description, &ts.Role)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ts, &ErrNotFound{message: "tank not found in trash"}
+		}
+
+		return ts, errors.Wrap(err, "unable to restore tank")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id": ts.ID,
+	}).Info("Tank restored successfully")
+
+	return ts, nil
+}
+
+// RestoreTankStatistic moves a tank statistic out of the trash
+func (d *Manager) RestoreTankStatistic(ctx context.Context, id int32) (TankStatistic, error) {
+	ts := TankStatistic{}
+
+	err := d.pool.QueryRow(
+		ctx,
+		"UPDATE tank_statistics SET deleted_at=NULL, updated_at=NOW() WHERE id=$1 AND deleted_at IS NOT NULL RETURNING id, test_date, ph, gh, kh, ammonia, nitrite, nitrate, phosphate",
+		id,
+	).Scan(&ts.ID, &ts.TestDate, &ts.PH, &ts.GH, &ts.KH, &ts.Ammonia, &ts.Nitrite, &ts.Nitrate, &ts.Phosphate)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ts, &ErrNotFound{message: "tank statistic not found in trash"}
+		}
+
+		return ts, errors.Wrap(err, "unable to restore tank statistic")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id": ts.ID,
+	}).Info("Tank Statistic restored successfully")
+
+	return ts, nil
+}
+
+// PurgeTrash permanently deletes the items of every household which were deleted before
+// the given time, returning how many were purged and the attachments of the purged tanks
+// and fish, whose blobs are left for the caller to delete. Row-level security limits
+// queries to a single household, so each household is purged in turn, followed by the
+// items which don't belong to one. The attachments of the households purged before an
+// error are still returned.
+func (d *Manager) PurgeTrash(ctx context.Context, deletedBefore time.Time) (int64, []Attachment, error) {
+	attachments := make([]Attachment, 0)
+
+	scopes, err := d.householdScopes(ctx)
+	if err != nil {
+		return 0, attachments, err
+	}
+
+	var purged int64
+	for _, scoped := range scopes {
+		n, a, err := d.purgeTrash(scoped, deletedBefore)
+		if err != nil {
+			return purged, attachments, err
+		}
+
+		purged += n
+		attachments = append(attachments, a...)
+	}
+
+	logrus.WithFields(logrus.Fields{"rowCount": purged, "attachmentCount": len(attachments)}).Info("Trash purged successfully")
+
+	return purged, attachments, nil
+}
+
+// purgeTrash permanently deletes the items visible to ctx which were deleted before the
+// given time, returning the attachments of the purged tanks and fish. They're deleted
+// first rather than by cascading, so their blob keys are known.
+func (d *Manager) purgeTrash(ctx context.Context, deletedBefore time.Time) (int64, []Attachment, error) {
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "unable to begin transaction")
+	}
+	defer tx.Rollback(ctx) // #nosec G104 -- no-op after commit
+
+	rows, err := tx.Query(
+		ctx,
+		`DELETE FROM attachments
+		WHERE tank_id IN (SELECT id FROM tanks WHERE deleted_at < $1) OR fish_id IN (SELECT id FROM fish WHERE deleted_at < $1)
+		RETURNING `+attachmentColumns,
+		deletedBefore,
+	)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "unable to purge attachments")
+	}
+
+	attachments := make([]Attachment, 0)
+	for rows.Next() {
+		a := Attachment{}
+
+		if err := scanAttachment(rows, &a); err != nil {
+			rows.Close()
+			return 0, nil, errors.Wrap(err, "unable to scan row")
+		}
+
+		attachments = append(attachments, a)
+	}
+
+	if rows.Err() != nil {
+		return 0, nil, errors.Wrap(rows.Err(), "erroring reading rows")
+	}
+
+	var purged int64
+	for _, table := range trashTables {
+		tag, err := tx.Exec(ctx, "DELETE FROM "+table+" WHERE deleted_at < $1", deletedBefore) // #nosec G202 -- table is a constant
+		if err != nil {
+			return 0, nil, errors.Wrapf(err, "unable to purge %s", table)
+		}
+
+		purged += tag.RowsAffected()
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, nil, errors.Wrap(err, "unable to commit transaction")
+	}
+
+	return purged, attachments, nil
+}
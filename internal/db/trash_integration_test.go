@@ -0,0 +1,110 @@
+//go:build integration
+// +build integration
+
+package db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+func TestTrash(t *testing.T) {
+	t.Run("Given deleted fish, tanks and tank statistics", func(t *testing.T) {
+		user, err := mgr.InsertUser(context.Background(), db.User{Username: "trash-owner", PasswordHash: "hash"}, "Trash")
+		assert.NoError(t, err)
+
+		ctx := db.WithHousehold(context.Background(), user.HouseholdID)
+
+		tank, err := mgr.InsertTank(ctx, db.Tank{Name: "Nano"})
+		assert.NoError(t, err)
+
+		fish, err := mgr.InsertFish(ctx, db.Fish{TankID: &tank.ID, Type: "Shrimp", Subtype: "Cherry", Count: 10})
+		assert.NoError(t, err)
+
+		stat, err := mgr.InsertTankStatistic(ctx, db.TankStatistic{TestDate: "2021/08/06 10:00"})
+		assert.NoError(t, err)
+
+		photo, err := mgr.InsertAttachment(ctx, db.Attachment{TankID: &tank.ID, ContentType: "image/png", Size: 5, BlobKey: "2021/08/nano", ThumbnailKey: "2021/08/nano_thumb"})
+		assert.NoError(t, err)
+
+		_, err = mgr.DeleteTankStatistic(ctx, stat.ID)
+		assert.NoError(t, err)
+
+		_, err = mgr.DeleteFish(ctx, fish.ID)
+		assert.NoError(t, err)
+
+		_, err = mgr.DeleteTank(ctx, tank.ID)
+		assert.NoError(t, err)
+
+		t.Run("When they are listed or deleted again", func(t *testing.T) {
+			t.Run("Then they aren't found", func(t *testing.T) {
+				tanks, err := mgr.ListTanks(ctx)
+				assert.NoError(t, err)
+				assert.Empty(t, tanks)
+
+				_, err = mgr.GetFish(ctx, fish.ID)
+				assert.IsType(t, &db.ErrNotFound{}, err)
+
+				_, err = mgr.DeleteTank(ctx, tank.ID)
+				assert.IsType(t, &db.ErrNotFound{}, err)
+			})
+		})
+
+		t.Run("When the trash is listed", func(t *testing.T) {
+			t.Run("Then they are returned, most recently deleted first", func(t *testing.T) {
+				items, err := mgr.ListTrash(ctx)
+				assert.NoError(t, err)
+				assert.Len(t, items, 3)
+				assert.Equal(t, db.TrashItem{Type: db.TrashTypeTank, ID: tank.ID, Name: "Nano", DeletedAt: items[0].DeletedAt}, items[0])
+				assert.Equal(t, db.TrashItem{Type: db.TrashTypeFish, ID: fish.ID, Name: "Shrimp Cherry", DeletedAt: items[1].DeletedAt}, items[1])
+				assert.Equal(t, db.TrashItem{Type: db.TrashTypeTankStatistic, ID: stat.ID, Name: "2021/08/06 10:00", DeletedAt: items[2].DeletedAt}, items[2])
+			})
+		})
+
+		t.Run("When a fish is restored", func(t *testing.T) {
+			t.Run("Then it is listed again", func(t *testing.T) {
+				f, err := mgr.RestoreFish(ctx, fish.ID)
+				assert.NoError(t, err)
+				assert.Equal(t, fish, f)
+
+				_, err = mgr.GetFish(ctx, fish.ID)
+				assert.NoError(t, err)
+
+				_, err = mgr.RestoreFish(ctx, fish.ID)
+				assert.IsType(t, &db.ErrNotFound{}, err)
+			})
+		})
+
+		t.Run("When the trash is purged without a household", func(t *testing.T) {
+			t.Run("Then the items of every household are permanently deleted", func(t *testing.T) {
+				purged, attachments, err := mgr.PurgeTrash(context.Background(), time.Now().Add(time.Minute))
+				assert.NoError(t, err)
+				assert.GreaterOrEqual(t, purged, int64(2))
+
+				keys := make([]string, len(attachments))
+				for i, a := range attachments {
+					keys[i] = a.BlobKey
+				}
+				assert.Contains(t, keys, photo.BlobKey)
+
+				_, err = mgr.GetAttachment(ctx, photo.ID)
+				assert.IsType(t, &db.ErrNotFound{}, err)
+
+				items, err := mgr.ListTrash(ctx)
+				assert.NoError(t, err)
+				assert.Empty(t, items)
+
+				_, err = mgr.RestoreTank(ctx, tank.ID)
+				assert.IsType(t, &db.ErrNotFound{}, err)
+
+				f, err := mgr.GetFish(ctx, fish.ID)
+				assert.NoError(t, err)
+				assert.Nil(t, f.TankID)
+			})
+		})
+	})
+}
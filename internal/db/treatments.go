@@ -0,0 +1,277 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Treatment is a course of medication given to a Tank. FishIDs are the fish that were
+// affected, which makes up the treatment history of each fish.
+type Treatment struct {
+	ID         int32
+	TankID     int32
+	FishIDs    []int32
+	Medication string
+	Dose       float32
+	DoseUnit   string
+	// DoseIntervalHours is the time between doses. Zero means a single dose on the StartDate.
+	DoseIntervalHours int32
+	StartDate         time.Time
+	EndDate           time.Time
+	Notes             string
+	CreatedAt         time.Time
+}
+
+// TreatmentFilter restricts the treatments returned by ListTreatments. Nil fields are ignored.
+type TreatmentFilter struct {
+	TankID *int32
+	FishID *int32
+	// ActiveAt only returns treatments whose course includes the given time
+	ActiveAt *time.Time
+}
+
+// TreatmentDose is a single scheduled dose of a Treatment. Doses which haven't been
+// administered by their due time act as reminders.
+type TreatmentDose struct {
+	ID             int32
+	TreatmentID    int32
+	TankID         int32
+	Medication     string
+	Dose           float32
+	DoseUnit       string
+	DueAt          time.Time
+	AdministeredAt *time.Time
+}
+
+const treatmentSelect = `SELECT t.id, t.tank_id, COALESCE(array_agg(tf.fish_id ORDER BY tf.fish_id) FILTER (WHERE tf.fish_id IS NOT NULL), '{}'),
+	t.medication, t.dose, t.dose_unit, t.dose_interval_hours, t.start_date, t.end_date, t.notes, t.created_at
+FROM treatments t
+LEFT JOIN treatment_fish tf ON tf.treatment_id = t.id`
+
+const treatmentDoseSelect = `SELECT d.id, d.treatment_id, t.tank_id, t.medication, t.dose, t.dose_unit, d.due_at, d.administered_at
+FROM treatment_doses d
+JOIN treatments t ON t.id = d.treatment_id`
+
+func scanTreatment(row pgx.Row, t *Treatment) error {
+	return row.Scan(&t.ID, &t.TankID, &t.FishIDs, &t.Medication, &t.Dose, &t.DoseUnit, &t.DoseIntervalHours, &t.StartDate, &t.EndDate, &t.Notes, &t.CreatedAt)
+}
+
+func scanTreatmentDose(row pgx.Row, d *TreatmentDose) error {
+	return row.Scan(&d.ID, &d.TreatmentID, &d.TankID, &d.Medication, &d.Dose, &d.DoseUnit, &d.DueAt, &d.AdministeredAt)
+}
+
+// InsertTreatment adds a treatment, links the affected fish and generates its dose
+// schedule, all within a single transaction
+func (d *Manager) InsertTreatment(ctx context.Context, treatment Treatment) (Treatment, error) {
+	t := Treatment{}
+
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return t, errors.Wrap(err, "unable to begin transaction")
+	}
+	defer tx.Rollback(ctx) // #nosec G104 -- no-op after commit
+
+	var id int32
+	err = tx.QueryRow(
+		ctx,
+		"INSERT INTO treatments(tank_id, medication, dose, dose_unit, dose_interval_hours, start_date, end_date, notes) VALUES($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id",
+		treatment.TankID, treatment.Medication, treatment.Dose, treatment.DoseUnit, treatment.DoseIntervalHours, treatment.StartDate, treatment.EndDate, treatment.Notes,
+	).Scan(&id)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return t, &ErrNotFound{message: "tank not found"}
+		}
+
+		return t, errors.Wrap(err, "unable to add treatment")
+	}
+
+	if len(treatment.FishIDs) > 0 {
+		if _, err := tx.Exec(
+			ctx,
+			"INSERT INTO treatment_fish(treatment_id, fish_id) SELECT $1, unnest($2::INT[]) ON CONFLICT DO NOTHING",
+			id, treatment.FishIDs,
+		); err != nil {
+			if isForeignKeyViolation(err) {
+				return t, &ErrNotFound{message: "fish not found"}
+			}
+
+			return t, errors.Wrap(err, "unable to add treatment fish")
+		}
+	}
+
+	// A zero interval is a single dose, otherwise schedule a dose every interval from the
+	// start of the course up to and including the end
+	if _, err := tx.Exec(
+		ctx,
+		`INSERT INTO treatment_doses(treatment_id, due_at)
+		SELECT $1, generate_series($2::TIMESTAMPTZ, CASE WHEN $4::INT = 0 THEN $2 ELSE $3::TIMESTAMPTZ END, make_interval(hours => GREATEST($4, 1)))`,
+		id, treatment.StartDate, treatment.EndDate, treatment.DoseIntervalHours,
+	); err != nil {
+		return t, errors.Wrap(err, "unable to add treatment doses")
+	}
+
+	if err := scanTreatment(tx.QueryRow(ctx, treatmentSelect+" WHERE t.id=$1 GROUP BY t.id", id), &t); err != nil {
+		return t, errors.Wrap(err, "unable to get treatment")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return t, errors.Wrap(err, "unable to commit treatment")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id": t.ID,
+	}).Info("Treatment inserted successfully")
+
+	return t, nil
+}
+
+func (d *Manager) GetTreatment(ctx context.Context, id int32) (Treatment, error) {
+	t := Treatment{}
+
+	if err := scanTreatment(d.pool.QueryRow(ctx, treatmentSelect+" WHERE t.id=$1 GROUP BY t.id", id), &t); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return t, &ErrNotFound{message: "treatment not found"}
+		}
+
+		return t, errors.Wrap(err, "unable to get treatment")
+	}
+
+	return t, nil
+}
+
+func (d *Manager) ListTreatments(ctx context.Context, filter TreatmentFilter) ([]Treatment, error) {
+	treatments := make([]Treatment, 0)
+
+	rows, err := d.pool.Query(
+		ctx,
+		treatmentSelect+`
+		WHERE ($1::INT IS NULL OR t.tank_id=$1)
+			AND ($2::INT IS NULL OR EXISTS (SELECT 1 FROM treatment_fish WHERE treatment_id=t.id AND fish_id=$2))
+			AND ($3::TIMESTAMPTZ IS NULL OR $3 BETWEEN t.start_date AND t.end_date)
+		GROUP BY t.id
+		ORDER BY t.start_date DESC, t.id DESC`,
+		filter.TankID, filter.FishID, filter.ActiveAt,
+	)
+	if err != nil {
+		return treatments, errors.Wrap(err, "unable to get treatments")
+	}
+
+	rowCount := 0
+	for rows.Next() {
+		t := Treatment{}
+
+		if err := scanTreatment(rows, &t); err != nil {
+			return nil, errors.Wrap(err, "unable to scan row")
+		}
+
+		treatments = append(treatments, t)
+
+		rowCount++
+	}
+
+	if rows.Err() != nil {
+		return nil, errors.Wrap(rows.Err(), "erroring reading rows")
+	}
+
+	logrus.WithFields(logrus.Fields{"rowCount": rowCount}).Info("Treatments queried successfully")
+
+	return treatments, nil
+}
+
+// DeleteTreatment deletes a treatment, its dose schedule and affected fish links
+func (d *Manager) DeleteTreatment(ctx context.Context, id int32) (Treatment, error) {
+	t, err := d.GetTreatment(ctx, id)
+	if err != nil {
+		return t, err
+	}
+
+	if _, err := d.pool.Exec(ctx, "DELETE FROM treatments WHERE id=$1", id); err != nil {
+		return t, errors.Wrap(err, "unable to delete treatment")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id": t.ID,
+	}).Info("Treatment deleted successfully")
+
+	return t, nil
+}
+
+func (d *Manager) ListTreatmentDoses(ctx context.Context, treatmentID int32) ([]TreatmentDose, error) {
+	return d.listTreatmentDoses(ctx, " WHERE d.treatment_id=$1 ORDER BY d.due_at", treatmentID)
+}
+
+// ListDueDoses returns the doses due at or before the given time which haven't been administered
+func (d *Manager) ListDueDoses(ctx context.Context, before time.Time) ([]TreatmentDose, error) {
+	return d.listTreatmentDoses(ctx, " WHERE d.administered_at IS NULL AND d.due_at <= $1 ORDER BY d.due_at", before)
+}
+
+func (d *Manager) listTreatmentDoses(ctx context.Context, where string, args ...interface{}) ([]TreatmentDose, error) {
+	doses := make([]TreatmentDose, 0)
+
+	rows, err := d.pool.Query(ctx, treatmentDoseSelect+where, args...)
+	if err != nil {
+		return doses, errors.Wrap(err, "unable to get treatment doses")
+	}
+
+	rowCount := 0
+	for rows.Next() {
+		td := TreatmentDose{}
+
+		if err := scanTreatmentDose(rows, &td); err != nil {
+			return nil, errors.Wrap(err, "unable to scan row")
+		}
+
+		doses = append(doses, td)
+
+		rowCount++
+	}
+
+	if rows.Err() != nil {
+		return nil, errors.Wrap(rows.Err(), "erroring reading rows")
+	}
+
+	logrus.WithFields(logrus.Fields{"rowCount": rowCount}).Info("Treatment Doses queried successfully")
+
+	return doses, nil
+}
+
+// AdministerDose records that a scheduled dose was given at the provided time. A dose which
+// has already been administered is a conflict, so it isn't recorded twice.
+func (d *Manager) AdministerDose(ctx context.Context, id int32, at time.Time) (TreatmentDose, error) {
+	td := TreatmentDose{}
+
+	err := scanTreatmentDose(d.pool.QueryRow(
+		ctx,
+		`WITH u AS (UPDATE treatment_doses SET administered_at=$2, updated_at=NOW() WHERE id=$1 AND administered_at IS NULL RETURNING id, treatment_id, due_at, administered_at)
+		SELECT u.id, u.treatment_id, t.tank_id, t.medication, t.dose, t.dose_unit, u.due_at, u.administered_at
+		FROM u
+		JOIN treatments t ON t.id = u.treatment_id`,
+		id, at,
+	), &td)
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return td, errors.Wrap(err, "unable to administer treatment dose")
+		}
+
+		var exists bool
+		if err := d.pool.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM treatment_doses WHERE id=$1)", id).Scan(&exists); err != nil {
+			return td, errors.Wrap(err, "unable to get treatment dose")
+		}
+
+		if exists {
+			return td, &ErrConflict{message: "treatment dose has already been administered"}
+		}
+
+		return td, &ErrNotFound{message: "treatment dose not found"}
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id": td.ID,
+	}).Info("Treatment Dose administered successfully")
+
+	return td, nil
+}
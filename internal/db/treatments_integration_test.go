@@ -0,0 +1,168 @@
+//go:build integration
+// +build integration
+
+package db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+func TestTreatments(t *testing.T) {
+	t.Run("Given a valid Treatment object", func(t *testing.T) {
+		var inserted db.Treatment
+
+		tank, err := mgr.InsertTank(context.Background(), db.Tank{Name: "Hospital"})
+		assert.NoError(t, err)
+
+		affected, err := mgr.InsertFish(context.Background(), db.Fish{Type: "Tetra", Count: 6})
+		assert.NoError(t, err)
+
+		unaffected, err := mgr.InsertFish(context.Background(), db.Fish{Type: "Pleco", Count: 1})
+		assert.NoError(t, err)
+
+		start := time.Date(2021, 8, 1, 9, 0, 0, 0, time.UTC)
+
+		treatment := db.Treatment{
+			TankID:            tank.ID,
+			FishIDs:           []int32{affected.ID},
+			Medication:        "Esha Exit",
+			Dose:              20,
+			DoseUnit:          "drops",
+			DoseIntervalHours: 24,
+			StartDate:         start,
+			EndDate:           start.AddDate(0, 0, 3),
+			Notes:             "Ich on the tetras",
+		}
+
+		t.Run("When it is passed to InsertTreatment", func(t *testing.T) {
+			t.Run("Then it should create the record and dose schedule without error", func(t *testing.T) {
+				inserted, err = mgr.InsertTreatment(context.Background(), treatment)
+				assert.NoError(t, err)
+
+				assert.Equal(t, treatment.TankID, inserted.TankID)
+				assert.Equal(t, treatment.FishIDs, inserted.FishIDs)
+				assert.Equal(t, treatment.Medication, inserted.Medication)
+				assert.Equal(t, treatment.Dose, inserted.Dose)
+				assert.Equal(t, treatment.DoseUnit, inserted.DoseUnit)
+				assert.Equal(t, treatment.DoseIntervalHours, inserted.DoseIntervalHours)
+				assert.True(t, treatment.StartDate.Equal(inserted.StartDate))
+				assert.True(t, treatment.EndDate.Equal(inserted.EndDate))
+
+				doses, err := mgr.ListTreatmentDoses(context.Background(), inserted.ID)
+				assert.NoError(t, err)
+
+				// One dose a day, including the last day of the course
+				assert.Len(t, doses, 4)
+				for i, d := range doses {
+					assert.True(t, start.AddDate(0, 0, i).Equal(d.DueAt))
+					assert.Nil(t, d.AdministeredAt)
+				}
+			})
+		})
+
+		t.Run("When ListTreatments is called for the affected fish", func(t *testing.T) {
+			t.Run("Then the treatment is in its history", func(t *testing.T) {
+				tr, err := mgr.ListTreatments(context.Background(), db.TreatmentFilter{FishID: &affected.ID})
+				assert.NoError(t, err)
+
+				assert.Len(t, tr, 1)
+				assert.Equal(t, inserted.ID, tr[0].ID)
+
+				tr, err = mgr.ListTreatments(context.Background(), db.TreatmentFilter{FishID: &unaffected.ID})
+				assert.NoError(t, err)
+
+				assert.Len(t, tr, 0)
+			})
+		})
+
+		t.Run("When ListTreatments is called for active treatments", func(t *testing.T) {
+			t.Run("Then only treatments in progress are returned", func(t *testing.T) {
+				during := start.AddDate(0, 0, 1)
+				tr, err := mgr.ListTreatments(context.Background(), db.TreatmentFilter{ActiveAt: &during})
+				assert.NoError(t, err)
+				assert.Len(t, tr, 1)
+
+				after := start.AddDate(0, 1, 0)
+				tr, err = mgr.ListTreatments(context.Background(), db.TreatmentFilter{ActiveAt: &after})
+				assert.NoError(t, err)
+				assert.Len(t, tr, 0)
+			})
+		})
+
+		t.Run("When a dose is administered", func(t *testing.T) {
+			t.Run("Then it is no longer due", func(t *testing.T) {
+				due, err := mgr.ListDueDoses(context.Background(), start.Add(time.Hour))
+				assert.NoError(t, err)
+				assert.Len(t, due, 1)
+
+				d, err := mgr.AdministerDose(context.Background(), due[0].ID, start.Add(time.Minute))
+				assert.NoError(t, err)
+				assert.Equal(t, inserted.ID, d.TreatmentID)
+				assert.Equal(t, treatment.Medication, d.Medication)
+				assert.True(t, start.Add(time.Minute).Equal(*d.AdministeredAt))
+
+				due, err = mgr.ListDueDoses(context.Background(), start.Add(time.Hour))
+				assert.NoError(t, err)
+				assert.Len(t, due, 0)
+			})
+		})
+
+		t.Run("When a dose is administered again", func(t *testing.T) {
+			t.Run("Then it conflicts and the first administration is kept", func(t *testing.T) {
+				doses, err := mgr.ListTreatmentDoses(context.Background(), inserted.ID)
+				assert.NoError(t, err)
+
+				_, err = mgr.AdministerDose(context.Background(), doses[0].ID, start.Add(time.Hour))
+				assert.IsType(t, &db.ErrConflict{}, err)
+
+				doses, err = mgr.ListTreatmentDoses(context.Background(), inserted.ID)
+				assert.NoError(t, err)
+				assert.True(t, start.Add(time.Minute).Equal(*doses[0].AdministeredAt))
+			})
+		})
+
+		t.Run("When a dose which doesn't exist is administered", func(t *testing.T) {
+			t.Run("Then it isn't found", func(t *testing.T) {
+				_, err := mgr.AdministerDose(context.Background(), -1, start)
+				assert.IsType(t, &db.ErrNotFound{}, err)
+			})
+		})
+
+		t.Run("When a treatment is passed to InsertTreatment for a fish which doesn't exist", func(t *testing.T) {
+			t.Run("Then it isn't found", func(t *testing.T) {
+				missing := treatment
+				missing.FishIDs = []int32{-1}
+
+				_, err := mgr.InsertTreatment(context.Background(), missing)
+				assert.IsType(t, &db.ErrNotFound{}, err)
+			})
+		})
+
+		t.Run("When DeleteTreatment is called", func(t *testing.T) {
+			t.Run("Then the treatment and its doses are deleted", func(t *testing.T) {
+				tr, err := mgr.DeleteTreatment(context.Background(), inserted.ID)
+				assert.NoError(t, err)
+				assert.Equal(t, inserted.ID, tr.ID)
+
+				_, err = mgr.GetTreatment(context.Background(), inserted.ID)
+				assert.IsType(t, &db.ErrNotFound{}, err)
+
+				doses, err := mgr.ListTreatmentDoses(context.Background(), inserted.ID)
+				assert.NoError(t, err)
+				assert.Len(t, doses, 0)
+			})
+		})
+
+		_, err = mgr.DeleteFish(context.Background(), affected.ID)
+		assert.NoError(t, err)
+		_, err = mgr.DeleteFish(context.Background(), unaffected.ID)
+		assert.NoError(t, err)
+		_, err = mgr.DeleteTank(context.Background(), tank.ID)
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,263 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// User is an account which can log in to the API, the household it belongs to and its
+// role within the household
+type User struct {
+	ID           int32
+	HouseholdID  int32
+	Username     string
+	PasswordHash string
+	Role         string
+	CreatedAt    time.Time
+}
+
+// userRoleOwner is the role which can manage a household, every household must have one
+const userRoleOwner = "OWNER"
+
+const userColumns = "id, household_id, username, password_hash, role, created_at"
+
+func scanUser(row pgx.Row, u *User) error {
+	return row.Scan(&u.ID, &u.HouseholdID, &u.Username, &u.PasswordHash, &u.Role, &u.CreatedAt)
+}
+
+func insertUser(ctx context.Context, tx pgx.Tx, user User) (User, error) {
+	u := User{}
+
+	err := scanUser(tx.QueryRow(
+		ctx,
+		"INSERT INTO users(household_id, username, password_hash, role) VALUES($1, $2, $3, $4) ON CONFLICT DO NOTHING RETURNING "+userColumns,
+		user.HouseholdID, user.Username, user.PasswordHash, user.Role,
+	), &u)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return u, &ErrConflict{message: "username already exists"}
+		}
+
+		return u, errors.Wrap(err, "unable to add user")
+	}
+
+	return u, nil
+}
+
+// InsertUser adds a user, returning an ErrConflict if the username is taken. A user
+// without a HouseholdID is added to a new household called household, which it owns.
+func (d *Manager) InsertUser(ctx context.Context, user User, household string) (User, error) {
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return User{}, errors.Wrap(err, "unable to begin transaction")
+	}
+	defer tx.Rollback(ctx) // #nosec G104 -- no-op after commit
+
+	if user.HouseholdID == 0 {
+		if err := tx.QueryRow(ctx, "INSERT INTO households(name) VALUES($1) RETURNING id", household).Scan(&user.HouseholdID); err != nil {
+			return User{}, errors.Wrap(err, "unable to add household")
+		}
+
+		user.Role = userRoleOwner
+	}
+
+	u, err := insertUser(ctx, tx, user)
+	if err != nil {
+		return u, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return u, errors.Wrap(err, "unable to commit transaction")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id":          u.ID,
+		"householdId": u.HouseholdID,
+	}).Info("User inserted successfully")
+
+	return u, nil
+}
+
+func (d *Manager) GetUser(ctx context.Context, id int32) (User, error) {
+	u := User{}
+
+	if err := scanUser(d.pool.QueryRow(ctx, "SELECT "+userColumns+" FROM users WHERE id=$1", id), &u); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return u, &ErrNotFound{message: "user not found"}
+		}
+
+		return u, errors.Wrap(err, "unable to get user")
+	}
+
+	return u, nil
+}
+
+// GetUserByUsername returns the user with the username, ignoring case
+func (d *Manager) GetUserByUsername(ctx context.Context, username string) (User, error) {
+	u := User{}
+
+	if err := scanUser(d.pool.QueryRow(ctx, "SELECT "+userColumns+" FROM users WHERE lower(username)=lower($1)", username), &u); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return u, &ErrNotFound{message: "user not found"}
+		}
+
+		return u, errors.Wrap(err, "unable to get user")
+	}
+
+	return u, nil
+}
+
+// CountUsers returns the number of users, used to allow the first user to sign up
+func (d *Manager) CountUsers(ctx context.Context) (int64, error) {
+	var count int64
+
+	if err := d.pool.QueryRow(ctx, "SELECT COUNT(*) FROM users").Scan(&count); err != nil {
+		return 0, errors.Wrap(err, "unable to count users")
+	}
+
+	return count, nil
+}
+
+// ListUsers returns the members of a household, ordered by username
+func (d *Manager) ListUsers(ctx context.Context, householdID int32) ([]User, error) {
+	users := make([]User, 0)
+
+	rows, err := d.pool.Query(ctx, "SELECT "+userColumns+" FROM users WHERE household_id=$1 ORDER BY lower(username)", householdID)
+	if err != nil {
+		return users, errors.Wrap(err, "unable to get users")
+	}
+
+	rowCount := 0
+	for rows.Next() {
+		u := User{}
+
+		if err := scanUser(rows, &u); err != nil {
+			return nil, errors.Wrap(err, "unable to scan row")
+		}
+
+		users = append(users, u)
+
+		rowCount++
+	}
+
+	if rows.Err() != nil {
+		return nil, errors.Wrap(rows.Err(), "erroring reading rows")
+	}
+
+	logrus.WithFields(logrus.Fields{"rowCount": rowCount}).Info("Users queried successfully")
+
+	return users, nil
+}
+
+// UpdateUserRole changes the role of a member of a household, returning an ErrConflict if
+// it would leave the household without an owner
+func (d *Manager) UpdateUserRole(ctx context.Context, householdID, id int32, role string) (User, error) {
+	u := User{}
+
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return u, errors.Wrap(err, "unable to begin transaction")
+	}
+	defer tx.Rollback(ctx) // #nosec G104 -- no-op after commit
+
+	if role != userRoleOwner {
+		if err := checkOtherOwner(ctx, tx, householdID, id); err != nil {
+			return u, err
+		}
+	}
+
+	err = scanUser(tx.QueryRow(
+		ctx,
+		"UPDATE users SET role=$3, updated_at=NOW() WHERE household_id=$1 AND id=$2 RETURNING "+userColumns,
+		householdID, id, role,
+	), &u)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return u, &ErrNotFound{message: "user not found"}
+		}
+
+		return u, errors.Wrap(err, "unable to update user")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return u, errors.Wrap(err, "unable to commit transaction")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id":   u.ID,
+		"role": u.Role,
+	}).Info("User updated successfully")
+
+	return u, nil
+}
+
+// DeleteUser removes a member of a household, returning an ErrConflict if it would leave
+// the household without an owner
+func (d *Manager) DeleteUser(ctx context.Context, householdID, id int32) (User, error) {
+	u := User{}
+
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return u, errors.Wrap(err, "unable to begin transaction")
+	}
+	defer tx.Rollback(ctx) // #nosec G104 -- no-op after commit
+
+	if err := checkOtherOwner(ctx, tx, householdID, id); err != nil {
+		return u, err
+	}
+
+	err = scanUser(tx.QueryRow(ctx, "DELETE FROM users WHERE household_id=$1 AND id=$2 RETURNING "+userColumns, householdID, id), &u)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return u, &ErrNotFound{message: "user not found"}
+		}
+
+		return u, errors.Wrap(err, "unable to delete user")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return u, errors.Wrap(err, "unable to commit transaction")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id": u.ID,
+	}).Info("User deleted successfully")
+
+	return u, nil
+}
+
+// checkOtherOwner returns an ErrConflict unless the household has an owner other than
+// the user. The owners are locked so concurrent changes can't remove every owner.
+func checkOtherOwner(ctx context.Context, tx pgx.Tx, householdID, id int32) error {
+	rows, err := tx.Query(ctx, "SELECT id FROM users WHERE household_id=$1 AND role=$2 FOR UPDATE", householdID, userRoleOwner)
+	if err != nil {
+		return errors.Wrap(err, "unable to get owners")
+	}
+	defer rows.Close()
+
+	others := 0
+	for rows.Next() {
+		var owner int32
+		if err := rows.Scan(&owner); err != nil {
+			return errors.Wrap(err, "unable to scan row")
+		}
+
+		if owner != id {
+			others++
+		}
+	}
+
+	if rows.Err() != nil {
+		return errors.Wrap(rows.Err(), "erroring reading rows")
+	}
+
+	if others == 0 {
+		return &ErrConflict{message: "a household must have an owner"}
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+//go:build integration
+// +build integration
+
+package db_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+func TestUsers(t *testing.T) {
+	t.Run("Given a user", func(t *testing.T) {
+		user, err := mgr.InsertUser(context.Background(), db.User{Username: "Nemo", PasswordHash: "hash"}, "Reef")
+		assert.NoError(t, err)
+
+		t.Run("When a user with the same username in a different case is added", func(t *testing.T) {
+			t.Run("Then a conflict is returned", func(t *testing.T) {
+				_, err := mgr.InsertUser(context.Background(), db.User{Username: "nemo", PasswordHash: "hash"}, "Reef")
+				assert.IsType(t, &db.ErrConflict{}, err)
+			})
+		})
+
+		t.Run("When it is added", func(t *testing.T) {
+			t.Run("Then it owns a new household", func(t *testing.T) {
+				h, err := mgr.GetHousehold(context.Background(), user.HouseholdID)
+				assert.NoError(t, err)
+				assert.Equal(t, "Reef", h.Name)
+				assert.Equal(t, "OWNER", user.Role)
+			})
+		})
+
+		t.Run("When a user is added to the same household", func(t *testing.T) {
+			t.Run("Then no new household is created", func(t *testing.T) {
+				u, err := mgr.InsertUser(context.Background(), db.User{HouseholdID: user.HouseholdID, Username: "marlin", PasswordHash: "hash", Role: "EDITOR"}, "")
+				assert.NoError(t, err)
+				assert.Equal(t, user.HouseholdID, u.HouseholdID)
+			})
+		})
+
+		t.Run("When GetUserByUsername is called", func(t *testing.T) {
+			t.Run("Then the user is returned regardless of case", func(t *testing.T) {
+				u, err := mgr.GetUserByUsername(context.Background(), "NEMO")
+				assert.NoError(t, err)
+				assert.Equal(t, user, u)
+
+				_, err = mgr.GetUserByUsername(context.Background(), "dory")
+				assert.IsType(t, &db.ErrNotFound{}, err)
+			})
+		})
+
+		t.Run("When CountUsers is called", func(t *testing.T) {
+			t.Run("Then the user is counted", func(t *testing.T) {
+				count, err := mgr.CountUsers(context.Background())
+				assert.NoError(t, err)
+				assert.GreaterOrEqual(t, count, int64(1))
+			})
+		})
+	})
+}
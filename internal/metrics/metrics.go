@@ -0,0 +1,280 @@
+// Package metrics exposes Prometheus metrics of the RPCs and HTTP requests served, the
+// database connection pool and the latest sensor readings, e.g. to graph water quality
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
+	"github.com/trackmyfish/backend/internal/db"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// Path is where the metrics are served
+const Path = "/metrics"
+
+// namespace prefixes the names of the metrics which aren't standard
+const namespace = "trackmyfish"
+
+// readingsMaxAge is how recently a parameter must have been read for its latest reading
+// to be exported, so the readings of sensors which have stopped reporting disappear
+const readingsMaxAge = 24 * time.Hour
+
+// collectTimeout is how long the database has to return the latest readings when the
+// metrics are scraped
+const collectTimeout = 5 * time.Second
+
+// DB is the database the metrics of the connection pool and latest readings come from
+type DB interface {
+	PoolStats() db.PoolStats
+	LatestSensorReadings(context.Context, time.Time) ([]db.LatestSensorReading, error)
+}
+
+// Metrics are the Prometheus metrics of the gRPC server, the HTTP proxy, the database
+// connection pool and the latest sensor readings
+type Metrics struct {
+	registry *prometheus.Registry
+
+	rpcsHandled   *prometheus.CounterVec
+	rpcDurations  *prometheus.HistogramVec
+	httpRequests  *prometheus.CounterVec
+	httpDurations *prometheus.HistogramVec
+}
+
+// New returns the metrics, along with those of the Go runtime and process, collecting the
+// pool statistics and latest sensor readings from d each time they're scraped
+func New(d DB) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+
+		rpcsHandled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_handled_total",
+			Help: "Total number of RPCs completed on the server, regardless of success or failure.",
+		}, []string{"grpc_service", "grpc_method", "grpc_code"}),
+		rpcDurations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "grpc_server_handling_seconds",
+			Help:    "Histogram of response latency (seconds) of RPCs handled by the server.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"grpc_service", "grpc_method"}),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "Total number of HTTP requests completed by the HTTP proxy.",
+		}, []string{"handler", "method", "code"}),
+		httpDurations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "Histogram of response latency (seconds) of HTTP requests handled by the HTTP proxy.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"handler", "method"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.rpcsHandled, m.rpcDurations, m.httpRequests, m.httpDurations,
+		poolCollector{d},
+		readingsCollector{d},
+	)
+
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func (m *Metrics) Handler() http.Handler {
+	// the other metrics are still served if the latest readings can't be collected
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{
+		ErrorLog:      errorLogger{},
+		ErrorHandling: promhttp.ContinueOnError,
+	})
+}
+
+// errorLogger logs the errors collecting metrics
+type errorLogger struct{}
+
+func (errorLogger) Println(v ...interface{}) {
+	logrus.Error(v...)
+}
+
+// UnaryServerInterceptor counts the RPCs handled by their method and status code, and
+// observes how long they took
+func (m *Metrics) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+
+		rsp, err := handler(ctx, req)
+
+		service, method := splitMethod(info.FullMethod)
+		m.rpcsHandled.WithLabelValues(service, method, status.Code(err).String()).Inc()
+		m.rpcDurations.WithLabelValues(service, method).Observe(time.Since(start).Seconds())
+
+		return rsp, err
+	}
+}
+
+// StreamServerInterceptor counts the streams handled by their method and status code, and
+// observes how long they were open
+func (m *Metrics) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+
+		err := handler(srv, ss)
+
+		service, method := splitMethod(info.FullMethod)
+		m.rpcsHandled.WithLabelValues(service, method, status.Code(err).String()).Inc()
+		m.rpcDurations.WithLabelValues(service, method).Observe(time.Since(start).Seconds())
+
+		return err
+	}
+}
+
+// splitMethod splits a full method name, e.g. "/pkg.Service/Method", into its service and
+// method
+func splitMethod(fullMethod string) (string, string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+
+	if i := strings.LastIndex(fullMethod, "/"); i >= 0 {
+		return fullMethod[:i], fullMethod[i+1:]
+	}
+
+	return "unknown", fullMethod
+}
+
+// Patterns finds the pattern of the handler a request is routed to, e.g. *http.ServeMux
+type Patterns interface {
+	Handler(*http.Request) (http.Handler, string)
+}
+
+// Middleware counts the HTTP requests by the pattern of the handler they're routed to in
+// patterns, their method and their status code, and observes how long they took. Requests
+// aren't labelled by path, so IDs in paths don't create a series each.
+func (m *Metrics) Middleware(patterns Patterns) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			_, pattern := patterns.Handler(r)
+			if pattern == "" {
+				pattern = "none"
+			}
+
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+
+			m.httpRequests.WithLabelValues(pattern, r.Method, strconv.Itoa(rec.status)).Inc()
+			m.httpDurations.WithLabelValues(pattern, r.Method).Observe(time.Since(start).Seconds())
+		})
+	}
+}
+
+// statusRecorder records the status code of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+
+	return s.ResponseWriter.Write(b)
+}
+
+// Flush sends what has been written of a streamed response to the client
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the recorded ResponseWriter, see http.ResponseController
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+var (
+	poolAcquiredConns = prometheus.NewDesc(namespace+"_db_pool_acquired_connections", "Number of connections currently acquired from the pool.", nil, nil)
+	poolIdleConns     = prometheus.NewDesc(namespace+"_db_pool_idle_connections", "Number of idle connections in the pool.", nil, nil)
+	poolTotalConns    = prometheus.NewDesc(namespace+"_db_pool_total_connections", "Number of connections in the pool, including those being established.", nil, nil)
+	poolMaxConns      = prometheus.NewDesc(namespace+"_db_pool_max_connections", "Maximum number of connections in the pool.", nil, nil)
+	poolAcquires      = prometheus.NewDesc(namespace+"_db_pool_acquires_total", "Total number of connections acquired from the pool.", nil, nil)
+	poolWaits         = prometheus.NewDesc(namespace+"_db_pool_waits_total", "Total number of acquires which waited for a connection to be released or established.", nil, nil)
+	poolCancelled     = prometheus.NewDesc(namespace+"_db_pool_cancelled_acquires_total", "Total number of acquires cancelled before getting a connection.", nil, nil)
+	poolAcquireTime   = prometheus.NewDesc(namespace+"_db_pool_acquire_seconds_total", "Total time spent acquiring connections from the pool.", nil, nil)
+
+	readingLabels    = []string{"household_id", "tank_id", "tank", "parameter"}
+	readingValue     = prometheus.NewDesc(namespace+"_sensor_reading_value", "Latest sensor reading of a parameter of a tank.", readingLabels, nil)
+	readingTimestamp = prometheus.NewDesc(namespace+"_sensor_reading_timestamp_seconds", "When the latest sensor reading of a parameter of a tank was read, as a Unix timestamp.", readingLabels, nil)
+)
+
+// poolCollector collects the statistics of the database connection pool
+type poolCollector struct {
+	d DB
+}
+
+func (c poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{poolAcquiredConns, poolIdleConns, poolTotalConns, poolMaxConns, poolAcquires, poolWaits, poolCancelled, poolAcquireTime} {
+		ch <- d
+	}
+}
+
+func (c poolCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.d.PoolStats()
+
+	ch <- prometheus.MustNewConstMetric(poolAcquiredConns, prometheus.GaugeValue, float64(s.AcquiredConns))
+	ch <- prometheus.MustNewConstMetric(poolIdleConns, prometheus.GaugeValue, float64(s.IdleConns))
+	ch <- prometheus.MustNewConstMetric(poolTotalConns, prometheus.GaugeValue, float64(s.TotalConns))
+	ch <- prometheus.MustNewConstMetric(poolMaxConns, prometheus.GaugeValue, float64(s.MaxConns))
+	ch <- prometheus.MustNewConstMetric(poolAcquires, prometheus.CounterValue, float64(s.AcquireCount))
+	ch <- prometheus.MustNewConstMetric(poolWaits, prometheus.CounterValue, float64(s.EmptyAcquireCount))
+	ch <- prometheus.MustNewConstMetric(poolCancelled, prometheus.CounterValue, float64(s.CanceledAcquireCount))
+	ch <- prometheus.MustNewConstMetric(poolAcquireTime, prometheus.CounterValue, s.AcquireDuration.Seconds())
+}
+
+// readingsCollector collects the latest sensor reading of each parameter of each tank,
+// which have been read within readingsMaxAge
+type readingsCollector struct {
+	d DB
+}
+
+func (c readingsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- readingValue
+	ch <- readingTimestamp
+}
+
+func (c readingsCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), collectTimeout)
+	defer cancel()
+
+	readings, err := c.d.LatestSensorReadings(ctx, time.Now().Add(-readingsMaxAge))
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(readingValue, err)
+		return
+	}
+
+	for _, r := range readings {
+		labels := []string{strconv.Itoa(int(r.HouseholdID)), strconv.Itoa(int(r.TankID)), r.TankName, r.Parameter}
+
+		ch <- prometheus.MustNewConstMetric(readingValue, prometheus.GaugeValue, r.Value, labels...)
+		ch <- prometheus.MustNewConstMetric(readingTimestamp, prometheus.GaugeValue, float64(r.ReadAt.Unix()), labels...)
+	}
+}
@@ -0,0 +1,155 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/trackmyfish/backend/internal/db"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	m := New(&dbMock{})
+	interceptor := m.UnaryServerInterceptor()
+
+	t.Run("Given RPCs handled by the server", func(t *testing.T) {
+		t.Run("When they succeed or fail", func(t *testing.T) {
+			t.Run("Then they are counted by method and code", func(t *testing.T) {
+				info := &grpc.UnaryServerInfo{FullMethod: "/trackmyfish.v1alpha1.TrackMyFishService/ListTanks"}
+
+				for _, err := range []error{nil, nil, status.Error(codes.Unauthenticated, "unauthenticated")} {
+					_, _ = interceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+						return nil, err
+					})
+				}
+
+				assert.Equal(t, float64(2), testutil.ToFloat64(m.rpcsHandled.WithLabelValues("trackmyfish.v1alpha1.TrackMyFishService", "ListTanks", "OK")))
+				assert.Equal(t, float64(1), testutil.ToFloat64(m.rpcsHandled.WithLabelValues("trackmyfish.v1alpha1.TrackMyFishService", "ListTanks", "Unauthenticated")))
+			})
+		})
+	})
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	m := New(&dbMock{})
+	interceptor := m.StreamServerInterceptor()
+
+	t.Run("Given streams handled by the server", func(t *testing.T) {
+		t.Run("When they end", func(t *testing.T) {
+			t.Run("Then they are counted by method and code", func(t *testing.T) {
+				info := &grpc.StreamServerInfo{FullMethod: "/trackmyfish.v1alpha1.SensorReadingService/StreamReadings"}
+
+				for _, err := range []error{nil, status.Error(codes.PermissionDenied, "forbidden")} {
+					_ = interceptor(nil, nil, info, func(srv interface{}, ss grpc.ServerStream) error {
+						return err
+					})
+				}
+
+				assert.Equal(t, float64(1), testutil.ToFloat64(m.rpcsHandled.WithLabelValues("trackmyfish.v1alpha1.SensorReadingService", "StreamReadings", "OK")))
+				assert.Equal(t, float64(1), testutil.ToFloat64(m.rpcsHandled.WithLabelValues("trackmyfish.v1alpha1.SensorReadingService", "StreamReadings", "PermissionDenied")))
+			})
+		})
+	})
+}
+
+func TestMiddleware(t *testing.T) {
+	m := New(&dbMock{})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1alpha1/tanks/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	mux.HandleFunc("/api/v1alpha1/watch/tanks/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(": watching\n\n"))
+		w.(http.Flusher).Flush()
+	})
+
+	handler := m.Middleware(mux)(mux)
+
+	t.Run("Given HTTP requests", func(t *testing.T) {
+		t.Run("When they are served", func(t *testing.T) {
+			t.Run("Then they are counted by the pattern they're routed to", func(t *testing.T) {
+				for _, path := range []string{"/api/v1alpha1/tanks/1", "/api/v1alpha1/tanks/2", "/api/v1alpha1/watch/tanks/1", "/unknown"} {
+					rec := httptest.NewRecorder()
+					handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+				}
+
+				assert.Equal(t, float64(2), testutil.ToFloat64(m.httpRequests.WithLabelValues("/api/v1alpha1/tanks/", http.MethodGet, "404")))
+				assert.Equal(t, float64(1), testutil.ToFloat64(m.httpRequests.WithLabelValues("/api/v1alpha1/watch/tanks/", http.MethodGet, "200")))
+				assert.Equal(t, float64(1), testutil.ToFloat64(m.httpRequests.WithLabelValues("none", http.MethodGet, "404")))
+			})
+		})
+	})
+}
+
+func TestHandler(t *testing.T) {
+	dm := &dbMock{
+		stats: db.PoolStats{AcquiredConns: 2, IdleConns: 3, TotalConns: 5, MaxConns: 10, AcquireCount: 40, EmptyAcquireCount: 4, AcquireDuration: 2 * time.Second},
+		readings: []db.LatestSensorReading{
+			{HouseholdID: 1, TankID: 4, TankName: "Reef", Parameter: "ph", Value: 8.2, ReadAt: time.Date(2021, 8, 6, 10, 0, 0, 0, time.UTC)},
+		},
+	}
+	m := New(dm)
+
+	scrape := func() (int, string) {
+		rec := httptest.NewRecorder()
+		m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, Path, nil))
+
+		return rec.Code, rec.Body.String()
+	}
+
+	t.Run("Given a pool and latest readings", func(t *testing.T) {
+		t.Run("When the metrics are scraped", func(t *testing.T) {
+			t.Run("Then they are exported", func(t *testing.T) {
+				code, body := scrape()
+
+				assert.Equal(t, http.StatusOK, code)
+				assert.Contains(t, body, "trackmyfish_db_pool_acquired_connections 2\n")
+				assert.Contains(t, body, "trackmyfish_db_pool_idle_connections 3\n")
+				assert.Contains(t, body, "trackmyfish_db_pool_waits_total 4\n")
+				assert.Contains(t, body, "trackmyfish_db_pool_acquire_seconds_total 2\n")
+				assert.Contains(t, body, `trackmyfish_sensor_reading_value{household_id="1",parameter="ph",tank="Reef",tank_id="4"} 8.2`+"\n")
+				assert.Contains(t, body, `trackmyfish_sensor_reading_timestamp_seconds{household_id="1",parameter="ph",tank="Reef",tank_id="4"} 1.628244e+09`+"\n")
+				assert.True(t, dm.since.After(time.Now().Add(-readingsMaxAge-time.Minute)))
+			})
+		})
+	})
+
+	t.Run("Given the latest readings can't be queried", func(t *testing.T) {
+		dm.err = assert.AnError
+
+		t.Run("When the metrics are scraped", func(t *testing.T) {
+			t.Run("Then the other metrics are still exported", func(t *testing.T) {
+				code, body := scrape()
+
+				assert.Equal(t, http.StatusOK, code)
+				assert.Contains(t, body, "trackmyfish_db_pool_acquired_connections 2\n")
+				assert.NotContains(t, body, "trackmyfish_sensor_reading_value{")
+			})
+		})
+	})
+}
+
+type dbMock struct {
+	stats    db.PoolStats
+	readings []db.LatestSensorReading
+	since    time.Time
+	err      error
+}
+
+func (m *dbMock) PoolStats() db.PoolStats {
+	return m.stats
+}
+
+func (m *dbMock) LatestSensorReadings(_ context.Context, since time.Time) ([]db.LatestSensorReading, error) {
+	m.since = since
+
+	return m.readings, m.err
+}
@@ -0,0 +1,293 @@
+// Package mqtt records the readings sensors publish to an MQTT broker, e.g. the one used
+// by a home automation system
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+// DefaultClientID is the client ID the bridge connects to the broker with if none is
+// configured. The broker keeps the subscriptions of the client between connections, so
+// readings published while the bridge is disconnected are delivered when it reconnects.
+const DefaultClientID = "trackmyfish"
+
+// maxSensorIDLength is the longest topic which can be used as the ID of its sensor
+const maxSensorIDLength = 64
+
+// disconnectQuiesce is how long, in milliseconds, the bridge waits for readings being
+// recorded when it's stopped
+const disconnectQuiesce = 250
+
+// Topic maps an MQTT topic to the tank and parameter its readings are of
+type Topic struct {
+	Topic     string `mapstructure:"topic"`
+	TankID    int32  `mapstructure:"tankId"`
+	Parameter string `mapstructure:"parameter"`
+	// Field is the field of a JSON payload holding the value, e.g. "DS18B20.Temperature"
+	// for nested objects. Payloads which are just a number are read as they are.
+	Field string `mapstructure:"field"`
+	// SensorID identifies the sensor the readings are from. It defaults to the topic.
+	SensorID string `mapstructure:"sensorId"`
+}
+
+type Config struct {
+	// Broker is the address of the broker, e.g. tcp://localhost:1883
+	Broker   string
+	ClientID string
+	Username string
+	Password string
+	// QoS is the quality of service the topics are subscribed with
+	QoS byte
+	// HouseholdID is the household the tanks belong to, or 0 for data without a household
+	HouseholdID int32
+	Topics      []Topic
+}
+
+// Recorder checks and adds a sensor reading. Readings are recorded the same way as those
+// streamed by sensors rather than as tank statistics, as tank statistics aren't recorded
+// per tank and can't hold parameters such as temperature.
+type Recorder interface {
+	RecordReading(context.Context, db.SensorReading) error
+}
+
+// Bridge subscribes to the configured topics and records the readings published to them
+type Bridge struct {
+	topics   map[string]Topic
+	qos      byte
+	ctx      context.Context
+	recorder Recorder
+	client   paho.Client
+
+	mu sync.Mutex
+	// sequences are the last sequence given to a reading of each sensor
+	sequences map[string]int64
+}
+
+// New returns a Bridge for the given config, which records readings with r
+func New(c Config, r Recorder) (*Bridge, error) {
+	if c.Broker == "" {
+		return nil, errors.New("broker is required")
+	}
+
+	if c.QoS > 2 {
+		return nil, errors.Errorf("invalid QoS %d, must be 0, 1 or 2", c.QoS)
+	}
+
+	if len(c.Topics) == 0 {
+		return nil, errors.New("at least one topic is required")
+	}
+
+	b := &Bridge{topics: map[string]Topic{}, qos: c.QoS, ctx: context.Background(), recorder: r, sequences: map[string]int64{}}
+
+	for _, t := range c.Topics {
+		switch {
+		case t.Topic == "":
+			return nil, errors.New("topic is required")
+		case strings.ContainsAny(t.Topic, "+#"):
+			return nil, errors.Errorf("topic %q can't contain wildcards", t.Topic)
+		case t.TankID == 0:
+			return nil, errors.Errorf("tankId is required for topic %q", t.Topic)
+		case t.Parameter == "":
+			return nil, errors.Errorf("parameter is required for topic %q", t.Topic)
+		}
+
+		if _, ok := b.topics[t.Topic]; ok {
+			return nil, errors.Errorf("topic %q is mapped more than once", t.Topic)
+		}
+
+		if t.SensorID == "" {
+			t.SensorID = t.Topic
+		}
+
+		if len(t.SensorID) > maxSensorIDLength {
+			return nil, errors.Errorf("topic %q is too long to identify its sensor, give it a sensorId", t.Topic)
+		}
+
+		b.topics[t.Topic] = t
+	}
+
+	if c.HouseholdID != 0 {
+		b.ctx = db.WithHousehold(b.ctx, c.HouseholdID)
+	}
+
+	clientID := c.ClientID
+	if clientID == "" {
+		clientID = DefaultClientID
+	}
+
+	opts := paho.NewClientOptions().
+		AddBroker(c.Broker).
+		SetClientID(clientID).
+		SetUsername(c.Username).
+		SetPassword(c.Password).
+		SetCleanSession(false).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetOnConnectHandler(b.subscribe).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			logrus.WithError(err).Warn("Lost connection to MQTT broker, reconnecting")
+		})
+
+	b.client = paho.NewClient(opts)
+
+	return b, nil
+}
+
+// Start connects to the broker in the background, retrying until it connects. The topics
+// are subscribed to whenever the bridge connects.
+func (b *Bridge) Start() {
+	b.client.Connect()
+}
+
+// Stop disconnects from the broker
+func (b *Bridge) Stop() {
+	b.client.Disconnect(disconnectQuiesce)
+}
+
+// subscribe subscribes to the topics once connected to the broker
+func (b *Bridge) subscribe(c paho.Client) {
+	filters := make(map[string]byte, len(b.topics))
+	for t := range b.topics {
+		filters[t] = b.qos
+	}
+
+	token := c.SubscribeMultiple(filters, func(_ paho.Client, m paho.Message) {
+		// the broker sends the last retained message of a topic on subscribing, which was
+		// read when it was published, not now, and recorded if the bridge was subscribed
+		if m.Retained() {
+			logrus.WithField("topic", m.Topic()).Debug("Ignoring retained MQTT reading")
+			return
+		}
+
+		b.handle(m.Topic(), m.Payload(), time.Now().UTC())
+	})
+
+	go func() {
+		if token.Wait(); token.Error() != nil {
+			logrus.WithError(token.Error()).Error("unable to subscribe to MQTT topics")
+			return
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"topics": len(filters),
+		}).Info("Subscribed to MQTT topics")
+	}()
+}
+
+// handle records the reading published to a topic at receivedAt. Readings are numbered
+// by when they were received, see nextSequence, as sensors publishing to MQTT don't number
+// them.
+func (b *Bridge) handle(topic string, payload []byte, receivedAt time.Time) {
+	t, ok := b.topics[topic]
+	if !ok {
+		return
+	}
+
+	log := logrus.WithField("topic", topic)
+
+	value, err := parseValue(payload, t.Field)
+	if err != nil {
+		log.WithError(err).Warn("Ignoring invalid MQTT reading")
+		return
+	}
+
+	reading := db.SensorReading{
+		SensorID:  t.SensorID,
+		Sequence:  b.nextSequence(t.SensorID, receivedAt),
+		TankID:    t.TankID,
+		Parameter: t.Parameter,
+		Value:     value,
+		ReadAt:    receivedAt,
+	}
+
+	if err := b.recorder.RecordReading(b.ctx, reading); err != nil {
+		log.WithError(err).Error("unable to record MQTT reading")
+	}
+}
+
+// nextSequence returns the sequence of a reading of a sensor received at receivedAt, which
+// is when it was received in nanoseconds, or one more than the sensor's last sequence if
+// that's no later, so readings received together are still recorded rather than being
+// taken for duplicates
+func (b *Bridge) nextSequence(sensorID string, receivedAt time.Time) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	seq := receivedAt.UnixNano()
+	if last := b.sequences[sensorID]; seq <= last {
+		seq = last + 1
+	}
+
+	b.sequences[sensorID] = seq
+
+	return seq
+}
+
+// parseValue returns the finite number in a payload, which is either just the number or a JSON
+// object holding it in field. Fields of nested objects are separated by dots.
+func parseValue(payload []byte, field string) (float64, error) {
+	v, err := parseNumber(payload, field)
+	if err != nil {
+		return 0, err
+	}
+
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, errors.Errorf("%v isn't a finite number", v)
+	}
+
+	return v, nil
+}
+
+func parseNumber(payload []byte, field string) (float64, error) {
+	p := strings.TrimSpace(string(payload))
+
+	if field == "" {
+		v, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			return 0, errors.Errorf("payload %q isn't a number", p)
+		}
+
+		return v, nil
+	}
+
+	var v interface{}
+	if err := json.Unmarshal([]byte(p), &v); err != nil {
+		return 0, errors.Wrap(err, "payload isn't JSON")
+	}
+
+	for _, name := range strings.Split(field, ".") {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return 0, errors.Errorf("payload has no field %q", field)
+		}
+
+		if v, ok = obj[name]; !ok {
+			return 0, errors.Errorf("payload has no field %q", field)
+		}
+	}
+
+	switch n := v.(type) {
+	case float64:
+		return n, nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		if err != nil {
+			return 0, errors.Errorf("field %q isn't a number", field)
+		}
+
+		return f, nil
+	default:
+		return 0, errors.Errorf("field %q isn't a number", field)
+	}
+}
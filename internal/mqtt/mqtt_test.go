@@ -0,0 +1,249 @@
+package mqtt
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+	"github.com/stretchr/testify/assert"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+func TestBridge(t *testing.T) {
+	b := startBroker(t)
+	rec := &recorderMock{readings: make(chan db.SensorReading, 10)}
+
+	bridge, err := New(Config{
+		Broker: "tcp://" + b.addr(),
+		Topics: []Topic{
+			{Topic: "aquarium/reef/ph", TankID: 1, Parameter: "ph"},
+			{Topic: "tele/sonoff/SENSOR", TankID: 2, Parameter: "temperature", Field: "DS18B20.Temperature", SensorID: "sonoff"},
+		},
+	}, rec)
+	assert.NoError(t, err)
+
+	t.Run("Given a bridge connected to a broker", func(t *testing.T) {
+		bridge.Start()
+		defer bridge.Stop()
+
+		select {
+		case topics := <-b.subscribed:
+			assert.ElementsMatch(t, []string{"aquarium/reef/ph", "tele/sonoff/SENSOR"}, topics)
+		case <-time.After(5 * time.Second):
+			t.Fatal("bridge didn't subscribe")
+		}
+
+		t.Run("When readings are published to the topics", func(t *testing.T) {
+			// retained readings aren't recorded
+			b.publish("aquarium/reef/ph", "7.0", true)
+			b.publish("aquarium/reef/ph", "8.1", false)
+			b.publish("tele/sonoff/SENSOR", `{"Time": "2021-08-06T10:00:00", "DS18B20": {"Temperature": 25.4}}`, false)
+
+			t.Run("Then they are recorded for the tanks and parameters of the topics", func(t *testing.T) {
+				for _, expected := range []db.SensorReading{
+					{SensorID: "aquarium/reef/ph", TankID: 1, Parameter: "ph", Value: 8.1},
+					{SensorID: "sonoff", TankID: 2, Parameter: "temperature", Value: 25.4},
+				} {
+					select {
+					case r := <-rec.readings:
+						assert.NotZero(t, r.Sequence)
+						assert.False(t, r.ReadAt.IsZero())
+
+						r.Sequence, r.ReadAt = 0, time.Time{}
+						assert.Equal(t, expected, r)
+					case <-time.After(5 * time.Second):
+						t.Fatal("reading wasn't recorded")
+					}
+				}
+			})
+		})
+	})
+}
+
+func TestHandle(t *testing.T) {
+	rec := &recorderMock{readings: make(chan db.SensorReading, 10)}
+
+	bridge, err := New(Config{
+		Broker: "tcp://localhost:1883",
+		Topics: []Topic{{Topic: "aquarium/reef/ph", TankID: 1, Parameter: "ph"}},
+	}, rec)
+	assert.NoError(t, err)
+
+	t.Run("Given readings received at the same time", func(t *testing.T) {
+		receivedAt := time.Date(2021, 8, 6, 10, 0, 0, 0, time.UTC)
+
+		t.Run("When they are handled", func(t *testing.T) {
+			bridge.handle("aquarium/reef/ph", []byte("8.1"), receivedAt)
+			bridge.handle("aquarium/reef/ph", []byte("8.2"), receivedAt)
+
+			t.Run("Then they are numbered in the order they were received", func(t *testing.T) {
+				first, second := <-rec.readings, <-rec.readings
+
+				assert.Equal(t, receivedAt.UnixNano(), first.Sequence)
+				assert.Equal(t, receivedAt.UnixNano()+1, second.Sequence)
+				assert.Equal(t, 8.2, second.Value)
+			})
+		})
+	})
+}
+
+func TestNew(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		config   Config
+		expected string
+	}{
+		{desc: "without a broker", config: Config{Topics: []Topic{{Topic: "ph", TankID: 1, Parameter: "ph"}}}, expected: "broker is required"},
+		{desc: "without topics", config: Config{Broker: "tcp://localhost:1883"}, expected: "at least one topic is required"},
+		{desc: "with a wildcard topic", config: Config{Broker: "tcp://localhost:1883", Topics: []Topic{{Topic: "aquarium/+/ph", TankID: 1, Parameter: "ph"}}}, expected: `topic "aquarium/+/ph" can't contain wildcards`},
+		{desc: "with a topic without a tank", config: Config{Broker: "tcp://localhost:1883", Topics: []Topic{{Topic: "ph", Parameter: "ph"}}}, expected: `tankId is required for topic "ph"`},
+		{desc: "with a topic mapped twice", config: Config{Broker: "tcp://localhost:1883", Topics: []Topic{{Topic: "ph", TankID: 1, Parameter: "ph"}, {Topic: "ph", TankID: 2, Parameter: "ph"}}}, expected: `topic "ph" is mapped more than once`},
+	}
+	for _, tC := range testCases {
+		t.Run("Given a config "+tC.desc, func(t *testing.T) {
+			t.Run("When a bridge is created", func(t *testing.T) {
+				t.Run("Then an error is returned", func(t *testing.T) {
+					_, err := New(tC.config, &recorderMock{})
+					assert.EqualError(t, err, tC.expected)
+				})
+			})
+		})
+	}
+}
+
+func TestParseValue(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		payload  string
+		field    string
+		expected float64
+		err      bool
+	}{
+		{desc: "a number", payload: " 7.9\n", expected: 7.9},
+		{desc: "a JSON field", payload: `{"value": 7.9}`, field: "value", expected: 7.9},
+		{desc: "a nested JSON field", payload: `{"DS18B20": {"Temperature": 25.4}}`, field: "DS18B20.Temperature", expected: 25.4},
+		{desc: "a JSON field holding a string", payload: `{"value": "7.9"}`, field: "value", expected: 7.9},
+		{desc: "text", payload: "online", err: true},
+		{desc: "JSON without the field", payload: `{"temperature": 25.4}`, field: "value", err: true},
+		{desc: "a JSON field which isn't a number", payload: `{"value": true}`, field: "value", err: true},
+		{desc: "NaN", payload: "nan", err: true},
+		{desc: "infinity", payload: "-Inf", err: true},
+		{desc: "a JSON field holding infinity", payload: `{"value": "Infinity"}`, field: "value", err: true},
+	}
+	for _, tC := range testCases {
+		t.Run("Given "+tC.desc, func(t *testing.T) {
+			t.Run("When the value is parsed", func(t *testing.T) {
+				v, err := parseValue([]byte(tC.payload), tC.field)
+
+				if tC.err {
+					t.Run("Then an error is returned", func(t *testing.T) {
+						assert.Error(t, err)
+					})
+
+					return
+				}
+
+				t.Run("Then the number is returned", func(t *testing.T) {
+					assert.NoError(t, err)
+					assert.Equal(t, tC.expected, v)
+				})
+			})
+		})
+	}
+}
+
+type recorderMock struct {
+	readings chan db.SensorReading
+}
+
+func (r *recorderMock) RecordReading(_ context.Context, reading db.SensorReading) error {
+	r.readings <- reading
+	return nil
+}
+
+// broker is an MQTT broker embedded in the tests. It serves a single client, and only
+// what the bridge needs: connecting, subscribing and being published to with QoS 0.
+type broker struct {
+	t          *testing.T
+	ln         net.Listener
+	subscribed chan []string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func startBroker(t *testing.T) *broker {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := &broker{t: t, ln: ln, subscribed: make(chan []string, 1)}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		b.mu.Lock()
+		b.conn = conn
+		b.mu.Unlock()
+
+		b.serve(conn)
+	}()
+
+	return b
+}
+
+func (b *broker) addr() string {
+	return b.ln.Addr().String()
+}
+
+func (b *broker) serve(conn net.Conn) {
+	for {
+		p, err := packets.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+
+		switch p := p.(type) {
+		case *packets.ConnectPacket:
+			b.write(packets.NewControlPacket(packets.Connack))
+		case *packets.SubscribePacket:
+			suback := packets.NewControlPacket(packets.Suback).(*packets.SubackPacket)
+			suback.MessageID = p.MessageID
+			suback.ReturnCodes = p.Qoss
+			b.write(suback)
+
+			b.subscribed <- p.Topics
+		case *packets.PingreqPacket:
+			b.write(packets.NewControlPacket(packets.Pingresp))
+		case *packets.DisconnectPacket:
+			return
+		}
+	}
+}
+
+func (b *broker) publish(topic, payload string, retained bool) {
+	p := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+	p.TopicName = topic
+	p.Payload = []byte(payload)
+	p.Retain = retained
+
+	b.write(p)
+}
+
+func (b *broker) write(p packets.ControlPacket) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := p.Write(b.conn); err != nil {
+		b.t.Errorf("unable to write %s: %v", p, err)
+	}
+}
@@ -0,0 +1,264 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/trackmyfish/backend/internal/auth"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+const (
+	apiKeysPath     = "/api/v1alpha1/api-keys"
+	apiKeysResource = "api-keys"
+
+	// apiKeyPrefixLength is the number of characters of a key stored to recognise it by
+	apiKeyPrefixLength  = 12
+	maxAPIKeyNameLength = 255
+)
+
+// scopeResources are the resources an API key can be scoped to
+var scopeResources = map[string]bool{
+	"attachments":     true,
+	"breedings":       true,
+	"dosing":          true,
+	"fertilisers":     true,
+	"fish":            true,
+	"fish-groups":     true,
+	"growth":          true,
+	"individuals":     true,
+	"journal":         true,
+	"lineage":         true,
+	"measurements":    true,
+	"notes":           true,
+	"quarantines":     true,
+	"readings":        true,
+	"species":         true,
+	"tank-roles":      true,
+	"tank-statistics": true,
+	"tanks":           true,
+	"treatment-doses": true,
+	"treatments":      true,
+}
+
+// tankScopeResources are the resources whose endpoints enforce the tank an API key is
+// scoped to, so are the only resources a key can be scoped to a tank of, see tankScopedPaths
+var tankScopeResources = map[string]bool{
+	"readings": true,
+	"tanks":    true,
+}
+
+type apiKeyQuerier interface {
+	ListAPIKeys(context.Context, int32) ([]db.APIKey, error)
+	UseAPIKey(context.Context, string) (db.APIKey, db.User, error)
+}
+
+type apiKeyModifier interface {
+	InsertAPIKey(context.Context, db.APIKey, string) (db.APIKey, error)
+	DeleteAPIKey(context.Context, int32, int32) (db.APIKey, error)
+}
+
+type scope struct {
+	Resource   string `json:"resource"`
+	Permission string `json:"permission"`
+	TankID     *int32 `json:"tankId,omitempty"`
+}
+
+type apiKeyRequest struct {
+	Name  string `json:"name"`
+	Scope *scope `json:"scope"`
+}
+
+type apiKeyResponse struct {
+	ID         int32      `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scope      *scope     `json:"scope,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	// Key is only returned when the API key is created
+	Key string `json:"key,omitempty"`
+}
+
+func toAPIKeyResponse(k db.APIKey) apiKeyResponse {
+	rsp := apiKeyResponse{
+		ID:         k.ID,
+		Name:       k.Name,
+		Prefix:     k.Prefix,
+		LastUsedAt: k.LastUsedAt,
+		CreatedAt:  k.CreatedAt,
+	}
+
+	if k.ScopeResource != "" {
+		rsp.Scope = &scope{Resource: k.ScopeResource, Permission: k.ScopePermission, TankID: k.ScopeTankID}
+	}
+
+	return rsp
+}
+
+// apiKeyVerifier implements auth.KeyVerifier, looking API keys up by their hash
+type apiKeyVerifier struct {
+	apiKeyQuerier apiKeyQuerier
+}
+
+func (v apiKeyVerifier) VerifyKey(ctx context.Context, key string) (auth.Identity, error) {
+	if !strings.HasPrefix(key, auth.APIKeyPrefix) {
+		return auth.Identity{}, auth.ErrUnauthenticated
+	}
+
+	k, u, err := v.apiKeyQuerier.UseAPIKey(ctx, auth.HashOpaqueToken(key))
+	if err != nil {
+		var nf *db.ErrNotFound
+		if !errors.As(err, &nf) {
+			logrus.WithError(err).Error("Unable to verify API key")
+		}
+
+		return auth.Identity{}, auth.ErrUnauthenticated
+	}
+
+	id := auth.Identity{UserID: u.ID, Username: u.Username, HouseholdID: u.HouseholdID, APIKeyID: k.ID}
+
+	if k.ScopeResource != "" {
+		p, err := auth.ParsePermission(k.ScopePermission)
+		if err != nil {
+			return auth.Identity{}, auth.ErrUnauthenticated
+		}
+
+		id.Scope = &auth.Scope{Resource: k.ScopeResource, Permission: p}
+		if k.ScopeTankID != nil {
+			id.Scope.TankID = *k.ScopeTankID
+		}
+	}
+
+	return id, nil
+}
+
+// handleAPIKeys serves /api/v1alpha1/api-keys, the API keys of the authenticated user
+//
+// GET lists the API keys. POST creates an API key, optionally scoped to a resource and
+// permission, and for readings and tanks to a single tank, returning the key. The key
+// can't be retrieved later.
+func (s *Server) handleAPIKeys(w http.ResponseWriter, r *http.Request) {
+	id, ok := auth.FromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, auth.ErrUnauthenticated)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		rsp, err := s.apiKeyQuerier.ListAPIKeys(r.Context(), id.UserID)
+		if err != nil {
+			writeError(w, statusForError(err), errors.Wrap(err, "unable to list api keys"))
+			return
+		}
+
+		keys := make([]apiKeyResponse, len(rsp))
+		for i, k := range rsp {
+			keys[i] = toAPIKeyResponse(k)
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{"apiKeys": keys})
+	case http.MethodPost:
+		s.addAPIKey(w, r, id)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// handleAPIKey serves /api/v1alpha1/api-keys/{id}, where DELETE revokes the API key
+func (s *Server) handleAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, ok := auth.FromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, auth.ErrUnauthenticated)
+		return
+	}
+
+	keyID, rest, err := pathID(r.URL.Path, "/api/v1alpha1/api-keys/")
+	if err != nil || rest != "" {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	if r.Method != http.MethodDelete {
+		methodNotAllowed(w, http.MethodDelete)
+		return
+	}
+
+	rsp, err := s.apiKeyModifier.DeleteAPIKey(r.Context(), id.UserID, keyID)
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to delete api key"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, toAPIKeyResponse(rsp))
+}
+
+func (s *Server) addAPIKey(w http.ResponseWriter, r *http.Request, id auth.Identity) {
+	var req apiKeyRequest
+	if err := readJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > maxAPIKeyNameLength {
+		writeError(w, http.StatusBadRequest, errors.Errorf("name must be between 1 and %d characters", maxAPIKeyNameLength))
+		return
+	}
+
+	k := db.APIKey{UserID: id.UserID, Name: name}
+
+	if req.Scope != nil {
+		if !scopeResources[req.Scope.Resource] {
+			writeError(w, http.StatusBadRequest, errors.Errorf("invalid scope resource %q", req.Scope.Resource))
+			return
+		}
+
+		p, err := auth.ParsePermission(req.Scope.Permission)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		k.ScopeResource, k.ScopePermission = req.Scope.Resource, p.String()
+
+		if req.Scope.TankID != nil {
+			if !tankScopeResources[req.Scope.Resource] {
+				writeError(w, http.StatusBadRequest, errors.Errorf("scope resource %q can't be restricted to a tank", req.Scope.Resource))
+				return
+			}
+
+			if err := s.checkTank(r.Context(), *req.Scope.TankID); err != nil {
+				writeError(w, statusForError(err), err)
+				return
+			}
+
+			k.ScopeTankID = req.Scope.TankID
+		}
+	}
+
+	token, err := auth.NewOpaqueToken()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	key := auth.APIKeyPrefix + token
+	k.Prefix = key[:apiKeyPrefixLength]
+
+	rsp, err := s.apiKeyModifier.InsertAPIKey(r.Context(), k, auth.HashOpaqueToken(key))
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to add api key"))
+		return
+	}
+
+	created := toAPIKeyResponse(rsp)
+	created.Key = key
+
+	writeJSON(w, http.StatusCreated, created)
+}
@@ -0,0 +1,267 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trackmyfish/backend/internal/auth"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+func TestAddAPIKey(t *testing.T) {
+	km := &apiKeyMock{}
+	tm := &tankMock{getTankResponse: db.Tank{ID: 4}}
+	s := Server{apiKeyModifier: km, tankQuerier: tm}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	user := auth.Identity{UserID: 3, Username: "nemo", HouseholdID: 2, Role: auth.RoleEditor}
+
+	request := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1alpha1/api-keys", strings.NewReader(body))
+
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req.WithContext(auth.NewContext(req.Context(), user)))
+
+		return rec
+	}
+
+	t.Run("Given a request to create an API key", func(t *testing.T) {
+		t.Run("When the scope resource is unknown", func(t *testing.T) {
+			t.Run("Then a bad request is returned", func(t *testing.T) {
+				rec := request(`{"name": "sensor", "scope": {"resource": "members", "permission": "READ"}}`)
+
+				assert.Equal(t, http.StatusBadRequest, rec.Code)
+			})
+		})
+		t.Run("When the scope permission is manage", func(t *testing.T) {
+			t.Run("Then a bad request is returned", func(t *testing.T) {
+				rec := request(`{"name": "sensor", "scope": {"resource": "tanks", "permission": "MANAGE"}}`)
+
+				assert.Equal(t, http.StatusBadRequest, rec.Code)
+			})
+		})
+		t.Run("When it is valid", func(t *testing.T) {
+			t.Run("Then the key is returned and only its hash is stored", func(t *testing.T) {
+				rec := request(`{"name": "sensor", "scope": {"resource": "tank-statistics", "permission": "write"}}`)
+
+				assert.Equal(t, http.StatusCreated, rec.Code)
+
+				var rsp apiKeyResponse
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(&rsp))
+				assert.True(t, strings.HasPrefix(rsp.Key, auth.APIKeyPrefix))
+				assert.Equal(t, auth.HashOpaqueToken(rsp.Key), km.insertAPIKeyHash)
+				assert.Equal(t, db.APIKey{
+					UserID:          3,
+					Name:            "sensor",
+					Prefix:          rsp.Key[:apiKeyPrefixLength],
+					ScopeResource:   "tank-statistics",
+					ScopePermission: "WRITE",
+				}, km.insertAPIKeyRequest)
+			})
+		})
+		t.Run("When it is scoped to a tank", func(t *testing.T) {
+			t.Run("Then the tank is stored with the scope", func(t *testing.T) {
+				rec := request(`{"name": "sensor", "scope": {"resource": "readings", "permission": "WRITE", "tankId": 4}}`)
+
+				assert.Equal(t, http.StatusCreated, rec.Code)
+
+				var rsp apiKeyResponse
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(&rsp))
+				assert.Equal(t, int32(4), *rsp.Scope.TankID)
+				assert.Equal(t, int32(4), *km.insertAPIKeyRequest.ScopeTankID)
+			})
+		})
+		t.Run("When it is scoped to a tank for a resource which isn't of tanks", func(t *testing.T) {
+			t.Run("Then a bad request is returned", func(t *testing.T) {
+				rec := request(`{"name": "sensor", "scope": {"resource": "tank-statistics", "permission": "WRITE", "tankId": 4}}`)
+
+				assert.Equal(t, http.StatusBadRequest, rec.Code)
+			})
+		})
+		t.Run("When it is scoped to a tank which doesn't exist", func(t *testing.T) {
+			t.Run("Then it isn't found", func(t *testing.T) {
+				tm.err = &db.ErrNotFound{}
+				defer func() { tm.err = nil }()
+
+				rec := request(`{"name": "sensor", "scope": {"resource": "readings", "permission": "WRITE", "tankId": 9}}`)
+
+				assert.Equal(t, http.StatusNotFound, rec.Code)
+			})
+		})
+	})
+}
+
+func TestVerifyKey(t *testing.T) {
+	km := &apiKeyMock{
+		useAPIKeyResponse: db.APIKey{ID: 5, UserID: 3, ScopeResource: "tank-statistics", ScopePermission: "WRITE"},
+		useAPIKeyUser:     db.User{ID: 3, HouseholdID: 2, Username: "nemo", Role: "EDITOR"},
+	}
+	v := apiKeyVerifier{km}
+
+	t.Run("Given an API key", func(t *testing.T) {
+		t.Run("When it exists", func(t *testing.T) {
+			t.Run("Then the identity of its user is returned with its scope", func(t *testing.T) {
+				id, err := v.VerifyKey(context.Background(), "tmf_key")
+				assert.NoError(t, err)
+				assert.Equal(t, auth.Identity{
+					UserID:      3,
+					Username:    "nemo",
+					HouseholdID: 2,
+					APIKeyID:    5,
+					Scope:       &auth.Scope{Resource: "tank-statistics", Permission: auth.PermissionWrite},
+				}, id)
+				assert.Equal(t, auth.HashOpaqueToken("tmf_key"), km.useAPIKeyHash)
+			})
+		})
+		t.Run("When it is scoped to a tank", func(t *testing.T) {
+			t.Run("Then the tank is returned with its scope", func(t *testing.T) {
+				tankID := int32(4)
+				km.useAPIKeyResponse.ScopeTankID = &tankID
+				defer func() { km.useAPIKeyResponse.ScopeTankID = nil }()
+
+				id, err := v.VerifyKey(context.Background(), "tmf_key")
+				assert.NoError(t, err)
+				assert.Equal(t, &auth.Scope{Resource: "tank-statistics", Permission: auth.PermissionWrite, TankID: 4}, id.Scope)
+			})
+		})
+		t.Run("When it doesn't exist", func(t *testing.T) {
+			t.Run("Then unauthenticated is returned", func(t *testing.T) {
+				km.err = &db.ErrNotFound{}
+				defer func() { km.err = nil }()
+
+				_, err := v.VerifyKey(context.Background(), "tmf_key")
+				assert.Equal(t, auth.ErrUnauthenticated, err)
+			})
+		})
+		t.Run("When it doesn't have the prefix", func(t *testing.T) {
+			t.Run("Then unauthenticated is returned", func(t *testing.T) {
+				_, err := v.VerifyKey(context.Background(), "key")
+				assert.Equal(t, auth.ErrUnauthenticated, err)
+			})
+		})
+	})
+}
+
+func TestScopedAPIKey(t *testing.T) {
+	tokens, err := auth.NewTokenManager("", time.Hour)
+	assert.NoError(t, err)
+
+	km := &apiKeyMock{
+		useAPIKeyResponse: db.APIKey{ID: 5, UserID: 3, ScopeResource: "tank-statistics", ScopePermission: "WRITE"},
+		useAPIKeyUser:     db.User{ID: 3, HouseholdID: 2, Username: "nemo", Role: "OWNER"},
+	}
+	um := &userMock{getUserResponse: km.useAPIKeyUser}
+	s := Server{userQuerier: um, apiKeyQuerier: km, tokens: tokens}
+
+	h := s.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	testCases := []struct {
+		desc           string
+		method         string
+		path           string
+		expectedStatus int
+	}{
+		{desc: "Adding a tank statistic is allowed", method: http.MethodPost, path: "/api/v1alpha1/tank/statistics", expectedStatus: http.StatusOK},
+		{desc: "Listing tank statistics is allowed", method: http.MethodGet, path: "/api/v1alpha1/tank/statistics", expectedStatus: http.StatusOK},
+		{desc: "Deleting a tank statistic is forbidden", method: http.MethodDelete, path: "/api/v1alpha1/tank/statistics/1", expectedStatus: http.StatusForbidden},
+		{desc: "Other resources are forbidden", method: http.MethodGet, path: "/api/v1alpha1/tanks", expectedStatus: http.StatusForbidden},
+		{desc: "Managing API keys is forbidden", method: http.MethodGet, path: "/api/v1alpha1/api-keys", expectedStatus: http.StatusForbidden},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			req := httptest.NewRequest(tC.method, tC.path, nil)
+			req.Header.Set(auth.APIKeyHeader, "tmf_key")
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			assert.Equal(t, tC.expectedStatus, rec.Code)
+		})
+	}
+}
+
+func TestTankScopedAPIKey(t *testing.T) {
+	tokens, err := auth.NewTokenManager("", time.Hour)
+	assert.NoError(t, err)
+
+	tankID := int32(4)
+	km := &apiKeyMock{
+		useAPIKeyResponse: db.APIKey{ID: 5, UserID: 3, ScopeResource: "tanks", ScopePermission: "READ", ScopeTankID: &tankID},
+		useAPIKeyUser:     db.User{ID: 3, HouseholdID: 2, Username: "nemo", Role: "OWNER"},
+	}
+	um := &userMock{getUserResponse: km.useAPIKeyUser}
+	s := Server{userQuerier: um, apiKeyQuerier: km, tokens: tokens}
+
+	h := s.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	testCases := []struct {
+		desc           string
+		method         string
+		path           string
+		expectedStatus int
+	}{
+		{desc: "Watching a tank is allowed", method: http.MethodGet, path: watchPath + "4", expectedStatus: http.StatusOK},
+		{desc: "Listing tanks is forbidden", method: http.MethodGet, path: "/api/v1alpha1/tanks", expectedStatus: http.StatusForbidden},
+		{desc: "Getting a tank is forbidden", method: http.MethodGet, path: "/api/v1alpha1/tanks/4", expectedStatus: http.StatusForbidden},
+		{desc: "Exporting tanks is forbidden", method: http.MethodGet, path: csvPath + "tanks", expectedStatus: http.StatusForbidden},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			req := httptest.NewRequest(tC.method, tC.path, nil)
+			req.Header.Set(auth.APIKeyHeader, "tmf_key")
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			assert.Equal(t, tC.expectedStatus, rec.Code)
+		})
+	}
+
+	t.Run("Given a key scoped to a tank", func(t *testing.T) {
+		t.Run("When it's used for an RPC", func(t *testing.T) {
+			t.Run("Then it's forbidden", func(t *testing.T) {
+				ctx := auth.NewContext(context.Background(), auth.Identity{UserID: 3, HouseholdID: 2, APIKeyID: 5, Scope: &auth.Scope{Resource: "tanks", Permission: auth.PermissionRead, TankID: 4}})
+
+				_, err := s.authorize(ctx, "tanks", auth.PermissionRead, false)
+				assert.Equal(t, auth.ErrForbidden, err)
+			})
+		})
+	})
+}
+
+type apiKeyMock struct {
+	insertAPIKeyRequest db.APIKey
+	insertAPIKeyHash    string
+	useAPIKeyHash       string
+	useAPIKeyResponse   db.APIKey
+	useAPIKeyUser       db.User
+	err                 error
+}
+
+func (m *apiKeyMock) ListAPIKeys(context.Context, int32) ([]db.APIKey, error) {
+	return nil, m.err
+}
+
+func (m *apiKeyMock) UseAPIKey(ctx context.Context, hash string) (db.APIKey, db.User, error) {
+	m.useAPIKeyHash = hash
+
+	return m.useAPIKeyResponse, m.useAPIKeyUser, m.err
+}
+
+func (m *apiKeyMock) InsertAPIKey(ctx context.Context, req db.APIKey, hash string) (db.APIKey, error) {
+	m.insertAPIKeyRequest, m.insertAPIKeyHash = req, hash
+
+	return req, m.err
+}
+
+func (m *apiKeyMock) DeleteAPIKey(ctx context.Context, userID, id int32) (db.APIKey, error) {
+	return db.APIKey{ID: id, UserID: userID}, m.err
+}
@@ -0,0 +1,303 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/trackmyfish/backend/internal/attachment"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+// DefaultMaxAttachmentSize is used when Config.MaxAttachmentSize isn't set
+const DefaultMaxAttachmentSize = 10 << 20 // 10 MiB
+
+type attachmentQuerier interface {
+	GetAttachment(context.Context, int32) (db.Attachment, error)
+	ListAttachments(context.Context, db.AttachmentFilter) ([]db.Attachment, error)
+}
+
+type attachmentModifier interface {
+	InsertAttachment(context.Context, db.Attachment) (db.Attachment, error)
+	DeleteAttachment(context.Context, int32) (db.Attachment, error)
+}
+
+type attachmentResponse struct {
+	ID          int32     `json:"id"`
+	TankID      *int32    `json:"tankId,omitempty"`
+	FishID      *int32    `json:"fishId,omitempty"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"contentType"`
+	Size        int64     `json:"size"`
+	Caption     string    `json:"caption"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+func toAttachmentResponse(a db.Attachment) attachmentResponse {
+	return attachmentResponse{
+		ID:          a.ID,
+		TankID:      a.TankID,
+		FishID:      a.FishID,
+		Filename:    a.Filename,
+		ContentType: a.ContentType,
+		Size:        a.Size,
+		Caption:     a.Caption,
+		CreatedAt:   a.CreatedAt,
+	}
+}
+
+// handleAttachments serves /api/v1alpha1/attachments
+//
+// GET lists attachments, optionally filtered by the tankId or fishId query parameters.
+// POST uploads a new attachment as multipart/form-data with a "file" part and exactly
+// one of the "tankId" or "fishId" fields, plus an optional "caption".
+func (s *Server) handleAttachments(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.listAttachments(w, r)
+	case http.MethodPost:
+		s.uploadAttachment(w, r)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// handleAttachment serves /api/v1alpha1/attachments/{id}, /api/v1alpha1/attachments/{id}/content
+// and /api/v1alpha1/attachments/{id}/thumbnail
+func (s *Server) handleAttachment(w http.ResponseWriter, r *http.Request) {
+	id, rest, err := pathID(r.URL.Path, "/api/v1alpha1/attachments/")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	switch {
+	case rest == "" && r.Method == http.MethodGet:
+		a, err := s.attachmentQuerier.GetAttachment(r.Context(), id)
+		if err != nil {
+			writeError(w, statusForError(err), errors.Wrap(err, "unable to get attachment"))
+			return
+		}
+
+		writeJSON(w, http.StatusOK, toAttachmentResponse(a))
+	case rest == "" && r.Method == http.MethodDelete:
+		s.deleteAttachment(w, r, id)
+	case (rest == "content" || rest == "thumbnail") && r.Method == http.MethodGet:
+		s.downloadAttachment(w, r, id, rest == "thumbnail")
+	default:
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+func (s *Server) listAttachments(w http.ResponseWriter, r *http.Request) {
+	var (
+		filter db.AttachmentFilter
+		err    error
+	)
+
+	if filter.TankID, err = optionalInt32(r, "tankId"); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if filter.FishID, err = optionalInt32(r, "fishId"); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	rsp, err := s.attachmentQuerier.ListAttachments(r.Context(), filter)
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to list attachments"))
+		return
+	}
+
+	attachments := make([]attachmentResponse, len(rsp))
+	for i, a := range rsp {
+		attachments[i] = toAttachmentResponse(a)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"attachments": attachments})
+}
+
+func (s *Server) uploadAttachment(w http.ResponseWriter, r *http.Request) {
+	// Allow a little headroom over the file size limit for the rest of the form
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxAttachmentSize+(1<<20))
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		if isBodyTooLarge(err) {
+			writeError(w, http.StatusRequestEntityTooLarge, errors.Errorf("file exceeds the maximum size of %d bytes", s.maxAttachmentSize))
+			return
+		}
+
+		writeError(w, http.StatusBadRequest, errors.Wrap(err, "unable to read file"))
+		return
+	}
+	defer file.Close()
+
+	if header.Size > s.maxAttachmentSize {
+		writeError(w, http.StatusRequestEntityTooLarge, errors.Errorf("file exceeds the maximum size of %d bytes", s.maxAttachmentSize))
+		return
+	}
+
+	a := db.Attachment{
+		Filename: header.Filename,
+		Size:     header.Size,
+		Caption:  r.FormValue("caption"),
+	}
+
+	if a.TankID, err = optionalInt32(r, "tankId"); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if a.FishID, err = optionalInt32(r, "fishId"); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if (a.TankID == nil) == (a.FishID == nil) {
+		writeError(w, http.StatusBadRequest, errors.New("exactly one of tankId or fishId must be provided"))
+		return
+	}
+
+	if err := s.checkTankOrFish(r.Context(), a.TankID, a.FishID); err != nil {
+		writeError(w, statusForError(err), err)
+		return
+	}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		writeError(w, http.StatusBadRequest, errors.Wrap(err, "unable to read file"))
+		return
+	}
+
+	if a.ContentType, err = attachment.ContentType(head[:n]); err != nil {
+		writeError(w, http.StatusUnsupportedMediaType, err)
+		return
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		writeError(w, http.StatusInternalServerError, errors.Wrap(err, "unable to read file"))
+		return
+	}
+
+	thumbnail, err := attachment.Thumbnail(file, attachment.ThumbnailSize)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		writeError(w, http.StatusInternalServerError, errors.Wrap(err, "unable to read file"))
+		return
+	}
+
+	key, err := newBlobKey()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	a.BlobKey = key + attachment.Extension(a.ContentType)
+	a.ThumbnailKey = key + "_thumb.jpg"
+
+	if err := s.blobStore.Put(r.Context(), a.BlobKey, file); err != nil {
+		writeError(w, http.StatusInternalServerError, errors.Wrap(err, "unable to store file"))
+		return
+	}
+
+	if err := s.blobStore.Put(r.Context(), a.ThumbnailKey, bytes.NewReader(thumbnail)); err != nil {
+		s.deleteBlobs(r.Context(), a)
+		writeError(w, http.StatusInternalServerError, errors.Wrap(err, "unable to store thumbnail"))
+		return
+	}
+
+	rsp, err := s.attachmentModifier.InsertAttachment(r.Context(), a)
+	if err != nil {
+		s.deleteBlobs(r.Context(), a)
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to add attachment"))
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, toAttachmentResponse(rsp))
+}
+
+func (s *Server) downloadAttachment(w http.ResponseWriter, r *http.Request, id int32, thumbnail bool) {
+	a, err := s.attachmentQuerier.GetAttachment(r.Context(), id)
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to get attachment"))
+		return
+	}
+
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+
+	s.serveAttachment(w, r, a, thumbnail)
+}
+
+// serveAttachment writes the blob of an attachment, or its thumbnail, to w
+func (s *Server) serveAttachment(w http.ResponseWriter, r *http.Request, a db.Attachment, thumbnail bool) {
+	key, contentType := a.BlobKey, a.ContentType
+	if thumbnail {
+		key, contentType = a.ThumbnailKey, "image/jpeg"
+	}
+
+	blob, err := s.blobStore.Get(r.Context(), key)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errors.Wrap(err, "unable to read attachment"))
+		return
+	}
+	defer blob.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	if !thumbnail {
+		w.Header().Set("Content-Length", strconv.FormatInt(a.Size, 10))
+		w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", a.Filename))
+	}
+
+	if _, err := io.Copy(w, blob); err != nil {
+		logrus.WithError(err).WithField("id", a.ID).Error("unable to write attachment")
+	}
+}
+
+func (s *Server) deleteAttachment(w http.ResponseWriter, r *http.Request, id int32) {
+	a, err := s.attachmentModifier.DeleteAttachment(r.Context(), id)
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to delete attachment"))
+		return
+	}
+
+	s.deleteBlobs(r.Context(), a)
+
+	writeJSON(w, http.StatusOK, toAttachmentResponse(a))
+}
+
+// deleteBlobs removes the blobs for an attachment. Failures are only logged as the
+// metadata is the source of truth and an orphaned blob is harmless.
+func (s *Server) deleteBlobs(ctx context.Context, a db.Attachment) {
+	for _, key := range []string{a.BlobKey, a.ThumbnailKey} {
+		if err := s.blobStore.Delete(ctx, key); err != nil {
+			logrus.WithError(err).WithField("key", key).Warn("unable to delete blob")
+		}
+	}
+}
+
+// newBlobKey returns a random, unguessable key, prefixed with the current year and
+// month to avoid a single huge directory
+func newBlobKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "unable to generate blob key")
+	}
+
+	return time.Now().UTC().Format("2006/01/") + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,324 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+func uploadRequest(t *testing.T, fields map[string]string, file []byte) *http.Request {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	for k, v := range fields {
+		assert.NoError(t, mw.WriteField(k, v))
+	}
+
+	fw, err := mw.CreateFormFile("file", "photo.png")
+	assert.NoError(t, err)
+	_, err = fw.Write(file)
+	assert.NoError(t, err)
+	assert.NoError(t, mw.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1alpha1/attachments", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	return req
+}
+
+func pngBytes(t *testing.T) []byte {
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 4))))
+
+	return buf.Bytes()
+}
+
+func TestUploadAttachment(t *testing.T) {
+	am := &attachmentMock{}
+	bs := &blobStoreMock{blobs: map[string][]byte{}}
+	tm := &tankMock{}
+	s := Server{attachmentModifier: am, blobStore: bs, tankQuerier: tm, fishQuerier: fishMock{}, maxAttachmentSize: DefaultMaxAttachmentSize}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	t.Run("Given a request to upload an attachment", func(t *testing.T) {
+		t.Run("When neither a tankId or fishId is provided", func(t *testing.T) {
+			t.Run("Then a bad request is returned", func(t *testing.T) {
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, uploadRequest(t, nil, pngBytes(t)))
+
+				assert.Equal(t, http.StatusBadRequest, rec.Code)
+				assert.Contains(t, rec.Body.String(), "exactly one of tankId or fishId must be provided")
+			})
+		})
+		t.Run("When the file isn't an image", func(t *testing.T) {
+			t.Run("Then unsupported media type is returned", func(t *testing.T) {
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, uploadRequest(t, map[string]string{"tankId": "1"}, []byte("plain text")))
+
+				assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+				assert.Empty(t, bs.blobs)
+			})
+		})
+		t.Run("When the tank isn't visible to the household", func(t *testing.T) {
+			t.Run("Then not found is returned and nothing is stored", func(t *testing.T) {
+				tm.err = &db.ErrNotFound{}
+				defer func() { tm.err = nil }()
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, uploadRequest(t, map[string]string{"tankId": "9"}, pngBytes(t)))
+
+				assert.Equal(t, http.StatusNotFound, rec.Code)
+				assert.Empty(t, bs.blobs)
+			})
+		})
+		t.Run("When the file is too large", func(t *testing.T) {
+			t.Run("Then request entity too large is returned", func(t *testing.T) {
+				small := Server{attachmentModifier: am, blobStore: bs, tankQuerier: tm, maxAttachmentSize: 10}
+
+				rec := httptest.NewRecorder()
+				small.handleAttachments(rec, uploadRequest(t, map[string]string{"tankId": "1"}, pngBytes(t)))
+
+				assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+				assert.Empty(t, bs.blobs)
+			})
+		})
+		t.Run("When the request is larger than the body limit", func(t *testing.T) {
+			t.Run("Then request entity too large is returned", func(t *testing.T) {
+				small := Server{attachmentModifier: am, blobStore: bs, tankQuerier: tm, maxAttachmentSize: 10}
+
+				rec := httptest.NewRecorder()
+				small.handleAttachments(rec, uploadRequest(t, map[string]string{"tankId": "1"}, make([]byte, 2<<20)))
+
+				assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+				assert.Contains(t, rec.Body.String(), "file exceeds the maximum size of 10 bytes")
+				assert.Empty(t, bs.blobs)
+			})
+		})
+		t.Run("When an error is returned inserting the metadata", func(t *testing.T) {
+			t.Run("Then the blobs are removed and the error is returned to the caller", func(t *testing.T) {
+				am.err = errors.New("an error")
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, uploadRequest(t, map[string]string{"tankId": "1"}, pngBytes(t)))
+
+				assert.Equal(t, http.StatusInternalServerError, rec.Code)
+				assert.Contains(t, rec.Body.String(), "unable to add attachment: an error")
+				assert.Empty(t, bs.blobs)
+			})
+		})
+		t.Run("When no error is returned", func(t *testing.T) {
+			t.Run("Then the blob and thumbnail are stored and the Attachment is returned", func(t *testing.T) {
+				am.err = nil
+				am.insertAttachmentResponse = db.Attachment{ID: 3, TankID: &[]int32{1}[0], Filename: "photo.png", ContentType: "image/png"}
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, uploadRequest(t, map[string]string{"tankId": "1", "caption": "Day one"}, pngBytes(t)))
+
+				assert.Equal(t, http.StatusCreated, rec.Code)
+
+				assert.Equal(t, int32(1), *am.insertAttachmentRequest.TankID)
+				assert.Nil(t, am.insertAttachmentRequest.FishID)
+				assert.Equal(t, "image/png", am.insertAttachmentRequest.ContentType)
+				assert.Equal(t, "Day one", am.insertAttachmentRequest.Caption)
+				assert.True(t, strings.HasSuffix(am.insertAttachmentRequest.BlobKey, ".png"))
+				assert.True(t, strings.HasSuffix(am.insertAttachmentRequest.ThumbnailKey, "_thumb.jpg"))
+				assert.Equal(t, pngBytes(t), bs.blobs[am.insertAttachmentRequest.BlobKey])
+				assert.Contains(t, bs.blobs, am.insertAttachmentRequest.ThumbnailKey)
+
+				var rsp attachmentResponse
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(&rsp))
+				assert.Equal(t, int32(3), rsp.ID)
+				assert.Equal(t, "image/png", rsp.ContentType)
+			})
+		})
+	})
+}
+
+func TestListAttachments(t *testing.T) {
+	am := &attachmentMock{}
+	s := Server{attachmentQuerier: am}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	t.Run("Given a request to list attachments", func(t *testing.T) {
+		t.Run("When the tankId is invalid", func(t *testing.T) {
+			t.Run("Then a bad request is returned", func(t *testing.T) {
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1alpha1/attachments?tankId=abc", nil))
+
+				assert.Equal(t, http.StatusBadRequest, rec.Code)
+			})
+		})
+		t.Run("When no error is returned", func(t *testing.T) {
+			t.Run("Then the Attachments are returned to the caller", func(t *testing.T) {
+				am.listAttachmentsResponse = []db.Attachment{{ID: 1}, {ID: 2}}
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1alpha1/attachments?fishId=4", nil))
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Nil(t, am.listAttachmentsRequest.TankID)
+				assert.Equal(t, int32(4), *am.listAttachmentsRequest.FishID)
+
+				var rsp struct{ Attachments []attachmentResponse }
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(&rsp))
+				assert.Len(t, rsp.Attachments, 2)
+			})
+		})
+	})
+}
+
+func TestDownloadAttachment(t *testing.T) {
+	am := &attachmentMock{}
+	bs := &blobStoreMock{blobs: map[string][]byte{"blob.png": []byte("image"), "blob_thumb.jpg": []byte("thumb")}}
+	s := Server{attachmentQuerier: am, blobStore: bs}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	t.Run("Given a request to download an attachment", func(t *testing.T) {
+		t.Run("When the attachment doesn't exist", func(t *testing.T) {
+			t.Run("Then not found is returned", func(t *testing.T) {
+				am.err = &db.ErrNotFound{}
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1alpha1/attachments/1/content", nil))
+
+				assert.Equal(t, http.StatusNotFound, rec.Code)
+			})
+		})
+		t.Run("When the content is requested", func(t *testing.T) {
+			t.Run("Then the blob is returned", func(t *testing.T) {
+				am.err = nil
+				am.getAttachmentResponse = db.Attachment{ID: 1, ContentType: "image/png", Size: 5, BlobKey: "blob.png", ThumbnailKey: "blob_thumb.jpg"}
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1alpha1/attachments/1/content", nil))
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Equal(t, "image/png", rec.Header().Get("Content-Type"))
+				assert.Equal(t, "image", rec.Body.String())
+			})
+		})
+		t.Run("When the thumbnail is requested", func(t *testing.T) {
+			t.Run("Then the thumbnail is returned", func(t *testing.T) {
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1alpha1/attachments/1/thumbnail", nil))
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Equal(t, "image/jpeg", rec.Header().Get("Content-Type"))
+				assert.Equal(t, "thumb", rec.Body.String())
+			})
+		})
+	})
+}
+
+func TestDeleteAttachment(t *testing.T) {
+	am := &attachmentMock{}
+	bs := &blobStoreMock{blobs: map[string][]byte{"blob.png": []byte("image"), "blob_thumb.jpg": []byte("thumb")}}
+	s := Server{attachmentModifier: am, blobStore: bs}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	t.Run("Given a request to delete an attachment", func(t *testing.T) {
+		t.Run("When an error is returned", func(t *testing.T) {
+			t.Run("Then the blobs are kept and the error is returned to the caller", func(t *testing.T) {
+				am.err = errors.New("an error")
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/v1alpha1/attachments/1", nil))
+
+				assert.Equal(t, http.StatusInternalServerError, rec.Code)
+				assert.Len(t, bs.blobs, 2)
+			})
+		})
+		t.Run("When no error is returned", func(t *testing.T) {
+			t.Run("Then the blobs are deleted", func(t *testing.T) {
+				am.err = nil
+				am.deleteAttachmentResponse = db.Attachment{ID: 1, BlobKey: "blob.png", ThumbnailKey: "blob_thumb.jpg"}
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/v1alpha1/attachments/1", nil))
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Empty(t, bs.blobs)
+			})
+		})
+	})
+}
+
+type attachmentMock struct {
+	insertAttachmentRequest  db.Attachment
+	insertAttachmentResponse db.Attachment
+	getAttachmentResponse    db.Attachment
+	listAttachmentsRequest   db.AttachmentFilter
+	listAttachmentsResponse  []db.Attachment
+	deleteAttachmentResponse db.Attachment
+	err                      error
+}
+
+func (a *attachmentMock) InsertAttachment(ctx context.Context, req db.Attachment) (db.Attachment, error) {
+	a.insertAttachmentRequest = req
+
+	return a.insertAttachmentResponse, a.err
+}
+
+func (a *attachmentMock) GetAttachment(context.Context, int32) (db.Attachment, error) {
+	return a.getAttachmentResponse, a.err
+}
+
+func (a *attachmentMock) ListAttachments(ctx context.Context, req db.AttachmentFilter) ([]db.Attachment, error) {
+	a.listAttachmentsRequest = req
+
+	return a.listAttachmentsResponse, a.err
+}
+
+func (a *attachmentMock) DeleteAttachment(context.Context, int32) (db.Attachment, error) {
+	return a.deleteAttachmentResponse, a.err
+}
+
+type blobStoreMock struct {
+	blobs map[string][]byte
+}
+
+func (b *blobStoreMock) Put(ctx context.Context, key string, r io.Reader) error {
+	d, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	b.blobs[key] = d
+
+	return nil
+}
+
+func (b *blobStoreMock) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	d, ok := b.blobs[key]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+
+	return io.NopCloser(bytes.NewReader(d)), nil
+}
+
+func (b *blobStoreMock) Delete(ctx context.Context, key string) error {
+	delete(b.blobs, key)
+
+	return nil
+}
@@ -0,0 +1,399 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/trackmyfish/backend/internal/auth"
+	"github.com/trackmyfish/backend/internal/db"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const auditEventsPath = "/api/v1alpha1/audit-events"
+
+// defaultAuditLimit and maxAuditLimit bound the number of events returned by ListAuditEvents
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// maxAuditedBodySize is the largest response recorded as the entity of an audit event.
+// Changes with larger responses are recorded without the entity.
+const maxAuditedBodySize = 64 << 10 // 64 KiB
+
+// unauditedPaths are HTTP endpoints which are POSTed to but don't change any data, in
+// addition to readOnlyPaths
+var unauditedPaths = map[string]bool{
+	"/api/v1alpha1/login": true,
+}
+
+// secretFields are removed from entities before they're recorded, as they're only
+// returned when created, e.g. the key of an API key
+var secretFields = []string{"token", "key", "code", "url"}
+
+type auditQuerier interface {
+	ListAuditEvents(context.Context, db.AuditFilter, int32) ([]db.AuditEvent, error)
+}
+
+type auditModifier interface {
+	InsertAuditEvent(context.Context, db.AuditEvent) (db.AuditEvent, error)
+}
+
+type auditEventResponse struct {
+	ID        int32           `json:"id"`
+	UserID    *int32          `json:"userId,omitempty"`
+	Username  string          `json:"username,omitempty"`
+	APIKeyID  *int32          `json:"apiKeyId,omitempty"`
+	Operation string          `json:"operation"`
+	Entity    string          `json:"entity"`
+	EntityID  *int32          `json:"entityId,omitempty"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+	ClientIP  string          `json:"clientIp"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+func toAuditEventResponse(e db.AuditEvent) auditEventResponse {
+	return auditEventResponse{
+		ID:        e.ID,
+		UserID:    e.UserID,
+		Username:  e.Username,
+		APIKeyID:  e.APIKeyID,
+		Operation: e.Operation,
+		Entity:    e.EntityType,
+		EntityID:  e.EntityID,
+		Before:    e.Before,
+		After:     e.After,
+		ClientIP:  e.ClientIP,
+		CreatedAt: e.CreatedAt,
+	}
+}
+
+// audit records a change in the audit log, attributed to the authenticated user in ctx.
+// The change has already been made, so failing to record it is only logged.
+func (s *Server) audit(ctx context.Context, e db.AuditEvent) {
+	// handlers can be used without an audit log, e.g. in tests
+	if s.auditModifier == nil {
+		return
+	}
+
+	if id, ok := auth.FromContext(ctx); ok {
+		e.UserID, e.Username = &id.UserID, id.Username
+		if id.APIKeyID != 0 {
+			e.APIKeyID = &id.APIKeyID
+		}
+	}
+
+	e.Before, e.After = redactSecrets(e.Before), redactSecrets(e.After)
+
+	if e.EntityID == nil {
+		e.EntityID = entityID(e.After)
+	}
+
+	if e.EntityID == nil {
+		e.EntityID = entityID(e.Before)
+	}
+
+	if _, err := s.auditModifier.InsertAuditEvent(ctx, e); err != nil {
+		logrus.WithError(err).WithField("operation", e.Operation).Error("unable to record audit event")
+	}
+}
+
+// auditRPC records a successful call to an RPC which isn't read only. The entity in the
+// response is recorded as it was before a delete, otherwise as it is after the change.
+func (s *Server) auditRPC(ctx context.Context, method string, a access, rsp interface{}) {
+	var entity []byte
+
+	if m, ok := rsp.(proto.Message); ok {
+		b, err := protojson.Marshal(m)
+		if err != nil {
+			logrus.WithError(err).WithField("operation", method).Warn("unable to marshal audited response")
+		} else {
+			entity = unwrapEntity(b)
+		}
+	}
+
+	e := db.AuditEvent{Operation: method, EntityType: a.resource, ClientIP: rpcClientIP(ctx)}
+	if a.permission == auth.PermissionDelete {
+		e.Before = entity
+	} else {
+		e.After = entity
+	}
+
+	s.audit(ctx, e)
+}
+
+// auditChangeKey is the context key of the *auditChange of a request
+type auditChangeKey struct{}
+
+// auditChange holds the entity a request updates as it was before the update
+type auditChange struct {
+	before []byte
+}
+
+// auditBefore records v as the entity a request is updating as it was before the update.
+// Handlers updating an entity call it before updating it, as the response only holds the
+// entity after the update.
+func auditBefore(ctx context.Context, v interface{}) {
+	c, ok := ctx.Value(auditChangeKey{}).(*auditChange)
+	if !ok {
+		return
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		logrus.WithError(err).Warn("unable to marshal audited entity")
+		return
+	}
+
+	c.before = b
+}
+
+// audited wraps next, recording the changes it makes in the audit log. Requests which
+// don't change anything and failed requests aren't recorded. The entity in the response
+// is recorded as it was before a DELETE, otherwise as it is after the change, along with
+// how it was before an update if the handler recorded it with auditBefore.
+func (s *Server) audited(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isChange(r) {
+			next(w, r)
+			return
+		}
+
+		change := &auditChange{}
+		r = r.WithContext(context.WithValue(r.Context(), auditChangeKey{}, change))
+
+		rec := &auditRecorder{ResponseWriter: w}
+		next(rec, r)
+
+		if rec.status < 200 || rec.status > 299 {
+			return
+		}
+
+		var entity []byte
+		if !rec.overflow && json.Valid(rec.body.Bytes()) {
+			entity = rec.body.Bytes()
+		}
+
+		e := db.AuditEvent{
+			Operation:  r.Method + " " + r.URL.Path,
+			EntityType: requestResource(r.URL.Path),
+			ClientIP:   requestClientIP(r),
+		}
+
+		if r.Method == http.MethodDelete {
+			e.Before = entity
+		} else {
+			e.Before, e.After = change.before, entity
+		}
+
+		s.audit(r.Context(), e)
+	}
+}
+
+func isChange(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+
+	return !readOnlyPaths[r.URL.Path] && !unauditedPaths[r.URL.Path]
+}
+
+// auditRecorder keeps a copy of the status and, up to maxAuditedBodySize, the body of a
+// response
+type auditRecorder struct {
+	http.ResponseWriter
+	status   int
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (a *auditRecorder) WriteHeader(status int) {
+	a.status = status
+	a.ResponseWriter.WriteHeader(status)
+}
+
+func (a *auditRecorder) Write(b []byte) (int, error) {
+	if a.status == 0 {
+		a.status = http.StatusOK
+	}
+
+	if a.body.Len()+len(b) > maxAuditedBodySize {
+		a.overflow = true
+	} else {
+		a.body.Write(b)
+	}
+
+	return a.ResponseWriter.Write(b)
+}
+
+// Flush sends what has been written of a streamed response to the client
+func (a *auditRecorder) Flush() {
+	flush(a.ResponseWriter)
+}
+
+// Unwrap returns the recorded ResponseWriter, see http.ResponseController
+func (a *auditRecorder) Unwrap() http.ResponseWriter {
+	return a.ResponseWriter
+}
+
+// unwrapEntity returns the entity from an RPC response, which holds it as its only field,
+// e.g. {"fish": {...}}. Other responses are returned as they are.
+func unwrapEntity(b []byte) []byte {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil || len(fields) != 1 {
+		return b
+	}
+
+	for _, v := range fields {
+		return v
+	}
+
+	return b
+}
+
+// redactSecrets removes secretFields from an entity
+func redactSecrets(b []byte) []byte {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return b
+	}
+
+	redacted := false
+	for _, f := range secretFields {
+		if _, ok := fields[f]; ok {
+			delete(fields, f)
+			redacted = true
+		}
+	}
+
+	if !redacted {
+		return b
+	}
+
+	out, err := json.Marshal(fields)
+	if err != nil {
+		return nil
+	}
+
+	return out
+}
+
+// entityID returns the id of an entity, or nil if it doesn't have one
+func entityID(b []byte) *int32 {
+	var entity struct {
+		ID *int32 `json:"id"`
+	}
+
+	if err := json.Unmarshal(b, &entity); err != nil {
+		return nil
+	}
+
+	return entity.ID
+}
+
+func requestClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// rpcClientIP returns the address of the client calling an RPC. Calls from the gateway
+// are made over loopback, so the client is the last address the gateway appended to
+// X-Forwarded-For, as any before it were sent by the client.
+func rpcClientIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		host = p.Addr.String()
+	}
+
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return host
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	if fwd := md.Get("x-forwarded-for"); len(fwd) > 0 {
+		addrs := strings.Split(fwd[len(fwd)-1], ",")
+		return strings.TrimSpace(addrs[len(addrs)-1])
+	}
+
+	return host
+}
+
+// handleAuditEvents serves /api/v1alpha1/audit-events, the HTTP equivalent of a
+// ListAuditEvents RPC
+//
+// GET lists the audit events of the household, newest first. Events can be restricted to
+// an entity with entity (e.g. tank-statistics) and entityId, and to a time range with from
+// (inclusive) and to (exclusive). The number of events is controlled with limit.
+func (s *Server) handleAuditEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	filter := db.AuditFilter{EntityType: r.FormValue("entity")}
+
+	var err error
+	if filter.EntityID, err = optionalInt32(r, "entityId"); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if filter.From, err = optionalDate(r, "from"); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if filter.To, err = optionalDate(r, "to"); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	limit, err := optionalInt32(r, "limit")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	l := int32(defaultAuditLimit)
+	if limit != nil && *limit > 0 {
+		l = *limit
+	}
+
+	if l > maxAuditLimit {
+		l = maxAuditLimit
+	}
+
+	rsp, err := s.auditQuerier.ListAuditEvents(r.Context(), filter, l)
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to list audit events"))
+		return
+	}
+
+	events := make([]auditEventResponse, len(rsp))
+	for i, e := range rsp {
+		events[i] = toAuditEventResponse(e)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"auditEvents": events})
+}
@@ -0,0 +1,189 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trackmyfish/backend/internal/auth"
+	"github.com/trackmyfish/backend/internal/db"
+	trackmyfishv1alpha1 "github.com/trackmyfish/proto/trackmyfish/v1alpha1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+func TestAudited(t *testing.T) {
+	am := &auditMock{}
+	s := Server{auditModifier: am}
+
+	user := auth.Identity{UserID: 3, Username: "nemo", HouseholdID: 2, APIKeyID: 5}
+
+	h := s.audited(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("fail") != "" {
+			writeError(w, http.StatusBadRequest, assert.AnError)
+			return
+		}
+
+		if r.Method == http.MethodPut {
+			auditBefore(r.Context(), map[string]interface{}{"id": 4, "name": "probe"})
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{"id": 4, "name": "sensor", "key": "tmf_secret"})
+	})
+
+	request := func(method, path string) {
+		req := httptest.NewRequest(method, path, strings.NewReader("{}"))
+		req.RemoteAddr = "192.0.2.1:1234"
+
+		h.ServeHTTP(httptest.NewRecorder(), req.WithContext(auth.NewContext(req.Context(), user)))
+	}
+
+	t.Run("Given an audited endpoint", func(t *testing.T) {
+		t.Run("When it changes an entity", func(t *testing.T) {
+			t.Run("Then the entity after the change is recorded without secrets", func(t *testing.T) {
+				request(http.MethodPost, "/api/v1alpha1/api-keys")
+
+				assert.Len(t, am.events, 1)
+
+				e := am.events[0]
+				assert.Equal(t, "POST /api/v1alpha1/api-keys", e.Operation)
+				assert.Equal(t, "api-keys", e.EntityType)
+				assert.Equal(t, int32(4), *e.EntityID)
+				assert.Equal(t, int32(3), *e.UserID)
+				assert.Equal(t, "nemo", e.Username)
+				assert.Equal(t, int32(5), *e.APIKeyID)
+				assert.Equal(t, "192.0.2.1", e.ClientIP)
+				assert.Nil(t, e.Before)
+				assert.JSONEq(t, `{"id": 4, "name": "sensor"}`, string(e.After))
+			})
+		})
+		t.Run("When it updates an entity", func(t *testing.T) {
+			t.Run("Then the entity before and after the update is recorded", func(t *testing.T) {
+				am.events = nil
+
+				request(http.MethodPut, "/api/v1alpha1/api-keys/4")
+
+				assert.Len(t, am.events, 1)
+				assert.JSONEq(t, `{"id": 4, "name": "probe"}`, string(am.events[0].Before))
+				assert.JSONEq(t, `{"id": 4, "name": "sensor"}`, string(am.events[0].After))
+			})
+		})
+		t.Run("When it deletes an entity", func(t *testing.T) {
+			t.Run("Then the entity before the delete is recorded", func(t *testing.T) {
+				am.events = nil
+
+				request(http.MethodDelete, "/api/v1alpha1/api-keys/4")
+
+				assert.Len(t, am.events, 1)
+				assert.NotNil(t, am.events[0].Before)
+				assert.Nil(t, am.events[0].After)
+			})
+		})
+		t.Run("When it doesn't change anything", func(t *testing.T) {
+			t.Run("Then nothing is recorded", func(t *testing.T) {
+				am.events = nil
+
+				request(http.MethodGet, "/api/v1alpha1/api-keys")
+				request(http.MethodPost, "/api/v1alpha1/dosing/calculate")
+				request(http.MethodPost, "/api/v1alpha1/login")
+				request(http.MethodPost, "/api/v1alpha1/api-keys?fail=true")
+
+				assert.Empty(t, am.events)
+			})
+		})
+	})
+}
+
+func TestAuditRPC(t *testing.T) {
+	am := &auditMock{}
+	s := Server{auditModifier: am}
+
+	ph := float32(7.2)
+	rsp := &trackmyfishv1alpha1.DeleteTankStatisticResponse{
+		TankStatistic: &trackmyfishv1alpha1.TankStatistic{Id: 6, TestDate: "2021/08/06 10:00", OptionalPh: &trackmyfishv1alpha1.TankStatistic_Ph{Ph: ph}},
+	}
+
+	t.Run("Given a delete RPC called through the gateway", func(t *testing.T) {
+		ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1234}})
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("x-forwarded-for", "10.0.0.1, 192.0.2.1"))
+		ctx = auth.NewContext(ctx, auth.Identity{UserID: 3, Username: "nemo", HouseholdID: 2})
+
+		t.Run("When it is audited", func(t *testing.T) {
+			t.Run("Then the deleted entity and the address the gateway was called from are recorded", func(t *testing.T) {
+				s.auditRPC(ctx, rpcPrefix+"DeleteTankStatistic", accessFor(rpcPrefix+"DeleteTankStatistic"), rsp)
+
+				assert.Len(t, am.events, 1)
+
+				e := am.events[0]
+				assert.Equal(t, rpcPrefix+"DeleteTankStatistic", e.Operation)
+				assert.Equal(t, "tank-statistics", e.EntityType)
+				assert.Equal(t, int32(6), *e.EntityID)
+				assert.Equal(t, "192.0.2.1", e.ClientIP)
+				assert.Nil(t, e.After)
+				assert.JSONEq(t, `{"id": 6, "testDate": "2021/08/06 10:00", "ph": 7.2}`, string(e.Before))
+			})
+		})
+	})
+}
+
+func TestListAuditEvents(t *testing.T) {
+	am := &auditMock{listAuditEventsResponse: []db.AuditEvent{{ID: 1, Operation: "POST /api/v1alpha1/journal", After: []byte(`{"id": 2}`)}}}
+	s := Server{auditQuerier: am}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	t.Run("Given a request to list audit events", func(t *testing.T) {
+		t.Run("When from is invalid", func(t *testing.T) {
+			t.Run("Then a bad request is returned", func(t *testing.T) {
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1alpha1/audit-events?from=yesterday", nil))
+
+				assert.Equal(t, http.StatusBadRequest, rec.Code)
+			})
+		})
+		t.Run("When it is filtered by entity and time", func(t *testing.T) {
+			t.Run("Then the filtered events are returned", func(t *testing.T) {
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1alpha1/audit-events?entity=tank-statistics&entityId=6&from=2021-08-01&limit=5000", nil))
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Equal(t, "tank-statistics", am.listAuditEventsRequest.EntityType)
+				assert.Equal(t, int32(6), *am.listAuditEventsRequest.EntityID)
+				assert.Equal(t, "2021-08-01", am.listAuditEventsRequest.From.Format("2006-01-02"))
+				assert.Nil(t, am.listAuditEventsRequest.To)
+				assert.Equal(t, int32(maxAuditLimit), am.listAuditEventsLimit)
+
+				var rsp struct{ AuditEvents []auditEventResponse }
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(&rsp))
+				assert.Len(t, rsp.AuditEvents, 1)
+				assert.JSONEq(t, `{"id": 2}`, string(rsp.AuditEvents[0].After))
+			})
+		})
+	})
+}
+
+type auditMock struct {
+	events                  []db.AuditEvent
+	listAuditEventsRequest  db.AuditFilter
+	listAuditEventsLimit    int32
+	listAuditEventsResponse []db.AuditEvent
+	err                     error
+}
+
+func (m *auditMock) InsertAuditEvent(ctx context.Context, e db.AuditEvent) (db.AuditEvent, error) {
+	m.events = append(m.events, e)
+
+	return e, m.err
+}
+
+func (m *auditMock) ListAuditEvents(ctx context.Context, filter db.AuditFilter, limit int32) ([]db.AuditEvent, error) {
+	m.listAuditEventsRequest, m.listAuditEventsLimit = filter, limit
+
+	return m.listAuditEventsResponse, m.err
+}
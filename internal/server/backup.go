@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+const (
+	exportPath = "/api/v1alpha1/export"
+	importPath = "/api/v1alpha1/import"
+)
+
+// maxBackupSize limits the size of backups which can be imported
+const maxBackupSize = 64 << 20 // 64 MiB
+
+type backupQuerier interface {
+	Export(context.Context) (db.Backup, error)
+}
+
+type backupModifier interface {
+	Import(context.Context, db.Backup, db.ImportOptions) (db.ImportResult, error)
+}
+
+type importResponse struct {
+	Imported map[string]int `json:"imported"`
+	Skipped  map[string]int `json:"skipped"`
+}
+
+// handleExport serves /api/v1alpha1/export, the HTTP equivalent of an Export RPC, where
+// GET downloads a backup of the household
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	b, err := s.backupQuerier.Export(r.Context())
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to export backup"))
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "trackmyfish-"+b.ExportedAt.Format("2006-01-02")+".json"))
+	writeJSON(w, http.StatusOK, b)
+}
+
+// handleImport serves /api/v1alpha1/import, the HTTP equivalent of an Import RPC, where
+// POST restores a backup into the household alongside its existing data. Conflicting rows
+// fail the import unless skipConflicts is true.
+func (s *Server) handleImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	skipConflicts, err := optionalBool(r, "skipConflicts")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var b db.Backup
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBackupSize)).Decode(&b); err != nil {
+		writeError(w, http.StatusBadRequest, errors.Wrap(err, "invalid backup"))
+		return
+	}
+
+	if b.Version < 1 || b.Version > db.BackupVersion {
+		writeError(w, http.StatusBadRequest, errors.Errorf("unsupported backup version %d", b.Version))
+		return
+	}
+
+	rsp, err := s.backupModifier.Import(r.Context(), b, db.ImportOptions{SkipConflicts: skipConflicts})
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to import backup"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, importResponse{Imported: rsp.Imported, Skipped: rsp.Skipped})
+}
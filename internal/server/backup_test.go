@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+func TestExport(t *testing.T) {
+	bm := &backupMock{exportResponse: db.Backup{
+		Version:    db.BackupVersion,
+		ExportedAt: time.Date(2021, 8, 6, 10, 0, 0, 0, time.UTC),
+		Tables:     map[string][]json.RawMessage{"tanks": {json.RawMessage(`{"id":1,"name":"Nano"}`)}},
+	}}
+	s := Server{backupQuerier: bm}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	t.Run("Given a household", func(t *testing.T) {
+		t.Run("When it is exported", func(t *testing.T) {
+			t.Run("Then the backup is downloaded", func(t *testing.T) {
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1alpha1/export", nil))
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Equal(t, `attachment; filename="trackmyfish-2021-08-06.json"`, rec.Header().Get("Content-Disposition"))
+				assert.JSONEq(t, `{"version":1,"exportedAt":"2021-08-06T10:00:00Z","tables":{"tanks":[{"id":1,"name":"Nano"}]}}`, rec.Body.String())
+			})
+		})
+	})
+}
+
+func TestImport(t *testing.T) {
+	bm := &backupMock{importResponse: db.ImportResult{Imported: map[string]int{"tanks": 1}, Skipped: map[string]int{}}}
+	s := Server{backupModifier: bm}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	request := func(path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+
+		return rec
+	}
+
+	t.Run("Given a backup", func(t *testing.T) {
+		t.Run("When it is imported", func(t *testing.T) {
+			t.Run("Then the imported rows are counted", func(t *testing.T) {
+				rec := request("/api/v1alpha1/import?skipConflicts=true", `{"version":1,"tables":{"tanks":[{"id":1,"name":"Nano"}]}}`)
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.JSONEq(t, `{"imported":{"tanks":1},"skipped":{}}`, rec.Body.String())
+				assert.True(t, bm.importOptions.SkipConflicts)
+				assert.Len(t, bm.importRequest.Tables["tanks"], 1)
+			})
+		})
+		t.Run("When it conflicts with existing rows", func(t *testing.T) {
+			t.Run("Then conflict is returned", func(t *testing.T) {
+				bm.err = &db.ErrConflict{}
+				defer func() { bm.err = nil }()
+
+				rec := request("/api/v1alpha1/import", `{"version":1,"tables":{}}`)
+
+				assert.Equal(t, http.StatusConflict, rec.Code)
+				assert.False(t, bm.importOptions.SkipConflicts)
+			})
+		})
+	})
+
+	t.Run("Given an invalid backup", func(t *testing.T) {
+		testCases := []struct {
+			desc string
+			path string
+			body string
+		}{
+			{desc: "it isn't JSON", path: "/api/v1alpha1/import", body: "version,tables"},
+			{desc: "its version is unsupported", path: "/api/v1alpha1/import", body: `{"version":2,"tables":{}}`},
+			{desc: "it has no version", path: "/api/v1alpha1/import", body: `{"tables":{}}`},
+			{desc: "skipConflicts is invalid", path: "/api/v1alpha1/import?skipConflicts=maybe", body: `{"version":1,"tables":{}}`},
+		}
+		for _, tC := range testCases {
+			t.Run("When "+tC.desc, func(t *testing.T) {
+				t.Run("Then bad request is returned", func(t *testing.T) {
+					assert.Equal(t, http.StatusBadRequest, request(tC.path, tC.body).Code)
+				})
+			})
+		}
+	})
+}
+
+type backupMock struct {
+	exportResponse db.Backup
+	importRequest  db.Backup
+	importOptions  db.ImportOptions
+	importResponse db.ImportResult
+	err            error
+}
+
+func (m *backupMock) Export(context.Context) (db.Backup, error) {
+	return m.exportResponse, m.err
+}
+
+func (m *backupMock) Import(ctx context.Context, b db.Backup, opts db.ImportOptions) (db.ImportResult, error) {
+	m.importRequest, m.importOptions = b, opts
+
+	return m.importResponse, m.err
+}
@@ -0,0 +1,199 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+const tankStatisticsBatchPath = "/api/v1alpha1/tank/statistics/batch"
+
+// maxBatchSize is the most tank statistics which can be added in one batch
+const maxBatchSize = 1000
+
+// tankStatisticMeasurements are the measurements of a tank statistic, which must be finite
+// and within 0 and max, or only at least 0 if max is 0
+var tankStatisticMeasurements = []struct {
+	name  string
+	value func(*db.TankStatistic) **float32
+	max   float32
+}{
+	{name: fieldPH, value: func(ts *db.TankStatistic) **float32 { return &ts.PH }, max: 14},
+	{name: fieldGH, value: func(ts *db.TankStatistic) **float32 { return &ts.GH }},
+	{name: fieldKH, value: func(ts *db.TankStatistic) **float32 { return &ts.KH }},
+	{name: fieldAmmonia, value: func(ts *db.TankStatistic) **float32 { return &ts.Ammonia }},
+	{name: fieldNitrite, value: func(ts *db.TankStatistic) **float32 { return &ts.Nitrite }},
+	{name: fieldNitrate, value: func(ts *db.TankStatistic) **float32 { return &ts.Nitrate }},
+	{name: fieldPhosphate, value: func(ts *db.TankStatistic) **float32 { return &ts.Phosphate }},
+}
+
+type tankStatisticJSON struct {
+	ID        int32    `json:"id,omitempty"`
+	TestDate  string   `json:"testDate"`
+	PH        *float32 `json:"ph,omitempty"`
+	GH        *float32 `json:"gh,omitempty"`
+	KH        *float32 `json:"kh,omitempty"`
+	Ammonia   *float32 `json:"ammonia,omitempty"`
+	Nitrite   *float32 `json:"nitrite,omitempty"`
+	Nitrate   *float32 `json:"nitrate,omitempty"`
+	Phosphate *float32 `json:"phosphate,omitempty"`
+}
+
+func (t tankStatisticJSON) toDB() db.TankStatistic {
+	return db.TankStatistic{
+		TestDate:  strings.TrimSpace(t.TestDate),
+		PH:        t.PH,
+		GH:        t.GH,
+		KH:        t.KH,
+		Ammonia:   t.Ammonia,
+		Nitrite:   t.Nitrite,
+		Nitrate:   t.Nitrate,
+		Phosphate: t.Phosphate,
+	}
+}
+
+func toTankStatisticJSON(ts db.TankStatistic) *tankStatisticJSON {
+	return &tankStatisticJSON{
+		ID:        ts.ID,
+		TestDate:  ts.TestDate,
+		PH:        ts.PH,
+		GH:        ts.GH,
+		KH:        ts.KH,
+		Ammonia:   ts.Ammonia,
+		Nitrite:   ts.Nitrite,
+		Nitrate:   ts.Nitrate,
+		Phosphate: ts.Phosphate,
+	}
+}
+
+type batchTankStatisticsRequest struct {
+	TankStatistics []tankStatisticJSON `json:"tankStatistics"`
+	// AllOrNothing adds none of the tank statistics if any are invalid, otherwise the
+	// valid ones are added
+	AllOrNothing bool `json:"allOrNothing"`
+}
+
+type batchTankStatisticsResponse struct {
+	Results []batchResult `json:"results"`
+	Added   int           `json:"added"`
+}
+
+// batchResult is the result of adding one tank statistic of a batch, which is either the
+// added tank statistic or the reasons it's invalid
+type batchResult struct {
+	Index         int                `json:"index"`
+	TankStatistic *tankStatisticJSON `json:"tankStatistic,omitempty"`
+	Errors        []string           `json:"errors,omitempty"`
+}
+
+// handleTankStatisticsBatch serves /api/v1alpha1/tank/statistics/batch, the HTTP
+// equivalent of a BatchAddTankStatistics RPC, where POST adds many tank statistics in a
+// single transaction
+//
+// Every tank statistic is validated first, and a result is returned for each, in the
+// order they were given. Invalid tank statistics are skipped, unless allOrNothing is set
+// in which case none are added.
+func (s *Server) handleTankStatisticsBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	var req batchTankStatisticsRequest
+	if err := readJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if len(req.TankStatistics) == 0 {
+		writeError(w, http.StatusBadRequest, errors.New("tankStatistics is required"))
+		return
+	}
+
+	if len(req.TankStatistics) > maxBatchSize {
+		writeError(w, http.StatusBadRequest, errors.Errorf("at most %d tank statistics can be added at once", maxBatchSize))
+		return
+	}
+
+	rsp := batchTankStatisticsResponse{Results: make([]batchResult, len(req.TankStatistics))}
+
+	valid := make([]db.TankStatistic, 0, len(req.TankStatistics))
+	indexes := make([]int, 0, len(req.TankStatistics))
+	invalid := false
+
+	for i, t := range req.TankStatistics {
+		ts := t.toDB()
+		rsp.Results[i].Index = i
+
+		errs := validateMeasurements(ts)
+		if ts.TestDate == "" {
+			errs = append([]string{"test date is required"}, errs...)
+		}
+
+		if len(errs) > 0 {
+			rsp.Results[i].Errors = errs
+			invalid = true
+
+			continue
+		}
+
+		valid = append(valid, ts)
+		indexes = append(indexes, i)
+	}
+
+	if invalid && req.AllOrNothing {
+		writeJSON(w, http.StatusUnprocessableEntity, rsp)
+		return
+	}
+
+	if len(valid) > 0 {
+		inserted, err := s.tankStatModifier.InsertTankStatistics(r.Context(), valid)
+		if err != nil {
+			writeError(w, statusForError(err), errors.Wrap(err, "unable to add tank statistics"))
+			return
+		}
+
+		for i, ts := range inserted {
+			rsp.Results[indexes[i]].TankStatistic = toTankStatisticJSON(ts)
+		}
+
+		rsp.Added = len(inserted)
+	}
+
+	writeJSON(w, http.StatusOK, rsp)
+}
+
+// validateMeasurements returns every reason the measurements of a tank statistic are
+// invalid
+func validateMeasurements(ts db.TankStatistic) []string {
+	errs := []string{}
+	measured := false
+
+	for _, m := range tankStatisticMeasurements {
+		v := *m.value(&ts)
+		if v == nil {
+			continue
+		}
+
+		measured = true
+
+		if math.IsNaN(float64(*v)) || math.IsInf(float64(*v), 0) {
+			errs = append(errs, fmt.Sprintf("%s %v is not a number", m.name, *v))
+			continue
+		}
+
+		if *v < 0 || (m.max > 0 && *v > m.max) {
+			errs = append(errs, fmt.Sprintf("%s %v is out of range", m.name, *v))
+		}
+	}
+
+	if !measured {
+		errs = append(errs, "no measurements")
+	}
+
+	return errs
+}
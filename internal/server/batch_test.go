@@ -0,0 +1,105 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+func TestTankStatisticsBatch(t *testing.T) {
+	tsm := &tankStatsMock{}
+	s := Server{tankStatModifier: tsm}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	request := func(body string) (*httptest.ResponseRecorder, batchTankStatisticsResponse) {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/tank/statistics/batch", strings.NewReader(body)))
+
+		var rsp batchTankStatisticsResponse
+		_ = json.Unmarshal(rec.Body.Bytes(), &rsp)
+
+		return rec, rsp
+	}
+
+	ph, nitrate := float32(7.2), float32(10)
+
+	t.Run("Given a batch of valid tank statistics", func(t *testing.T) {
+		t.Run("When it is added", func(t *testing.T) {
+			t.Run("Then every tank statistic is added in one call", func(t *testing.T) {
+				rec, rsp := request(`{"tankStatistics": [{"testDate": "2021/08/06 10:00", "ph": 7.2}, {"testDate": "2021/08/06 11:00", "nitrate": 10}]}`)
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Equal(t, 2, rsp.Added)
+				assert.Equal(t, []db.TankStatistic{
+					{TestDate: "2021/08/06 10:00", PH: &ph},
+					{TestDate: "2021/08/06 11:00", Nitrate: &nitrate},
+				}, tsm.insertManyRequest)
+				assert.Equal(t, []batchResult{
+					{Index: 0, TankStatistic: &tankStatisticJSON{TestDate: "2021/08/06 10:00", PH: &ph}},
+					{Index: 1, TankStatistic: &tankStatisticJSON{TestDate: "2021/08/06 11:00", Nitrate: &nitrate}},
+				}, rsp.Results)
+			})
+		})
+	})
+
+	t.Run("Given a batch with invalid tank statistics", func(t *testing.T) {
+		body := `{"tankStatistics": [{"testDate": "2021/08/06 10:00", "ph": 15}, {"testDate": "2021/08/06 11:00", "nitrate": 10}, {"testDate": ""}]%s}`
+
+		t.Run("When it is added", func(t *testing.T) {
+			t.Run("Then the valid tank statistics are added and the rest reported", func(t *testing.T) {
+				rec, rsp := request(strings.Replace(body, "%s", "", 1))
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Equal(t, 1, rsp.Added)
+				assert.Equal(t, []db.TankStatistic{{TestDate: "2021/08/06 11:00", Nitrate: &nitrate}}, tsm.insertManyRequest)
+				assert.Equal(t, []batchResult{
+					{Index: 0, Errors: []string{"ph 15 is out of range"}},
+					{Index: 1, TankStatistic: &tankStatisticJSON{TestDate: "2021/08/06 11:00", Nitrate: &nitrate}},
+					{Index: 2, Errors: []string{"test date is required", "no measurements"}},
+				}, rsp.Results)
+			})
+		})
+		t.Run("When it is added all or nothing", func(t *testing.T) {
+			t.Run("Then nothing is added", func(t *testing.T) {
+				tsm.insertManyRequest = nil
+
+				rec, rsp := request(strings.Replace(body, "%s", `, "allOrNothing": true`, 1))
+
+				assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+				assert.Equal(t, 0, rsp.Added)
+				assert.Len(t, rsp.Results, 3)
+				assert.Nil(t, tsm.insertManyRequest)
+			})
+		})
+	})
+
+	t.Run("Given an empty batch", func(t *testing.T) {
+		t.Run("When it is added", func(t *testing.T) {
+			t.Run("Then bad request is returned", func(t *testing.T) {
+				rec, _ := request(`{"tankStatistics": []}`)
+
+				assert.Equal(t, http.StatusBadRequest, rec.Code)
+			})
+		})
+	})
+
+	t.Run("Given a batch which can't be added", func(t *testing.T) {
+		t.Run("When it is added", func(t *testing.T) {
+			t.Run("Then the error is returned", func(t *testing.T) {
+				tsm.err = assert.AnError
+				defer func() { tsm.err = nil }()
+
+				rec, _ := request(`{"tankStatistics": [{"testDate": "2021/08/06 10:00", "ph": 7.2}]}`)
+
+				assert.Equal(t, http.StatusInternalServerError, rec.Code)
+			})
+		})
+	})
+}
@@ -0,0 +1,407 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+type breedingQuerier interface {
+	GetBreeding(context.Context, int32) (db.Breeding, error)
+	ListBreedings(context.Context, db.BreedingFilter) ([]db.Breeding, error)
+	ListFryCounts(context.Context, int32) ([]db.FryCount, error)
+	ListAncestors(context.Context, int32) ([]db.Ancestor, error)
+}
+
+type breedingModifier interface {
+	InsertBreeding(context.Context, db.Breeding) (db.Breeding, error)
+	DeleteBreeding(context.Context, int32) (db.Breeding, error)
+	InsertFryCount(context.Context, db.FryCount) (db.FryCount, error)
+	PromoteFry(context.Context, int32, db.Fish) (db.Fish, error)
+}
+
+type breedingRequest struct {
+	TankID            int32  `json:"tankId"`
+	MotherFishID      *int32 `json:"motherFishId"`
+	FatherFishID      *int32 `json:"fatherFishId"`
+	SpawnDate         string `json:"spawnDate"`
+	EstimatedFryCount int32  `json:"estimatedFryCount"`
+	Notes             string `json:"notes"`
+}
+
+type breedingResponse struct {
+	ID                int32     `json:"id"`
+	TankID            int32     `json:"tankId"`
+	MotherFishID      *int32    `json:"motherFishId,omitempty"`
+	FatherFishID      *int32    `json:"fatherFishId,omitempty"`
+	SpawnDate         time.Time `json:"spawnDate"`
+	EstimatedFryCount int32     `json:"estimatedFryCount"`
+	LatestFryCount    *int32    `json:"latestFryCount,omitempty"`
+	// SurvivalRate is the latest fry count as a fraction of the estimated count
+	SurvivalRate     *float32 `json:"survivalRate,omitempty"`
+	OffspringFishIDs []int32  `json:"offspringFishIds"`
+	Notes            string   `json:"notes"`
+}
+
+type fryCountRequest struct {
+	CountDate string `json:"countDate"`
+	Count     int32  `json:"count"`
+}
+
+type fryCountResponse struct {
+	ID         int32     `json:"id"`
+	BreedingID int32     `json:"breedingId"`
+	CountDate  time.Time `json:"countDate"`
+	Count      int32     `json:"count"`
+}
+
+type promoteFryRequest struct {
+	Count   int32  `json:"count"`
+	Type    string `json:"type"`
+	Subtype string `json:"subtype"`
+	Color   string `json:"color"`
+	Gender  string `json:"gender"`
+}
+
+type fishResponse struct {
+	ID           int32  `json:"id"`
+	TankID       *int32 `json:"tankId,omitempty"`
+	Type         string `json:"type"`
+	Subtype      string `json:"subtype"`
+	Color        string `json:"color"`
+	Gender       string `json:"gender"`
+	PurchaseDate string `json:"purchaseDate"`
+	Count        int32  `json:"count"`
+}
+
+type ancestorResponse struct {
+	Generation int32        `json:"generation"`
+	BreedingID int32        `json:"breedingId"`
+	Fish       fishResponse `json:"fish"`
+}
+
+func toBreedingResponse(b db.Breeding) breedingResponse {
+	rsp := breedingResponse{
+		ID:                b.ID,
+		TankID:            b.TankID,
+		MotherFishID:      b.MotherFishID,
+		FatherFishID:      b.FatherFishID,
+		SpawnDate:         b.SpawnDate,
+		EstimatedFryCount: b.EstimatedFryCount,
+		LatestFryCount:    b.LatestFryCount,
+		OffspringFishIDs:  b.OffspringFishIDs,
+		Notes:             b.Notes,
+	}
+
+	if rsp.OffspringFishIDs == nil {
+		rsp.OffspringFishIDs = []int32{}
+	}
+
+	if b.LatestFryCount != nil && b.EstimatedFryCount > 0 {
+		rate := float32(*b.LatestFryCount) / float32(b.EstimatedFryCount)
+		rsp.SurvivalRate = &rate
+	}
+
+	return rsp
+}
+
+func toFishResponse(f db.Fish) fishResponse {
+	return fishResponse{
+		ID:           f.ID,
+		TankID:       f.TankID,
+		Type:         f.Type,
+		Subtype:      f.Subtype,
+		Color:        f.Color,
+		Gender:       stringToGender(f.Gender).String(),
+		PurchaseDate: f.PurchaseDate,
+		Count:        f.Count,
+	}
+}
+
+// handleBreedings serves /api/v1alpha1/breedings
+//
+// GET lists breedings, newest first, optionally filtered by tankId or parentFishId.
+// POST records a new breeding.
+func (s *Server) handleBreedings(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.listBreedings(w, r)
+	case http.MethodPost:
+		s.addBreeding(w, r)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// handleBreeding serves /api/v1alpha1/breedings/{id}, /api/v1alpha1/breedings/{id}/fry-counts
+// and /api/v1alpha1/breedings/{id}/promote
+func (s *Server) handleBreeding(w http.ResponseWriter, r *http.Request) {
+	id, rest, err := pathID(r.URL.Path, "/api/v1alpha1/breedings/")
+	if err != nil {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	switch {
+	case rest == "" && r.Method == http.MethodGet:
+		rsp, err := s.breedingQuerier.GetBreeding(r.Context(), id)
+		if err != nil {
+			writeError(w, statusForError(err), errors.Wrap(err, "unable to get breeding"))
+			return
+		}
+
+		writeJSON(w, http.StatusOK, toBreedingResponse(rsp))
+	case rest == "" && r.Method == http.MethodDelete:
+		rsp, err := s.breedingModifier.DeleteBreeding(r.Context(), id)
+		if err != nil {
+			writeError(w, statusForError(err), errors.Wrap(err, "unable to delete breeding"))
+			return
+		}
+
+		writeJSON(w, http.StatusOK, toBreedingResponse(rsp))
+	case rest == "fry-counts" && r.Method == http.MethodGet:
+		s.listFryCounts(w, r, id)
+	case rest == "fry-counts" && r.Method == http.MethodPost:
+		s.addFryCount(w, r, id)
+	case rest == "promote" && r.Method == http.MethodPost:
+		s.promoteFry(w, r, id)
+	default:
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+// handleLineage serves /api/v1alpha1/lineage/{fishId}, returning the ancestors of the fish
+func (s *Server) handleLineage(w http.ResponseWriter, r *http.Request) {
+	id, rest, err := pathID(r.URL.Path, "/api/v1alpha1/lineage/")
+	if err != nil || rest != "" {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	rsp, err := s.breedingQuerier.ListAncestors(r.Context(), id)
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to get lineage"))
+		return
+	}
+
+	ancestors := make([]ancestorResponse, len(rsp))
+	for i, a := range rsp {
+		ancestors[i] = ancestorResponse{
+			Generation: a.Generation,
+			BreedingID: a.BreedingID,
+			Fish:       toFishResponse(a.Fish),
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"fishId": id, "ancestors": ancestors})
+}
+
+func (s *Server) listBreedings(w http.ResponseWriter, r *http.Request) {
+	var (
+		filter db.BreedingFilter
+		err    error
+	)
+
+	if filter.TankID, err = optionalInt32(r, "tankId"); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if filter.ParentFishID, err = optionalInt32(r, "parentFishId"); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	rsp, err := s.breedingQuerier.ListBreedings(r.Context(), filter)
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to list breedings"))
+		return
+	}
+
+	breedings := make([]breedingResponse, len(rsp))
+	for i, b := range rsp {
+		breedings[i] = toBreedingResponse(b)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"breedings": breedings})
+}
+
+func (s *Server) addBreeding(w http.ResponseWriter, r *http.Request) {
+	var req breedingRequest
+	if err := readJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if req.TankID == 0 {
+		writeError(w, http.StatusBadRequest, errors.New("tankId must be provided"))
+		return
+	}
+
+	if req.EstimatedFryCount < 0 {
+		writeError(w, http.StatusBadRequest, errors.New("estimatedFryCount must not be negative"))
+		return
+	}
+
+	spawnDate, err := parseDate(req.SpawnDate, time.Now())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := s.checkTank(r.Context(), req.TankID); err != nil {
+		writeError(w, statusForError(err), err)
+		return
+	}
+
+	for _, id := range []*int32{req.MotherFishID, req.FatherFishID} {
+		if id == nil {
+			continue
+		}
+
+		if err := s.checkFish(r.Context(), *id); err != nil {
+			writeError(w, statusForError(err), err)
+			return
+		}
+	}
+
+	rsp, err := s.breedingModifier.InsertBreeding(r.Context(), db.Breeding{
+		TankID:            req.TankID,
+		MotherFishID:      req.MotherFishID,
+		FatherFishID:      req.FatherFishID,
+		SpawnDate:         spawnDate,
+		EstimatedFryCount: req.EstimatedFryCount,
+		Notes:             req.Notes,
+	})
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to add breeding"))
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, toBreedingResponse(rsp))
+}
+
+func (s *Server) listFryCounts(w http.ResponseWriter, r *http.Request, breedingID int32) {
+	rsp, err := s.breedingQuerier.ListFryCounts(r.Context(), breedingID)
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to list fry counts"))
+		return
+	}
+
+	counts := make([]fryCountResponse, len(rsp))
+	for i, c := range rsp {
+		counts[i] = fryCountResponse{ID: c.ID, BreedingID: c.BreedingID, CountDate: c.CountDate, Count: c.Count}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"fryCounts": counts})
+}
+
+func (s *Server) addFryCount(w http.ResponseWriter, r *http.Request, breedingID int32) {
+	var req fryCountRequest
+	if err := readJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if req.Count < 0 {
+		writeError(w, http.StatusBadRequest, errors.New("count must not be negative"))
+		return
+	}
+
+	countDate, err := parseDate(req.CountDate, time.Now())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	c, err := s.breedingModifier.InsertFryCount(r.Context(), db.FryCount{BreedingID: breedingID, CountDate: countDate, Count: req.Count})
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to add fry count"))
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, fryCountResponse{ID: c.ID, BreedingID: c.BreedingID, CountDate: c.CountDate, Count: c.Count})
+}
+
+// promoteFry creates a fish record for surviving fry. Unless overridden in the request the
+// type and subtype are inherited from the mother (or father) and the purchase date is the
+// spawn date.
+func (s *Server) promoteFry(w http.ResponseWriter, r *http.Request, breedingID int32) {
+	var req promoteFryRequest
+	if err := readJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if req.Count <= 0 {
+		writeError(w, http.StatusBadRequest, errors.New("count must be greater than zero"))
+		return
+	}
+
+	b, err := s.breedingQuerier.GetBreeding(r.Context(), breedingID)
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to get breeding"))
+		return
+	}
+
+	fish := db.Fish{
+		Type:         req.Type,
+		Subtype:      req.Subtype,
+		Color:        req.Color,
+		Gender:       stringToGender(req.Gender).String(),
+		PurchaseDate: b.SpawnDate.Format("2006-01-02"),
+		Count:        req.Count,
+	}
+
+	if fish.Type == "" || fish.Subtype == "" {
+		parent, err := s.parentFish(r.Context(), b)
+		if err != nil {
+			writeError(w, statusForError(err), err)
+			return
+		}
+
+		if fish.Type == "" {
+			fish.Type = parent.Type
+		}
+
+		if fish.Subtype == "" {
+			fish.Subtype = parent.Subtype
+		}
+	}
+
+	rsp, err := s.breedingModifier.PromoteFry(r.Context(), breedingID, fish)
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to promote fry"))
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, toFishResponse(rsp))
+}
+
+// parentFish returns the mother of a breeding, falling back to the father, or an empty
+// Fish if neither parent is known
+func (s *Server) parentFish(ctx context.Context, b db.Breeding) (db.Fish, error) {
+	parentID := b.MotherFishID
+	if parentID == nil {
+		parentID = b.FatherFishID
+	}
+
+	if parentID == nil {
+		return db.Fish{}, nil
+	}
+
+	parent, err := s.fishQuerier.GetFish(ctx, *parentID)
+	if err != nil {
+		return db.Fish{}, errors.Wrap(err, "unable to get parent fish")
+	}
+
+	return parent, nil
+}
@@ -0,0 +1,213 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openlyinc/pointy"
+	"github.com/stretchr/testify/assert"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+func TestToBreedingResponse(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		breeding db.Breeding
+		expected *float32
+	}{
+		{desc: "No fry count has no survival rate", breeding: db.Breeding{EstimatedFryCount: 20}, expected: nil},
+		{desc: "No estimate has no survival rate", breeding: db.Breeding{LatestFryCount: pointy.Int32(5)}, expected: nil},
+		{desc: "Survival rate is the latest count over the estimate", breeding: db.Breeding{EstimatedFryCount: 20, LatestFryCount: pointy.Int32(15)}, expected: pointy.Float32(0.75)},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			rsp := toBreedingResponse(tC.breeding)
+
+			assert.Equal(t, tC.expected, rsp.SurvivalRate)
+			assert.NotNil(t, rsp.OffspringFishIDs)
+		})
+	}
+}
+
+func TestAddBreeding(t *testing.T) {
+	bm := &breedingMock{}
+	fm := &fishMock{}
+	s := Server{breedingModifier: bm, tankQuerier: &tankMock{}, fishQuerier: fm}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	t.Run("Given a request to add a breeding", func(t *testing.T) {
+		t.Run("When no tank is provided", func(t *testing.T) {
+			t.Run("Then a bad request is returned", func(t *testing.T) {
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/breedings", strings.NewReader(`{"estimatedFryCount": 20}`)))
+
+				assert.Equal(t, http.StatusBadRequest, rec.Code)
+			})
+		})
+		t.Run("When a parent isn't visible to the household", func(t *testing.T) {
+			t.Run("Then not found is returned", func(t *testing.T) {
+				fm.err = &db.ErrNotFound{}
+				defer func() { fm.err = nil }()
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/breedings", strings.NewReader(`{"tankId": 1, "motherFishId": 9}`)))
+
+				assert.Equal(t, http.StatusNotFound, rec.Code)
+			})
+		})
+		t.Run("When no error is returned", func(t *testing.T) {
+			t.Run("Then the breeding is returned", func(t *testing.T) {
+				bm.insertBreedingResponse = db.Breeding{ID: 3, TankID: 1, EstimatedFryCount: 20}
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/breedings", strings.NewReader(`{"tankId": 1, "motherFishId": 2, "spawnDate": "2021-08-01", "estimatedFryCount": 20}`)))
+
+				assert.Equal(t, http.StatusCreated, rec.Code)
+				assert.Equal(t, int32(2), *bm.insertBreedingRequest.MotherFishID)
+				assert.Equal(t, time.Date(2021, 8, 1, 0, 0, 0, 0, time.UTC), bm.insertBreedingRequest.SpawnDate)
+
+				var rsp breedingResponse
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(&rsp))
+				assert.Equal(t, int32(3), rsp.ID)
+			})
+		})
+	})
+}
+
+func TestPromoteFry(t *testing.T) {
+	bm := &breedingMock{}
+	fm := &fishMock{}
+	s := Server{breedingQuerier: bm, breedingModifier: bm, fishQuerier: fm}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	t.Run("Given a request to promote fry", func(t *testing.T) {
+		t.Run("When the count is zero", func(t *testing.T) {
+			t.Run("Then a bad request is returned", func(t *testing.T) {
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/breedings/3/promote", strings.NewReader(`{"count": 0}`)))
+
+				assert.Equal(t, http.StatusBadRequest, rec.Code)
+			})
+		})
+		t.Run("When the breeding doesn't exist", func(t *testing.T) {
+			t.Run("Then not found is returned", func(t *testing.T) {
+				bm.err = &db.ErrNotFound{}
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/breedings/3/promote", strings.NewReader(`{"count": 12}`)))
+
+				assert.Equal(t, http.StatusNotFound, rec.Code)
+			})
+		})
+		t.Run("When no type is provided", func(t *testing.T) {
+			t.Run("Then the type is inherited from the mother", func(t *testing.T) {
+				bm.err = nil
+				bm.getBreedingResponse = db.Breeding{ID: 3, MotherFishID: pointy.Int32(2), SpawnDate: time.Date(2021, 8, 1, 0, 0, 0, 0, time.UTC)}
+				bm.promoteFryResponse = db.Fish{ID: 9, Type: "Guppy", Subtype: "Endler", Count: 12}
+				fm.getFishResponse = db.Fish{ID: 2, Type: "Guppy", Subtype: "Endler"}
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/breedings/3/promote", strings.NewReader(`{"count": 12}`)))
+
+				assert.Equal(t, http.StatusCreated, rec.Code)
+				assert.Equal(t, int32(3), bm.promoteFryBreedingID)
+				assert.Equal(t, "Guppy", bm.promoteFryRequest.Type)
+				assert.Equal(t, "Endler", bm.promoteFryRequest.Subtype)
+				assert.Equal(t, "2021-08-01", bm.promoteFryRequest.PurchaseDate)
+				assert.Equal(t, int32(12), bm.promoteFryRequest.Count)
+			})
+		})
+	})
+}
+
+func TestLineage(t *testing.T) {
+	bm := &breedingMock{}
+	s := Server{breedingQuerier: bm}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	t.Run("Given a request for a fish's lineage", func(t *testing.T) {
+		t.Run("When no error is returned", func(t *testing.T) {
+			t.Run("Then the ancestors are returned", func(t *testing.T) {
+				bm.listAncestorsResponse = []db.Ancestor{
+					{Generation: 1, BreedingID: 3, Fish: db.Fish{ID: 2, Type: "Guppy"}},
+					{Generation: 2, BreedingID: 1, Fish: db.Fish{ID: 1, Type: "Guppy"}},
+				}
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1alpha1/lineage/9", nil))
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+
+				var rsp struct {
+					FishID    int32
+					Ancestors []ancestorResponse
+				}
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(&rsp))
+				assert.Equal(t, int32(9), rsp.FishID)
+				assert.Len(t, rsp.Ancestors, 2)
+				assert.Equal(t, int32(2), rsp.Ancestors[1].Generation)
+			})
+		})
+	})
+}
+
+type breedingMock struct {
+	insertBreedingRequest  db.Breeding
+	insertBreedingResponse db.Breeding
+	getBreedingResponse    db.Breeding
+	listBreedingsResponse  []db.Breeding
+	listFryCountsResponse  []db.FryCount
+	insertFryCountResponse db.FryCount
+	promoteFryBreedingID   int32
+	promoteFryRequest      db.Fish
+	promoteFryResponse     db.Fish
+	listAncestorsResponse  []db.Ancestor
+	err                    error
+}
+
+func (m *breedingMock) InsertBreeding(ctx context.Context, req db.Breeding) (db.Breeding, error) {
+	m.insertBreedingRequest = req
+
+	return m.insertBreedingResponse, m.err
+}
+
+func (m *breedingMock) GetBreeding(context.Context, int32) (db.Breeding, error) {
+	return m.getBreedingResponse, m.err
+}
+
+func (m *breedingMock) ListBreedings(context.Context, db.BreedingFilter) ([]db.Breeding, error) {
+	return m.listBreedingsResponse, m.err
+}
+
+func (m *breedingMock) DeleteBreeding(context.Context, int32) (db.Breeding, error) {
+	return m.getBreedingResponse, m.err
+}
+
+func (m *breedingMock) InsertFryCount(context.Context, db.FryCount) (db.FryCount, error) {
+	return m.insertFryCountResponse, m.err
+}
+
+func (m *breedingMock) ListFryCounts(context.Context, int32) ([]db.FryCount, error) {
+	return m.listFryCountsResponse, m.err
+}
+
+func (m *breedingMock) PromoteFry(ctx context.Context, breedingID int32, fish db.Fish) (db.Fish, error) {
+	m.promoteFryBreedingID, m.promoteFryRequest = breedingID, fish
+
+	return m.promoteFryResponse, m.err
+}
+
+func (m *breedingMock) ListAncestors(context.Context, int32) ([]db.Ancestor, error) {
+	return m.listAncestorsResponse, m.err
+}
@@ -0,0 +1,272 @@
+package server
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+// csvPath serves tanks, fish and tank statistics as CSV, e.g. /api/v1alpha1/csv/tanks
+const csvPath = "/api/v1alpha1/csv/"
+
+// csvColumn is a column of a CSV export, formatting its value from an entity. Text columns
+// hold what users entered, which is escaped so spreadsheets don't run it as a formula.
+type csvColumn struct {
+	name   string
+	format func(interface{}) string
+	text   bool
+}
+
+var tankCSVColumns = []csvColumn{
+	{name: "id", format: func(v interface{}) string { return strconv.Itoa(int(v.(db.Tank).ID)) }},
+	{name: "name", format: func(v interface{}) string { return v.(db.Tank).Name }, text: true},
+	{name: "make", format: func(v interface{}) string { return v.(db.Tank).Make }, text: true},
+	{name: "model", format: func(v interface{}) string { return v.(db.Tank).Model }, text: true},
+	{name: "location", format: func(v interface{}) string { return v.(db.Tank).Location }, text: true},
+	{name: "capacity", format: func(v interface{}) string { return formatFloat(v.(db.Tank).Capacity) }},
+	{name: "capacityMeasurement", format: func(v interface{}) string { return v.(db.Tank).CapacityMeasurement }, text: true},
+	{name: "description", format: func(v interface{}) string { return v.(db.Tank).Description }, text: true},
+	{name: "role", format: func(v interface{}) string { return v.(db.Tank).Role }, text: true},
+}
+
+var fishCSVColumns = []csvColumn{
+	{name: "id", format: func(v interface{}) string { return strconv.Itoa(int(v.(db.Fish).ID)) }},
+	{name: "tankId", format: func(v interface{}) string { return formatInt(v.(db.Fish).TankID) }},
+	{name: "type", format: func(v interface{}) string { return v.(db.Fish).Type }, text: true},
+	{name: "subtype", format: func(v interface{}) string { return v.(db.Fish).Subtype }, text: true},
+	{name: "color", format: func(v interface{}) string { return v.(db.Fish).Color }, text: true},
+	{name: "gender", format: func(v interface{}) string { return v.(db.Fish).Gender }, text: true},
+	{name: "purchaseDate", format: func(v interface{}) string { return v.(db.Fish).PurchaseDate }, text: true},
+	{name: "count", format: func(v interface{}) string { return strconv.Itoa(int(v.(db.Fish).Count)) }},
+}
+
+var tankStatisticCSVColumns = []csvColumn{
+	{name: "id", format: func(v interface{}) string { return strconv.Itoa(int(v.(db.TankStatistic).ID)) }},
+	{name: "testDate", format: func(v interface{}) string { return v.(db.TankStatistic).TestDate }, text: true},
+	{name: "ph", format: func(v interface{}) string { return formatFloat(v.(db.TankStatistic).PH) }},
+	{name: "gh", format: func(v interface{}) string { return formatFloat(v.(db.TankStatistic).GH) }},
+	{name: "kh", format: func(v interface{}) string { return formatFloat(v.(db.TankStatistic).KH) }},
+	{name: "ammonia", format: func(v interface{}) string { return formatFloat(v.(db.TankStatistic).Ammonia) }},
+	{name: "nitrite", format: func(v interface{}) string { return formatFloat(v.(db.TankStatistic).Nitrite) }},
+	{name: "nitrate", format: func(v interface{}) string { return formatFloat(v.(db.TankStatistic).Nitrate) }},
+	{name: "phosphate", format: func(v interface{}) string { return formatFloat(v.(db.TankStatistic).Phosphate) }},
+}
+
+// handleCSVExport serves /api/v1alpha1/csv/{tanks,fish,tank-statistics}, where GET
+// downloads them as CSV
+//
+// The columns, and their order, can be chosen with columns, e.g. columns=testDate,ph.
+// Fish and tank statistics can be restricted to those purchased or tested within a date
+// range with from (inclusive) and to (exclusive), which leaves out those whose date
+// can't be read.
+func (s *Server) handleCSVExport(w http.ResponseWriter, r *http.Request) {
+	entity := strings.TrimPrefix(r.URL.Path, csvPath)
+
+	var available []csvColumn
+	switch entity {
+	case "tanks":
+		available = tankCSVColumns
+	case "fish":
+		available = fishCSVColumns
+	case "tank-statistics":
+		available = tankStatisticCSVColumns
+	default:
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	columns, err := selectCSVColumns(available, r.FormValue("columns"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	from, err := optionalDate(r, "from")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	to, err := optionalDate(r, "to")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if entity == "tanks" && (from != nil || to != nil) {
+		writeError(w, http.StatusBadRequest, errors.New("tanks can't be restricted to a date range"))
+		return
+	}
+
+	inRange := func(date string) bool {
+		if from == nil && to == nil {
+			return true
+		}
+
+		t, ok := parseStoredDate(date)
+
+		return ok && (from == nil || !t.Before(*from)) && (to == nil || t.Before(*to))
+	}
+
+	rows := make([]interface{}, 0)
+
+	switch entity {
+	case "tanks":
+		tanks, err := s.tankQuerier.ListTanks(r.Context())
+		if err != nil {
+			writeError(w, statusForError(err), errors.Wrap(err, "unable to list tanks"))
+			return
+		}
+
+		for _, t := range tanks {
+			rows = append(rows, t)
+		}
+	case "fish":
+		fish, err := s.fishQuerier.ListFish(r.Context())
+		if err != nil {
+			writeError(w, statusForError(err), errors.Wrap(err, "unable to list fish"))
+			return
+		}
+
+		for _, f := range fish {
+			if inRange(f.PurchaseDate) {
+				rows = append(rows, f)
+			}
+		}
+	case "tank-statistics":
+		stats, err := s.tankStatQuerier.ListTankStatistics(r.Context())
+		if err != nil {
+			writeError(w, statusForError(err), errors.Wrap(err, "unable to list tank statistics"))
+			return
+		}
+
+		for _, ts := range stats {
+			if inRange(ts.TestDate) {
+				rows = append(rows, ts)
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", entity+".csv"))
+	w.WriteHeader(http.StatusOK)
+
+	if err := writeCSV(w, columns, rows); err != nil {
+		logrus.WithError(err).Error("unable to write CSV")
+	}
+}
+
+// selectCSVColumns returns the named columns, separated by commas, or every column if none
+// are named
+func selectCSVColumns(available []csvColumn, names string) ([]csvColumn, error) {
+	if names == "" {
+		return available, nil
+	}
+
+	columns := make([]csvColumn, 0)
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+
+		i := -1
+		for j, c := range available {
+			if strings.EqualFold(c.name, name) {
+				i = j
+				break
+			}
+		}
+
+		if i < 0 {
+			return nil, errors.Errorf("unknown column %q", name)
+		}
+
+		columns = append(columns, available[i])
+	}
+
+	return columns, nil
+}
+
+// writeCSV writes a header of the column names followed by a record for each row, flushing
+// as it goes so large exports are streamed
+func writeCSV(w http.ResponseWriter, columns []csvColumn, rows []interface{}) error {
+	cw := csv.NewWriter(w)
+
+	record := make([]string, len(columns))
+	for i, c := range columns {
+		record[i] = c.name
+	}
+
+	if err := cw.Write(record); err != nil {
+		return err
+	}
+
+	for n, row := range rows {
+		for i, c := range columns {
+			record[i] = c.format(row)
+			if c.text {
+				record[i] = escapeCSVFormula(record[i])
+			}
+		}
+
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+
+		if n%100 == 99 {
+			cw.Flush()
+		}
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
+
+// escapeCSVFormula prefixes text which spreadsheets would take to be a formula with a
+// quote, so it's shown as text instead of being run when the export is opened
+func escapeCSVFormula(v string) string {
+	if v != "" && strings.ContainsAny(v[:1], "=+-@\t\r") {
+		return "'" + v
+	}
+
+	return v
+}
+
+// parseStoredDate parses a test or purchase date, which are stored as entered so may be in
+// any of csvDateFormats
+func parseStoredDate(v string) (time.Time, bool) {
+	for _, f := range csvDateFormats {
+		if t, err := parseTestDate(f.layout, strings.TrimSpace(v)); err == nil {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+func formatFloat(f *float32) string {
+	if f == nil {
+		return ""
+	}
+
+	return strconv.FormatFloat(float64(*f), 'f', -1, 32)
+}
+
+func formatInt(i *int32) string {
+	if i == nil {
+		return ""
+	}
+
+	return strconv.Itoa(int(*i))
+}
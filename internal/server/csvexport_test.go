@@ -0,0 +1,105 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+func TestCSVExport(t *testing.T) {
+	ph, capacity := float32(7.2), float32(60)
+	tankID := int32(1)
+
+	s := Server{
+		tankQuerier: &tankMock{listTankResponse: []db.Tank{{ID: 1, Name: "Reef, \"Big\"", Capacity: &capacity, CapacityMeasurement: "LITRES", Description: "=1+2", Role: db.TankRoleDisplay}}},
+		fishQuerier: fishMock{listFishResponse: []db.Fish{
+			{ID: 1, TankID: &tankID, Type: "Clownfish", PurchaseDate: "2021-08-06", Count: 2},
+			{ID: 2, Type: "Guppy", Count: 5},
+		}},
+		tankStatQuerier: &tankStatsMock{listTankStatisticsResponse: []db.TankStatistic{
+			{ID: 1, TestDate: "2021/07/31 23:00", PH: &ph},
+			{ID: 2, TestDate: "2021/08/06 10:00", PH: &ph},
+			{ID: 3, TestDate: "06/08/2021"},
+			{ID: 4, TestDate: "2021/09/01 00:00"},
+		}},
+	}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+		return rec
+	}
+
+	t.Run("Given tanks, fish and tank statistics", func(t *testing.T) {
+		t.Run("When tanks are exported", func(t *testing.T) {
+			t.Run("Then every column is written", func(t *testing.T) {
+				rec := get("/api/v1alpha1/csv/tanks")
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Equal(t, "text/csv; charset=utf-8", rec.Header().Get("Content-Type"))
+				assert.Equal(t, `attachment; filename="tanks.csv"`, rec.Header().Get("Content-Disposition"))
+				assert.Equal(t, "id,name,make,model,location,capacity,capacityMeasurement,description,role\n1,\"Reef, \"\"Big\"\"\",,,,60,LITRES,'=1+2,DISPLAY\n", rec.Body.String())
+			})
+		})
+		t.Run("When columns are chosen", func(t *testing.T) {
+			t.Run("Then only they are written, in order", func(t *testing.T) {
+				rec := get("/api/v1alpha1/csv/fish?columns=count,type,tankId")
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Equal(t, "count,type,tankId\n2,Clownfish,1\n5,Guppy,\n", rec.Body.String())
+			})
+		})
+		t.Run("When tank statistics are exported for a date range", func(t *testing.T) {
+			t.Run("Then only those tested within it are written", func(t *testing.T) {
+				rec := get("/api/v1alpha1/csv/tank-statistics?columns=id,testDate,ph&from=2021-08-01&to=2021-09-01")
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Equal(t, "id,testDate,ph\n2,2021/08/06 10:00,7.2\n3,06/08/2021,\n", rec.Body.String())
+			})
+		})
+		t.Run("When an unknown column is chosen", func(t *testing.T) {
+			t.Run("Then bad request is returned", func(t *testing.T) {
+				assert.Equal(t, http.StatusBadRequest, get("/api/v1alpha1/csv/fish?columns=type,name").Code)
+			})
+		})
+		t.Run("When tanks are exported for a date range", func(t *testing.T) {
+			t.Run("Then bad request is returned", func(t *testing.T) {
+				assert.Equal(t, http.StatusBadRequest, get("/api/v1alpha1/csv/tanks?from=2021-08-01").Code)
+			})
+		})
+		t.Run("When something else is exported", func(t *testing.T) {
+			t.Run("Then not found is returned", func(t *testing.T) {
+				assert.Equal(t, http.StatusNotFound, get("/api/v1alpha1/csv/users").Code)
+			})
+		})
+	})
+}
+
+func TestEscapeCSVFormula(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		value    string
+		expected string
+	}{
+		{desc: "Text is written as it is", value: "Reef", expected: "Reef"},
+		{desc: "Empty text is written as it is", value: "", expected: ""},
+		{desc: "Formulas are escaped", value: "=HYPERLINK(\"http://example.com\")", expected: "'=HYPERLINK(\"http://example.com\")"},
+		{desc: "Text starting with a plus is escaped", value: "+1", expected: "'+1"},
+		{desc: "Text starting with a minus is escaped", value: "-1+1", expected: "'-1+1"},
+		{desc: "Text starting with an at is escaped", value: "@SUM(A1)", expected: "'@SUM(A1)"},
+		{desc: "Text starting with a tab is escaped", value: "\t=1", expected: "'\t=1"},
+		{desc: "Text starting with a carriage return is escaped", value: "\r=1", expected: "'\r=1"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			assert.Equal(t, tC.expected, escapeCSVFormula(tC.value))
+		})
+	}
+}
@@ -0,0 +1,390 @@
+package server
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+const tankStatisticsImportPath = "/api/v1alpha1/tank/statistics/import"
+
+// maxCSVImportSize limits the size of CSV files which can be imported
+const maxCSVImportSize = 10 << 20 // 10 MiB
+
+// testDateLayout is the layout test dates are stored in
+const testDateLayout = "2006/01/02 15:04"
+
+// Fields of a tank statistic which columns are mapped to
+const (
+	fieldTestDate  = "testDate"
+	fieldPH        = "ph"
+	fieldGH        = "gh"
+	fieldKH        = "kh"
+	fieldAmmonia   = "ammonia"
+	fieldNitrite   = "nitrite"
+	fieldNitrate   = "nitrate"
+	fieldPhosphate = "phosphate"
+)
+
+// csvFields are the fields of a tank statistic in the order they're reported, with the
+// headers they're recognised by when no mapping is given. Headers are compared ignoring
+// case, units, spaces and punctuation.
+var csvFields = []struct {
+	name    string
+	headers []string
+}{
+	{name: fieldTestDate, headers: []string{"testdate", "date", "datetime", "tested", "testedat", "time"}},
+	{name: fieldPH, headers: []string{"ph"}},
+	{name: fieldGH, headers: []string{"gh", "dgh", "generalhardness"}},
+	{name: fieldKH, headers: []string{"kh", "dkh", "carbonatehardness", "alkalinity"}},
+	{name: fieldAmmonia, headers: []string{"ammonia", "nh3", "nh4", "nh3nh4"}},
+	{name: fieldNitrite, headers: []string{"nitrite", "no2"}},
+	{name: fieldNitrate, headers: []string{"nitrate", "no3"}},
+	{name: fieldPhosphate, headers: []string{"phosphate", "po4"}},
+}
+
+// csvDateFormats are the date formats test dates are detected in, in order of preference,
+// so ambiguous dates are read as day then month. Dates can be followed by a time in any
+// of csvTimeLayouts.
+var csvDateFormats = []struct {
+	name   string
+	layout string
+}{
+	{name: "YYYY/MM/DD", layout: "2006/01/02"},
+	{name: "YYYY-MM-DD", layout: "2006-01-02"},
+	{name: "DD/MM/YYYY", layout: "2/1/2006"},
+	{name: "MM/DD/YYYY", layout: "1/2/2006"},
+	{name: "DD.MM.YYYY", layout: "2.1.2006"},
+	{name: "DD-MM-YYYY", layout: "2-1-2006"},
+}
+
+// csvTimeLayouts are the times which can follow the date of a test
+var csvTimeLayouts = []string{"", " 15:04", " 15:04:05", "T15:04:05Z07:00"}
+
+type csvImportResponse struct {
+	DryRun     bool              `json:"dryRun"`
+	DateFormat string            `json:"dateFormat"`
+	Columns    map[string]string `json:"columns"`
+	Rows       int               `json:"rows"`
+	Valid      int               `json:"valid"`
+	Imported   int               `json:"imported"`
+	Errors     []csvRowError     `json:"errors"`
+}
+
+// csvRowError reports why a row can't be imported. Row is the row number in the file,
+// where the header is row 1.
+type csvRowError struct {
+	Row    int      `json:"row"`
+	Errors []string `json:"errors"`
+}
+
+// handleTankStatisticsImport serves /api/v1alpha1/tank/statistics/import, where POST
+// imports tank statistics from a CSV file with a header row
+//
+// Columns are matched to fields by their header, or mapped explicitly with map, e.g.
+// map=ph:pH%20Level. The date format is detected from the test dates unless given with
+// dateFormat. Every row is validated before anything is imported, and the rows are
+// imported in a single transaction. Invalid rows fail the import unless skipInvalid is
+// true, which imports the valid rows. dryRun validates without importing anything.
+func (s *Server) handleTankStatisticsImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	dryRun, err := optionalBool(r, "dryRun")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	skipInvalid, err := optionalBool(r, "skipInvalid")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxCSVImportSize))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errors.Wrap(err, "unable to read CSV"))
+		return
+	}
+
+	header, records, err := readCSV(body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	columns, err := mapColumns(header, r.URL.Query()["map"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	dates := make([]string, len(records))
+	for i, record := range records {
+		dates[i] = field(record, columns[fieldTestDate])
+	}
+
+	layout, format, err := dateFormat(r.URL.Query().Get("dateFormat"), dates)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	rsp := csvImportResponse{DryRun: dryRun, DateFormat: format, Columns: map[string]string{}, Rows: len(records), Errors: []csvRowError{}}
+	for name, i := range columns {
+		rsp.Columns[name] = header[i]
+	}
+
+	stats := make([]db.TankStatistic, 0, len(records))
+	for i, record := range records {
+		ts, errs := parseTankStatistic(record, columns, layout)
+		if len(errs) > 0 {
+			rsp.Errors = append(rsp.Errors, csvRowError{Row: i + 2, Errors: errs})
+			continue
+		}
+
+		stats = append(stats, ts)
+	}
+
+	rsp.Valid = len(stats)
+
+	if dryRun {
+		writeJSON(w, http.StatusOK, rsp)
+		return
+	}
+
+	if len(rsp.Errors) > 0 && !skipInvalid {
+		writeJSON(w, http.StatusUnprocessableEntity, rsp)
+		return
+	}
+
+	if len(stats) > 0 {
+		inserted, err := s.tankStatModifier.InsertTankStatistics(r.Context(), stats)
+		if err != nil {
+			writeError(w, statusForError(err), errors.Wrap(err, "unable to import tank statistics"))
+			return
+		}
+
+		rsp.Imported = len(inserted)
+	}
+
+	writeJSON(w, http.StatusOK, rsp)
+}
+
+// readCSV returns the header and records of a CSV file, which may be separated by commas
+// or semicolons
+func readCSV(b []byte) ([]string, [][]string, error) {
+	b = bytes.TrimPrefix(b, []byte("\xef\xbb\xbf")) // byte order mark written by spreadsheets
+
+	firstLine := b
+	if i := bytes.IndexByte(b, '\n'); i >= 0 {
+		firstLine = b[:i]
+	}
+
+	cr := csv.NewReader(bytes.NewReader(b))
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	if bytes.Count(firstLine, []byte(";")) > bytes.Count(firstLine, []byte(",")) {
+		cr.Comma = ';'
+	}
+
+	header, err := cr.Read()
+	if err != nil {
+		if err == io.EOF {
+			return nil, nil, errors.New("CSV is empty")
+		}
+
+		return nil, nil, errors.Wrap(err, "invalid CSV")
+	}
+
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "invalid CSV")
+	}
+
+	return header, records, nil
+}
+
+// mapColumns returns the index of the column each field is read from. Mappings are given as
+// field:header, and the remaining fields are matched by their header.
+func mapColumns(header []string, mappings []string) (map[string]int, error) {
+	columns := map[string]int{}
+
+	known := map[string]bool{}
+	for _, f := range csvFields {
+		known[f.name] = true
+	}
+
+	for _, m := range mappings {
+		parts := strings.SplitN(m, ":", 2)
+		if len(parts) != 2 || !known[parts[0]] {
+			return nil, errors.Errorf("invalid mapping %q, expected field:header", m)
+		}
+
+		i := indexOf(header, func(h string) bool { return strings.EqualFold(strings.TrimSpace(h), strings.TrimSpace(parts[1])) })
+		if i < 0 {
+			return nil, errors.Errorf("column %q not found", parts[1])
+		}
+
+		columns[parts[0]] = i
+	}
+
+	for _, f := range csvFields {
+		if _, ok := columns[f.name]; ok {
+			continue
+		}
+
+		for _, h := range f.headers {
+			if i := indexOf(header, func(c string) bool { return normaliseHeader(c) == h }); i >= 0 {
+				columns[f.name] = i
+				break
+			}
+		}
+	}
+
+	if _, ok := columns[fieldTestDate]; !ok {
+		return nil, errors.New("no test date column, map one with map=testDate:header")
+	}
+
+	if len(columns) == 1 {
+		return nil, errors.New("no measurement columns, map them with map=field:header")
+	}
+
+	return columns, nil
+}
+
+func indexOf(header []string, match func(string) bool) int {
+	for i, h := range header {
+		if match(h) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// normaliseHeader lower cases a header and removes its unit, e.g. "NO3 (ppm)", and
+// everything but letters and numbers
+func normaliseHeader(h string) string {
+	if i := strings.IndexAny(h, "(["); i > 0 {
+		h = h[:i]
+	}
+
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+
+		return -1
+	}, h)
+}
+
+// dateFormat returns the layout and name of the named date format, or detects it as the
+// first format every date can be parsed with. If none can parse every date, the one which
+// can parse the most is used and the rest are reported as invalid.
+func dateFormat(name string, dates []string) (string, string, error) {
+	if name != "" {
+		for _, f := range csvDateFormats {
+			if strings.EqualFold(f.name, name) {
+				return f.layout, f.name, nil
+			}
+		}
+
+		return "", "", errors.Errorf("unknown date format %q", name)
+	}
+
+	best, bestParsed := 0, -1
+	for i, f := range csvDateFormats {
+		parsed := 0
+		for _, d := range dates {
+			if _, err := parseTestDate(f.layout, d); err == nil {
+				parsed++
+			}
+		}
+
+		if parsed > bestParsed {
+			best, bestParsed = i, parsed
+		}
+
+		if parsed == len(dates) {
+			break
+		}
+	}
+
+	return csvDateFormats[best].layout, csvDateFormats[best].name, nil
+}
+
+// parseTestDate parses a date in the given layout, followed by any of csvTimeLayouts
+func parseTestDate(layout, v string) (time.Time, error) {
+	var err error
+	for _, l := range csvTimeLayouts {
+		var t time.Time
+		if t, err = time.Parse(layout+l, v); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, err
+}
+
+// parseTankStatistic returns the tank statistic in a record, or every reason it's invalid
+func parseTankStatistic(record []string, columns map[string]int, layout string) (db.TankStatistic, []string) {
+	ts := db.TankStatistic{}
+	errs := []string{}
+
+	if d := field(record, columns[fieldTestDate]); d == "" {
+		errs = append(errs, "test date is required")
+	} else if t, err := parseTestDate(layout, d); err != nil {
+		errs = append(errs, fmt.Sprintf("invalid test date %q", d))
+	} else {
+		ts.TestDate = t.Format(testDateLayout)
+	}
+
+	for _, m := range tankStatisticMeasurements {
+		i, ok := columns[m.name]
+		if !ok {
+			continue
+		}
+
+		v := field(record, i)
+		if v == "" {
+			continue
+		}
+
+		f, err := strconv.ParseFloat(v, 32)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("invalid %s %q", m.name, v))
+			continue
+		}
+
+		f32 := float32(f)
+		*m.value(&ts) = &f32
+	}
+
+	errs = append(errs, validateMeasurements(ts)...)
+
+	return ts, errs
+}
+
+// field returns the trimmed value of column i of a record, which is empty if the record
+// is too short
+func field(record []string, i int) string {
+	if i >= len(record) {
+		return ""
+	}
+
+	return strings.TrimSpace(record[i])
+}
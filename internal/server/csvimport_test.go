@@ -0,0 +1,141 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+func TestTankStatisticsImport(t *testing.T) {
+	tsm := &tankStatsMock{}
+	s := Server{tankStatModifier: tsm}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	request := func(query, body string) (*httptest.ResponseRecorder, csvImportResponse) {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/tank/statistics/import"+query, strings.NewReader(body)))
+
+		var rsp csvImportResponse
+		_ = json.Unmarshal(rec.Body.Bytes(), &rsp)
+
+		return rec, rsp
+	}
+
+	ph, nitrate := float32(7.2), float32(10)
+
+	t.Run("Given a valid CSV", func(t *testing.T) {
+		csv := "Date,pH,NO3 (ppm),Notes\n13/08/2021,7.2,,cloudy\n06/08/2021 18:30,,10,\n"
+
+		t.Run("When it is imported", func(t *testing.T) {
+			t.Run("Then the columns and date format are detected and every row is imported", func(t *testing.T) {
+				rec, rsp := request("", csv)
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Equal(t, 2, rsp.Imported)
+				assert.Equal(t, map[string]string{"testDate": "Date", "ph": "pH", "nitrate": "NO3 (ppm)"}, rsp.Columns)
+				assert.Equal(t, []db.TankStatistic{
+					{TestDate: "2021/08/13 00:00", PH: &ph},
+					{TestDate: "2021/08/06 18:30", Nitrate: &nitrate},
+				}, tsm.insertManyRequest)
+			})
+		})
+		t.Run("When it is a dry run", func(t *testing.T) {
+			t.Run("Then nothing is imported", func(t *testing.T) {
+				tsm.insertManyRequest = nil
+
+				rec, rsp := request("?dryRun=true", csv)
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Equal(t, 2, rsp.Valid)
+				assert.Equal(t, 0, rsp.Imported)
+				assert.Nil(t, tsm.insertManyRequest)
+			})
+		})
+	})
+
+	t.Run("Given a CSV with semicolons, US dates and unrecognised headers", func(t *testing.T) {
+		csv := "\xef\xbb\xbfWhen;Acidity\n08/13/2021;6.5\n"
+
+		t.Run("When its columns are mapped", func(t *testing.T) {
+			t.Run("Then it is imported", func(t *testing.T) {
+				rec, rsp := request("?map=testDate:when&map=ph:Acidity", csv)
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Equal(t, "MM/DD/YYYY", rsp.DateFormat)
+				assert.Equal(t, "2021/08/13 00:00", tsm.insertManyRequest[0].TestDate)
+			})
+		})
+		t.Run("When its columns aren't mapped", func(t *testing.T) {
+			t.Run("Then bad request is returned", func(t *testing.T) {
+				rec, _ := request("", csv)
+
+				assert.Equal(t, http.StatusBadRequest, rec.Code)
+			})
+		})
+	})
+
+	t.Run("Given a CSV with invalid rows", func(t *testing.T) {
+		csv := "Test Date,pH,Ammonia\n2021-08-06,7.2,0\nyesterday,15,\n2021-08-07,,\n2021-08-08,NaN,\n2021-08-09,7,inf\n"
+
+		t.Run("When it is imported", func(t *testing.T) {
+			t.Run("Then every invalid row is reported and nothing is imported", func(t *testing.T) {
+				tsm.insertManyRequest = nil
+
+				rec, rsp := request("", csv)
+
+				assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+				assert.Equal(t, []csvRowError{
+					{Row: 3, Errors: []string{`invalid test date "yesterday"`, "ph 15 is out of range"}},
+					{Row: 4, Errors: []string{"no measurements"}},
+					{Row: 5, Errors: []string{"ph NaN is not a number"}},
+					{Row: 6, Errors: []string{"ammonia +Inf is not a number"}},
+				}, rsp.Errors)
+				assert.Nil(t, tsm.insertManyRequest)
+			})
+		})
+		t.Run("When invalid rows are skipped", func(t *testing.T) {
+			t.Run("Then the valid rows are imported", func(t *testing.T) {
+				rec, rsp := request("?skipInvalid=true", csv)
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Equal(t, 1, rsp.Imported)
+				assert.Len(t, rsp.Errors, 4)
+			})
+		})
+	})
+
+	t.Run("Given a date format", func(t *testing.T) {
+		t.Run("When it is unknown", func(t *testing.T) {
+			t.Run("Then bad request is returned", func(t *testing.T) {
+				rec, _ := request("?dateFormat=DD-MM", "Date,pH\n2021-08-06,7\n")
+
+				assert.Equal(t, http.StatusBadRequest, rec.Code)
+			})
+		})
+		t.Run("When it is known", func(t *testing.T) {
+			t.Run("Then it is used instead of detecting one", func(t *testing.T) {
+				rec, rsp := request("?dateFormat=mm/dd/yyyy", "Date,pH\n01/02/2021,7\n")
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Equal(t, "MM/DD/YYYY", rsp.DateFormat)
+				assert.Equal(t, "2021/01/02 00:00", tsm.insertManyRequest[0].TestDate)
+			})
+		})
+		t.Run("When dates include a time zone", func(t *testing.T) {
+			t.Run("Then they are imported", func(t *testing.T) {
+				rec, rsp := request("", "Date,pH\n2021-08-06T10:00:00Z,7\n")
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Equal(t, "YYYY-MM-DD", rsp.DateFormat)
+				assert.Equal(t, "2021/08/06 10:00", tsm.insertManyRequest[0].TestDate)
+			})
+		})
+	})
+}
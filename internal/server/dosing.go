@@ -0,0 +1,455 @@
+package server
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/trackmyfish/backend/internal/db"
+	trackmyfishv1alpha1 "github.com/trackmyfish/proto/trackmyfish/v1alpha1"
+)
+
+// litresPerGallon converts tank capacities recorded in (US) gallons to litres
+const litresPerGallon = 3.785411784
+
+type fertiliserQuerier interface {
+	GetFertiliserProduct(context.Context, int32) (db.FertiliserProduct, error)
+	ListFertiliserProducts(context.Context) ([]db.FertiliserProduct, error)
+}
+
+type fertiliserModifier interface {
+	InsertFertiliserProduct(context.Context, db.FertiliserProduct) (db.FertiliserProduct, error)
+	DeleteFertiliserProduct(context.Context, int32) (db.FertiliserProduct, error)
+}
+
+type dosingQuerier interface {
+	ListDosingEntries(context.Context, db.DosingFilter) ([]db.DosingEntry, error)
+}
+
+type dosingModifier interface {
+	InsertDosingEntry(context.Context, db.DosingEntry) (db.DosingEntry, error)
+	DeleteDosingEntry(context.Context, int32) (db.DosingEntry, error)
+}
+
+type productComponent struct {
+	Parameter string  `json:"parameter"`
+	MgPerMl   float32 `json:"mgPerMl"`
+}
+
+type fertiliserProduct struct {
+	ID           int32              `json:"id"`
+	Name         string             `json:"name"`
+	Manufacturer string             `json:"manufacturer"`
+	Notes        string             `json:"notes"`
+	Components   []productComponent `json:"components"`
+}
+
+type dosingEntryRequest struct {
+	TankID    int32   `json:"tankId"`
+	ProductID int32   `json:"productId"`
+	AmountMl  float32 `json:"amountMl"`
+	DosedAt   string  `json:"dosedAt"`
+	Notes     string  `json:"notes"`
+}
+
+type dosingEntryResponse struct {
+	ID          int32     `json:"id"`
+	TankID      int32     `json:"tankId"`
+	ProductID   int32     `json:"productId"`
+	ProductName string    `json:"productName"`
+	AmountMl    float32   `json:"amountMl"`
+	DosedAt     time.Time `json:"dosedAt"`
+	Notes       string    `json:"notes"`
+}
+
+type doseCalculationRequest struct {
+	TankID    int32  `json:"tankId"`
+	ProductID int32  `json:"productId"`
+	Parameter string `json:"parameter"`
+	// Increase is the target increase of the parameter in ppm (mg/l)
+	Increase float32 `json:"increase"`
+	// VolumeLitres overrides the tank's capacity, e.g. to account for substrate and hardscape
+	VolumeLitres float32 `json:"volumeLitres"`
+}
+
+type doseCalculationResponse struct {
+	TankID       int32   `json:"tankId"`
+	ProductID    int32   `json:"productId"`
+	Parameter    string  `json:"parameter"`
+	Increase     float32 `json:"increase"`
+	VolumeLitres float32 `json:"volumeLitres"`
+	AmountMl     float32 `json:"amountMl"`
+	// Increases is the resulting increase of every parameter in the product, in ppm
+	Increases map[string]float32 `json:"increases"`
+}
+
+func toFertiliserProduct(p db.FertiliserProduct) fertiliserProduct {
+	components := make([]productComponent, len(p.Components))
+	for i, c := range p.Components {
+		components[i] = productComponent{Parameter: c.Parameter, MgPerMl: c.MgPerMl}
+	}
+
+	return fertiliserProduct{
+		ID:           p.ID,
+		Name:         p.Name,
+		Manufacturer: p.Manufacturer,
+		Notes:        p.Notes,
+		Components:   components,
+	}
+}
+
+func toDosingEntryResponse(e db.DosingEntry) dosingEntryResponse {
+	return dosingEntryResponse{
+		ID:          e.ID,
+		TankID:      e.TankID,
+		ProductID:   e.ProductID,
+		ProductName: e.ProductName,
+		AmountMl:    e.AmountMl,
+		DosedAt:     e.DosedAt,
+		Notes:       e.Notes,
+	}
+}
+
+// tankVolumeLitres returns the capacity of the tank in litres. Tanks without a capacity
+// measurement are assumed to be in litres.
+func tankVolumeLitres(t db.Tank) (float32, error) {
+	if t.Capacity == nil || *t.Capacity <= 0 {
+		return 0, errors.New("tank has no capacity, provide volumeLitres")
+	}
+
+	if stringToCapacity(t.CapacityMeasurement) == trackmyfishv1alpha1.Tank_GALLONS {
+		return *t.Capacity * litresPerGallon, nil
+	}
+
+	return *t.Capacity, nil
+}
+
+// calculateDose returns the amount of product, in ml, that raises the parameter by
+// increase ppm in volumeLitres of water, along with the resulting increase of every
+// parameter in the product
+func calculateDose(p db.FertiliserProduct, parameter string, increase, volumeLitres float32) (float32, map[string]float32, error) {
+	var mgPerMl float32
+	for _, c := range p.Components {
+		if c.Parameter == parameter {
+			mgPerMl = c.MgPerMl
+		}
+	}
+
+	if mgPerMl <= 0 {
+		return 0, nil, errors.Errorf("%s doesn't contain %s", p.Name, parameter)
+	}
+
+	// 1 ppm is 1 mg/l, so the mg required is the increase multiplied by the volume
+	amount := increase * volumeLitres / mgPerMl
+
+	increases := make(map[string]float32, len(p.Components))
+	for _, c := range p.Components {
+		increases[c.Parameter] = roundTo(c.MgPerMl*amount/volumeLitres, 2)
+	}
+
+	return roundTo(amount, 2), increases, nil
+}
+
+func roundTo(v float32, places int) float32 {
+	p := math.Pow(10, float64(places))
+
+	return float32(math.Round(float64(v)*p) / p)
+}
+
+// handleFertilisers serves /api/v1alpha1/fertilisers
+//
+// GET lists the product catalogue. POST adds a product.
+func (s *Server) handleFertilisers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		rsp, err := s.fertiliserQuerier.ListFertiliserProducts(r.Context())
+		if err != nil {
+			writeError(w, statusForError(err), errors.Wrap(err, "unable to list fertiliser products"))
+			return
+		}
+
+		products := make([]fertiliserProduct, len(rsp))
+		for i, p := range rsp {
+			products[i] = toFertiliserProduct(p)
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{"fertilisers": products})
+	case http.MethodPost:
+		s.addFertiliser(w, r)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// handleFertiliser serves /api/v1alpha1/fertilisers/{id}
+func (s *Server) handleFertiliser(w http.ResponseWriter, r *http.Request) {
+	id, rest, err := pathID(r.URL.Path, "/api/v1alpha1/fertilisers/")
+	if err != nil || rest != "" {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		rsp, err := s.fertiliserQuerier.GetFertiliserProduct(r.Context(), id)
+		if err != nil {
+			writeError(w, statusForError(err), errors.Wrap(err, "unable to get fertiliser product"))
+			return
+		}
+
+		writeJSON(w, http.StatusOK, toFertiliserProduct(rsp))
+	case http.MethodDelete:
+		rsp, err := s.fertiliserModifier.DeleteFertiliserProduct(r.Context(), id)
+		if err != nil {
+			writeError(w, statusForError(err), errors.Wrap(err, "unable to delete fertiliser product"))
+			return
+		}
+
+		writeJSON(w, http.StatusOK, toFertiliserProduct(rsp))
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodDelete)
+	}
+}
+
+func (s *Server) addFertiliser(w http.ResponseWriter, r *http.Request) {
+	var req fertiliserProduct
+	if err := readJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if req.Name == "" {
+		writeError(w, http.StatusBadRequest, errors.New("name must be provided"))
+		return
+	}
+
+	if len(req.Components) == 0 {
+		writeError(w, http.StatusBadRequest, errors.New("at least one component must be provided"))
+		return
+	}
+
+	product := db.FertiliserProduct{Name: req.Name, Manufacturer: req.Manufacturer, Notes: req.Notes}
+
+	seen := map[string]bool{}
+	for _, c := range req.Components {
+		parameter := strings.ToUpper(strings.TrimSpace(c.Parameter))
+		if parameter == "" || c.MgPerMl <= 0 {
+			writeError(w, http.StatusBadRequest, errors.New("components must have a parameter and a positive mgPerMl"))
+			return
+		}
+
+		if seen[parameter] {
+			writeError(w, http.StatusBadRequest, errors.Errorf("duplicate component %q", parameter))
+			return
+		}
+		seen[parameter] = true
+
+		product.Components = append(product.Components, db.ProductComponent{Parameter: parameter, MgPerMl: c.MgPerMl})
+	}
+
+	rsp, err := s.fertiliserModifier.InsertFertiliserProduct(r.Context(), product)
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to add fertiliser product"))
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, toFertiliserProduct(rsp))
+}
+
+// handleDosing serves /api/v1alpha1/dosing
+//
+// GET lists the dosing log, newest first, optionally filtered by tankId, productId and a
+// from/to date range. POST records a dose.
+func (s *Server) handleDosing(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.listDosing(w, r)
+	case http.MethodPost:
+		s.addDosing(w, r)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// handleDosingEntry serves /api/v1alpha1/dosing/{id}, where DELETE removes the entry from the log
+func (s *Server) handleDosingEntry(w http.ResponseWriter, r *http.Request) {
+	id, rest, err := pathID(r.URL.Path, "/api/v1alpha1/dosing/")
+	if err != nil || rest != "" {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	if r.Method != http.MethodDelete {
+		methodNotAllowed(w, http.MethodDelete)
+		return
+	}
+
+	rsp, err := s.dosingModifier.DeleteDosingEntry(r.Context(), id)
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to delete dosing entry"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, toDosingEntryResponse(rsp))
+}
+
+func (s *Server) listDosing(w http.ResponseWriter, r *http.Request) {
+	var (
+		filter db.DosingFilter
+		err    error
+	)
+
+	if filter.TankID, err = optionalInt32(r, "tankId"); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if filter.ProductID, err = optionalInt32(r, "productId"); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if filter.From, err = optionalDate(r, "from"); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if filter.To, err = optionalDate(r, "to"); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	rsp, err := s.dosingQuerier.ListDosingEntries(r.Context(), filter)
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to list dosing entries"))
+		return
+	}
+
+	entries := make([]dosingEntryResponse, len(rsp))
+	for i, e := range rsp {
+		entries[i] = toDosingEntryResponse(e)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"entries": entries})
+}
+
+func (s *Server) addDosing(w http.ResponseWriter, r *http.Request) {
+	var req dosingEntryRequest
+	if err := readJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if req.TankID == 0 || req.ProductID == 0 {
+		writeError(w, http.StatusBadRequest, errors.New("tankId and productId must be provided"))
+		return
+	}
+
+	if req.AmountMl <= 0 {
+		writeError(w, http.StatusBadRequest, errors.New("amountMl must be greater than zero"))
+		return
+	}
+
+	dosedAt, err := parseDate(req.DosedAt, time.Now())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := s.checkTank(r.Context(), req.TankID); err != nil {
+		writeError(w, statusForError(err), err)
+		return
+	}
+
+	// products are also only visible to their household, and a dosed product can't be
+	// deleted, so dosing another household's product would stop them deleting it
+	if _, err := s.fertiliserQuerier.GetFertiliserProduct(r.Context(), req.ProductID); err != nil {
+		writeError(w, statusForError(err), errors.Wrapf(err, "unable to get fertiliser product %d", req.ProductID))
+		return
+	}
+
+	rsp, err := s.dosingModifier.InsertDosingEntry(r.Context(), db.DosingEntry{
+		TankID:    req.TankID,
+		ProductID: req.ProductID,
+		AmountMl:  req.AmountMl,
+		DosedAt:   dosedAt,
+		Notes:     req.Notes,
+	})
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to add dosing entry"))
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, toDosingEntryResponse(rsp))
+}
+
+// handleDoseCalculation serves /api/v1alpha1/dosing/calculate, where POST returns the
+// amount of a product needed to raise a parameter in a tank by the requested ppm
+func (s *Server) handleDoseCalculation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	var req doseCalculationRequest
+	if err := readJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	req.Parameter = strings.ToUpper(strings.TrimSpace(req.Parameter))
+
+	if req.ProductID == 0 || req.Parameter == "" {
+		writeError(w, http.StatusBadRequest, errors.New("productId and parameter must be provided"))
+		return
+	}
+
+	if req.Increase <= 0 {
+		writeError(w, http.StatusBadRequest, errors.New("increase must be greater than zero"))
+		return
+	}
+
+	volume := req.VolumeLitres
+	if volume <= 0 {
+		if req.TankID == 0 {
+			writeError(w, http.StatusBadRequest, errors.New("tankId or volumeLitres must be provided"))
+			return
+		}
+
+		tank, err := s.tankQuerier.GetTank(r.Context(), req.TankID)
+		if err != nil {
+			writeError(w, statusForError(err), errors.Wrap(err, "unable to get tank"))
+			return
+		}
+
+		if volume, err = tankVolumeLitres(tank); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	product, err := s.fertiliserQuerier.GetFertiliserProduct(r.Context(), req.ProductID)
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to get fertiliser product"))
+		return
+	}
+
+	amount, increases, err := calculateDose(product, req.Parameter, req.Increase, volume)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, doseCalculationResponse{
+		TankID:       req.TankID,
+		ProductID:    req.ProductID,
+		Parameter:    req.Parameter,
+		Increase:     req.Increase,
+		VolumeLitres: volume,
+		AmountMl:     amount,
+		Increases:    increases,
+	})
+}
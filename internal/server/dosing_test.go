@@ -0,0 +1,244 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/openlyinc/pointy"
+	"github.com/stretchr/testify/assert"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+func TestCalculateDose(t *testing.T) {
+	product := db.FertiliserProduct{
+		Name: "Macro Mix",
+		Components: []db.ProductComponent{
+			{Parameter: "NITRATE", MgPerMl: 12.5},
+			{Parameter: "PHOSPHATE", MgPerMl: 1.25},
+		},
+	}
+
+	testCases := []struct {
+		desc              string
+		parameter         string
+		increase          float32
+		volume            float32
+		expectedAmount    float32
+		expectedIncreases map[string]float32
+		expectedErr       bool
+	}{
+		{desc: "+10ppm nitrate in 120l", parameter: "NITRATE", increase: 10, volume: 120, expectedAmount: 96, expectedIncreases: map[string]float32{"NITRATE": 10, "PHOSPHATE": 1}},
+		{desc: "+1ppm phosphate in 60l", parameter: "PHOSPHATE", increase: 1, volume: 60, expectedAmount: 48, expectedIncreases: map[string]float32{"NITRATE": 10, "PHOSPHATE": 1}},
+		{desc: "Parameter not in the product", parameter: "IRON", increase: 0.1, volume: 60, expectedErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			amount, increases, err := calculateDose(product, tC.parameter, tC.increase, tC.volume)
+			if tC.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tC.expectedAmount, amount)
+			assert.Equal(t, tC.expectedIncreases, increases)
+		})
+	}
+}
+
+func TestTankVolumeLitres(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		tank        db.Tank
+		expected    float32
+		expectedErr bool
+	}{
+		{desc: "No capacity", tank: db.Tank{}, expectedErr: true},
+		{desc: "Litres", tank: db.Tank{CapacityMeasurement: "LITRES", Capacity: pointy.Float32(120)}, expected: 120},
+		{desc: "Unspecified is assumed to be litres", tank: db.Tank{CapacityMeasurement: "UNSPECIFIED", Capacity: pointy.Float32(60)}, expected: 60},
+		{desc: "Gallons are converted to litres", tank: db.Tank{CapacityMeasurement: "GALLONS", Capacity: pointy.Float32(10)}, expected: 10 * litresPerGallon},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			v, err := tankVolumeLitres(tC.tank)
+			if tC.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.InDelta(t, tC.expected, v, 0.001)
+		})
+	}
+}
+
+func TestDoseCalculation(t *testing.T) {
+	tm := &tankMock{}
+	fm := &fertiliserMock{}
+	s := Server{tankQuerier: tm, fertiliserQuerier: fm}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	t.Run("Given a request to calculate a dose", func(t *testing.T) {
+		t.Run("When the tank has no capacity", func(t *testing.T) {
+			t.Run("Then a bad request is returned", func(t *testing.T) {
+				tm.getTankResponse = db.Tank{ID: 1}
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/dosing/calculate", strings.NewReader(`{"tankId": 1, "productId": 2, "parameter": "nitrate", "increase": 10}`)))
+
+				assert.Equal(t, http.StatusBadRequest, rec.Code)
+			})
+		})
+		t.Run("When the tank has a capacity", func(t *testing.T) {
+			t.Run("Then the amount of product is returned", func(t *testing.T) {
+				tm.getTankResponse = db.Tank{ID: 1, CapacityMeasurement: "LITRES", Capacity: pointy.Float32(120)}
+				fm.getFertiliserProductResponse = db.FertiliserProduct{ID: 2, Name: "Nitrate", Components: []db.ProductComponent{{Parameter: "NITRATE", MgPerMl: 12.5}}}
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/dosing/calculate", strings.NewReader(`{"tankId": 1, "productId": 2, "parameter": "nitrate", "increase": 10}`)))
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+
+				var rsp doseCalculationResponse
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(&rsp))
+				assert.Equal(t, "NITRATE", rsp.Parameter)
+				assert.Equal(t, float32(120), rsp.VolumeLitres)
+				assert.Equal(t, float32(96), rsp.AmountMl)
+			})
+		})
+		t.Run("When a volume is provided", func(t *testing.T) {
+			t.Run("Then it is used instead of the tank's capacity", func(t *testing.T) {
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/dosing/calculate", strings.NewReader(`{"productId": 2, "parameter": "NITRATE", "increase": 10, "volumeLitres": 100}`)))
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+
+				var rsp doseCalculationResponse
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(&rsp))
+				assert.Equal(t, float32(80), rsp.AmountMl)
+			})
+		})
+	})
+}
+
+func TestAddFertiliser(t *testing.T) {
+	fm := &fertiliserMock{}
+	s := Server{fertiliserModifier: fm}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	t.Run("Given a request to add a fertiliser product", func(t *testing.T) {
+		t.Run("When a component is duplicated", func(t *testing.T) {
+			t.Run("Then a bad request is returned", func(t *testing.T) {
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/fertilisers", strings.NewReader(`{"name": "Macro Mix", "components": [{"parameter": "NITRATE", "mgPerMl": 12.5}, {"parameter": "nitrate", "mgPerMl": 1}]}`)))
+
+				assert.Equal(t, http.StatusBadRequest, rec.Code)
+			})
+		})
+		t.Run("When no error is returned", func(t *testing.T) {
+			t.Run("Then the product is returned", func(t *testing.T) {
+				fm.insertFertiliserProductResponse = db.FertiliserProduct{ID: 2, Name: "Macro Mix"}
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/fertilisers", strings.NewReader(`{"name": "Macro Mix", "components": [{"parameter": "nitrate", "mgPerMl": 12.5}]}`)))
+
+				assert.Equal(t, http.StatusCreated, rec.Code)
+				assert.Equal(t, []db.ProductComponent{{Parameter: "NITRATE", MgPerMl: 12.5}}, fm.insertFertiliserProductRequest.Components)
+			})
+		})
+	})
+}
+
+func TestAddDosing(t *testing.T) {
+	tm := &tankMock{}
+	fm := &fertiliserMock{}
+	dm := &dosingMock{}
+	s := Server{tankQuerier: tm, fertiliserQuerier: fm, dosingModifier: dm}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	request := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/dosing", strings.NewReader(`{"tankId": 1, "productId": 2, "amountMl": 96, "dosedAt": "2021-08-06T10:00:00Z"}`)))
+
+		return rec
+	}
+
+	t.Run("Given a request to log a dose", func(t *testing.T) {
+		t.Run("When the tank isn't visible to the household", func(t *testing.T) {
+			t.Run("Then not found is returned and nothing is logged", func(t *testing.T) {
+				tm.err = &db.ErrNotFound{}
+				defer func() { tm.err = nil }()
+
+				assert.Equal(t, http.StatusNotFound, request().Code)
+				assert.Zero(t, dm.insertDosingEntryRequest.TankID)
+			})
+		})
+		t.Run("When the product isn't visible to the household", func(t *testing.T) {
+			t.Run("Then not found is returned and nothing is logged", func(t *testing.T) {
+				fm.err = &db.ErrNotFound{}
+				defer func() { fm.err = nil }()
+
+				assert.Equal(t, http.StatusNotFound, request().Code)
+				assert.Zero(t, dm.insertDosingEntryRequest.TankID)
+			})
+		})
+		t.Run("When the tank and product are visible", func(t *testing.T) {
+			t.Run("Then the dose is logged", func(t *testing.T) {
+				assert.Equal(t, http.StatusCreated, request().Code)
+				assert.Equal(t, int32(1), dm.insertDosingEntryRequest.TankID)
+				assert.Equal(t, int32(2), dm.insertDosingEntryRequest.ProductID)
+			})
+		})
+	})
+}
+
+type dosingMock struct {
+	insertDosingEntryRequest db.DosingEntry
+	err                      error
+}
+
+func (m *dosingMock) InsertDosingEntry(ctx context.Context, req db.DosingEntry) (db.DosingEntry, error) {
+	m.insertDosingEntryRequest = req
+
+	return req, m.err
+}
+
+func (m *dosingMock) DeleteDosingEntry(ctx context.Context, id int32) (db.DosingEntry, error) {
+	return db.DosingEntry{ID: id}, m.err
+}
+
+type fertiliserMock struct {
+	insertFertiliserProductRequest  db.FertiliserProduct
+	insertFertiliserProductResponse db.FertiliserProduct
+	getFertiliserProductResponse    db.FertiliserProduct
+	listFertiliserProductsResponse  []db.FertiliserProduct
+	err                             error
+}
+
+func (m *fertiliserMock) InsertFertiliserProduct(ctx context.Context, req db.FertiliserProduct) (db.FertiliserProduct, error) {
+	m.insertFertiliserProductRequest = req
+
+	return m.insertFertiliserProductResponse, m.err
+}
+
+func (m *fertiliserMock) GetFertiliserProduct(context.Context, int32) (db.FertiliserProduct, error) {
+	return m.getFertiliserProductResponse, m.err
+}
+
+func (m *fertiliserMock) ListFertiliserProducts(context.Context) ([]db.FertiliserProduct, error) {
+	return m.listFertiliserProductsResponse, m.err
+}
+
+func (m *fertiliserMock) DeleteFertiliserProduct(context.Context, int32) (db.FertiliserProduct, error) {
+	return m.getFertiliserProductResponse, m.err
+}
@@ -0,0 +1,250 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+// daysPerMonth is used to express growth rates per month
+const daysPerMonth = 30
+
+type speciesQuerier interface {
+	ListSpecies(context.Context) ([]db.Species, error)
+	GetSpeciesFor(context.Context, string, string) (db.Species, error)
+}
+
+type speciesModifier interface {
+	InsertSpecies(context.Context, db.Species) (db.Species, error)
+	DeleteSpecies(context.Context, int32) (db.Species, error)
+}
+
+type growthQuerier interface {
+	ListGrowth(context.Context, int32) ([]db.GrowthPoint, error)
+}
+
+type species struct {
+	ID            int32    `json:"id"`
+	Type          string   `json:"type"`
+	Subtype       string   `json:"subtype"`
+	AdultLengthCm *float32 `json:"adultLengthCm,omitempty"`
+	AdultWeightG  *float32 `json:"adultWeightG,omitempty"`
+	Notes         string   `json:"notes"`
+}
+
+type growthPoint struct {
+	Date     time.Time `json:"date"`
+	LengthCm *float32  `json:"lengthCm,omitempty"`
+	WeightG  *float32  `json:"weightG,omitempty"`
+	Samples  int32     `json:"samples"`
+	// PercentOfAdultLength and PercentOfAdultWeight compare the point to the expected
+	// adult size of the species
+	PercentOfAdultLength *float32 `json:"percentOfAdultLength,omitempty"`
+	PercentOfAdultWeight *float32 `json:"percentOfAdultWeight,omitempty"`
+}
+
+type growthResponse struct {
+	FishID  int32         `json:"fishId"`
+	Species *species      `json:"species,omitempty"`
+	Points  []growthPoint `json:"points"`
+	// LengthCmPerMonth is the average growth in length between the first and last measurement
+	LengthCmPerMonth *float32 `json:"lengthCmPerMonth,omitempty"`
+}
+
+func toSpecies(s db.Species) species {
+	return species{
+		ID:            s.ID,
+		Type:          s.Type,
+		Subtype:       s.Subtype,
+		AdultLengthCm: s.AdultLengthCm,
+		AdultWeightG:  s.AdultWeightG,
+		Notes:         s.Notes,
+	}
+}
+
+// percentOf returns v as a percentage of adult, or nil if either are unknown
+func percentOf(v, adult *float32) *float32 {
+	if v == nil || adult == nil || *adult <= 0 {
+		return nil
+	}
+
+	p := roundTo(*v / *adult * 100, 1)
+
+	return &p
+}
+
+// lengthPerMonth returns the average growth in length per month between the first and
+// last points with a length, or nil if there aren't two such points on different days
+func lengthPerMonth(points []db.GrowthPoint) *float32 {
+	var first, last *db.GrowthPoint
+	for i := range points {
+		if points[i].LengthCm == nil {
+			continue
+		}
+
+		if first == nil {
+			first = &points[i]
+		}
+		last = &points[i]
+	}
+
+	if first == nil || !last.Date.After(first.Date) {
+		return nil
+	}
+
+	days := float32(last.Date.Sub(first.Date).Hours() / 24)
+	rate := roundTo((*last.LengthCm-*first.LengthCm)/days*daysPerMonth, 2)
+
+	return &rate
+}
+
+// handleSpecies serves /api/v1alpha1/species
+//
+// GET lists the species reference. POST adds a species.
+func (s *Server) handleSpecies(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		rsp, err := s.speciesQuerier.ListSpecies(r.Context())
+		if err != nil {
+			writeError(w, statusForError(err), errors.Wrap(err, "unable to list species"))
+			return
+		}
+
+		list := make([]species, len(rsp))
+		for i, sp := range rsp {
+			list[i] = toSpecies(sp)
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{"species": list})
+	case http.MethodPost:
+		s.addSpecies(w, r)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// handleSpeciesEntry serves /api/v1alpha1/species/{id}, where DELETE removes the species
+func (s *Server) handleSpeciesEntry(w http.ResponseWriter, r *http.Request) {
+	id, rest, err := pathID(r.URL.Path, "/api/v1alpha1/species/")
+	if err != nil || rest != "" {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	if r.Method != http.MethodDelete {
+		methodNotAllowed(w, http.MethodDelete)
+		return
+	}
+
+	rsp, err := s.speciesModifier.DeleteSpecies(r.Context(), id)
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to delete species"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, toSpecies(rsp))
+}
+
+func (s *Server) addSpecies(w http.ResponseWriter, r *http.Request) {
+	var req species
+	if err := readJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	req.Type, req.Subtype = strings.TrimSpace(req.Type), strings.TrimSpace(req.Subtype)
+
+	if req.Type == "" {
+		writeError(w, http.StatusBadRequest, errors.New("type must be provided"))
+		return
+	}
+
+	if req.AdultLengthCm == nil && req.AdultWeightG == nil {
+		writeError(w, http.StatusBadRequest, errors.New("adultLengthCm or adultWeightG must be provided"))
+		return
+	}
+
+	if (req.AdultLengthCm != nil && *req.AdultLengthCm <= 0) || (req.AdultWeightG != nil && *req.AdultWeightG <= 0) {
+		writeError(w, http.StatusBadRequest, errors.New("adult sizes must be greater than zero"))
+		return
+	}
+
+	rsp, err := s.speciesModifier.InsertSpecies(r.Context(), db.Species{
+		Type:          req.Type,
+		Subtype:       req.Subtype,
+		AdultLengthCm: req.AdultLengthCm,
+		AdultWeightG:  req.AdultWeightG,
+		Notes:         req.Notes,
+	})
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to add species"))
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, toSpecies(rsp))
+}
+
+// handleGrowth serves /api/v1alpha1/growth/{fishId}, returning the growth curve of the fish
+// (or group) compared against the expected adult size of its species
+func (s *Server) handleGrowth(w http.ResponseWriter, r *http.Request) {
+	id, rest, err := pathID(r.URL.Path, "/api/v1alpha1/growth/")
+	if err != nil || rest != "" {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	fish, err := s.fishQuerier.GetFish(r.Context(), id)
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to get fish"))
+		return
+	}
+
+	points, err := s.growthQuerier.ListGrowth(r.Context(), id)
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to get growth"))
+		return
+	}
+
+	rsp := growthResponse{
+		FishID:           id,
+		Points:           make([]growthPoint, len(points)),
+		LengthCmPerMonth: lengthPerMonth(points),
+	}
+
+	// fish without a species in the reference are returned without a comparison
+	ref, err := s.speciesQuerier.GetSpeciesFor(r.Context(), fish.Type, fish.Subtype)
+	if err != nil {
+		var nf *db.ErrNotFound
+		if !errors.As(err, &nf) {
+			writeError(w, statusForError(err), errors.Wrap(err, "unable to get species"))
+			return
+		}
+
+		ref = db.Species{}
+	} else {
+		sp := toSpecies(ref)
+		rsp.Species = &sp
+	}
+
+	for i, p := range points {
+		rsp.Points[i] = growthPoint{
+			Date:                 p.Date,
+			LengthCm:             p.LengthCm,
+			WeightG:              p.WeightG,
+			Samples:              p.Samples,
+			PercentOfAdultLength: percentOf(p.LengthCm, ref.AdultLengthCm),
+			PercentOfAdultWeight: percentOf(p.WeightG, ref.AdultWeightG),
+		}
+	}
+
+	writeJSON(w, http.StatusOK, rsp)
+}
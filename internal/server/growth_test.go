@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/openlyinc/pointy"
+	"github.com/stretchr/testify/assert"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+func TestLengthPerMonth(t *testing.T) {
+	day := time.Date(2021, 8, 1, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		desc     string
+		points   []db.GrowthPoint
+		expected *float32
+	}{
+		{desc: "No points", points: nil, expected: nil},
+		{desc: "A single length", points: []db.GrowthPoint{{Date: day, LengthCm: pointy.Float32(4)}, {Date: day.AddDate(0, 0, 30), WeightG: pointy.Float32(3)}}, expected: nil},
+		{desc: "First and last lengths are used", points: []db.GrowthPoint{
+			{Date: day, LengthCm: pointy.Float32(4)},
+			{Date: day.AddDate(0, 0, 30), LengthCm: pointy.Float32(4.2)},
+			{Date: day.AddDate(0, 0, 60), LengthCm: pointy.Float32(5)},
+			{Date: day.AddDate(0, 0, 90), WeightG: pointy.Float32(5)},
+		}, expected: pointy.Float32(0.5)},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			assert.Equal(t, tC.expected, lengthPerMonth(tC.points))
+		})
+	}
+}
+
+func TestGrowth(t *testing.T) {
+	fm := &fishMock{}
+	gm := &growthMock{}
+	s := Server{fishQuerier: fm, growthQuerier: gm, speciesQuerier: gm}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	t.Run("Given a request for the growth of a fish", func(t *testing.T) {
+		fm.getFishResponse = db.Fish{ID: 4, Type: "Cichlid", Subtype: "Yellow Lab"}
+		gm.listGrowthResponse = []db.GrowthPoint{{Date: time.Now(), LengthCm: pointy.Float32(5), Samples: 1}}
+
+		t.Run("When the species isn't in the reference", func(t *testing.T) {
+			t.Run("Then the growth is returned without a comparison", func(t *testing.T) {
+				gm.err = &db.ErrNotFound{}
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1alpha1/growth/4", nil))
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+
+				var rsp growthResponse
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(&rsp))
+				assert.Nil(t, rsp.Species)
+				assert.Len(t, rsp.Points, 1)
+				assert.Nil(t, rsp.Points[0].PercentOfAdultLength)
+			})
+		})
+		t.Run("When the species is in the reference", func(t *testing.T) {
+			t.Run("Then the growth is compared against the adult size", func(t *testing.T) {
+				gm.err = nil
+				gm.getSpeciesForResponse = db.Species{ID: 1, Type: "Cichlid", AdultLengthCm: pointy.Float32(10)}
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1alpha1/growth/4", nil))
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Equal(t, "Yellow Lab", gm.subtype)
+
+				var rsp growthResponse
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(&rsp))
+				assert.Equal(t, int32(1), rsp.Species.ID)
+				assert.Equal(t, float32(50), *rsp.Points[0].PercentOfAdultLength)
+				assert.Nil(t, rsp.Points[0].PercentOfAdultWeight)
+			})
+		})
+	})
+}
+
+type growthMock struct {
+	listGrowthResponse    []db.GrowthPoint
+	listSpeciesResponse   []db.Species
+	subtype               string
+	getSpeciesForResponse db.Species
+	err                   error
+}
+
+func (m *growthMock) ListGrowth(context.Context, int32) ([]db.GrowthPoint, error) {
+	return m.listGrowthResponse, nil
+}
+
+func (m *growthMock) ListSpecies(context.Context) ([]db.Species, error) {
+	return m.listSpeciesResponse, m.err
+}
+
+func (m *growthMock) GetSpeciesFor(ctx context.Context, fishType, subtype string) (db.Species, error) {
+	m.subtype = subtype
+
+	return m.getSpeciesForResponse, m.err
+}
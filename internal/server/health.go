@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	healthzPath = "/healthz"
+	readyzPath  = "/readyz"
+)
+
+// healthCheckMethod and healthWatchMethod are the grpc.health.v1 RPCs, which can be called
+// without authenticating
+const (
+	healthCheckMethod = "/grpc.health.v1.Health/Check"
+	healthWatchMethod = "/grpc.health.v1.Health/Watch"
+)
+
+// healthCheckInterval is how often the database is checked to update the health of the
+// services
+const healthCheckInterval = 10 * time.Second
+
+// healthCheckTimeout is how long the database has to respond to a health check
+const healthCheckTimeout = 2 * time.Second
+
+// healthServices are the services whose health reflects the database, "" being the health
+// of the server as a whole
+var healthServices = []string{"", "trackmyfish.v1alpha1.TrackMyFishService", sensorReadingService, tankWatchService}
+
+type pinger interface {
+	Ping(context.Context) error
+}
+
+type healthResponse struct {
+	Status string `json:"status"`
+}
+
+// RegisterHealth registers the grpc.health.v1 Health service on g, reporting the server and
+// its services as serving while the database can be reached
+func (s *Server) RegisterHealth(g *grpc.Server) {
+	healthpb.RegisterHealthServer(g, s.health)
+}
+
+// MonitorHealth checks the database every healthCheckInterval until ctx is done, updating
+// the health of the services. Once ctx is done the services are reported as not serving,
+// so no more requests are sent while the server shuts down.
+func (s *Server) MonitorHealth(ctx context.Context) {
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		s.checkHealth(ctx)
+
+		select {
+		case <-ctx.Done():
+			s.health.Shutdown()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkHealth pings the database, setting the health of the services by whether it responds
+func (s *Server) checkHealth(ctx context.Context) {
+	status := healthpb.HealthCheckResponse_SERVING
+	if err := s.pingDB(ctx); err != nil {
+		status = healthpb.HealthCheckResponse_NOT_SERVING
+
+		logrus.WithError(err).Warn("Database health check failed")
+	}
+
+	for _, service := range healthServices {
+		s.health.SetServingStatus(service, status)
+	}
+}
+
+func (s *Server) pingDB(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	return s.pinger.Ping(ctx)
+}
+
+// handleHealthz serves /healthz, where GET checks the server is alive and can reach the
+// database, returning a 503 if it can't
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		methodNotAllowed(w, http.MethodGet, http.MethodHead)
+		return
+	}
+
+	if err := s.pingDB(r.Context()); err != nil {
+		logrus.WithError(err).Warn("Database health check failed")
+
+		writeJSON(w, http.StatusServiceUnavailable, healthResponse{Status: healthpb.HealthCheckResponse_NOT_SERVING.String()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, healthResponse{Status: healthpb.HealthCheckResponse_SERVING.String()})
+}
+
+// handleReadyz serves /readyz, where GET checks the server is ready for requests, which it
+// isn't once the database couldn't be reached by the last health check or it's shutting
+// down, returning a 503 if not
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		methodNotAllowed(w, http.MethodGet, http.MethodHead)
+		return
+	}
+
+	rsp, err := s.health.Check(r.Context(), &healthpb.HealthCheckRequest{})
+	if err != nil || rsp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		writeJSON(w, http.StatusServiceUnavailable, healthResponse{Status: healthpb.HealthCheckResponse_NOT_SERVING.String()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, healthResponse{Status: rsp.GetStatus().String()})
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestHealth(t *testing.T) {
+	pm := &pingerMock{}
+	s := &Server{pinger: pm, health: health.NewServer()}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	get := func(path string) int {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+		return rec.Code
+	}
+
+	check := func(service string) healthpb.HealthCheckResponse_ServingStatus {
+		rsp, err := s.health.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+		assert.NoError(t, err)
+
+		return rsp.GetStatus()
+	}
+
+	t.Run("Given the database can be reached", func(t *testing.T) {
+		pm.err = nil
+
+		t.Run("When the health is checked", func(t *testing.T) {
+			t.Run("Then the server is serving", func(t *testing.T) {
+				s.checkHealth(context.Background())
+
+				assert.Equal(t, healthpb.HealthCheckResponse_SERVING, check(""))
+				assert.Equal(t, healthpb.HealthCheckResponse_SERVING, check(healthServices[1]))
+				assert.Equal(t, http.StatusOK, get(healthzPath))
+				assert.Equal(t, http.StatusOK, get(readyzPath))
+			})
+		})
+	})
+
+	t.Run("Given the database can't be reached", func(t *testing.T) {
+		pm.err = assert.AnError
+
+		t.Run("When the health is checked", func(t *testing.T) {
+			t.Run("Then the server isn't serving", func(t *testing.T) {
+				s.checkHealth(context.Background())
+
+				assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, check(""))
+				assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, check(healthServices[1]))
+				assert.Equal(t, http.StatusServiceUnavailable, get(healthzPath))
+				assert.Equal(t, http.StatusServiceUnavailable, get(readyzPath))
+			})
+		})
+	})
+
+	t.Run("Given the server is shutting down", func(t *testing.T) {
+		pm.err = nil
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		t.Run("When the health is checked", func(t *testing.T) {
+			t.Run("Then it's alive but not ready", func(t *testing.T) {
+				s.MonitorHealth(ctx)
+
+				assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, check(""))
+				assert.Equal(t, http.StatusOK, get(healthzPath))
+				assert.Equal(t, http.StatusServiceUnavailable, get(readyzPath))
+			})
+		})
+	})
+}
+
+type pingerMock struct {
+	err error
+}
+
+func (m *pingerMock) Ping(context.Context) error {
+	return m.err
+}
@@ -0,0 +1,340 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/trackmyfish/backend/internal/auth"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+// maxHouseholdNameLength is the maximum length of the name of a household
+const maxHouseholdNameLength = 255
+
+const (
+	// defaultInviteDays is how long an invite can be accepted for, unless set
+	defaultInviteDays = 7
+	// maxInviteDays is the longest an invite can be accepted for
+	maxInviteDays = 30
+)
+
+type householdQuerier interface {
+	GetHousehold(context.Context, int32) (db.Household, error)
+}
+
+type householdModifier interface {
+	RenameHousehold(context.Context, int32, string) (db.Household, error)
+}
+
+type inviteQuerier interface {
+	ListInvites(context.Context, int32) ([]db.Invite, error)
+}
+
+type inviteModifier interface {
+	InsertInvite(context.Context, db.Invite, string) (db.Invite, error)
+	DeleteInvite(context.Context, int32, int32) (db.Invite, error)
+	AcceptInvite(context.Context, string, db.User) (db.User, error)
+}
+
+type householdRequest struct {
+	Name string `json:"name"`
+}
+
+type householdResponse struct {
+	ID   int32  `json:"id"`
+	Name string `json:"name"`
+}
+
+type roleRequest struct {
+	Role string `json:"role"`
+}
+
+type inviteRequest struct {
+	Role          string `json:"role"`
+	ExpiresInDays int    `json:"expiresInDays"`
+}
+
+type inviteResponse struct {
+	ID         int32      `json:"id"`
+	Role       string     `json:"role"`
+	CreatedBy  int32      `json:"createdBy"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	AcceptedBy *int32     `json:"acceptedBy,omitempty"`
+	AcceptedAt *time.Time `json:"acceptedAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	// Code is only returned when the invite is created
+	Code string `json:"code,omitempty"`
+}
+
+func toInviteResponse(i db.Invite) inviteResponse {
+	return inviteResponse{
+		ID:         i.ID,
+		Role:       i.Role,
+		CreatedBy:  i.CreatedBy,
+		ExpiresAt:  i.ExpiresAt,
+		AcceptedBy: i.AcceptedBy,
+		AcceptedAt: i.AcceptedAt,
+		CreatedAt:  i.CreatedAt,
+	}
+}
+
+func toHouseholdResponse(h db.Household) householdResponse {
+	return householdResponse{ID: h.ID, Name: h.Name}
+}
+
+// handleHousehold serves /api/v1alpha1/household, the household of the authenticated user
+//
+// GET returns the household. PUT renames it.
+func (s *Server) handleHousehold(w http.ResponseWriter, r *http.Request) {
+	id, ok := auth.FromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, auth.ErrUnauthenticated)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		rsp, err := s.householdQuerier.GetHousehold(r.Context(), id.HouseholdID)
+		if err != nil {
+			writeError(w, statusForError(err), errors.Wrap(err, "unable to get household"))
+			return
+		}
+
+		writeJSON(w, http.StatusOK, toHouseholdResponse(rsp))
+	case http.MethodPut:
+		s.renameHousehold(w, r, id.HouseholdID)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPut)
+	}
+}
+
+func (s *Server) renameHousehold(w http.ResponseWriter, r *http.Request, id int32) {
+	var req householdRequest
+	if err := readJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > maxHouseholdNameLength {
+		writeError(w, http.StatusBadRequest, errors.Errorf("name must be between 1 and %d characters", maxHouseholdNameLength))
+		return
+	}
+
+	before, err := s.householdQuerier.GetHousehold(r.Context(), id)
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to get household"))
+		return
+	}
+
+	auditBefore(r.Context(), toHouseholdResponse(before))
+
+	rsp, err := s.householdModifier.RenameHousehold(r.Context(), id, name)
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to rename household"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, toHouseholdResponse(rsp))
+}
+
+// handleMembers serves /api/v1alpha1/members, where GET lists the members of the household
+// of the authenticated user
+func (s *Server) handleMembers(w http.ResponseWriter, r *http.Request) {
+	id, ok := auth.FromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, auth.ErrUnauthenticated)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	rsp, err := s.userQuerier.ListUsers(r.Context(), id.HouseholdID)
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to list members"))
+		return
+	}
+
+	members := make([]userResponse, len(rsp))
+	for i, u := range rsp {
+		members[i] = toUserResponse(u)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"members": members})
+}
+
+// handleMember serves /api/v1alpha1/members/{id}
+//
+// PUT changes the role of the member. DELETE removes the member from the household. A
+// household must always have an owner.
+func (s *Server) handleMember(w http.ResponseWriter, r *http.Request) {
+	id, ok := auth.FromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, auth.ErrUnauthenticated)
+		return
+	}
+
+	userID, rest, err := pathID(r.URL.Path, "/api/v1alpha1/members/")
+	if err != nil || rest != "" {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		var req roleRequest
+		if err := readJSON(w, r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		role, err := auth.ParseRole(req.Role)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		before, err := s.userQuerier.GetUser(r.Context(), userID)
+		if err != nil {
+			writeError(w, statusForError(err), errors.Wrap(err, "unable to get member"))
+			return
+		}
+
+		if before.HouseholdID != id.HouseholdID {
+			writeError(w, http.StatusNotFound, errors.New("member not found"))
+			return
+		}
+
+		auditBefore(r.Context(), toUserResponse(before))
+
+		rsp, err := s.userModifier.UpdateUserRole(r.Context(), id.HouseholdID, userID, string(role))
+		if err != nil {
+			writeError(w, statusForError(err), errors.Wrap(err, "unable to update member"))
+			return
+		}
+
+		writeJSON(w, http.StatusOK, toUserResponse(rsp))
+	case http.MethodDelete:
+		rsp, err := s.userModifier.DeleteUser(r.Context(), id.HouseholdID, userID)
+		if err != nil {
+			writeError(w, statusForError(err), errors.Wrap(err, "unable to remove member"))
+			return
+		}
+
+		writeJSON(w, http.StatusOK, toUserResponse(rsp))
+	default:
+		methodNotAllowed(w, http.MethodPut, http.MethodDelete)
+	}
+}
+
+// handleInvites serves /api/v1alpha1/invites
+//
+// GET lists the invites of the household. POST creates an invite granting a role in the
+// household, returning the code to sign up with. The code can't be retrieved later.
+func (s *Server) handleInvites(w http.ResponseWriter, r *http.Request) {
+	id, ok := auth.FromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, auth.ErrUnauthenticated)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		rsp, err := s.inviteQuerier.ListInvites(r.Context(), id.HouseholdID)
+		if err != nil {
+			writeError(w, statusForError(err), errors.Wrap(err, "unable to list invites"))
+			return
+		}
+
+		invites := make([]inviteResponse, len(rsp))
+		for i, invite := range rsp {
+			invites[i] = toInviteResponse(invite)
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{"invites": invites})
+	case http.MethodPost:
+		s.addInvite(w, r, id)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// handleInvite serves /api/v1alpha1/invites/{id}, where DELETE revokes the invite
+func (s *Server) handleInvite(w http.ResponseWriter, r *http.Request) {
+	id, ok := auth.FromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, auth.ErrUnauthenticated)
+		return
+	}
+
+	inviteID, rest, err := pathID(r.URL.Path, "/api/v1alpha1/invites/")
+	if err != nil || rest != "" {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	if r.Method != http.MethodDelete {
+		methodNotAllowed(w, http.MethodDelete)
+		return
+	}
+
+	rsp, err := s.inviteModifier.DeleteInvite(r.Context(), id.HouseholdID, inviteID)
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to delete invite"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, toInviteResponse(rsp))
+}
+
+func (s *Server) addInvite(w http.ResponseWriter, r *http.Request, id auth.Identity) {
+	var req inviteRequest
+	if err := readJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	role, err := auth.ParseRole(req.Role)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	days := req.ExpiresInDays
+	if days == 0 {
+		days = defaultInviteDays
+	}
+
+	if days < 0 || days > maxInviteDays {
+		writeError(w, http.StatusBadRequest, errors.Errorf("expiresInDays must be between 1 and %d", maxInviteDays))
+		return
+	}
+
+	code, err := auth.NewOpaqueToken()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	rsp, err := s.inviteModifier.InsertInvite(r.Context(), db.Invite{
+		HouseholdID: id.HouseholdID,
+		Role:        string(role),
+		CreatedBy:   id.UserID,
+		ExpiresAt:   time.Now().AddDate(0, 0, days),
+	}, auth.HashOpaqueToken(code))
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to add invite"))
+		return
+	}
+
+	invite := toInviteResponse(rsp)
+	invite.Code = code
+
+	writeJSON(w, http.StatusCreated, invite)
+}
@@ -0,0 +1,215 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trackmyfish/backend/internal/auth"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+func TestHousehold(t *testing.T) {
+	hm := &householdMock{getHouseholdResponse: db.Household{ID: 2, Name: "Reef Club"}}
+	s := Server{householdQuerier: hm, householdModifier: hm}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	authenticated := func(req *http.Request) *http.Request {
+		return req.WithContext(auth.NewContext(req.Context(), auth.Identity{UserID: 3, Username: "nemo", HouseholdID: 2}))
+	}
+
+	t.Run("Given a request for the household", func(t *testing.T) {
+		t.Run("When it isn't authenticated", func(t *testing.T) {
+			t.Run("Then unauthorized is returned", func(t *testing.T) {
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1alpha1/household", nil))
+
+				assert.Equal(t, http.StatusUnauthorized, rec.Code)
+			})
+		})
+		t.Run("When it is authenticated", func(t *testing.T) {
+			t.Run("Then the household of the user is returned", func(t *testing.T) {
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, authenticated(httptest.NewRequest(http.MethodGet, "/api/v1alpha1/household", nil)))
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Equal(t, int32(2), hm.getHouseholdRequest)
+
+				var rsp householdResponse
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(&rsp))
+				assert.Equal(t, householdResponse{ID: 2, Name: "Reef Club"}, rsp)
+			})
+		})
+	})
+
+	t.Run("Given a request to rename the household", func(t *testing.T) {
+		t.Run("When the name is empty", func(t *testing.T) {
+			t.Run("Then a bad request is returned", func(t *testing.T) {
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, authenticated(httptest.NewRequest(http.MethodPut, "/api/v1alpha1/household", strings.NewReader(`{"name": " "}`))))
+
+				assert.Equal(t, http.StatusBadRequest, rec.Code)
+			})
+		})
+		t.Run("When the name is valid", func(t *testing.T) {
+			t.Run("Then the household of the user is renamed", func(t *testing.T) {
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, authenticated(httptest.NewRequest(http.MethodPut, "/api/v1alpha1/household", strings.NewReader(`{"name": "Tropical Club"}`))))
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Equal(t, int32(2), hm.renameHouseholdID)
+				assert.Equal(t, "Tropical Club", hm.renameHouseholdName)
+			})
+		})
+	})
+}
+
+func TestInvites(t *testing.T) {
+	im := &inviteMock{}
+	s := Server{inviteQuerier: im, inviteModifier: im}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	owner := auth.Identity{UserID: 3, Username: "nemo", HouseholdID: 2, Role: auth.RoleOwner}
+
+	t.Run("Given a request to invite a user", func(t *testing.T) {
+		t.Run("When the role is invalid", func(t *testing.T) {
+			t.Run("Then a bad request is returned", func(t *testing.T) {
+				req := httptest.NewRequest(http.MethodPost, "/api/v1alpha1/invites", strings.NewReader(`{"role": "ADMIN"}`))
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, req.WithContext(auth.NewContext(req.Context(), owner)))
+
+				assert.Equal(t, http.StatusBadRequest, rec.Code)
+			})
+		})
+		t.Run("When the role is valid", func(t *testing.T) {
+			t.Run("Then the code is returned and only its hash is stored", func(t *testing.T) {
+				req := httptest.NewRequest(http.MethodPost, "/api/v1alpha1/invites", strings.NewReader(`{"role": "viewer"}`))
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, req.WithContext(auth.NewContext(req.Context(), owner)))
+
+				assert.Equal(t, http.StatusCreated, rec.Code)
+
+				var rsp inviteResponse
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(&rsp))
+				assert.NotEmpty(t, rsp.Code)
+				assert.Equal(t, auth.HashOpaqueToken(rsp.Code), im.insertInviteHash)
+				assert.Equal(t, db.Invite{HouseholdID: 2, Role: "VIEWER", CreatedBy: 3}, db.Invite{
+					HouseholdID: im.insertInviteRequest.HouseholdID,
+					Role:        im.insertInviteRequest.Role,
+					CreatedBy:   im.insertInviteRequest.CreatedBy,
+				})
+				assert.WithinDuration(t, time.Now().AddDate(0, 0, defaultInviteDays), im.insertInviteRequest.ExpiresAt, time.Minute)
+			})
+		})
+	})
+}
+
+func TestMembers(t *testing.T) {
+	um := &userMock{getUserResponse: db.User{ID: 4, HouseholdID: 2, Role: "VIEWER"}}
+	s := Server{userQuerier: um, userModifier: um}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	owner := auth.Identity{UserID: 3, Username: "nemo", HouseholdID: 2, Role: auth.RoleOwner}
+
+	t.Run("Given a request to change the role of a member", func(t *testing.T) {
+		t.Run("When the role is valid", func(t *testing.T) {
+			t.Run("Then the role is changed within the household of the user", func(t *testing.T) {
+				req := httptest.NewRequest(http.MethodPut, "/api/v1alpha1/members/4", strings.NewReader(`{"role": "editor"}`))
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, req.WithContext(auth.NewContext(req.Context(), owner)))
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Equal(t, db.User{ID: 4, HouseholdID: 2, Role: "EDITOR"}, um.updateUserRoleRequest)
+			})
+		})
+		t.Run("When the member is of another household", func(t *testing.T) {
+			t.Run("Then not found is returned", func(t *testing.T) {
+				um.updateUserRoleRequest = db.User{}
+
+				req := httptest.NewRequest(http.MethodPut, "/api/v1alpha1/members/4", strings.NewReader(`{"role": "editor"}`))
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, req.WithContext(auth.NewContext(req.Context(), auth.Identity{UserID: 8, HouseholdID: 7, Role: auth.RoleOwner})))
+
+				assert.Equal(t, http.StatusNotFound, rec.Code)
+				assert.Equal(t, db.User{}, um.updateUserRoleRequest)
+			})
+		})
+		t.Run("When it would leave the household without an owner", func(t *testing.T) {
+			t.Run("Then a conflict is returned", func(t *testing.T) {
+				um.err = &db.ErrConflict{}
+				defer func() { um.err = nil }()
+
+				req := httptest.NewRequest(http.MethodPut, "/api/v1alpha1/members/3", strings.NewReader(`{"role": "VIEWER"}`))
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, req.WithContext(auth.NewContext(req.Context(), owner)))
+
+				assert.Equal(t, http.StatusConflict, rec.Code)
+			})
+		})
+	})
+}
+
+type householdMock struct {
+	getHouseholdRequest  int32
+	getHouseholdResponse db.Household
+	renameHouseholdID    int32
+	renameHouseholdName  string
+	err                  error
+}
+
+func (m *householdMock) GetHousehold(ctx context.Context, id int32) (db.Household, error) {
+	m.getHouseholdRequest = id
+
+	return m.getHouseholdResponse, m.err
+}
+
+func (m *householdMock) RenameHousehold(ctx context.Context, id int32, name string) (db.Household, error) {
+	m.renameHouseholdID, m.renameHouseholdName = id, name
+
+	return db.Household{ID: id, Name: name}, m.err
+}
+
+type inviteMock struct {
+	insertInviteRequest  db.Invite
+	insertInviteHash     string
+	acceptInviteHash     string
+	acceptInviteRequest  db.User
+	acceptInviteResponse db.User
+	err                  error
+}
+
+func (m *inviteMock) ListInvites(context.Context, int32) ([]db.Invite, error) {
+	return nil, m.err
+}
+
+func (m *inviteMock) InsertInvite(ctx context.Context, req db.Invite, hash string) (db.Invite, error) {
+	m.insertInviteRequest, m.insertInviteHash = req, hash
+
+	return req, m.err
+}
+
+func (m *inviteMock) DeleteInvite(ctx context.Context, householdID, id int32) (db.Invite, error) {
+	return db.Invite{ID: id, HouseholdID: householdID}, m.err
+}
+
+func (m *inviteMock) AcceptInvite(ctx context.Context, hash string, req db.User) (db.User, error) {
+	m.acceptInviteHash, m.acceptInviteRequest = hash, req
+
+	return m.acceptInviteResponse, m.err
+}
@@ -0,0 +1,255 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+// RegisterHandlers registers the HTTP only endpoints, i.e. those which don't map to
+// an RPC on the TrackMyFishService, on the provided mux. Changes made through them are
+// recorded in the audit log.
+func (s *Server) RegisterHandlers(mux *http.ServeMux) {
+	handle := func(pattern string, handler http.HandlerFunc) {
+		mux.HandleFunc(pattern, s.audited(handler))
+	}
+
+	handle("/api/v1alpha1/attachments", s.handleAttachments)
+	handle("/api/v1alpha1/attachments/", s.handleAttachment)
+	handle("/api/v1alpha1/journal", s.handleJournal)
+	handle("/api/v1alpha1/journal/", s.handleJournalEntry)
+	handle("/api/v1alpha1/notes/search", s.handleSearchNotes)
+	handle("/api/v1alpha1/treatments", s.handleTreatments)
+	handle("/api/v1alpha1/treatments/", s.handleTreatment)
+	handle("/api/v1alpha1/treatment-doses", s.handleDueDoses)
+	handle("/api/v1alpha1/treatment-doses/", s.handleDose)
+	handle("/api/v1alpha1/tank-roles/", s.handleTankRole)
+	handle("/api/v1alpha1/quarantines", s.handleQuarantines)
+	handle("/api/v1alpha1/quarantines/", s.handleQuarantine)
+	handle("/api/v1alpha1/breedings", s.handleBreedings)
+	handle("/api/v1alpha1/breedings/", s.handleBreeding)
+	handle("/api/v1alpha1/lineage/", s.handleLineage)
+	handle("/api/v1alpha1/fertilisers", s.handleFertilisers)
+	handle("/api/v1alpha1/fertilisers/", s.handleFertiliser)
+	handle("/api/v1alpha1/dosing", s.handleDosing)
+	handle("/api/v1alpha1/dosing/", s.handleDosingEntry)
+	handle("/api/v1alpha1/dosing/calculate", s.handleDoseCalculation)
+	handle("/api/v1alpha1/individuals", s.handleIndividuals)
+	handle("/api/v1alpha1/individuals/", s.handleIndividual)
+	handle("/api/v1alpha1/fish-groups/", s.handleFishGroup)
+	handle("/api/v1alpha1/measurements", s.handleMeasurements)
+	handle("/api/v1alpha1/measurements/", s.handleMeasurement)
+	handle("/api/v1alpha1/species", s.handleSpecies)
+	handle("/api/v1alpha1/species/", s.handleSpeciesEntry)
+	handle("/api/v1alpha1/growth/", s.handleGrowth)
+	handle("/api/v1alpha1/login", s.handleLogin)
+	handle("/api/v1alpha1/users", s.handleUsers)
+	handle("/api/v1alpha1/users/me", s.handleMe)
+	handle("/api/v1alpha1/household", s.handleHousehold)
+	handle("/api/v1alpha1/members", s.handleMembers)
+	handle("/api/v1alpha1/members/", s.handleMember)
+	handle("/api/v1alpha1/invites", s.handleInvites)
+	handle("/api/v1alpha1/invites/", s.handleInvite)
+	handle("/api/v1alpha1/api-keys", s.handleAPIKeys)
+	handle("/api/v1alpha1/api-keys/", s.handleAPIKey)
+	handle("/api/v1alpha1/tank-shares", s.handleTankShares)
+	handle("/api/v1alpha1/tank-shares/", s.handleTankShare)
+	handle("/api/v1alpha1/showcase/", s.handleShowcase)
+	handle("/showcase/", s.handleShowcasePage)
+	handle(auditEventsPath, s.handleAuditEvents)
+	handle(trashPath, s.handleTrash)
+	handle(trashPath+"/", s.handleTrashItem)
+	handle(exportPath, s.handleExport)
+	handle(importPath, s.handleImport)
+	handle(tankStatisticsImportPath, s.handleTankStatisticsImport)
+	handle(tankStatisticsBatchPath, s.handleTankStatisticsBatch)
+	handle(csvPath, s.handleCSVExport)
+	handle(readingsPath, s.handleReadings)
+	handle(readingsStreamPath, s.handleReadingsStream)
+	handle(watchPath, s.handleWatchTank)
+	handle(healthzPath, s.handleHealthz)
+	handle(readyzPath, s.handleReadyz)
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logrus.WithError(err).Error("unable to write response")
+	}
+}
+
+// maxJSONBodySize limits the size of JSON request bodies
+const maxJSONBodySize = 1 << 20 // 1 MiB
+
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxJSONBodySize))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(v); err != nil {
+		return errors.Wrap(err, "invalid request body")
+	}
+
+	return nil
+}
+
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+// statusForError maps errors returned by the db layer to a HTTP status code
+func statusForError(err error) int {
+	var nf *db.ErrNotFound
+	if errors.As(err, &nf) {
+		return http.StatusNotFound
+	}
+
+	var c *db.ErrConflict
+	if errors.As(err, &c) {
+		return http.StatusConflict
+	}
+
+	return http.StatusInternalServerError
+}
+
+// isBodyTooLarge returns whether err was returned reading past the limit of an
+// http.MaxBytesReader. http.MaxBytesError is only available from Go 1.19, so the error is
+// matched by its message, which may be wrapped, e.g. by the multipart reader.
+func isBodyTooLarge(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "http: request body too large")
+}
+
+// checkTank checks a tank referenced by a new record is visible to the household. Foreign
+// keys aren't subject to row level security, so they'd accept another household's tanks.
+func (s *Server) checkTank(ctx context.Context, id int32) error {
+	if _, err := s.tankQuerier.GetTank(ctx, id); err != nil {
+		return errors.Wrapf(err, "unable to get tank %d", id)
+	}
+
+	return nil
+}
+
+// checkFish checks a fish referenced by a new record is visible to the household, see
+// checkTank
+func (s *Server) checkFish(ctx context.Context, id int32) error {
+	if _, err := s.fishQuerier.GetFish(ctx, id); err != nil {
+		return errors.Wrapf(err, "unable to get fish %d", id)
+	}
+
+	return nil
+}
+
+// checkTankOrFish checks whichever of the tank or fish a new record belongs to is visible
+// to the household
+func (s *Server) checkTankOrFish(ctx context.Context, tankID, fishID *int32) error {
+	if tankID != nil {
+		return s.checkTank(ctx, *tankID)
+	}
+
+	if fishID != nil {
+		return s.checkFish(ctx, *fishID)
+	}
+
+	return nil
+}
+
+// optionalInt32 parses the named query parameter or form field, returning nil if it isn't set
+func optionalInt32(r *http.Request, name string) (*int32, error) {
+	v := r.FormValue(name)
+	if v == "" {
+		return nil, nil
+	}
+
+	i, err := strconv.ParseInt(v, 10, 32)
+	if err != nil {
+		return nil, errors.Errorf("invalid %s %q", name, v)
+	}
+
+	i32 := int32(i)
+
+	return &i32, nil
+}
+
+// optionalBool parses the named query parameter, returning false if it isn't set. Unlike
+// the other parameters it isn't read from forms, as it's used alongside request bodies
+// which mustn't be parsed as a form.
+func optionalBool(r *http.Request, name string) (bool, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, errors.Errorf("invalid %s %q", name, v)
+	}
+
+	return b, nil
+}
+
+// optionalDate parses the named query parameter or form field as a date, returning nil if it isn't set
+func optionalDate(r *http.Request, name string) (*time.Time, error) {
+	v := r.FormValue(name)
+	if v == "" {
+		return nil, nil
+	}
+
+	t, err := parseDate(v, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// pathID splits the path remaining after prefix into its leading ID and any trailing segments,
+// e.g. "/api/v1alpha1/attachments/3/content" with prefix "/api/v1alpha1/attachments/" returns 3, "content"
+func pathID(path, prefix string) (int32, string, error) {
+	parts := strings.SplitN(strings.TrimPrefix(path, prefix), "/", 2)
+
+	id, err := strconv.ParseInt(parts[0], 10, 32)
+	if err != nil {
+		return 0, "", errors.Errorf("invalid id %q", parts[0])
+	}
+
+	if len(parts) == 1 {
+		return int32(id), "", nil
+	}
+
+	return int32(id), parts[1], nil
+}
+
+// dateLayouts are the layouts accepted by parseDate, in order of preference
+var dateLayouts = []string{time.RFC3339, "2006-01-02 15:04", "2006-01-02"}
+
+// parseDate parses a date provided by a client, returning def if it is empty
+func parseDate(v string, def time.Time) (time.Time, error) {
+	if v == "" {
+		return def, nil
+	}
+
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, errors.Errorf("invalid date %q, expected YYYY-MM-DD or RFC3339", v)
+}
@@ -0,0 +1,360 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/trackmyfish/backend/internal/db"
+	trackmyfishv1alpha1 "github.com/trackmyfish/proto/trackmyfish/v1alpha1"
+)
+
+// maxSplitIndividuals limits the number of individuals created by a single split
+const maxSplitIndividuals = 100
+
+type individualQuerier interface {
+	GetIndividual(context.Context, int32) (db.Individual, error)
+	ListIndividuals(context.Context, db.IndividualFilter) ([]db.Individual, error)
+}
+
+type individualModifier interface {
+	InsertIndividual(context.Context, db.Individual) (db.Individual, error)
+	UpdateIndividual(context.Context, db.Individual) (db.Individual, error)
+	SplitFish(context.Context, int32, []db.Individual) ([]db.Individual, error)
+	MergeFish(context.Context, int32, []int32) (db.Fish, error)
+}
+
+type individualRequest struct {
+	TankID           *int32 `json:"tankId"`
+	Type             string `json:"type"`
+	Subtype          string `json:"subtype"`
+	Color            string `json:"color"`
+	Gender           string `json:"gender"`
+	PurchaseDate     string `json:"purchaseDate"`
+	Name             string `json:"name"`
+	IdentifyingMarks string `json:"identifyingMarks"`
+	BirthDate        string `json:"birthDate"`
+}
+
+type individualProfileRequest struct {
+	Name              string `json:"name"`
+	IdentifyingMarks  string `json:"identifyingMarks"`
+	BirthDate         string `json:"birthDate"`
+	PhotoAttachmentID *int32 `json:"photoAttachmentId"`
+}
+
+type individualResponse struct {
+	fishResponse
+	Name              string     `json:"name"`
+	IdentifyingMarks  string     `json:"identifyingMarks"`
+	BirthDate         string     `json:"birthDate,omitempty"`
+	PhotoAttachmentID *int32     `json:"photoAttachmentId,omitempty"`
+	GroupID           *int32     `json:"groupId,omitempty"`
+	MergedAt          *time.Time `json:"mergedAt,omitempty"`
+}
+
+type splitRequest struct {
+	Individuals []struct {
+		Name             string `json:"name"`
+		IdentifyingMarks string `json:"identifyingMarks"`
+		Gender           string `json:"gender"`
+		BirthDate        string `json:"birthDate"`
+	} `json:"individuals"`
+}
+
+type mergeRequest struct {
+	FishIDs []int32 `json:"fishIds"`
+}
+
+func toIndividualResponse(i db.Individual) individualResponse {
+	rsp := individualResponse{
+		fishResponse:      toFishResponse(i.Fish),
+		Name:              i.Name,
+		IdentifyingMarks:  i.IdentifyingMarks,
+		PhotoAttachmentID: i.PhotoAttachmentID,
+		GroupID:           i.GroupID,
+		MergedAt:          i.MergedAt,
+	}
+
+	if i.BirthDate != nil {
+		rsp.BirthDate = i.BirthDate.Format("2006-01-02")
+	}
+
+	return rsp
+}
+
+// optionalBirthDate parses a birth date, returning nil if it is empty
+func optionalBirthDate(v string) (*time.Time, error) {
+	if v == "" {
+		return nil, nil
+	}
+
+	t, err := parseDate(v, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// handleIndividuals serves /api/v1alpha1/individuals
+//
+// GET lists individuals, optionally filtered by tankId or groupId. Individuals which have
+// been merged back into a group are only included with includeMerged=true.
+// POST adds an individual which wasn't split from a group.
+func (s *Server) handleIndividuals(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.listIndividuals(w, r)
+	case http.MethodPost:
+		s.addIndividual(w, r)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// handleIndividual serves /api/v1alpha1/individuals/{id}, where PUT replaces the profile
+// (name, identifying marks, birth date and photo) of the individual
+func (s *Server) handleIndividual(w http.ResponseWriter, r *http.Request) {
+	id, rest, err := pathID(r.URL.Path, "/api/v1alpha1/individuals/")
+	if err != nil || rest != "" {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		rsp, err := s.individualQuerier.GetIndividual(r.Context(), id)
+		if err != nil {
+			writeError(w, statusForError(err), errors.Wrap(err, "unable to get individual"))
+			return
+		}
+
+		writeJSON(w, http.StatusOK, toIndividualResponse(rsp))
+	case http.MethodPut:
+		s.updateIndividual(w, r, id)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPut)
+	}
+}
+
+// handleFishGroup serves /api/v1alpha1/fish-groups/{id}/split and /api/v1alpha1/fish-groups/{id}/merge
+func (s *Server) handleFishGroup(w http.ResponseWriter, r *http.Request) {
+	id, rest, err := pathID(r.URL.Path, "/api/v1alpha1/fish-groups/")
+	if err != nil || (rest != "split" && rest != "merge") {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	if rest == "split" {
+		s.splitFish(w, r, id)
+		return
+	}
+
+	s.mergeFish(w, r, id)
+}
+
+func (s *Server) listIndividuals(w http.ResponseWriter, r *http.Request) {
+	var (
+		filter = db.IndividualFilter{IncludeMerged: r.URL.Query().Get("includeMerged") == "true"}
+		err    error
+	)
+
+	if filter.TankID, err = optionalInt32(r, "tankId"); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if filter.GroupID, err = optionalInt32(r, "groupId"); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	rsp, err := s.individualQuerier.ListIndividuals(r.Context(), filter)
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to list individuals"))
+		return
+	}
+
+	individuals := make([]individualResponse, len(rsp))
+	for i, individual := range rsp {
+		individuals[i] = toIndividualResponse(individual)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"individuals": individuals})
+}
+
+func (s *Server) addIndividual(w http.ResponseWriter, r *http.Request) {
+	var req individualRequest
+	if err := readJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if strings.TrimSpace(req.Name) == "" || req.Type == "" {
+		writeError(w, http.StatusBadRequest, errors.New("name and type must be provided"))
+		return
+	}
+
+	birthDate, err := optionalBirthDate(req.BirthDate)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if req.TankID != nil {
+		if err := s.checkTank(r.Context(), *req.TankID); err != nil {
+			writeError(w, statusForError(err), err)
+			return
+		}
+	}
+
+	rsp, err := s.individualModifier.InsertIndividual(r.Context(), db.Individual{
+		Fish: db.Fish{
+			TankID:       req.TankID,
+			Type:         req.Type,
+			Subtype:      req.Subtype,
+			Color:        req.Color,
+			Gender:       stringToGender(req.Gender).String(),
+			PurchaseDate: req.PurchaseDate,
+		},
+		Name:             strings.TrimSpace(req.Name),
+		IdentifyingMarks: req.IdentifyingMarks,
+		BirthDate:        birthDate,
+	})
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to add individual"))
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, toIndividualResponse(rsp))
+}
+
+func (s *Server) updateIndividual(w http.ResponseWriter, r *http.Request, id int32) {
+	var req individualProfileRequest
+	if err := readJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if strings.TrimSpace(req.Name) == "" {
+		writeError(w, http.StatusBadRequest, errors.New("name must be provided"))
+		return
+	}
+
+	birthDate, err := optionalBirthDate(req.BirthDate)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	before, err := s.individualQuerier.GetIndividual(r.Context(), id)
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to get individual"))
+		return
+	}
+
+	auditBefore(r.Context(), toIndividualResponse(before))
+
+	rsp, err := s.individualModifier.UpdateIndividual(r.Context(), db.Individual{
+		Fish:              db.Fish{ID: id},
+		Name:              strings.TrimSpace(req.Name),
+		IdentifyingMarks:  req.IdentifyingMarks,
+		BirthDate:         birthDate,
+		PhotoAttachmentID: req.PhotoAttachmentID,
+	})
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to update individual"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, toIndividualResponse(rsp))
+}
+
+func (s *Server) splitFish(w http.ResponseWriter, r *http.Request, groupID int32) {
+	var req splitRequest
+	if err := readJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if len(req.Individuals) == 0 || len(req.Individuals) > maxSplitIndividuals {
+		writeError(w, http.StatusBadRequest, errors.Errorf("between 1 and %d individuals must be provided", maxSplitIndividuals))
+		return
+	}
+
+	individuals := make([]db.Individual, len(req.Individuals))
+	for i, ind := range req.Individuals {
+		if strings.TrimSpace(ind.Name) == "" {
+			writeError(w, http.StatusBadRequest, errors.New("every individual must have a name"))
+			return
+		}
+
+		birthDate, err := optionalBirthDate(ind.BirthDate)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		individuals[i] = db.Individual{
+			Name:             strings.TrimSpace(ind.Name),
+			IdentifyingMarks: ind.IdentifyingMarks,
+			BirthDate:        birthDate,
+		}
+
+		// an unspecified gender is inherited from the group
+		if gender := stringToGender(ind.Gender); gender != trackmyfishv1alpha1.Fish_UNSPECIFIED {
+			individuals[i].Fish.Gender = gender.String()
+		}
+	}
+
+	rsp, err := s.individualModifier.SplitFish(r.Context(), groupID, individuals)
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to split fish"))
+		return
+	}
+
+	split := make([]individualResponse, len(rsp))
+	for i, individual := range rsp {
+		split[i] = toIndividualResponse(individual)
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"individuals": split})
+}
+
+func (s *Server) mergeFish(w http.ResponseWriter, r *http.Request, groupID int32) {
+	var req mergeRequest
+	if err := readJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if len(req.FishIDs) == 0 {
+		writeError(w, http.StatusBadRequest, errors.New("fishIds must be provided"))
+		return
+	}
+
+	seen := map[int32]bool{}
+	for _, id := range req.FishIDs {
+		if seen[id] || id == groupID {
+			writeError(w, http.StatusBadRequest, errors.Errorf("invalid fishId %d", id))
+			return
+		}
+		seen[id] = true
+	}
+
+	rsp, err := s.individualModifier.MergeFish(r.Context(), groupID, req.FishIDs)
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to merge fish"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, toFishResponse(rsp))
+}
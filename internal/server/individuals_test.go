@@ -0,0 +1,249 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+func TestAddIndividual(t *testing.T) {
+	im := &individualMock{insertIndividualResponse: db.Individual{Fish: db.Fish{ID: 4, Type: "Clownfish"}, Name: "Nemo"}}
+	tm := &tankMock{}
+	s := Server{individualModifier: im, tankQuerier: tm}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	request := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/individuals", strings.NewReader(`{"name": "Nemo", "type": "Clownfish", "tankId": 1}`)))
+
+		return rec
+	}
+
+	t.Run("Given a request to add an individual to a tank", func(t *testing.T) {
+		t.Run("When the tank isn't visible to the household", func(t *testing.T) {
+			t.Run("Then not found is returned and nothing is added", func(t *testing.T) {
+				tm.err = &db.ErrNotFound{}
+				defer func() { tm.err = nil }()
+
+				assert.Equal(t, http.StatusNotFound, request().Code)
+				assert.Empty(t, im.insertIndividualRequest.Name)
+			})
+		})
+		t.Run("When the tank is visible", func(t *testing.T) {
+			t.Run("Then the individual is added to it", func(t *testing.T) {
+				assert.Equal(t, http.StatusCreated, request().Code)
+				assert.Equal(t, int32(1), *im.insertIndividualRequest.Fish.TankID)
+			})
+		})
+	})
+}
+
+func TestSplitFish(t *testing.T) {
+	im := &individualMock{}
+	s := Server{individualModifier: im}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	t.Run("Given a request to split a group", func(t *testing.T) {
+		t.Run("When an individual has no name", func(t *testing.T) {
+			t.Run("Then a bad request is returned", func(t *testing.T) {
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/fish-groups/1/split", strings.NewReader(`{"individuals": [{"name": "Sunny"}, {"name": " "}]}`)))
+
+				assert.Equal(t, http.StatusBadRequest, rec.Code)
+			})
+		})
+		t.Run("When the group doesn't contain enough fish", func(t *testing.T) {
+			t.Run("Then a conflict is returned", func(t *testing.T) {
+				im.err = &db.ErrConflict{}
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/fish-groups/1/split", strings.NewReader(`{"individuals": [{"name": "Sunny"}]}`)))
+
+				assert.Equal(t, http.StatusConflict, rec.Code)
+			})
+		})
+		t.Run("When no error is returned", func(t *testing.T) {
+			t.Run("Then the individuals are returned", func(t *testing.T) {
+				im.err = nil
+				birthDate := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+				im.splitFishResponse = []db.Individual{{Fish: db.Fish{ID: 5, Count: 1, Gender: "MALE"}, Name: "Sunny", BirthDate: &birthDate}}
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/fish-groups/1/split", strings.NewReader(`{"individuals": [{"name": "Sunny", "gender": "male", "birthDate": "2021-03-01"}, {"name": "Lemon"}]}`)))
+
+				assert.Equal(t, http.StatusCreated, rec.Code)
+				assert.Equal(t, int32(1), im.groupID)
+				assert.Len(t, im.splitFishRequest, 2)
+				assert.Equal(t, "MALE", im.splitFishRequest[0].Fish.Gender)
+				assert.Equal(t, "", im.splitFishRequest[1].Fish.Gender)
+				assert.Equal(t, birthDate, *im.splitFishRequest[0].BirthDate)
+
+				var rsp struct{ Individuals []individualResponse }
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(&rsp))
+				assert.Len(t, rsp.Individuals, 1)
+				assert.Equal(t, int32(5), rsp.Individuals[0].ID)
+				assert.Equal(t, "Sunny", rsp.Individuals[0].Name)
+				assert.Equal(t, "2021-03-01", rsp.Individuals[0].BirthDate)
+			})
+		})
+	})
+}
+
+func TestMergeFish(t *testing.T) {
+	im := &individualMock{}
+	s := Server{individualModifier: im}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	t.Run("Given a request to merge individuals into a group", func(t *testing.T) {
+		t.Run("When an individual is duplicated", func(t *testing.T) {
+			t.Run("Then a bad request is returned", func(t *testing.T) {
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/fish-groups/1/merge", strings.NewReader(`{"fishIds": [5, 5]}`)))
+
+				assert.Equal(t, http.StatusBadRequest, rec.Code)
+			})
+		})
+		t.Run("When the group is one of the individuals", func(t *testing.T) {
+			t.Run("Then a bad request is returned", func(t *testing.T) {
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/fish-groups/1/merge", strings.NewReader(`{"fishIds": [1, 5]}`)))
+
+				assert.Equal(t, http.StatusBadRequest, rec.Code)
+			})
+		})
+		t.Run("When no error is returned", func(t *testing.T) {
+			t.Run("Then the group is returned", func(t *testing.T) {
+				im.mergeFishResponse = db.Fish{ID: 1, Count: 3}
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/fish-groups/1/merge", strings.NewReader(`{"fishIds": [5, 6]}`)))
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Equal(t, []int32{5, 6}, im.mergeFishRequest)
+
+				var rsp fishResponse
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(&rsp))
+				assert.Equal(t, int32(3), rsp.Count)
+			})
+		})
+	})
+}
+
+func TestAddMeasurement(t *testing.T) {
+	mm := &measurementMock{}
+	s := Server{measurementModifier: mm, fishQuerier: fishMock{}}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	t.Run("Given a request to add a measurement", func(t *testing.T) {
+		t.Run("When neither length nor weight are provided", func(t *testing.T) {
+			t.Run("Then a bad request is returned", func(t *testing.T) {
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/measurements", strings.NewReader(`{"fishId": 5}`)))
+
+				assert.Equal(t, http.StatusBadRequest, rec.Code)
+			})
+		})
+		t.Run("When the length is negative", func(t *testing.T) {
+			t.Run("Then a bad request is returned", func(t *testing.T) {
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/measurements", strings.NewReader(`{"fishId": 5, "lengthCm": -1}`)))
+
+				assert.Equal(t, http.StatusBadRequest, rec.Code)
+			})
+		})
+		t.Run("When no error is returned", func(t *testing.T) {
+			t.Run("Then the measurement is returned", func(t *testing.T) {
+				mm.insertMeasurementResponse = db.Measurement{ID: 2, FishID: 5}
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/measurements", strings.NewReader(`{"fishId": 5, "lengthCm": 6.5, "measuredAt": "2021-08-01"}`)))
+
+				assert.Equal(t, http.StatusCreated, rec.Code)
+				assert.Equal(t, float32(6.5), *mm.insertMeasurementRequest.LengthCm)
+				assert.Nil(t, mm.insertMeasurementRequest.WeightG)
+			})
+		})
+	})
+}
+
+type individualMock struct {
+	insertIndividualRequest  db.Individual
+	insertIndividualResponse db.Individual
+	getIndividualResponse    db.Individual
+	listIndividualsResponse  []db.Individual
+	updateIndividualRequest  db.Individual
+	groupID                  int32
+	splitFishRequest         []db.Individual
+	splitFishResponse        []db.Individual
+	mergeFishRequest         []int32
+	mergeFishResponse        db.Fish
+	err                      error
+}
+
+func (m *individualMock) InsertIndividual(ctx context.Context, req db.Individual) (db.Individual, error) {
+	m.insertIndividualRequest = req
+
+	return m.insertIndividualResponse, m.err
+}
+
+func (m *individualMock) GetIndividual(context.Context, int32) (db.Individual, error) {
+	return m.getIndividualResponse, m.err
+}
+
+func (m *individualMock) ListIndividuals(context.Context, db.IndividualFilter) ([]db.Individual, error) {
+	return m.listIndividualsResponse, m.err
+}
+
+func (m *individualMock) UpdateIndividual(ctx context.Context, req db.Individual) (db.Individual, error) {
+	m.updateIndividualRequest = req
+
+	return m.getIndividualResponse, m.err
+}
+
+func (m *individualMock) SplitFish(ctx context.Context, groupID int32, req []db.Individual) ([]db.Individual, error) {
+	m.groupID, m.splitFishRequest = groupID, req
+
+	return m.splitFishResponse, m.err
+}
+
+func (m *individualMock) MergeFish(ctx context.Context, groupID int32, req []int32) (db.Fish, error) {
+	m.groupID, m.mergeFishRequest = groupID, req
+
+	return m.mergeFishResponse, m.err
+}
+
+type measurementMock struct {
+	insertMeasurementRequest  db.Measurement
+	insertMeasurementResponse db.Measurement
+	listMeasurementsResponse  []db.Measurement
+	err                       error
+}
+
+func (m *measurementMock) InsertMeasurement(ctx context.Context, req db.Measurement) (db.Measurement, error) {
+	m.insertMeasurementRequest = req
+
+	return m.insertMeasurementResponse, m.err
+}
+
+func (m *measurementMock) ListMeasurements(context.Context, int32) ([]db.Measurement, error) {
+	return m.listMeasurementsResponse, m.err
+}
+
+func (m *measurementMock) DeleteMeasurement(context.Context, int32) (db.Measurement, error) {
+	return m.insertMeasurementResponse, m.err
+}
@@ -0,0 +1,257 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+// defaultSearchLimit and maxSearchLimit bound the number of hits returned by SearchNotes
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// journalCategories are the accepted values for a journal entry's category
+var journalCategories = map[string]bool{
+	"OBSERVATION": true,
+	"TREATMENT":   true,
+	"RESCAPE":     true,
+	"MAINTENANCE": true,
+	"OTHER":       true,
+}
+
+type journalQuerier interface {
+	ListJournalEntries(context.Context, db.JournalFilter) ([]db.JournalEntry, error)
+	SearchNotes(context.Context, string, db.JournalFilter, int32) ([]db.NoteHit, error)
+}
+
+type journalModifier interface {
+	InsertJournalEntry(context.Context, db.JournalEntry) (db.JournalEntry, error)
+	DeleteJournalEntry(context.Context, int32) (db.JournalEntry, error)
+}
+
+type journalEntryRequest struct {
+	TankID    *int32 `json:"tankId"`
+	FishID    *int32 `json:"fishId"`
+	EntryDate string `json:"entryDate"`
+	Category  string `json:"category"`
+	Title     string `json:"title"`
+	Body      string `json:"body"`
+}
+
+type journalEntryResponse struct {
+	ID        int32     `json:"id"`
+	TankID    *int32    `json:"tankId,omitempty"`
+	FishID    *int32    `json:"fishId,omitempty"`
+	EntryDate time.Time `json:"entryDate"`
+	Category  string    `json:"category"`
+	Title     string    `json:"title"`
+	Body      string    `json:"body"`
+}
+
+type noteHitResponse struct {
+	Entry   journalEntryResponse `json:"entry"`
+	Rank    float32              `json:"rank"`
+	Snippet string               `json:"snippet"`
+}
+
+func toJournalEntryResponse(j db.JournalEntry) journalEntryResponse {
+	return journalEntryResponse{
+		ID:        j.ID,
+		TankID:    j.TankID,
+		FishID:    j.FishID,
+		EntryDate: j.EntryDate,
+		Category:  j.Category,
+		Title:     j.Title,
+		Body:      j.Body,
+	}
+}
+
+// handleJournal serves /api/v1alpha1/journal
+//
+// GET lists journal entries, newest first, optionally filtered by the tankId or fishId
+// query parameters. POST adds a new journal entry.
+func (s *Server) handleJournal(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.listJournalEntries(w, r)
+	case http.MethodPost:
+		s.addJournalEntry(w, r)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// handleJournalEntry serves /api/v1alpha1/journal/{id}
+func (s *Server) handleJournalEntry(w http.ResponseWriter, r *http.Request) {
+	id, rest, err := pathID(r.URL.Path, "/api/v1alpha1/journal/")
+	if err != nil || rest != "" {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	if r.Method != http.MethodDelete {
+		methodNotAllowed(w, http.MethodDelete)
+		return
+	}
+
+	rsp, err := s.journalModifier.DeleteJournalEntry(r.Context(), id)
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to delete journal entry"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, toJournalEntryResponse(rsp))
+}
+
+// handleSearchNotes serves /api/v1alpha1/notes/search, the HTTP equivalent of a SearchNotes RPC
+//
+// The q query parameter is required. Results can be restricted with tankId or fishId and
+// the number of hits controlled with limit.
+func (s *Server) handleSearchNotes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		writeError(w, http.StatusBadRequest, errors.New("q must be provided"))
+		return
+	}
+
+	filter, err := journalFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	limit, err := optionalInt32(r, "limit")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	l := int32(defaultSearchLimit)
+	if limit != nil && *limit > 0 {
+		l = *limit
+	}
+
+	if l > maxSearchLimit {
+		l = maxSearchLimit
+	}
+
+	rsp, err := s.journalQuerier.SearchNotes(r.Context(), q, filter, l)
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to search notes"))
+		return
+	}
+
+	hits := make([]noteHitResponse, len(rsp))
+	for i, h := range rsp {
+		hits[i] = noteHitResponse{
+			Entry:   toJournalEntryResponse(h.Entry),
+			Rank:    h.Rank,
+			Snippet: h.Snippet,
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"hits": hits})
+}
+
+func (s *Server) listJournalEntries(w http.ResponseWriter, r *http.Request) {
+	filter, err := journalFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	rsp, err := s.journalQuerier.ListJournalEntries(r.Context(), filter)
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to list journal entries"))
+		return
+	}
+
+	entries := make([]journalEntryResponse, len(rsp))
+	for i, j := range rsp {
+		entries[i] = toJournalEntryResponse(j)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"entries": entries})
+}
+
+func (s *Server) addJournalEntry(w http.ResponseWriter, r *http.Request) {
+	var req journalEntryRequest
+	if err := readJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if (req.TankID == nil) == (req.FishID == nil) {
+		writeError(w, http.StatusBadRequest, errors.New("exactly one of tankId or fishId must be provided"))
+		return
+	}
+
+	entryDate, err := parseDate(req.EntryDate, time.Now())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	category := strings.ToUpper(req.Category)
+	if category == "" {
+		category = "OBSERVATION"
+	}
+
+	if !journalCategories[category] {
+		writeError(w, http.StatusBadRequest, errors.Errorf("invalid category %q", req.Category))
+		return
+	}
+
+	if strings.TrimSpace(req.Title) == "" && strings.TrimSpace(req.Body) == "" {
+		writeError(w, http.StatusBadRequest, errors.New("one of title or body must be provided"))
+		return
+	}
+
+	if err := s.checkTankOrFish(r.Context(), req.TankID, req.FishID); err != nil {
+		writeError(w, statusForError(err), err)
+		return
+	}
+
+	rsp, err := s.journalModifier.InsertJournalEntry(r.Context(), db.JournalEntry{
+		TankID:    req.TankID,
+		FishID:    req.FishID,
+		EntryDate: entryDate,
+		Category:  category,
+		Title:     req.Title,
+		Body:      req.Body,
+	})
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to add journal entry"))
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, toJournalEntryResponse(rsp))
+}
+
+func journalFilter(r *http.Request) (db.JournalFilter, error) {
+	var (
+		filter db.JournalFilter
+		err    error
+	)
+
+	if filter.TankID, err = optionalInt32(r, "tankId"); err != nil {
+		return filter, err
+	}
+
+	if filter.FishID, err = optionalInt32(r, "fishId"); err != nil {
+		return filter, err
+	}
+
+	return filter, nil
+}
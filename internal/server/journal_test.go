@@ -0,0 +1,255 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+func TestAddJournalEntry(t *testing.T) {
+	jm := &journalMock{}
+	s := Server{journalModifier: jm, tankQuerier: &tankMock{}, fishQuerier: fishMock{}}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	testCases := []struct {
+		desc         string
+		body         string
+		expectedCode int
+		expectedErr  string
+	}{
+		{
+			desc:         "Missing tankId and fishId returns bad request",
+			body:         `{"title": "Spots"}`,
+			expectedCode: http.StatusBadRequest,
+			expectedErr:  "exactly one of tankId or fishId must be provided",
+		},
+		{
+			desc:         "Invalid date returns bad request",
+			body:         `{"tankId": 1, "title": "Spots", "entryDate": "yesterday"}`,
+			expectedCode: http.StatusBadRequest,
+			expectedErr:  `invalid date \"yesterday\"`,
+		},
+		{
+			desc:         "Invalid category returns bad request",
+			body:         `{"tankId": 1, "title": "Spots", "category": "party"}`,
+			expectedCode: http.StatusBadRequest,
+			expectedErr:  `invalid category \"party\"`,
+		},
+		{
+			desc:         "Empty title and body returns bad request",
+			body:         `{"tankId": 1}`,
+			expectedCode: http.StatusBadRequest,
+			expectedErr:  "one of title or body must be provided",
+		},
+		{
+			desc:         "Unknown fields return bad request",
+			body:         `{"tankId": 1, "title": "Spots", "colour": "red"}`,
+			expectedCode: http.StatusBadRequest,
+			expectedErr:  "invalid request body",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/journal", strings.NewReader(tC.body)))
+
+			assert.Equal(t, tC.expectedCode, rec.Code)
+			assert.Contains(t, rec.Body.String(), tC.expectedErr)
+		})
+	}
+
+	t.Run("Given a valid request to add a journal entry", func(t *testing.T) {
+		body := `{"fishId": 2, "entryDate": "2021-08-01", "category": "treatment", "title": "Ich", "body": "Started treatment"}`
+
+		t.Run("When the fish isn't visible to the household", func(t *testing.T) {
+			t.Run("Then not found is returned", func(t *testing.T) {
+				foreign := Server{journalModifier: jm, fishQuerier: fishMock{err: &db.ErrNotFound{}}}
+
+				rec := httptest.NewRecorder()
+				foreign.handleJournal(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/journal", strings.NewReader(body)))
+
+				assert.Equal(t, http.StatusNotFound, rec.Code)
+				assert.Contains(t, rec.Body.String(), "unable to get fish 2")
+			})
+		})
+		t.Run("When an error is returned", func(t *testing.T) {
+			t.Run("Then the error is returned to the caller", func(t *testing.T) {
+				jm.err = errors.New("an error")
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/journal", strings.NewReader(body)))
+
+				assert.Equal(t, http.StatusInternalServerError, rec.Code)
+				assert.Contains(t, rec.Body.String(), "unable to add journal entry: an error")
+			})
+		})
+		t.Run("When no error is returned", func(t *testing.T) {
+			t.Run("Then the entry is returned to the caller", func(t *testing.T) {
+				jm.err = nil
+				jm.insertJournalEntryResponse = db.JournalEntry{ID: 7, FishID: &[]int32{2}[0], Category: "TREATMENT", Title: "Ich"}
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/journal", strings.NewReader(body)))
+
+				assert.Equal(t, http.StatusCreated, rec.Code)
+
+				assert.Equal(t, int32(2), *jm.insertJournalEntryRequest.FishID)
+				assert.Equal(t, "TREATMENT", jm.insertJournalEntryRequest.Category)
+				assert.Equal(t, time.Date(2021, 8, 1, 0, 0, 0, 0, time.UTC), jm.insertJournalEntryRequest.EntryDate)
+
+				var rsp journalEntryResponse
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(&rsp))
+				assert.Equal(t, int32(7), rsp.ID)
+			})
+		})
+	})
+}
+
+func TestListJournalEntries(t *testing.T) {
+	jm := &journalMock{}
+	s := Server{journalQuerier: jm}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	t.Run("Given a request to list journal entries", func(t *testing.T) {
+		t.Run("When no error is returned", func(t *testing.T) {
+			t.Run("Then the entries are returned to the caller", func(t *testing.T) {
+				jm.listJournalEntriesResponse = []db.JournalEntry{{ID: 1}, {ID: 2}}
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1alpha1/journal?tankId=3", nil))
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Equal(t, int32(3), *jm.filter.TankID)
+
+				var rsp struct{ Entries []journalEntryResponse }
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(&rsp))
+				assert.Len(t, rsp.Entries, 2)
+			})
+		})
+	})
+}
+
+func TestDeleteJournalEntry(t *testing.T) {
+	jm := &journalMock{}
+	s := Server{journalModifier: jm}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	t.Run("Given a request to delete a journal entry", func(t *testing.T) {
+		t.Run("When the entry doesn't exist", func(t *testing.T) {
+			t.Run("Then not found is returned", func(t *testing.T) {
+				jm.err = &db.ErrNotFound{}
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/v1alpha1/journal/4", nil))
+
+				assert.Equal(t, http.StatusNotFound, rec.Code)
+			})
+		})
+		t.Run("When no error is returned", func(t *testing.T) {
+			t.Run("Then the deleted entry is returned", func(t *testing.T) {
+				jm.err = nil
+				jm.deleteJournalEntryResponse = db.JournalEntry{ID: 4}
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/v1alpha1/journal/4", nil))
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Contains(t, rec.Body.String(), `"id":4`)
+			})
+		})
+	})
+}
+
+func TestSearchNotes(t *testing.T) {
+	jm := &journalMock{}
+	s := Server{journalQuerier: jm}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	t.Run("Given a request to search notes", func(t *testing.T) {
+		t.Run("When no query is provided", func(t *testing.T) {
+			t.Run("Then a bad request is returned", func(t *testing.T) {
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1alpha1/notes/search?q=+", nil))
+
+				assert.Equal(t, http.StatusBadRequest, rec.Code)
+			})
+		})
+		t.Run("When the limit is too large", func(t *testing.T) {
+			t.Run("Then it is capped", func(t *testing.T) {
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1alpha1/notes/search?q=ich&limit=5000", nil))
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Equal(t, int32(maxSearchLimit), jm.limit)
+			})
+		})
+		t.Run("When no error is returned", func(t *testing.T) {
+			t.Run("Then the hits are returned to the caller", func(t *testing.T) {
+				jm.searchNotesResponse = []db.NoteHit{{Entry: db.JournalEntry{ID: 1}, Rank: 0.5, Snippet: "<mark>ich</mark>"}}
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1alpha1/notes/search?q=ich&fishId=2", nil))
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Equal(t, "ich", jm.query)
+				assert.Equal(t, int32(2), *jm.filter.FishID)
+				assert.Equal(t, int32(defaultSearchLimit), jm.limit)
+
+				var rsp struct{ Hits []noteHitResponse }
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(&rsp))
+				assert.Len(t, rsp.Hits, 1)
+				assert.Equal(t, "<mark>ich</mark>", rsp.Hits[0].Snippet)
+			})
+		})
+	})
+}
+
+type journalMock struct {
+	insertJournalEntryRequest  db.JournalEntry
+	insertJournalEntryResponse db.JournalEntry
+	deleteJournalEntryResponse db.JournalEntry
+	listJournalEntriesResponse []db.JournalEntry
+	searchNotesResponse        []db.NoteHit
+	query                      string
+	filter                     db.JournalFilter
+	limit                      int32
+	err                        error
+}
+
+func (j *journalMock) InsertJournalEntry(ctx context.Context, req db.JournalEntry) (db.JournalEntry, error) {
+	j.insertJournalEntryRequest = req
+
+	return j.insertJournalEntryResponse, j.err
+}
+
+func (j *journalMock) DeleteJournalEntry(context.Context, int32) (db.JournalEntry, error) {
+	return j.deleteJournalEntryResponse, j.err
+}
+
+func (j *journalMock) ListJournalEntries(ctx context.Context, filter db.JournalFilter) ([]db.JournalEntry, error) {
+	j.filter = filter
+
+	return j.listJournalEntriesResponse, j.err
+}
+
+func (j *journalMock) SearchNotes(ctx context.Context, query string, filter db.JournalFilter, limit int32) ([]db.NoteHit, error) {
+	j.query, j.filter, j.limit = query, filter, limit
+
+	return j.searchNotesResponse, j.err
+}
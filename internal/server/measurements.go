@@ -0,0 +1,158 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+type measurementQuerier interface {
+	ListMeasurements(context.Context, int32) ([]db.Measurement, error)
+}
+
+type measurementModifier interface {
+	InsertMeasurement(context.Context, db.Measurement) (db.Measurement, error)
+	DeleteMeasurement(context.Context, int32) (db.Measurement, error)
+}
+
+type measurementRequest struct {
+	FishID     int32    `json:"fishId"`
+	MeasuredAt string   `json:"measuredAt"`
+	LengthCm   *float32 `json:"lengthCm"`
+	WeightG    *float32 `json:"weightG"`
+	Notes      string   `json:"notes"`
+}
+
+type measurementResponse struct {
+	ID         int32     `json:"id"`
+	FishID     int32     `json:"fishId"`
+	MeasuredAt time.Time `json:"measuredAt"`
+	LengthCm   *float32  `json:"lengthCm,omitempty"`
+	WeightG    *float32  `json:"weightG,omitempty"`
+	Notes      string    `json:"notes"`
+}
+
+func toMeasurementResponse(m db.Measurement) measurementResponse {
+	return measurementResponse{
+		ID:         m.ID,
+		FishID:     m.FishID,
+		MeasuredAt: m.MeasuredAt,
+		LengthCm:   m.LengthCm,
+		WeightG:    m.WeightG,
+		Notes:      m.Notes,
+	}
+}
+
+// handleMeasurements serves /api/v1alpha1/measurements
+//
+// GET lists the measurements of the fish given by fishId, oldest first. POST records a
+// measurement of a fish.
+func (s *Server) handleMeasurements(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.listMeasurements(w, r)
+	case http.MethodPost:
+		s.addMeasurement(w, r)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// handleMeasurement serves /api/v1alpha1/measurements/{id}, where DELETE removes the measurement
+func (s *Server) handleMeasurement(w http.ResponseWriter, r *http.Request) {
+	id, rest, err := pathID(r.URL.Path, "/api/v1alpha1/measurements/")
+	if err != nil || rest != "" {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	if r.Method != http.MethodDelete {
+		methodNotAllowed(w, http.MethodDelete)
+		return
+	}
+
+	rsp, err := s.measurementModifier.DeleteMeasurement(r.Context(), id)
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to delete measurement"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, toMeasurementResponse(rsp))
+}
+
+func (s *Server) listMeasurements(w http.ResponseWriter, r *http.Request) {
+	fishID, err := optionalInt32(r, "fishId")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if fishID == nil {
+		writeError(w, http.StatusBadRequest, errors.New("fishId must be provided"))
+		return
+	}
+
+	rsp, err := s.measurementQuerier.ListMeasurements(r.Context(), *fishID)
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to list measurements"))
+		return
+	}
+
+	measurements := make([]measurementResponse, len(rsp))
+	for i, m := range rsp {
+		measurements[i] = toMeasurementResponse(m)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"measurements": measurements})
+}
+
+func (s *Server) addMeasurement(w http.ResponseWriter, r *http.Request) {
+	var req measurementRequest
+	if err := readJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if req.FishID == 0 {
+		writeError(w, http.StatusBadRequest, errors.New("fishId must be provided"))
+		return
+	}
+
+	if req.LengthCm == nil && req.WeightG == nil {
+		writeError(w, http.StatusBadRequest, errors.New("lengthCm or weightG must be provided"))
+		return
+	}
+
+	if (req.LengthCm != nil && *req.LengthCm <= 0) || (req.WeightG != nil && *req.WeightG <= 0) {
+		writeError(w, http.StatusBadRequest, errors.New("measurements must be greater than zero"))
+		return
+	}
+
+	measuredAt, err := parseDate(req.MeasuredAt, time.Now())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := s.checkFish(r.Context(), req.FishID); err != nil {
+		writeError(w, statusForError(err), err)
+		return
+	}
+
+	rsp, err := s.measurementModifier.InsertMeasurement(r.Context(), db.Measurement{
+		FishID:     req.FishID,
+		MeasuredAt: measuredAt,
+		LengthCm:   req.LengthCm,
+		WeightG:    req.WeightG,
+		Notes:      req.Notes,
+	})
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to add measurement"))
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, toMeasurementResponse(rsp))
+}
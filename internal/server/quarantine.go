@@ -0,0 +1,233 @@
+package server
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+// defaultQuarantineDays is used when a quarantine is started without a length
+const defaultQuarantineDays = 28
+
+type quarantineQuerier interface {
+	GetQuarantine(context.Context, int32) (db.Quarantine, error)
+	ListQuarantines(context.Context, bool) ([]db.Quarantine, error)
+}
+
+type quarantineModifier interface {
+	StartQuarantine(context.Context, db.Quarantine) (db.Quarantine, error)
+	ReleaseQuarantine(context.Context, int32, time.Time) (db.Quarantine, error)
+}
+
+type quarantineRequest struct {
+	FishID           int32  `json:"fishId"`
+	QuarantineTankID int32  `json:"quarantineTankId"`
+	TargetTankID     int32  `json:"targetTankId"`
+	StartDate        string `json:"startDate"`
+	Days             int32  `json:"days"`
+	Notes            string `json:"notes"`
+}
+
+type releaseQuarantineRequest struct {
+	ReleasedAt string `json:"releasedAt"`
+}
+
+type quarantineFishResponse struct {
+	ID      int32  `json:"id"`
+	Type    string `json:"type"`
+	Subtype string `json:"subtype"`
+	Count   int32  `json:"count"`
+}
+
+type quarantineResponse struct {
+	ID               int32                  `json:"id"`
+	Fish             quarantineFishResponse `json:"fish"`
+	QuarantineTankID int32                  `json:"quarantineTankId"`
+	TargetTankID     int32                  `json:"targetTankId"`
+	StartDate        time.Time              `json:"startDate"`
+	EndDate          time.Time              `json:"endDate"`
+	Days             int32                  `json:"days"`
+	// DaysRemaining is the number of days until the planned end, zero once it has passed
+	DaysRemaining int32      `json:"daysRemaining"`
+	ReleasedAt    *time.Time `json:"releasedAt,omitempty"`
+	Notes         string     `json:"notes"`
+}
+
+func toQuarantineResponse(q db.Quarantine, now time.Time) quarantineResponse {
+	rsp := quarantineResponse{
+		ID: q.ID,
+		Fish: quarantineFishResponse{
+			ID:      q.Fish.ID,
+			Type:    q.Fish.Type,
+			Subtype: q.Fish.Subtype,
+			Count:   q.Fish.Count,
+		},
+		QuarantineTankID: q.QuarantineTankID,
+		TargetTankID:     q.TargetTankID,
+		StartDate:        q.StartDate,
+		EndDate:          q.EndDate(),
+		Days:             q.Days,
+		ReleasedAt:       q.ReleasedAt,
+		Notes:            q.Notes,
+	}
+
+	if q.ReleasedAt == nil {
+		rsp.DaysRemaining = daysRemaining(q.EndDate(), now)
+	}
+
+	return rsp
+}
+
+// daysRemaining returns the number of whole or part days from now until end
+func daysRemaining(end, now time.Time) int32 {
+	d := end.Sub(now)
+	if d <= 0 {
+		return 0
+	}
+
+	return int32(math.Ceil(d.Hours() / 24))
+}
+
+// handleQuarantines serves /api/v1alpha1/quarantines
+//
+// GET lists quarantines, with active=true restricting them to fish currently in quarantine.
+// POST starts a new quarantine, moving the fish into the quarantine tank.
+func (s *Server) handleQuarantines(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.listQuarantines(w, r)
+	case http.MethodPost:
+		s.startQuarantine(w, r)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// handleQuarantine serves /api/v1alpha1/quarantines/{id} and /api/v1alpha1/quarantines/{id}/release
+func (s *Server) handleQuarantine(w http.ResponseWriter, r *http.Request) {
+	id, rest, err := pathID(r.URL.Path, "/api/v1alpha1/quarantines/")
+	if err != nil {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	switch {
+	case rest == "" && r.Method == http.MethodGet:
+		rsp, err := s.quarantineQuerier.GetQuarantine(r.Context(), id)
+		if err != nil {
+			writeError(w, statusForError(err), errors.Wrap(err, "unable to get quarantine"))
+			return
+		}
+
+		writeJSON(w, http.StatusOK, toQuarantineResponse(rsp, time.Now()))
+	case rest == "release" && r.Method == http.MethodPost:
+		s.releaseQuarantine(w, r, id)
+	default:
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+func (s *Server) listQuarantines(w http.ResponseWriter, r *http.Request) {
+	rsp, err := s.quarantineQuerier.ListQuarantines(r.Context(), r.URL.Query().Get("active") == "true")
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to list quarantines"))
+		return
+	}
+
+	now := time.Now()
+
+	quarantines := make([]quarantineResponse, len(rsp))
+	for i, q := range rsp {
+		quarantines[i] = toQuarantineResponse(q, now)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"quarantines": quarantines})
+}
+
+func (s *Server) startQuarantine(w http.ResponseWriter, r *http.Request) {
+	var req quarantineRequest
+	if err := readJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if req.FishID == 0 || req.QuarantineTankID == 0 || req.TargetTankID == 0 {
+		writeError(w, http.StatusBadRequest, errors.New("fishId, quarantineTankId and targetTankId must be provided"))
+		return
+	}
+
+	if req.QuarantineTankID == req.TargetTankID {
+		writeError(w, http.StatusBadRequest, errors.New("quarantineTankId and targetTankId must be different"))
+		return
+	}
+
+	if req.Days < 0 {
+		writeError(w, http.StatusBadRequest, errors.New("days must not be negative"))
+		return
+	}
+
+	if req.Days == 0 {
+		req.Days = defaultQuarantineDays
+	}
+
+	startDate, err := parseDate(req.StartDate, time.Now())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// the fish is moved to the quarantine tank now and to the target tank on release
+	for _, check := range []error{
+		s.checkFish(r.Context(), req.FishID),
+		s.checkTank(r.Context(), req.QuarantineTankID),
+		s.checkTank(r.Context(), req.TargetTankID),
+	} {
+		if check != nil {
+			writeError(w, statusForError(check), check)
+			return
+		}
+	}
+
+	rsp, err := s.quarantineModifier.StartQuarantine(r.Context(), db.Quarantine{
+		FishID:           req.FishID,
+		QuarantineTankID: req.QuarantineTankID,
+		TargetTankID:     req.TargetTankID,
+		StartDate:        startDate,
+		Days:             req.Days,
+		Notes:            req.Notes,
+	})
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to start quarantine"))
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, toQuarantineResponse(rsp, time.Now()))
+}
+
+func (s *Server) releaseQuarantine(w http.ResponseWriter, r *http.Request, id int32) {
+	var req releaseQuarantineRequest
+	if r.ContentLength != 0 {
+		if err := readJSON(w, r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	releasedAt, err := parseDate(req.ReleasedAt, time.Now())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	rsp, err := s.quarantineModifier.ReleaseQuarantine(r.Context(), id, releasedAt)
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to release quarantine"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, toQuarantineResponse(rsp, time.Now()))
+}
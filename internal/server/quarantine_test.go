@@ -0,0 +1,242 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+func TestDaysRemaining(t *testing.T) {
+	now := time.Date(2021, 8, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		desc     string
+		end      time.Time
+		expected int32
+	}{
+		{desc: "End in the past returns zero", end: now.Add(-time.Hour), expected: 0},
+		{desc: "End now returns zero", end: now, expected: 0},
+		{desc: "Part days are rounded up", end: now.Add(time.Hour), expected: 1},
+		{desc: "Whole days are exact", end: now.AddDate(0, 0, 14), expected: 14},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			assert.Equal(t, tC.expected, daysRemaining(tC.end, now))
+		})
+	}
+}
+
+func TestStartQuarantine(t *testing.T) {
+	qm := &quarantineMock{}
+	tm := &tankMock{}
+	s := Server{quarantineModifier: qm, tankQuerier: tm, fishQuerier: fishMock{}}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	t.Run("Given a request to start a quarantine", func(t *testing.T) {
+		t.Run("When a tank isn't visible to the household", func(t *testing.T) {
+			t.Run("Then not found is returned", func(t *testing.T) {
+				tm.err = &db.ErrNotFound{}
+				defer func() { tm.err = nil }()
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/quarantines", strings.NewReader(`{"fishId": 1, "quarantineTankId": 2, "targetTankId": 9}`)))
+
+				assert.Equal(t, http.StatusNotFound, rec.Code)
+				assert.Zero(t, qm.startQuarantineRequest.FishID)
+			})
+		})
+		t.Run("When the target and quarantine tanks are the same", func(t *testing.T) {
+			t.Run("Then a bad request is returned", func(t *testing.T) {
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/quarantines", strings.NewReader(`{"fishId": 1, "quarantineTankId": 2, "targetTankId": 2}`)))
+
+				assert.Equal(t, http.StatusBadRequest, rec.Code)
+			})
+		})
+		t.Run("When the tank isn't a quarantine tank", func(t *testing.T) {
+			t.Run("Then a conflict is returned", func(t *testing.T) {
+				qm.err = &db.ErrConflict{}
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/quarantines", strings.NewReader(`{"fishId": 1, "quarantineTankId": 2, "targetTankId": 3}`)))
+
+				assert.Equal(t, http.StatusConflict, rec.Code)
+			})
+		})
+		t.Run("When no error is returned", func(t *testing.T) {
+			t.Run("Then the quarantine is returned with the default length", func(t *testing.T) {
+				qm.err = nil
+				qm.startQuarantineResponse = db.Quarantine{ID: 4, FishID: 1, StartDate: time.Now(), Days: defaultQuarantineDays}
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/quarantines", strings.NewReader(`{"fishId": 1, "quarantineTankId": 2, "targetTankId": 3}`)))
+
+				assert.Equal(t, http.StatusCreated, rec.Code)
+				assert.Equal(t, int32(defaultQuarantineDays), qm.startQuarantineRequest.Days)
+
+				var rsp quarantineResponse
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(&rsp))
+				assert.Equal(t, int32(4), rsp.ID)
+				assert.Equal(t, int32(defaultQuarantineDays), rsp.DaysRemaining)
+			})
+		})
+	})
+}
+
+func TestListQuarantines(t *testing.T) {
+	qm := &quarantineMock{}
+	s := Server{quarantineQuerier: qm}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	t.Run("Given a request to list fish in quarantine", func(t *testing.T) {
+		t.Run("When no error is returned", func(t *testing.T) {
+			t.Run("Then the quarantines are returned with the days remaining", func(t *testing.T) {
+				released := time.Now()
+				qm.listQuarantinesResponse = []db.Quarantine{
+					{ID: 1, StartDate: time.Now().AddDate(0, 0, -7), Days: 10},
+					{ID: 2, StartDate: time.Now().AddDate(0, 0, -30), Days: 28, ReleasedAt: &released},
+				}
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1alpha1/quarantines?active=true", nil))
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.True(t, qm.activeOnly)
+
+				var rsp struct{ Quarantines []quarantineResponse }
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(&rsp))
+				assert.Len(t, rsp.Quarantines, 2)
+				assert.Equal(t, int32(3), rsp.Quarantines[0].DaysRemaining)
+				assert.Equal(t, int32(0), rsp.Quarantines[1].DaysRemaining)
+			})
+		})
+	})
+}
+
+func TestReleaseQuarantine(t *testing.T) {
+	qm := &quarantineMock{}
+	s := Server{quarantineModifier: qm}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	t.Run("Given a request to release a quarantine", func(t *testing.T) {
+		t.Run("When it has already been released", func(t *testing.T) {
+			t.Run("Then a conflict is returned", func(t *testing.T) {
+				qm.err = &db.ErrConflict{}
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/quarantines/4/release", nil))
+
+				assert.Equal(t, http.StatusConflict, rec.Code)
+			})
+		})
+		t.Run("When no error is returned", func(t *testing.T) {
+			t.Run("Then the released quarantine is returned", func(t *testing.T) {
+				qm.err = nil
+				releasedAt := time.Date(2021, 8, 29, 0, 0, 0, 0, time.UTC)
+				qm.releaseQuarantineResponse = db.Quarantine{ID: 4, ReleasedAt: &releasedAt}
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/quarantines/4/release", strings.NewReader(`{"releasedAt": "2021-08-29"}`)))
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Equal(t, int32(4), qm.releaseQuarantineID)
+				assert.Equal(t, releasedAt, qm.releasedAt)
+			})
+		})
+	})
+}
+
+func TestSetTankRole(t *testing.T) {
+	tm := &tankRoleMock{}
+	am := &auditMock{}
+	s := Server{tankRoleModifier: tm, tankQuerier: &tankMock{getTankResponse: db.Tank{ID: 1, Role: db.TankRoleDisplay}}, auditModifier: am}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	t.Run("Given a request to set a tank's role", func(t *testing.T) {
+		t.Run("When the role is invalid", func(t *testing.T) {
+			t.Run("Then a bad request is returned", func(t *testing.T) {
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/api/v1alpha1/tank-roles/1", strings.NewReader(`{"role": "sump"}`)))
+
+				assert.Equal(t, http.StatusBadRequest, rec.Code)
+			})
+		})
+		t.Run("When no error is returned", func(t *testing.T) {
+			t.Run("Then the role is returned and the change is audited", func(t *testing.T) {
+				tm.setTankRoleResponse = db.Tank{ID: 1, Role: db.TankRoleQuarantine}
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/api/v1alpha1/tank-roles/1", strings.NewReader(`{"role": "quarantine"}`)))
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Equal(t, db.TankRoleQuarantine, tm.role)
+				assert.JSONEq(t, `{"tankId": 1, "role": "QUARANTINE"}`, rec.Body.String())
+
+				assert.Len(t, am.events, 1)
+				assert.JSONEq(t, `{"tankId": 1, "role": "DISPLAY"}`, string(am.events[0].Before))
+				assert.JSONEq(t, `{"tankId": 1, "role": "QUARANTINE"}`, string(am.events[0].After))
+			})
+		})
+	})
+}
+
+type quarantineMock struct {
+	startQuarantineRequest    db.Quarantine
+	startQuarantineResponse   db.Quarantine
+	getQuarantineResponse     db.Quarantine
+	activeOnly                bool
+	listQuarantinesResponse   []db.Quarantine
+	releaseQuarantineID       int32
+	releasedAt                time.Time
+	releaseQuarantineResponse db.Quarantine
+	err                       error
+}
+
+func (m *quarantineMock) StartQuarantine(ctx context.Context, req db.Quarantine) (db.Quarantine, error) {
+	m.startQuarantineRequest = req
+
+	return m.startQuarantineResponse, m.err
+}
+
+func (m *quarantineMock) GetQuarantine(context.Context, int32) (db.Quarantine, error) {
+	return m.getQuarantineResponse, m.err
+}
+
+func (m *quarantineMock) ListQuarantines(ctx context.Context, activeOnly bool) ([]db.Quarantine, error) {
+	m.activeOnly = activeOnly
+
+	return m.listQuarantinesResponse, m.err
+}
+
+func (m *quarantineMock) ReleaseQuarantine(ctx context.Context, id int32, at time.Time) (db.Quarantine, error) {
+	m.releaseQuarantineID, m.releasedAt = id, at
+
+	return m.releaseQuarantineResponse, m.err
+}
+
+type tankRoleMock struct {
+	role                string
+	setTankRoleResponse db.Tank
+	err                 error
+}
+
+func (m *tankRoleMock) SetTankRole(ctx context.Context, id int32, role string) (db.Tank, error) {
+	m.role = role
+
+	return m.setTankRoleResponse, m.err
+}
@@ -0,0 +1,599 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/trackmyfish/backend/internal/auth"
+	"github.com/trackmyfish/backend/internal/db"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	readingsPath       = "/api/v1alpha1/readings"
+	readingsStreamPath = "/api/v1alpha1/readings/stream"
+)
+
+// defaultReadingsLimit and maxReadingsLimit bound the number of readings returned by
+// ListSensorReadings
+const (
+	defaultReadingsLimit = 100
+	maxReadingsLimit     = 1000
+)
+
+// readingBatchSize is the most sensor readings written at once. Readings are written when
+// a batch is full, or every readingFlushInterval, whichever is sooner, and acknowledged
+// once they're written.
+const (
+	readingBatchSize     = 100
+	readingFlushInterval = 5 * time.Second
+)
+
+// maxReadingLineSize limits the size of each reading in a stream
+const maxReadingLineSize = 4 << 10 // 4 KiB
+
+const maxSensorIDLength = 64
+
+// sensorParameters are the parameters sensors can measure, with the range their readings
+// must be within
+var sensorParameters = map[string]struct{ min, max float64 }{
+	"ph":           {min: 0, max: 14},
+	"temperature":  {min: -10, max: 60},
+	"salinity":     {min: 0, max: 100},
+	"conductivity": {min: 0, max: 1e6},
+	"tds":          {min: 0, max: 1e6},
+	"orp":          {min: -2000, max: 2000},
+	"oxygen":       {min: 0, max: 100},
+}
+
+type sensorReadingQuerier interface {
+	ListSensorReadings(context.Context, db.SensorReadingFilter, int32) ([]db.SensorReading, error)
+	LatestSensorReadings(context.Context, time.Time) ([]db.LatestSensorReading, error)
+}
+
+type sensorReadingModifier interface {
+	InsertSensorReadings(context.Context, []db.SensorReading) (int64, error)
+}
+
+type sensorReadingJSON struct {
+	ID        int64     `json:"id,omitempty"`
+	SensorID  string    `json:"sensorId"`
+	Sequence  int64     `json:"sequence"`
+	TankID    int32     `json:"tankId"`
+	Parameter string    `json:"parameter"`
+	Value     *float64  `json:"value"`
+	ReadAt    time.Time `json:"readAt"`
+}
+
+func toSensorReadingJSON(r db.SensorReading) sensorReadingJSON {
+	value := r.Value
+
+	return sensorReadingJSON{
+		ID:        r.ID,
+		SensorID:  r.SensorID,
+		Sequence:  r.Sequence,
+		TankID:    r.TankID,
+		Parameter: r.Parameter,
+		Value:     &value,
+		ReadAt:    r.ReadAt,
+	}
+}
+
+// readingsAck acknowledges the readings of a stream which have been written since the
+// previous acknowledgement
+type readingsAck struct {
+	// Received is the number of lines read
+	Received int `json:"received"`
+	// Written is the number of readings added, and Duplicates the number which had already
+	// been added, e.g. by a stream which was interrupted
+	Written    int64 `json:"written"`
+	Duplicates int64 `json:"duplicates"`
+	// Sequences is the highest sequence of each sensor which has been written, so the
+	// readings up to it needn't be sent again
+	Sequences map[string]int64 `json:"sequences"`
+	// Errors are the readings which were rejected. They aren't written, so they shouldn't
+	// be sent again.
+	Errors []readingError `json:"errors,omitempty"`
+	// Error ends the stream early. The readings which haven't been acknowledged should be
+	// sent again.
+	Error string `json:"error,omitempty"`
+}
+
+// readingError reports why a reading was rejected. Line is the line number in the
+// stream, starting from 1.
+type readingError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// readingLine is a reading received in a stream, numbered from 1. rejected is set if the
+// reading is invalid, and err if the stream can't be read any further.
+type readingLine struct {
+	number   int
+	reading  db.SensorReading
+	rejected error
+	err      error
+}
+
+// handleReadings serves /api/v1alpha1/readings, where GET lists sensor readings, most recent
+// first, optionally filtered by tankId, parameter, sensorId, from (inclusive) and
+// to (exclusive)
+func (s *Server) handleReadings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	filter := db.SensorReadingFilter{Parameter: r.FormValue("parameter"), SensorID: r.FormValue("sensorId")}
+
+	var err error
+	if filter.TankID, err = optionalInt32(r, "tankId"); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// API keys scoped to a tank only list the readings of the tank
+	if id, ok := auth.FromContext(r.Context()); ok && id.Scope != nil && id.Scope.TankID != 0 {
+		if filter.TankID != nil && *filter.TankID != id.Scope.TankID {
+			writeError(w, http.StatusForbidden, auth.ErrForbidden)
+			return
+		}
+
+		filter.TankID = &id.Scope.TankID
+	}
+
+	if filter.From, err = optionalDate(r, "from"); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if filter.To, err = optionalDate(r, "to"); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	limit, err := optionalInt32(r, "limit")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	l := int32(defaultReadingsLimit)
+	if limit != nil && *limit > 0 {
+		l = *limit
+	}
+
+	if l > maxReadingsLimit {
+		l = maxReadingsLimit
+	}
+
+	rsp, err := s.sensorReadingQuerier.ListSensorReadings(r.Context(), filter, l)
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to list sensor readings"))
+		return
+	}
+
+	readings := make([]sensorReadingJSON, len(rsp))
+	for i, reading := range rsp {
+		readings[i] = toSensorReadingJSON(reading)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"readings": readings})
+}
+
+// handleReadingsStream serves /api/v1alpha1/readings/stream, the HTTP equivalent of the
+// StreamReadings RPC, where POST adds an unbounded stream of sensor readings, one JSON
+// object per line
+//
+// Readings are written in batches and each batch is acknowledged with a line of JSON,
+// so the response is streamed back while the readings are still being sent. Readings
+// are unique by sensor and sequence, so after reconnecting a sensor can send every
+// reading which wasn't acknowledged without duplicating those which were written.
+func (s *Server) handleReadingsStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	enableFullDuplex(w)
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flush(w)
+
+	lines := make(chan readingLine)
+	go scanReadings(r, lines)
+
+	enc := json.NewEncoder(w)
+
+	_ = s.streamReadings(r.Context(), lines, func(ack readingsAck) error {
+		if err := enc.Encode(ack); err != nil {
+			return err
+		}
+
+		flush(w)
+
+		return nil
+	})
+}
+
+// streamReadingsRPC serves the StreamReadings RPC, the gRPC equivalent of
+// /api/v1alpha1/readings/stream, where each SensorReading message of the stream adds a
+// reading and each batch is acknowledged with a ReadingsAck message. The line of a
+// rejected reading is the number of its message in the stream, starting from 1. Streams
+// which end early with an error acknowledged end with an Aborted status.
+func (s *Server) streamReadingsRPC(stream grpc.ServerStream) error {
+	lines := make(chan readingLine)
+	go receiveReadings(stream, lines)
+
+	err := s.streamReadings(stream.Context(), lines, func(ack readingsAck) error {
+		m, err := toReadingsAckMessage(ack)
+		if err != nil {
+			return err
+		}
+
+		return stream.SendMsg(m)
+	})
+
+	if ctxErr := stream.Context().Err(); ctxErr != nil {
+		return status.FromContextError(ctxErr).Err()
+	}
+
+	if err != nil {
+		return status.Error(codes.Aborted, err.Error())
+	}
+
+	return nil
+}
+
+// streamReadings writes the readings of a stream in batches, sending an acknowledgement
+// of each batch with send, until lines is closed or ctx is done. An error is returned if
+// the stream ends early, in which case the readings which weren't acknowledged have to be
+// sent again.
+func (s *Server) streamReadings(ctx context.Context, lines <-chan readingLine, send func(readingsAck) error) error {
+	ticker := time.NewTicker(readingFlushInterval)
+	defer ticker.Stop()
+
+	tanks := map[int32]bool{}
+	pending := make([]db.SensorReading, 0, readingBatchSize)
+	ack := readingsAck{Sequences: map[string]int64{}}
+
+	// write adds the pending readings and acknowledges them, returning an error if the
+	// stream has to end
+	write := func() error {
+		if len(pending) > 0 {
+			written, err := s.sensorReadingModifier.InsertSensorReadings(ctx, pending)
+			if err != nil {
+				logrus.WithError(err).Error("unable to add sensor readings")
+				ack.Error = "unable to add sensor readings"
+			} else {
+				ack.Written, ack.Duplicates = written, int64(len(pending))-written
+
+				for _, reading := range pending {
+					if reading.Sequence > ack.Sequences[reading.SensorID] {
+						ack.Sequences[reading.SensorID] = reading.Sequence
+					}
+				}
+			}
+		}
+
+		if err := send(ack); err != nil {
+			logrus.WithError(err).Warn("unable to acknowledge sensor readings")
+			return errors.Wrap(err, "unable to acknowledge sensor readings")
+		}
+
+		var err error
+		if ack.Error != "" {
+			err = errors.New(ack.Error)
+		}
+
+		pending, ack = pending[:0], readingsAck{Sequences: map[string]int64{}}
+
+		return err
+	}
+
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				return write()
+			}
+
+			if line.err != nil {
+				ack.Error = line.err.Error()
+				return write()
+			}
+
+			ack.Received++
+
+			err := line.rejected
+			if err == nil {
+				err = s.checkReading(ctx, &line.reading, tanks)
+			}
+
+			if err != nil {
+				var rejected *rejectedReading
+				if !errors.As(err, &rejected) {
+					logrus.WithError(err).Error("unable to check sensor reading")
+					ack.Error = "unable to check sensor reading"
+					return write()
+				}
+
+				ack.Errors = append(ack.Errors, readingError{Line: line.number, Error: rejected.reason})
+				continue
+			}
+
+			pending = append(pending, line.reading)
+
+			if len(pending) == readingBatchSize {
+				if err := write(); err != nil {
+					return err
+				}
+			}
+		case <-ticker.C:
+			if ack.Received > 0 || len(pending) > 0 {
+				if err := write(); err != nil {
+					return err
+				}
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// scanReadings sends the reading of each non-empty line of the request body to lines,
+// closing it at the end of the body. An error reading the body is sent as the last line.
+func scanReadings(r *http.Request, lines chan<- readingLine) {
+	defer close(lines)
+
+	send := func(l readingLine) bool {
+		return sendReading(r.Context(), lines, l)
+	}
+
+	sc := bufio.NewScanner(r.Body)
+	sc.Buffer(make([]byte, 0, 512), maxReadingLineSize)
+
+	number := 0
+	for sc.Scan() {
+		number++
+
+		text := strings.TrimSpace(sc.Text())
+		if text == "" {
+			continue
+		}
+
+		reading, err := decodeReading([]byte(text))
+		if !send(readingLine{number: number, reading: reading, rejected: err}) {
+			return
+		}
+	}
+
+	if err := sc.Err(); err != nil {
+		send(readingLine{number: number + 1, err: errors.Wrapf(err, "unable to read line %d", number+1)})
+	}
+}
+
+// receiveReadings sends the reading of each message of a StreamReadings RPC to lines,
+// closing it once the client has finished sending. An error receiving a message is sent as
+// the last line.
+func receiveReadings(stream grpc.ServerStream, lines chan<- readingLine) {
+	defer close(lines)
+
+	for number := 1; ; number++ {
+		m := dynamicpb.NewMessage(sensorReadingDesc)
+		if err := stream.RecvMsg(m); err != nil {
+			if err != io.EOF {
+				sendReading(stream.Context(), lines, readingLine{number: number, err: errors.Wrapf(err, "unable to receive reading %d", number)})
+			}
+
+			return
+		}
+
+		reading, err := readingFromMessage(m)
+		if !sendReading(stream.Context(), lines, readingLine{number: number, reading: reading, rejected: err}) {
+			return
+		}
+	}
+}
+
+// sendReading sends l to lines, returning false if ctx is done first
+func sendReading(ctx context.Context, lines chan<- readingLine, l readingLine) bool {
+	select {
+	case lines <- l:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// rejectedReading is returned for readings which are invalid
+type rejectedReading struct {
+	reason string
+}
+
+func (r *rejectedReading) Error() string {
+	return r.reason
+}
+
+func reject(format string, args ...interface{}) error {
+	return &rejectedReading{reason: fmt.Sprintf(format, args...)}
+}
+
+// RecordReading adds a sensor reading received outside of a stream, e.g. over MQTT, after
+// checking it the same way as the readings of a stream. ctx must be scoped to the
+// household of the tank with db.WithHousehold.
+func (s *Server) RecordReading(ctx context.Context, reading db.SensorReading) error {
+	if err := s.checkReading(ctx, &reading, map[int32]bool{}); err != nil {
+		return err
+	}
+
+	if _, err := s.sensorReadingModifier.InsertSensorReadings(ctx, []db.SensorReading{reading}); err != nil {
+		return errors.Wrap(err, "unable to add sensor reading")
+	}
+
+	return nil
+}
+
+// decodeReading returns the sensor reading in a line of a stream, or a *rejectedReading if
+// it isn't valid JSON or has no value. The reading is checked by checkReading.
+func decodeReading(line []byte) (db.SensorReading, error) {
+	var rj sensorReadingJSON
+
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&rj); err != nil {
+		return db.SensorReading{}, reject("invalid reading: %v", err)
+	}
+
+	if rj.Value == nil {
+		return db.SensorReading{}, reject("value is required")
+	}
+
+	return db.SensorReading{
+		SensorID:  rj.SensorID,
+		Sequence:  rj.Sequence,
+		TankID:    rj.TankID,
+		Parameter: rj.Parameter,
+		Value:     *rj.Value,
+		ReadAt:    rj.ReadAt,
+	}, nil
+}
+
+// readingFromMessage returns the sensor reading in a SensorReading message, or a
+// *rejectedReading if it has no value. The reading is checked by checkReading.
+func readingFromMessage(m protoreflect.Message) (db.SensorReading, error) {
+	fields := m.Descriptor().Fields()
+
+	value := fields.ByName("value")
+	if !m.Has(value) {
+		return db.SensorReading{}, reject("value is required")
+	}
+
+	reading := db.SensorReading{
+		SensorID:  m.Get(fields.ByName("sensor_id")).String(),
+		Sequence:  m.Get(fields.ByName("sequence")).Int(),
+		TankID:    int32(m.Get(fields.ByName("tank_id")).Int()),
+		Parameter: m.Get(fields.ByName("parameter")).String(),
+		Value:     m.Get(value).Float(),
+	}
+
+	if readAt := fields.ByName("read_at"); m.Has(readAt) {
+		ts := m.Get(readAt).Message()
+		tsFields := ts.Descriptor().Fields()
+
+		reading.ReadAt = time.Unix(ts.Get(tsFields.ByName("seconds")).Int(), ts.Get(tsFields.ByName("nanos")).Int()).UTC()
+	}
+
+	return reading, nil
+}
+
+// toReadingsAckMessage returns ack as a ReadingsAck message
+func toReadingsAckMessage(ack readingsAck) (proto.Message, error) {
+	b, err := json.Marshal(ack)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to marshal acknowledgement")
+	}
+
+	m := dynamicpb.NewMessage(readingsAckDesc)
+	if err := protojson.Unmarshal(b, m); err != nil {
+		return nil, errors.Wrap(err, "unable to convert acknowledgement")
+	}
+
+	return m, nil
+}
+
+// checkReading normalises a sensor reading and returns a *rejectedReading if it's invalid.
+// Readings without a time are taken to have been read when they're checked. The tanks
+// known to exist are cached in tanks.
+func (s *Server) checkReading(ctx context.Context, reading *db.SensorReading, tanks map[int32]bool) error {
+	reading.SensorID = strings.TrimSpace(reading.SensorID)
+	reading.Parameter = strings.ToLower(strings.TrimSpace(reading.Parameter))
+
+	switch {
+	case reading.SensorID == "":
+		return reject("sensorId is required")
+	case len(reading.SensorID) > maxSensorIDLength:
+		return reject("sensorId must be at most %d characters", maxSensorIDLength)
+	case reading.Sequence <= 0:
+		return reject("sequence must be positive")
+	case reading.TankID == 0:
+		return reject("tankId is required")
+	}
+
+	bounds, ok := sensorParameters[reading.Parameter]
+	if !ok {
+		return reject("unknown parameter %q", reading.Parameter)
+	}
+
+	// NaN compares false with both bounds
+	if math.IsNaN(reading.Value) || reading.Value < bounds.min || reading.Value > bounds.max {
+		return reject("%s %v is out of range", reading.Parameter, reading.Value)
+	}
+
+	if reading.ReadAt.IsZero() {
+		reading.ReadAt = time.Now().UTC()
+	}
+
+	if !allowsTank(ctx, reading.TankID) {
+		return reject("tank %d isn't within the scope of the API key", reading.TankID)
+	}
+
+	if !tanks[reading.TankID] {
+		if _, err := s.tankQuerier.GetTank(ctx, reading.TankID); err != nil {
+			var nf *db.ErrNotFound
+			if errors.As(err, &nf) {
+				return reject("tank %d not found", reading.TankID)
+			}
+
+			return errors.Wrap(err, "unable to get tank")
+		}
+
+		tanks[reading.TankID] = true
+	}
+
+	return nil
+}
+
+// enableFullDuplex allows the response to be written while the request body is still
+// being read, which HTTP/1.1 servers only allow from Go 1.21. HTTP/2 always allows it.
+func enableFullDuplex(w http.ResponseWriter) {
+	for {
+		switch rw := w.(type) {
+		case interface{ EnableFullDuplex() error }:
+			if err := rw.EnableFullDuplex(); err != nil {
+				logrus.WithError(err).Debug("unable to enable full duplex")
+			}
+
+			return
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = rw.Unwrap()
+		default:
+			return
+		}
+	}
+}
+
+// flush sends what has been written of a response to the client
+func flush(w http.ResponseWriter) {
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
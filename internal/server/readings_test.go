@@ -0,0 +1,405 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trackmyfish/backend/internal/auth"
+	"github.com/trackmyfish/backend/internal/db"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func TestStreamReadings(t *testing.T) {
+	rm := &readingsMock{}
+	tm := &tankMock{getTankResponse: db.Tank{ID: 1, Name: "Reef"}}
+	s := Server{sensorReadingModifier: rm, tankQuerier: tm}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	stream := func(lines ...string) []readingsAck {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, readingsStreamPath, strings.NewReader(strings.Join(lines, "\n"))))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "application/x-ndjson", rec.Header().Get("Content-Type"))
+
+		acks := []readingsAck{}
+		dec := json.NewDecoder(rec.Body)
+		for dec.More() {
+			var ack readingsAck
+			assert.NoError(t, dec.Decode(&ack))
+			acks = append(acks, ack)
+		}
+
+		return acks
+	}
+
+	t.Run("Given a stream of readings", func(t *testing.T) {
+		t.Run("When it ends", func(t *testing.T) {
+			t.Run("Then the readings are written and acknowledged", func(t *testing.T) {
+				*rm = readingsMock{}
+
+				acks := stream(
+					`{"sensorId": "probe-1", "sequence": 1, "tankId": 1, "parameter": "pH", "value": 8.1, "readAt": "2021-08-06T10:00:00Z"}`,
+					``,
+					`{"sensorId": "probe-1", "sequence": 2, "tankId": 1, "parameter": "ph", "value": 8.2, "readAt": "2021-08-06T10:01:00Z"}`,
+					`{"sensorId": "probe-2", "sequence": 7, "tankId": 1, "parameter": "temperature", "value": 25.5}`,
+				)
+
+				assert.Equal(t, []readingsAck{{Received: 3, Written: 3, Sequences: map[string]int64{"probe-1": 2, "probe-2": 7}}}, acks)
+
+				assert.Len(t, rm.insertRequests, 1)
+				assert.Equal(t, db.SensorReading{SensorID: "probe-1", Sequence: 1, TankID: 1, Parameter: "ph", Value: 8.1, ReadAt: time.Date(2021, 8, 6, 10, 0, 0, 0, time.UTC)}, rm.insertRequests[0][0])
+				assert.False(t, rm.insertRequests[0][2].ReadAt.IsZero())
+			})
+		})
+
+		t.Run("When it has more readings than fit in a batch", func(t *testing.T) {
+			t.Run("Then each batch is acknowledged as it's written", func(t *testing.T) {
+				*rm = readingsMock{}
+
+				lines := make([]string, readingBatchSize+10)
+				for i := range lines {
+					lines[i] = fmt.Sprintf(`{"sensorId": "probe-1", "sequence": %d, "tankId": 1, "parameter": "ph", "value": 8}`, i+1)
+				}
+
+				acks := stream(lines...)
+
+				assert.Len(t, acks, 2)
+				assert.Equal(t, int64(readingBatchSize), acks[0].Sequences["probe-1"])
+				assert.Equal(t, int64(readingBatchSize+10), acks[1].Sequences["probe-1"])
+				assert.Len(t, rm.insertRequests, 2)
+			})
+		})
+
+		t.Run("When it's sent again after reconnecting", func(t *testing.T) {
+			t.Run("Then the readings already written are acknowledged as duplicates", func(t *testing.T) {
+				*rm = readingsMock{duplicates: 1}
+
+				acks := stream(
+					`{"sensorId": "probe-1", "sequence": 2, "tankId": 1, "parameter": "ph", "value": 8.2}`,
+					`{"sensorId": "probe-1", "sequence": 3, "tankId": 1, "parameter": "ph", "value": 8.3}`,
+				)
+
+				assert.Equal(t, []readingsAck{{Received: 2, Written: 1, Duplicates: 1, Sequences: map[string]int64{"probe-1": 3}}}, acks)
+			})
+		})
+	})
+
+	t.Run("Given a stream with invalid readings", func(t *testing.T) {
+		t.Run("When it ends", func(t *testing.T) {
+			t.Run("Then the valid readings are written and the invalid ones are rejected", func(t *testing.T) {
+				*rm = readingsMock{}
+
+				acks := stream(
+					`{"sensorId": "probe-1", "sequence": 1, "tankId": 1, "parameter": "ph", "value": 8.1}`,
+					`not json`,
+					`{"sensorId": "probe-1", "sequence": 2, "tankId": 1, "parameter": "ph", "value": 15}`,
+					`{"sensorId": "probe-1", "sequence": 3, "tankId": 1, "parameter": "ph"}`,
+					`{"sensorId": "probe-1", "sequence": 4, "tankId": 1, "parameter": "lux", "value": 3}`,
+				)
+
+				assert.Len(t, acks, 1)
+				assert.Equal(t, 5, acks[0].Received)
+				assert.Equal(t, int64(1), acks[0].Written)
+				assert.Equal(t, map[string]int64{"probe-1": 1}, acks[0].Sequences)
+				assert.Len(t, acks[0].Errors, 4)
+				assert.Equal(t, readingError{Line: 3, Error: "ph 15 is out of range"}, acks[0].Errors[1])
+				assert.Equal(t, readingError{Line: 4, Error: "value is required"}, acks[0].Errors[2])
+				assert.Equal(t, readingError{Line: 5, Error: `unknown parameter "lux"`}, acks[0].Errors[3])
+			})
+		})
+
+		t.Run("When a reading is for a tank which doesn't exist", func(t *testing.T) {
+			t.Run("Then it's rejected", func(t *testing.T) {
+				*rm = readingsMock{}
+				tm.err = &db.ErrNotFound{}
+				defer func() { tm.err = nil }()
+
+				acks := stream(`{"sensorId": "probe-1", "sequence": 1, "tankId": 9, "parameter": "ph", "value": 8.1}`)
+
+				assert.Equal(t, []readingsAck{{Received: 1, Sequences: map[string]int64{}, Errors: []readingError{{Line: 1, Error: "tank 9 not found"}}}}, acks)
+				assert.Empty(t, rm.insertRequests)
+			})
+		})
+	})
+
+	t.Run("Given the readings can't be written", func(t *testing.T) {
+		t.Run("When a stream ends", func(t *testing.T) {
+			t.Run("Then the error is acknowledged so the readings are sent again", func(t *testing.T) {
+				*rm = readingsMock{err: assert.AnError}
+
+				acks := stream(`{"sensorId": "probe-1", "sequence": 1, "tankId": 1, "parameter": "ph", "value": 8.1}`)
+
+				assert.Equal(t, []readingsAck{{Received: 1, Sequences: map[string]int64{}, Error: "unable to add sensor readings"}}, acks)
+			})
+		})
+	})
+}
+
+func TestStreamReadingsRPC(t *testing.T) {
+	rm := &readingsMock{}
+	tm := &tankMock{getTankResponse: db.Tank{ID: 1, Name: "Reef"}}
+	s := &Server{sensorReadingModifier: rm, tankQuerier: tm}
+
+	conn := serveStreams(t, s)
+
+	stream := func(readings ...string) []readingsAck {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		cs, err := conn.NewStream(ctx, &grpc.StreamDesc{ClientStreams: true, ServerStreams: true}, streamReadingsMethod)
+		assert.NoError(t, err)
+
+		for _, reading := range readings {
+			m := dynamicpb.NewMessage(sensorReadingDesc)
+			assert.NoError(t, protojson.Unmarshal([]byte(reading), m))
+			assert.NoError(t, cs.SendMsg(m))
+		}
+
+		assert.NoError(t, cs.CloseSend())
+
+		acks := []readingsAck{}
+		for {
+			m := dynamicpb.NewMessage(readingsAckDesc)
+			if err := cs.RecvMsg(m); err != nil {
+				assert.Equal(t, io.EOF, err)
+				return acks
+			}
+
+			acks = append(acks, fromReadingsAckMessage(m))
+		}
+	}
+
+	t.Run("Given a stream of readings", func(t *testing.T) {
+		t.Run("When it ends", func(t *testing.T) {
+			t.Run("Then the valid readings are written and acknowledged", func(t *testing.T) {
+				*rm = readingsMock{}
+
+				acks := stream(
+					`{"sensorId": "probe-1", "sequence": 1, "tankId": 1, "parameter": "pH", "value": 8.1, "readAt": "2021-08-06T10:00:00Z"}`,
+					`{"sensorId": "probe-1", "sequence": 2, "tankId": 1, "parameter": "ph"}`,
+					`{"sensorId": "probe-2", "sequence": 7, "tankId": 1, "parameter": "temperature", "value": 0}`,
+				)
+
+				assert.Equal(t, []readingsAck{{
+					Received:  3,
+					Written:   2,
+					Sequences: map[string]int64{"probe-1": 1, "probe-2": 7},
+					Errors:    []readingError{{Line: 2, Error: "value is required"}},
+				}}, acks)
+
+				assert.Len(t, rm.insertRequests, 1)
+				assert.Equal(t, db.SensorReading{SensorID: "probe-1", Sequence: 1, TankID: 1, Parameter: "ph", Value: 8.1, ReadAt: time.Date(2021, 8, 6, 10, 0, 0, 0, time.UTC)}, rm.insertRequests[0][0])
+				assert.Equal(t, 0.0, rm.insertRequests[0][1].Value)
+			})
+		})
+	})
+
+	t.Run("Given the readings can't be written", func(t *testing.T) {
+		t.Run("When a stream ends", func(t *testing.T) {
+			t.Run("Then the error is acknowledged and the stream is aborted", func(t *testing.T) {
+				*rm = readingsMock{err: assert.AnError}
+
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+
+				cs, err := conn.NewStream(ctx, &grpc.StreamDesc{ClientStreams: true, ServerStreams: true}, streamReadingsMethod)
+				assert.NoError(t, err)
+
+				m := dynamicpb.NewMessage(sensorReadingDesc)
+				assert.NoError(t, protojson.Unmarshal([]byte(`{"sensorId": "probe-1", "sequence": 1, "tankId": 1, "parameter": "ph", "value": 8.1}`), m))
+				assert.NoError(t, cs.SendMsg(m))
+				assert.NoError(t, cs.CloseSend())
+
+				ack := dynamicpb.NewMessage(readingsAckDesc)
+				assert.NoError(t, cs.RecvMsg(ack))
+				assert.Equal(t, readingsAck{Received: 1, Sequences: map[string]int64{}, Error: "unable to add sensor readings"}, fromReadingsAckMessage(ack))
+
+				assert.Equal(t, codes.Aborted, status.Code(cs.RecvMsg(dynamicpb.NewMessage(readingsAckDesc))))
+			})
+		})
+	})
+}
+func TestRecordReading(t *testing.T) {
+	rm := &readingsMock{}
+	s := Server{sensorReadingModifier: rm, tankQuerier: &tankMock{getTankResponse: db.Tank{ID: 1}}}
+
+	t.Run("Given a reading received over MQTT", func(t *testing.T) {
+		t.Run("When it's valid", func(t *testing.T) {
+			t.Run("Then it's added", func(t *testing.T) {
+				reading := db.SensorReading{SensorID: "aquarium/reef/ph", Sequence: 1628244000000, TankID: 1, Parameter: "PH", Value: 8.1, ReadAt: time.Date(2021, 8, 6, 10, 0, 0, 0, time.UTC)}
+
+				assert.NoError(t, s.RecordReading(context.Background(), reading))
+
+				reading.Parameter = "ph"
+				assert.Equal(t, [][]db.SensorReading{{reading}}, rm.insertRequests)
+			})
+		})
+
+		t.Run("When it's out of range", func(t *testing.T) {
+			t.Run("Then it's rejected", func(t *testing.T) {
+				err := s.RecordReading(context.Background(), db.SensorReading{SensorID: "aquarium/reef/ph", Sequence: 1, TankID: 1, Parameter: "ph", Value: 15})
+
+				assert.EqualError(t, err, "ph 15 is out of range")
+				assert.Len(t, rm.insertRequests, 1)
+			})
+		})
+
+		t.Run("When it isn't a finite number", func(t *testing.T) {
+			t.Run("Then it's rejected", func(t *testing.T) {
+				for _, v := range []float64{math.NaN(), math.Inf(1)} {
+					err := s.RecordReading(context.Background(), db.SensorReading{SensorID: "aquarium/reef/ph", Sequence: 1, TankID: 1, Parameter: "ph", Value: v})
+
+					assert.EqualError(t, err, fmt.Sprintf("ph %v is out of range", v))
+				}
+
+				assert.Len(t, rm.insertRequests, 1)
+			})
+		})
+
+		t.Run("When it's for a tank outside the scope of the API key", func(t *testing.T) {
+			t.Run("Then it's rejected", func(t *testing.T) {
+				ctx := auth.NewContext(context.Background(), auth.Identity{APIKeyID: 5, Scope: &auth.Scope{Resource: "readings", Permission: auth.PermissionWrite, TankID: 2}})
+
+				err := s.RecordReading(ctx, db.SensorReading{SensorID: "aquarium/reef/ph", Sequence: 1, TankID: 1, Parameter: "ph", Value: 8.1})
+
+				assert.EqualError(t, err, "tank 1 isn't within the scope of the API key")
+				assert.Len(t, rm.insertRequests, 1)
+			})
+		})
+	})
+}
+
+func TestListReadings(t *testing.T) {
+	readAt := time.Date(2021, 8, 6, 10, 0, 0, 0, time.UTC)
+
+	rm := &readingsMock{listResponse: []db.SensorReading{{ID: 4, SensorID: "probe-1", Sequence: 2, TankID: 1, Parameter: "ph", Value: 8.2, ReadAt: readAt}}}
+	s := Server{sensorReadingQuerier: rm}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	t.Run("Given readings of a tank", func(t *testing.T) {
+		t.Run("When they are listed", func(t *testing.T) {
+			t.Run("Then the filtered readings are returned", func(t *testing.T) {
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, readingsPath+"?tankId=1&parameter=ph&limit=5000", nil))
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+
+				var rsp struct {
+					Readings []sensorReadingJSON `json:"readings"`
+				}
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(&rsp))
+
+				value := 8.2
+				assert.Equal(t, []sensorReadingJSON{{ID: 4, SensorID: "probe-1", Sequence: 2, TankID: 1, Parameter: "ph", Value: &value, ReadAt: readAt}}, rsp.Readings)
+
+				assert.Equal(t, int32(1), *rm.listFilter.TankID)
+				assert.Equal(t, "ph", rm.listFilter.Parameter)
+				assert.Equal(t, int32(maxReadingsLimit), rm.listLimit)
+			})
+		})
+	})
+
+	t.Run("Given an API key scoped to a tank", func(t *testing.T) {
+		list := func(query string) int {
+			req := httptest.NewRequest(http.MethodGet, readingsPath+query, nil)
+			ctx := auth.NewContext(req.Context(), auth.Identity{APIKeyID: 5, Scope: &auth.Scope{Resource: "readings", Permission: auth.PermissionRead, TankID: 2}})
+
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req.WithContext(ctx))
+
+			return rec.Code
+		}
+
+		t.Run("When readings are listed without a tank", func(t *testing.T) {
+			t.Run("Then only the readings of the tank are listed", func(t *testing.T) {
+				assert.Equal(t, http.StatusOK, list(""))
+				assert.Equal(t, int32(2), *rm.listFilter.TankID)
+			})
+		})
+		t.Run("When the readings of another tank are listed", func(t *testing.T) {
+			t.Run("Then it's forbidden", func(t *testing.T) {
+				assert.Equal(t, http.StatusForbidden, list("?tankId=1"))
+			})
+		})
+	})
+}
+
+type readingsMock struct {
+	insertRequests [][]db.SensorReading
+	duplicates     int64
+	listResponse   []db.SensorReading
+	listFilter     db.SensorReadingFilter
+	listLimit      int32
+	latestResponse []db.LatestSensorReading
+	latestSince    time.Time
+	err            error
+}
+
+func (m *readingsMock) InsertSensorReadings(_ context.Context, readings []db.SensorReading) (int64, error) {
+	if m.err != nil {
+		return 0, m.err
+	}
+
+	m.insertRequests = append(m.insertRequests, append([]db.SensorReading(nil), readings...))
+
+	return int64(len(readings)) - m.duplicates, nil
+}
+
+func (m *readingsMock) LatestSensorReadings(_ context.Context, since time.Time) ([]db.LatestSensorReading, error) {
+	m.latestSince = since
+
+	return m.latestResponse, m.err
+}
+
+func (m *readingsMock) ListSensorReadings(_ context.Context, filter db.SensorReadingFilter, limit int32) ([]db.SensorReading, error) {
+	m.listFilter, m.listLimit = filter, limit
+
+	return m.listResponse, m.err
+}
+
+// fromReadingsAckMessage returns the acknowledgement in a ReadingsAck message
+func fromReadingsAckMessage(m protoreflect.Message) readingsAck {
+	fields := m.Descriptor().Fields()
+
+	ack := readingsAck{
+		Received:   int(m.Get(fields.ByName("received")).Int()),
+		Written:    m.Get(fields.ByName("written")).Int(),
+		Duplicates: m.Get(fields.ByName("duplicates")).Int(),
+		Sequences:  map[string]int64{},
+		Error:      m.Get(fields.ByName("error")).String(),
+	}
+
+	m.Get(fields.ByName("sequences")).Map().Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+		ack.Sequences[k.String()] = v.Int()
+		return true
+	})
+
+	errs := m.Get(fields.ByName("errors")).List()
+	for i := 0; i < errs.Len(); i++ {
+		e := errs.Get(i).Message()
+		errFields := e.Descriptor().Fields()
+
+		ack.Errors = append(ack.Errors, readingError{Line: int(e.Get(errFields.ByName("line")).Int()), Error: e.Get(errFields.ByName("error")).String()})
+	}
+
+	return ack
+}
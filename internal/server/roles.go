@@ -0,0 +1,201 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/trackmyfish/backend/internal/auth"
+	"github.com/trackmyfish/backend/internal/db"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const rpcPrefix = "/trackmyfish.v1alpha1.TrackMyFishService/"
+
+// access is the resource an RPC belongs to and the permission needed to call it
+type access struct {
+	resource   string
+	permission auth.Permission
+}
+
+// methodAccess is the access needed to call each RPC. RPCs missing from it need
+// auth.PermissionManage, so new RPCs are restricted to owners until they're added. The
+// resources match those of the equivalent HTTP endpoints, see requestResource.
+var methodAccess = map[string]access{
+	rpcPrefix + "Heartbeat":           {"heartbeat", auth.PermissionRead},
+	rpcPrefix + "AddFish":             {"fish", auth.PermissionWrite},
+	rpcPrefix + "ListFish":            {"fish", auth.PermissionRead},
+	rpcPrefix + "DeleteFish":          {"fish", auth.PermissionDelete},
+	rpcPrefix + "AddTankStatistic":    {"tank-statistics", auth.PermissionWrite},
+	rpcPrefix + "ListTankStatistics":  {"tank-statistics", auth.PermissionRead},
+	rpcPrefix + "DeleteTankStatistic": {"tank-statistics", auth.PermissionDelete},
+	rpcPrefix + "AddTank":             {"tanks", auth.PermissionWrite},
+	rpcPrefix + "ListTanks":           {"tanks", auth.PermissionRead},
+	rpcPrefix + "DeleteTank":          {"tanks", auth.PermissionDelete},
+	streamReadingsMethod:              {"readings", auth.PermissionWrite},
+	watchTankMethod:                   {"tanks", auth.PermissionRead},
+}
+
+// readOnlyPaths are HTTP endpoints which are POSTed to but don't change any data
+var readOnlyPaths = map[string]bool{
+	"/api/v1alpha1/dosing/calculate": true,
+}
+
+// managePaths are the HTTP endpoints managing the household, its members, invites and
+// tank shares, its audit log and its backups. Changes to them need auth.PermissionManage,
+// as does everything under manageOnlyPaths.
+var managePaths = []string{"/api/v1alpha1/household", "/api/v1alpha1/members", invitesPath, tankSharesPath, auditEventsPath, exportPath, importPath}
+
+// manageOnlyPaths are the managePaths which need auth.PermissionManage even to read
+var manageOnlyPaths = map[string]bool{invitesPath: true, auditEventsPath: true, exportPath: true}
+
+const invitesPath = "/api/v1alpha1/invites"
+
+// tankScopedPaths are the HTTP endpoints which enforce the tank an API key is scoped to.
+// Keys scoped to a tank can't be used with any other endpoint or RPC, as they'd allow
+// every tank.
+var tankScopedPaths = []string{readingsPath, watchPath}
+
+// tankScopedMethods are the RPCs which enforce the tank an API key is scoped to, the same
+// as tankScopedPaths
+var tankScopedMethods = map[string]bool{streamReadingsMethod: true, watchTankMethod: true}
+
+func accessFor(fullMethod string) access {
+	if a, ok := methodAccess[fullMethod]; ok {
+		return a
+	}
+
+	return access{permission: auth.PermissionManage}
+}
+
+// requestResource returns the resource an HTTP endpoint belongs to, which is the first
+// segment of its path, e.g. "tanks" for /api/v1alpha1/tanks/1. Tank statistics are
+// served from /api/v1alpha1/tank/statistics, so are "tank-statistics", and CSV exports
+// belong to the resource they export, e.g. "fish" for /api/v1alpha1/csv/fish. Watching a
+// tank at /api/v1alpha1/watch/tanks/1 belongs to "tanks".
+func requestResource(path string) string {
+	segments := strings.SplitN(strings.TrimPrefix(path, "/api/v1alpha1/"), "/", 3)
+
+	if segments[0] == "tank" && len(segments) > 1 && segments[1] == "statistics" {
+		return "tank-statistics"
+	}
+
+	if (segments[0] == "csv" || segments[0] == "watch") && len(segments) > 1 {
+		return segments[1]
+	}
+
+	return segments[0]
+}
+
+// isTankScoped returns whether an HTTP endpoint enforces the tank an API key is scoped to
+func isTankScoped(path string) bool {
+	for _, p := range tankScopedPaths {
+		if path == p || strings.HasPrefix(path, strings.TrimSuffix(p, "/")+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// allowsTank returns whether the API key the request in ctx was authenticated with, if
+// any, allows the tank with the given id
+func allowsTank(ctx context.Context, tankID int32) bool {
+	id, ok := auth.FromContext(ctx)
+
+	return !ok || id.Scope.AllowsTank(tankID)
+}
+
+// requestPermission returns the permission needed to make an HTTP request, which depends
+// on the method: reading needs auth.PermissionRead, deleting auth.PermissionDelete and
+// anything else auth.PermissionWrite. Every member can manage their own API keys.
+func requestPermission(r *http.Request) auth.Permission {
+	read := r.Method == http.MethodGet || r.Method == http.MethodHead || readOnlyPaths[r.URL.Path]
+
+	if strings.HasPrefix(r.URL.Path, apiKeysPath) {
+		return auth.PermissionRead
+	}
+
+	for _, p := range managePaths {
+		if strings.HasPrefix(r.URL.Path, p) && (!read || manageOnlyPaths[p]) {
+			return auth.PermissionManage
+		}
+	}
+
+	switch {
+	case read:
+		return auth.PermissionRead
+	case r.Method == http.MethodDelete:
+		return auth.PermissionDelete
+	default:
+		return auth.PermissionWrite
+	}
+}
+
+// authorize returns an error unless the authenticated user in ctx has permission p on
+// resource, and so does the scope of the API key they authenticated with. API keys can't
+// be used to manage API keys, and those scoped to a tank can only be used where tankScoped,
+// i.e. the endpoint enforces it. The role is read from the database on each request, so
+// changes to it apply immediately, and added to the identity in the returned context.
+func (s *Server) authorize(ctx context.Context, resource string, p auth.Permission, tankScoped bool) (context.Context, error) {
+	id, ok := auth.FromContext(ctx)
+	if !ok {
+		return ctx, auth.ErrUnauthenticated
+	}
+
+	if id.APIKeyID != 0 && (resource == apiKeysResource || !id.Scope.Allows(resource, p)) {
+		return ctx, auth.ErrForbidden
+	}
+
+	if id.Scope != nil && id.Scope.TankID != 0 && !tankScoped {
+		return ctx, auth.ErrForbidden
+	}
+
+	u, err := s.userQuerier.GetUser(ctx, id.UserID)
+	if err != nil {
+		var nf *db.ErrNotFound
+		if errors.As(err, &nf) {
+			// the user has been removed since the token was issued
+			return ctx, auth.ErrUnauthenticated
+		}
+
+		return ctx, errors.Wrap(err, "unable to get user")
+	}
+
+	if u.HouseholdID != id.HouseholdID {
+		return ctx, auth.ErrUnauthenticated
+	}
+
+	id.Role = auth.Role(u.Role)
+	if !id.Role.Allows(p) {
+		return ctx, auth.ErrForbidden
+	}
+
+	return auth.NewContext(ctx, id), nil
+}
+
+// authorizationStatus returns the HTTP status for an error returned by authorize
+func authorizationStatus(err error) int {
+	switch err {
+	case auth.ErrUnauthenticated:
+		return http.StatusUnauthorized
+	case auth.ErrForbidden:
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// authorizationError returns the gRPC status for an error returned by authorize
+func authorizationError(err error) error {
+	switch err {
+	case auth.ErrUnauthenticated:
+		return status.Error(codes.Unauthenticated, err.Error())
+	case auth.ErrForbidden:
+		return status.Error(codes.PermissionDenied, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
@@ -0,0 +1,287 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trackmyfish/backend/internal/auth"
+	"github.com/trackmyfish/backend/internal/db"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestRequestPermission(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		method   string
+		path     string
+		expected auth.Permission
+	}{
+		{desc: "Listing needs read", method: http.MethodGet, path: "/api/v1alpha1/tanks", expected: auth.PermissionRead},
+		{desc: "Adding needs write", method: http.MethodPost, path: "/api/v1alpha1/tank/statistics", expected: auth.PermissionWrite},
+		{desc: "Updating needs write", method: http.MethodPut, path: "/api/v1alpha1/individuals/1", expected: auth.PermissionWrite},
+		{desc: "Deleting needs delete", method: http.MethodDelete, path: "/api/v1alpha1/tanks/1", expected: auth.PermissionDelete},
+		{desc: "Calculating a dose needs read", method: http.MethodPost, path: "/api/v1alpha1/dosing/calculate", expected: auth.PermissionRead},
+		{desc: "Getting the household needs read", method: http.MethodGet, path: "/api/v1alpha1/household", expected: auth.PermissionRead},
+		{desc: "Renaming the household needs manage", method: http.MethodPut, path: "/api/v1alpha1/household", expected: auth.PermissionManage},
+		{desc: "Listing members needs read", method: http.MethodGet, path: "/api/v1alpha1/members", expected: auth.PermissionRead},
+		{desc: "Removing a member needs manage", method: http.MethodDelete, path: "/api/v1alpha1/members/3", expected: auth.PermissionManage},
+		{desc: "Listing invites needs manage", method: http.MethodGet, path: "/api/v1alpha1/invites", expected: auth.PermissionManage},
+		{desc: "Listing tank shares needs read", method: http.MethodGet, path: "/api/v1alpha1/tank-shares", expected: auth.PermissionRead},
+		{desc: "Sharing a tank needs manage", method: http.MethodPost, path: "/api/v1alpha1/tank-shares", expected: auth.PermissionManage},
+		{desc: "Listing audit events needs manage", method: http.MethodGet, path: "/api/v1alpha1/audit-events", expected: auth.PermissionManage},
+		{desc: "Exporting a backup needs manage", method: http.MethodGet, path: "/api/v1alpha1/export", expected: auth.PermissionManage},
+		{desc: "Importing a backup needs manage", method: http.MethodPost, path: "/api/v1alpha1/import", expected: auth.PermissionManage},
+		{desc: "Restoring from the trash needs write", method: http.MethodPost, path: "/api/v1alpha1/trash/tanks/1/restore", expected: auth.PermissionWrite},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			assert.Equal(t, tC.expected, requestPermission(httptest.NewRequest(tC.method, tC.path, nil)))
+		})
+	}
+}
+
+func TestAccessFor(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		method   string
+		expected access
+	}{
+		{desc: "Listing needs read", method: rpcPrefix + "ListFish", expected: access{"fish", auth.PermissionRead}},
+		{desc: "Adding needs write", method: rpcPrefix + "AddTankStatistic", expected: access{"tank-statistics", auth.PermissionWrite}},
+		{desc: "Deleting needs delete", method: rpcPrefix + "DeleteTank", expected: access{"tanks", auth.PermissionDelete}},
+		{desc: "Unknown methods need manage", method: rpcPrefix + "Unknown", expected: access{"", auth.PermissionManage}},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			assert.Equal(t, tC.expected, accessFor(tC.method))
+		})
+	}
+}
+
+func TestRequestResource(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		path     string
+		expected string
+	}{
+		{desc: "Collections are resources", path: "/api/v1alpha1/tanks", expected: "tanks"},
+		{desc: "Entries belong to their collection", path: "/api/v1alpha1/fish-groups/3/split", expected: "fish-groups"},
+		{desc: "Tank statistics are a resource", path: "/api/v1alpha1/tank/statistics", expected: "tank-statistics"},
+		{desc: "Tank statistic entries are tank statistics", path: "/api/v1alpha1/tank/statistics/4", expected: "tank-statistics"},
+		{desc: "CSV exports belong to what they export", path: "/api/v1alpha1/csv/tank-statistics", expected: "tank-statistics"},
+		{desc: "Watching a tank belongs to tanks", path: "/api/v1alpha1/watch/tanks/1", expected: "tanks"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			assert.Equal(t, tC.expected, requestResource(tC.path))
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	tokens, err := auth.NewTokenManager("", time.Hour)
+	assert.NoError(t, err)
+
+	token, _, err := tokens.Issue(auth.Identity{UserID: 3, Username: "nemo", HouseholdID: 2})
+	assert.NoError(t, err)
+
+	um := &userMock{getUserResponse: db.User{ID: 3, HouseholdID: 2, Username: "nemo", Role: "EDITOR"}}
+	s := Server{userQuerier: um, tokens: tokens}
+
+	var (
+		id        auth.Identity
+		household int32
+		scoped    bool
+	)
+
+	h := s.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, _ = auth.FromContext(r.Context())
+		household, scoped = db.HouseholdFromContext(r.Context())
+	}))
+
+	authenticated := func(method, path string) *http.Request {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		return req
+	}
+
+	t.Run("Given an authenticated request", func(t *testing.T) {
+		t.Run("When the role of the user allows it", func(t *testing.T) {
+			t.Run("Then it is scoped to the household of the user", func(t *testing.T) {
+				rec := httptest.NewRecorder()
+				h.ServeHTTP(rec, authenticated(http.MethodPost, "/api/v1alpha1/tanks"))
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.True(t, scoped)
+				assert.Equal(t, int32(2), household)
+				assert.Equal(t, auth.RoleEditor, id.Role)
+			})
+		})
+		t.Run("When the role of the user doesn't allow it", func(t *testing.T) {
+			t.Run("Then forbidden is returned", func(t *testing.T) {
+				rec := httptest.NewRecorder()
+				h.ServeHTTP(rec, authenticated(http.MethodDelete, "/api/v1alpha1/tanks/1"))
+
+				assert.Equal(t, http.StatusForbidden, rec.Code)
+			})
+		})
+		t.Run("When the user has been removed", func(t *testing.T) {
+			t.Run("Then unauthorized is returned", func(t *testing.T) {
+				um.err = &db.ErrNotFound{}
+				defer func() { um.err = nil }()
+
+				rec := httptest.NewRecorder()
+				h.ServeHTTP(rec, authenticated(http.MethodGet, "/api/v1alpha1/tanks"))
+
+				assert.Equal(t, http.StatusUnauthorized, rec.Code)
+			})
+		})
+	})
+
+	t.Run("Given a public request", func(t *testing.T) {
+		t.Run("When it is served", func(t *testing.T) {
+			t.Run("Then it isn't scoped to a household", func(t *testing.T) {
+				h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1alpha1/heartbeat", nil))
+
+				assert.False(t, scoped)
+			})
+		})
+	})
+}
+
+func TestUnaryInterceptor(t *testing.T) {
+	tokens, err := auth.NewTokenManager("", time.Hour)
+	assert.NoError(t, err)
+
+	token, _, err := tokens.Issue(auth.Identity{UserID: 3, Username: "nemo", HouseholdID: 2})
+	assert.NoError(t, err)
+
+	um := &userMock{getUserResponse: db.User{ID: 3, HouseholdID: 2, Username: "nemo", Role: "VIEWER"}}
+	s := Server{userQuerier: um, tokens: tokens}
+
+	interceptor := s.UnaryInterceptor()
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		household, _ := db.HouseholdFromContext(ctx)
+		return household, nil
+	}
+
+	t.Run("Given a viewer", func(t *testing.T) {
+		t.Run("When a list RPC is called", func(t *testing.T) {
+			t.Run("Then it is scoped to the household of the user", func(t *testing.T) {
+				rsp, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: rpcPrefix + "ListTanks"}, handler)
+				assert.NoError(t, err)
+				assert.Equal(t, int32(2), rsp)
+			})
+		})
+		t.Run("When a delete RPC is called", func(t *testing.T) {
+			t.Run("Then permission denied is returned", func(t *testing.T) {
+				_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: rpcPrefix + "DeleteTank"}, handler)
+				assert.Equal(t, codes.PermissionDenied, status.Code(err))
+			})
+		})
+	})
+
+	t.Run("Given an unauthenticated call", func(t *testing.T) {
+		t.Run("When the heartbeat is called", func(t *testing.T) {
+			t.Run("Then it is allowed", func(t *testing.T) {
+				_, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: heartbeatMethod}, handler)
+				assert.NoError(t, err)
+			})
+		})
+		t.Run("When the health is checked", func(t *testing.T) {
+			t.Run("Then it is allowed", func(t *testing.T) {
+				_, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: healthCheckMethod}, handler)
+				assert.NoError(t, err)
+			})
+		})
+		t.Run("When another RPC is called", func(t *testing.T) {
+			t.Run("Then unauthenticated is returned", func(t *testing.T) {
+				_, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: rpcPrefix + "ListTanks"}, handler)
+				assert.Equal(t, codes.Unauthenticated, status.Code(err))
+			})
+		})
+	})
+}
+
+type serverStreamMock struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s serverStreamMock) Context() context.Context {
+	return s.ctx
+}
+
+func TestStreamInterceptor(t *testing.T) {
+	tokens, err := auth.NewTokenManager("", time.Hour)
+	assert.NoError(t, err)
+
+	token, _, err := tokens.Issue(auth.Identity{UserID: 3, Username: "nemo", HouseholdID: 2})
+	assert.NoError(t, err)
+
+	um := &userMock{getUserResponse: db.User{ID: 3, HouseholdID: 2, Username: "nemo", Role: "EDITOR"}}
+	am := &auditMock{}
+	s := Server{userQuerier: um, auditModifier: am, tokens: tokens}
+
+	interceptor := s.StreamInterceptor()
+	ss := serverStreamMock{ctx: metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))}
+
+	var household int32
+	handler := func(srv interface{}, ss grpc.ServerStream) error {
+		household, _ = db.HouseholdFromContext(ss.Context())
+		return nil
+	}
+
+	t.Run("Given an editor", func(t *testing.T) {
+		t.Run("When readings are streamed", func(t *testing.T) {
+			t.Run("Then the stream is scoped to the household of the user and audited", func(t *testing.T) {
+				household = 0
+
+				err := interceptor(nil, ss, &grpc.StreamServerInfo{FullMethod: streamReadingsMethod}, handler)
+				assert.NoError(t, err)
+				assert.Equal(t, int32(2), household)
+				assert.Len(t, am.events, 1)
+				assert.Equal(t, streamReadingsMethod, am.events[0].Operation)
+			})
+		})
+	})
+
+	t.Run("Given a viewer", func(t *testing.T) {
+		t.Run("When readings are streamed", func(t *testing.T) {
+			t.Run("Then permission denied is returned", func(t *testing.T) {
+				um.getUserResponse.Role = "VIEWER"
+				defer func() { um.getUserResponse.Role = "EDITOR" }()
+
+				err := interceptor(nil, ss, &grpc.StreamServerInfo{FullMethod: streamReadingsMethod}, handler)
+				assert.Equal(t, codes.PermissionDenied, status.Code(err))
+			})
+		})
+	})
+
+	t.Run("Given an unauthenticated stream", func(t *testing.T) {
+		unauthenticated := serverStreamMock{ctx: context.Background()}
+
+		t.Run("When the health is watched", func(t *testing.T) {
+			t.Run("Then it is allowed", func(t *testing.T) {
+				err := interceptor(nil, unauthenticated, &grpc.StreamServerInfo{FullMethod: healthWatchMethod}, handler)
+				assert.NoError(t, err)
+			})
+		})
+		t.Run("When readings are streamed", func(t *testing.T) {
+			t.Run("Then unauthenticated is returned", func(t *testing.T) {
+				err := interceptor(nil, unauthenticated, &grpc.StreamServerInfo{FullMethod: streamReadingsMethod}, handler)
+				assert.Equal(t, codes.Unauthenticated, status.Code(err))
+			})
+		})
+	})
+}
@@ -3,13 +3,24 @@ package server
 import (
 	"context"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/trackmyfish/backend/internal/attachment"
+	"github.com/trackmyfish/backend/internal/auth"
 	"github.com/trackmyfish/backend/internal/db"
+	"github.com/trackmyfish/backend/internal/metrics"
 	trackmyfishv1alpha1 "github.com/trackmyfish/proto/trackmyfish/v1alpha1"
+	"google.golang.org/grpc/health"
 )
 
+type dbCloser interface {
+	Close()
+}
+
 type fishQuerier interface {
+	GetFish(context.Context, int32) (db.Fish, error)
 	ListFish(context.Context) ([]db.Fish, error)
 }
 
@@ -24,10 +35,12 @@ type tankStatQuerier interface {
 
 type tankStatModifier interface {
 	InsertTankStatistic(context.Context, db.TankStatistic) (db.TankStatistic, error)
+	InsertTankStatistics(context.Context, []db.TankStatistic) ([]db.TankStatistic, error)
 	DeleteTankStatistic(context.Context, int32) (db.TankStatistic, error)
 }
 
 type tankQuerier interface {
+	GetTank(context.Context, int32) (db.Tank, error)
 	ListTanks(context.Context) ([]db.Tank, error)
 }
 
@@ -38,12 +51,78 @@ type tankModifier interface {
 
 // Server is the implementation of the trackmyfishv1alpha1.TrackMyFishServiceServer
 type Server struct {
+	dbCloser dbCloser
+	pinger   pinger
+	health   *health.Server
+	metrics  *metrics.Metrics
+
 	fishQuerier      fishQuerier
 	fishModifier     fishModifier
 	tankStatQuerier  tankStatQuerier
 	tankStatModifier tankStatModifier
 	tankQuerier      tankQuerier
 	tankModifier     tankModifier
+
+	attachmentQuerier  attachmentQuerier
+	attachmentModifier attachmentModifier
+	blobStore          attachment.Store
+	maxAttachmentSize  int64
+
+	journalQuerier  journalQuerier
+	journalModifier journalModifier
+
+	treatmentQuerier  treatmentQuerier
+	treatmentModifier treatmentModifier
+
+	tankRoleModifier   tankRoleModifier
+	quarantineQuerier  quarantineQuerier
+	quarantineModifier quarantineModifier
+
+	breedingQuerier  breedingQuerier
+	breedingModifier breedingModifier
+
+	fertiliserQuerier  fertiliserQuerier
+	fertiliserModifier fertiliserModifier
+	dosingQuerier      dosingQuerier
+	dosingModifier     dosingModifier
+
+	individualQuerier   individualQuerier
+	individualModifier  individualModifier
+	measurementQuerier  measurementQuerier
+	measurementModifier measurementModifier
+	speciesQuerier      speciesQuerier
+	speciesModifier     speciesModifier
+	growthQuerier       growthQuerier
+
+	userQuerier  userQuerier
+	userModifier userModifier
+	tokens       *auth.TokenManager
+	allowSignup  bool
+
+	householdQuerier  householdQuerier
+	householdModifier householdModifier
+	inviteQuerier     inviteQuerier
+	inviteModifier    inviteModifier
+	apiKeyQuerier     apiKeyQuerier
+	apiKeyModifier    apiKeyModifier
+
+	tankShareQuerier  tankShareQuerier
+	tankShareModifier tankShareModifier
+
+	auditQuerier  auditQuerier
+	auditModifier auditModifier
+
+	trashQuerier  trashQuerier
+	trashModifier trashModifier
+
+	backupQuerier  backupQuerier
+	backupModifier backupModifier
+
+	sensorReadingQuerier  sensorReadingQuerier
+	sensorReadingModifier sensorReadingModifier
+
+	tankEventListener tankEventListener
+	tankWatchers      tankWatchers
 }
 
 type Config struct {
@@ -52,6 +131,18 @@ type Config struct {
 	DBUsername string
 	DBPassword string
 	DBName     string
+
+	// AttachmentsPath is the directory attachment blobs are stored in
+	AttachmentsPath string
+	// MaxAttachmentSize is the maximum size, in bytes, of an uploaded attachment
+	MaxAttachmentSize int64
+
+	// AuthSecret signs session tokens. A random secret is used if it is empty.
+	AuthSecret string
+	// TokenTTL is how long session tokens are valid for
+	TokenTTL time.Duration
+	// AllowSignup allows anyone to sign up, otherwise only the first user can
+	AllowSignup bool
 }
 
 func New(c Config) (*Server, error) {
@@ -66,16 +157,112 @@ func New(c Config) (*Server, error) {
 		return nil, errors.Wrap(err, "unable to create db instance")
 	}
 
+	blobStore, err := attachment.NewFileStore(c.AttachmentsPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create attachment store")
+	}
+
+	maxAttachmentSize := c.MaxAttachmentSize
+	if maxAttachmentSize <= 0 {
+		maxAttachmentSize = DefaultMaxAttachmentSize
+	}
+
+	if c.AuthSecret == "" {
+		logrus.Warn("No auth secret configured, using a random secret so sessions won't survive a restart")
+	}
+
+	tokens, err := auth.NewTokenManager(c.AuthSecret, c.TokenTTL)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create token manager")
+	}
+
 	return &Server{
+		dbCloser: dbManager,
+		pinger:   dbManager,
+		health:   health.NewServer(),
+		metrics:  metrics.New(dbManager),
+
 		fishQuerier:      dbManager,
 		fishModifier:     dbManager,
 		tankStatQuerier:  dbManager,
 		tankStatModifier: dbManager,
 		tankQuerier:      dbManager,
 		tankModifier:     dbManager,
+
+		attachmentQuerier:  dbManager,
+		attachmentModifier: dbManager,
+		blobStore:          blobStore,
+		maxAttachmentSize:  maxAttachmentSize,
+
+		journalQuerier:  dbManager,
+		journalModifier: dbManager,
+
+		treatmentQuerier:  dbManager,
+		treatmentModifier: dbManager,
+
+		tankRoleModifier:   dbManager,
+		quarantineQuerier:  dbManager,
+		quarantineModifier: dbManager,
+
+		breedingQuerier:  dbManager,
+		breedingModifier: dbManager,
+
+		fertiliserQuerier:  dbManager,
+		fertiliserModifier: dbManager,
+		dosingQuerier:      dbManager,
+		dosingModifier:     dbManager,
+
+		individualQuerier:   dbManager,
+		individualModifier:  dbManager,
+		measurementQuerier:  dbManager,
+		measurementModifier: dbManager,
+		speciesQuerier:      dbManager,
+		speciesModifier:     dbManager,
+		growthQuerier:       dbManager,
+
+		userQuerier:  dbManager,
+		userModifier: dbManager,
+		tokens:       tokens,
+		allowSignup:  c.AllowSignup,
+
+		householdQuerier:  dbManager,
+		householdModifier: dbManager,
+		inviteQuerier:     dbManager,
+		inviteModifier:    dbManager,
+		apiKeyQuerier:     dbManager,
+		apiKeyModifier:    dbManager,
+
+		tankShareQuerier:  dbManager,
+		tankShareModifier: dbManager,
+
+		auditQuerier:  dbManager,
+		auditModifier: dbManager,
+
+		trashQuerier:  dbManager,
+		trashModifier: dbManager,
+
+		backupQuerier:  dbManager,
+		backupModifier: dbManager,
+
+		sensorReadingQuerier:  dbManager,
+		sensorReadingModifier: dbManager,
+
+		tankEventListener: dbManager,
 	}, nil
 }
 
+// Metrics returns the metrics of the server, including those of its connection pool and
+// the latest sensor readings
+func (s *Server) Metrics() *metrics.Metrics {
+	return s.metrics
+}
+
+// Close closes the connections to the database, waiting for those in use to be released, so
+// should only be called once the servers and background tasks using s have stopped
+func (s *Server) Close() {
+	s.dbCloser.Close()
+}
+
 func (s *Server) Heartbeat(ctx context.Context, req *trackmyfishv1alpha1.HeartbeatRequest) (*trackmyfishv1alpha1.HeartbeatResponse, error) {
 	return &trackmyfishv1alpha1.HeartbeatResponse{}, nil
 }
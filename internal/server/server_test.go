@@ -600,6 +600,7 @@ func TestStringToGender(t *testing.T) {
 }
 
 type fishMock struct {
+	getFishResponse    db.Fish
 	insertFishResponse db.Fish
 	deleteFishResponse db.Fish
 	listFishResponse   []db.Fish
@@ -614,6 +615,10 @@ func (f fishMock) DeleteFish(context.Context, int32) (db.Fish, error) {
 	return f.deleteFishResponse, f.err
 }
 
+func (f fishMock) GetFish(context.Context, int32) (db.Fish, error) {
+	return f.getFishResponse, f.err
+}
+
 func (f fishMock) ListFish(context.Context) ([]db.Fish, error) {
 	return f.listFishResponse, f.err
 }
@@ -623,6 +628,7 @@ type tankStatsMock struct {
 	insertTankStatisticsRequest  db.TankStatistic
 	deleteTankStatisticsResponse db.TankStatistic
 	listTankStatisticsResponse   []db.TankStatistic
+	insertManyRequest            []db.TankStatistic
 	err                          error
 }
 
@@ -632,6 +638,12 @@ func (f *tankStatsMock) InsertTankStatistic(ctx context.Context, req db.TankStat
 	return f.insertTankStatisticsResponse, f.err
 }
 
+func (f *tankStatsMock) InsertTankStatistics(ctx context.Context, req []db.TankStatistic) ([]db.TankStatistic, error) {
+	f.insertManyRequest = req
+
+	return req, f.err
+}
+
 func (f *tankStatsMock) DeleteTankStatistic(context.Context, int32) (db.TankStatistic, error) {
 	return f.deleteTankStatisticsResponse, f.err
 }
@@ -641,6 +653,7 @@ func (f *tankStatsMock) ListTankStatistics(context.Context) ([]db.TankStatistic,
 }
 
 type tankMock struct {
+	getTankResponse    db.Tank
 	insertTankResponse db.Tank
 	insertTankRequest  db.Tank
 	deleteTankResponse db.Tank
@@ -658,6 +671,10 @@ func (f *tankMock) DeleteTank(context.Context, int32) (db.Tank, error) {
 	return f.deleteTankResponse, f.err
 }
 
+func (f *tankMock) GetTank(context.Context, int32) (db.Tank, error) {
+	return f.getTankResponse, f.err
+}
+
 func (f *tankMock) ListTanks(context.Context) ([]db.Tank, error) {
 	return f.listTankResponse, f.err
 }
@@ -0,0 +1,410 @@
+package server
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/trackmyfish/backend/internal/auth"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+const (
+	tankSharesPath = "/api/v1alpha1/tank-shares"
+	// showcasePath serves the JSON view of a shared tank, and its photos
+	showcasePath = "/api/v1alpha1/showcase/"
+	// showcasePagePath serves the HTML view of a shared tank
+	showcasePagePath = "/showcase/"
+	// shareTokenPrefixLength is how many characters of a share token are stored, to
+	// recognise it by
+	shareTokenPrefixLength = 8
+)
+
+// showcaseCacheControl makes clients revalidate showcases, so revoking a share takes
+// effect immediately
+const showcaseCacheControl = "no-cache"
+
+// showcaseReadingsMaxAge is how recently a parameter must have been read to be shown, so
+// the readings of sensors which have stopped reporting disappear
+const showcaseReadingsMaxAge = 24 * time.Hour
+
+type tankShareQuerier interface {
+	ListTankShares(context.Context, int32) ([]db.TankShare, error)
+	GetTankShare(context.Context, string) (db.TankShare, error)
+}
+
+type tankShareModifier interface {
+	InsertTankShare(context.Context, db.TankShare, string) (db.TankShare, error)
+	DeleteTankShare(context.Context, int32, int32) (db.TankShare, error)
+}
+
+type tankShareRequest struct {
+	TankID int32 `json:"tankId"`
+}
+
+type tankShareResponse struct {
+	ID        int32     `json:"id"`
+	TankID    int32     `json:"tankId"`
+	Prefix    string    `json:"prefix"`
+	CreatedBy int32     `json:"createdBy"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Token and URL are only returned when the share is created
+	Token string `json:"token,omitempty"`
+	URL   string `json:"url,omitempty"`
+}
+
+// showcase is the read-only view of a shared tank. It's sanitised to what's worth showing
+// off, so leaves out IDs, the location of the tank, purchase dates and notes.
+type showcase struct {
+	Tank           showcaseTank      `json:"tank"`
+	Livestock      []showcaseFish    `json:"livestock"`
+	Photos         []showcasePhoto   `json:"photos"`
+	LatestReadings []showcaseReading `json:"latestReadings"`
+}
+
+type showcaseTank struct {
+	Name                string   `json:"name"`
+	Make                string   `json:"make"`
+	Model               string   `json:"model"`
+	Capacity            *float32 `json:"capacity,omitempty"`
+	CapacityMeasurement string   `json:"capacityMeasurement"`
+	Description         string   `json:"description"`
+}
+
+type showcaseFish struct {
+	Type    string `json:"type"`
+	Subtype string `json:"subtype"`
+	Color   string `json:"color"`
+	Gender  string `json:"gender"`
+	Count   int32  `json:"count"`
+}
+
+type showcasePhoto struct {
+	Caption      string `json:"caption"`
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnailUrl"`
+}
+
+type showcaseReading struct {
+	Parameter string    `json:"parameter"`
+	Value     float64   `json:"value"`
+	ReadAt    time.Time `json:"readAt"`
+}
+
+func toTankShareResponse(s db.TankShare) tankShareResponse {
+	return tankShareResponse{
+		ID:        s.ID,
+		TankID:    s.TankID,
+		Prefix:    s.Prefix,
+		CreatedBy: s.CreatedBy,
+		CreatedAt: s.CreatedAt,
+	}
+}
+
+// handleTankShares serves /api/v1alpha1/tank-shares
+//
+// GET lists the tank shares of the household. POST shares a tank, returning the token and
+// URL of its showcase. The token can't be retrieved later.
+func (s *Server) handleTankShares(w http.ResponseWriter, r *http.Request) {
+	id, ok := auth.FromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, auth.ErrUnauthenticated)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		rsp, err := s.tankShareQuerier.ListTankShares(r.Context(), id.HouseholdID)
+		if err != nil {
+			writeError(w, statusForError(err), errors.Wrap(err, "unable to list tank shares"))
+			return
+		}
+
+		shares := make([]tankShareResponse, len(rsp))
+		for i, share := range rsp {
+			shares[i] = toTankShareResponse(share)
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{"tankShares": shares})
+	case http.MethodPost:
+		s.addTankShare(w, r, id)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// handleTankShare serves /api/v1alpha1/tank-shares/{id}, where DELETE revokes the share
+func (s *Server) handleTankShare(w http.ResponseWriter, r *http.Request) {
+	id, ok := auth.FromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, auth.ErrUnauthenticated)
+		return
+	}
+
+	shareID, rest, err := pathID(r.URL.Path, tankSharesPath+"/")
+	if err != nil || rest != "" {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	if r.Method != http.MethodDelete {
+		methodNotAllowed(w, http.MethodDelete)
+		return
+	}
+
+	rsp, err := s.tankShareModifier.DeleteTankShare(r.Context(), id.HouseholdID, shareID)
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to delete tank share"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, toTankShareResponse(rsp))
+}
+
+func (s *Server) addTankShare(w http.ResponseWriter, r *http.Request, id auth.Identity) {
+	var req tankShareRequest
+	if err := readJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// the tank must be visible to the household to be shared
+	if _, err := s.tankQuerier.GetTank(r.Context(), req.TankID); err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to get tank"))
+		return
+	}
+
+	token, err := auth.NewOpaqueToken()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	rsp, err := s.tankShareModifier.InsertTankShare(r.Context(), db.TankShare{
+		HouseholdID: id.HouseholdID,
+		TankID:      req.TankID,
+		Prefix:      token[:shareTokenPrefixLength],
+		CreatedBy:   id.UserID,
+	}, auth.HashOpaqueToken(token))
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to add tank share"))
+		return
+	}
+
+	share := toTankShareResponse(rsp)
+	share.Token = token
+	share.URL = showcasePagePath + token
+
+	writeJSON(w, http.StatusCreated, share)
+}
+
+// handleShowcase serves the public /api/v1alpha1/showcase/{token}, returning the showcase
+// of the shared tank, and /api/v1alpha1/showcase/{token}/photos/{id} and
+// /api/v1alpha1/showcase/{token}/photos/{id}/thumbnail, returning its photos
+func (s *Server) handleShowcase(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, showcasePath), "/", 2)
+
+	ctx, share, ok := s.shareContext(w, r, parts[0])
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Cache-Control", showcaseCacheControl)
+	w.Header().Set("X-Robots-Tag", "noindex")
+
+	if len(parts) == 1 {
+		rsp, err := s.showcase(ctx, share, parts[0])
+		if err != nil {
+			writeShowcaseError(w, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, rsp)
+		return
+	}
+
+	id, rest, err := pathID(parts[1], "photos/")
+	if err != nil || (rest != "" && rest != "thumbnail") {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	a, err := s.attachmentQuerier.GetAttachment(ctx, id)
+	if err != nil {
+		writeShowcaseError(w, err)
+		return
+	}
+
+	if a.TankID == nil || *a.TankID != share.TankID {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	s.serveAttachment(w, r.WithContext(ctx), a, rest == "thumbnail")
+}
+
+// handleShowcasePage serves the public /showcase/{token}, rendering the showcase of the
+// shared tank as HTML
+func (s *Server) handleShowcasePage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	token := strings.TrimPrefix(r.URL.Path, showcasePagePath)
+
+	ctx, share, ok := s.shareContext(w, r, token)
+	if !ok {
+		return
+	}
+
+	rsp, err := s.showcase(ctx, share, token)
+	if err != nil {
+		writeShowcaseError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", showcaseCacheControl)
+	w.Header().Set("X-Robots-Tag", "noindex")
+
+	if err := showcaseTemplate.Execute(w, rsp); err != nil {
+		logrus.WithError(err).Error("unable to write showcase")
+	}
+}
+
+// shareContext looks up the share with token, returning a context scoped to the household
+// which shared it. An unknown token is written as not found.
+func (s *Server) shareContext(w http.ResponseWriter, r *http.Request, token string) (context.Context, db.TankShare, bool) {
+	if token == "" || strings.Contains(token, "/") {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return nil, db.TankShare{}, false
+	}
+
+	share, err := s.tankShareQuerier.GetTankShare(r.Context(), auth.HashOpaqueToken(token))
+	if err != nil {
+		writeShowcaseError(w, err)
+		return nil, share, false
+	}
+
+	return db.WithHousehold(r.Context(), share.HouseholdID), share, true
+}
+
+// showcase returns the showcase of a shared tank. Tank statistics aren't recorded per tank,
+// so aren't shown, only the latest sensor readings of the tank.
+func (s *Server) showcase(ctx context.Context, share db.TankShare, token string) (showcase, error) {
+	tank, err := s.tankQuerier.GetTank(ctx, share.TankID)
+	if err != nil {
+		return showcase{}, errors.Wrap(err, "unable to get tank")
+	}
+
+	fish, err := s.fishQuerier.ListFish(ctx)
+	if err != nil {
+		return showcase{}, errors.Wrap(err, "unable to list fish")
+	}
+
+	attachments, err := s.attachmentQuerier.ListAttachments(ctx, db.AttachmentFilter{TankID: &share.TankID})
+	if err != nil {
+		return showcase{}, errors.Wrap(err, "unable to list attachments")
+	}
+
+	readings, err := s.sensorReadingQuerier.LatestSensorReadings(ctx, time.Now().Add(-showcaseReadingsMaxAge))
+	if err != nil {
+		return showcase{}, errors.Wrap(err, "unable to get latest sensor readings")
+	}
+
+	rsp := showcase{
+		Tank: showcaseTank{
+			Name:                tank.Name,
+			Make:                tank.Make,
+			Model:               tank.Model,
+			Capacity:            tank.Capacity,
+			CapacityMeasurement: tank.CapacityMeasurement,
+			Description:         tank.Description,
+		},
+		Livestock:      make([]showcaseFish, 0),
+		Photos:         make([]showcasePhoto, len(attachments)),
+		LatestReadings: make([]showcaseReading, 0),
+	}
+
+	for _, f := range fish {
+		if f.TankID == nil || *f.TankID != share.TankID {
+			continue
+		}
+
+		rsp.Livestock = append(rsp.Livestock, showcaseFish{
+			Type:    f.Type,
+			Subtype: f.Subtype,
+			Color:   f.Color,
+			Gender:  f.Gender,
+			Count:   f.Count,
+		})
+	}
+
+	for i, a := range attachments {
+		url := showcasePath + token + "/photos/" + strconv.Itoa(int(a.ID))
+
+		rsp.Photos[i] = showcasePhoto{Caption: a.Caption, URL: url, ThumbnailURL: url + "/thumbnail"}
+	}
+
+	for _, r := range readings {
+		if r.TankID != share.TankID {
+			continue
+		}
+
+		rsp.LatestReadings = append(rsp.LatestReadings, showcaseReading{Parameter: r.Parameter, Value: r.Value, ReadAt: r.ReadAt})
+	}
+
+	return rsp, nil
+}
+
+// writeShowcaseError writes an error from a public showcase endpoint, only logging the
+// details of unexpected errors
+func writeShowcaseError(w http.ResponseWriter, err error) {
+	status := statusForError(err)
+	if status == http.StatusNotFound {
+		writeError(w, status, errors.New("not found"))
+		return
+	}
+
+	logrus.WithError(err).Error("unable to get showcase")
+
+	writeError(w, status, errors.New("unable to get showcase"))
+}
+
+var showcaseTemplate = template.Must(template.New("showcase").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{.Tank.Name}}</title>
+</head>
+<body>
+<h1>{{.Tank.Name}}</h1>
+{{if or .Tank.Make .Tank.Model}}<p>{{.Tank.Make}} {{.Tank.Model}}{{with .Tank.Capacity}} &middot; {{.}} {{$.Tank.CapacityMeasurement}}{{end}}</p>{{end}}
+{{with .Tank.Description}}<p>{{.}}</p>{{end}}
+{{if .Photos}}<h2>Photos</h2>
+{{range .Photos}}<figure><a href="{{.URL}}"><img src="{{.ThumbnailURL}}" alt="{{.Caption}}"></a>{{with .Caption}}<figcaption>{{.}}</figcaption>{{end}}</figure>
+{{end}}{{end}}
+<h2>Livestock</h2>
+{{if .Livestock}}<ul>
+{{range .Livestock}}<li>{{.Count}} &times; {{.Type}}{{with .Subtype}} ({{.}}){{end}}{{with .Color}}, {{.}}{{end}}</li>
+{{end}}</ul>{{else}}<p>No livestock yet.</p>{{end}}
+{{if .LatestReadings}}<h2>Latest Readings</h2>
+<ul>
+{{range .LatestReadings}}<li>{{.Parameter}}: {{.Value}}</li>
+{{end}}</ul>{{end}}
+</body>
+</html>
+`))
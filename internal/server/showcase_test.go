@@ -0,0 +1,209 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trackmyfish/backend/internal/auth"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+func TestAddTankShare(t *testing.T) {
+	tm := &tankMock{}
+	sm := &tankShareMock{}
+	s := Server{tankQuerier: tm, tankShareModifier: sm}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	user := auth.Identity{UserID: 3, Username: "nemo", HouseholdID: 2, Role: auth.RoleOwner}
+
+	request := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1alpha1/tank-shares", strings.NewReader(body))
+
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req.WithContext(auth.NewContext(req.Context(), user)))
+
+		return rec
+	}
+
+	t.Run("Given a request to share a tank", func(t *testing.T) {
+		t.Run("When the tank isn't found", func(t *testing.T) {
+			t.Run("Then not found is returned", func(t *testing.T) {
+				tm.err = &db.ErrNotFound{}
+				defer func() { tm.err = nil }()
+
+				rec := request(`{"tankId": 1}`)
+
+				assert.Equal(t, http.StatusNotFound, rec.Code)
+			})
+		})
+		t.Run("When the tank is found", func(t *testing.T) {
+			t.Run("Then the token is returned and only its hash is stored", func(t *testing.T) {
+				rec := request(`{"tankId": 1}`)
+
+				assert.Equal(t, http.StatusCreated, rec.Code)
+
+				var rsp tankShareResponse
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(&rsp))
+				assert.NotEmpty(t, rsp.Token)
+				assert.Equal(t, "/showcase/"+rsp.Token, rsp.URL)
+				assert.Equal(t, auth.HashOpaqueToken(rsp.Token), sm.insertTankShareHash)
+				assert.Equal(t, db.TankShare{
+					HouseholdID: 2,
+					TankID:      1,
+					Prefix:      rsp.Token[:shareTokenPrefixLength],
+					CreatedBy:   3,
+				}, sm.insertTankShareRequest)
+			})
+		})
+	})
+}
+
+func TestShowcase(t *testing.T) {
+	tankID, otherTankID := int32(1), int32(2)
+
+	tm := &scopedTankMock{tankMock: &tankMock{getTankResponse: db.Tank{ID: 1, Name: "Reef <3", Location: "Living room", Description: "Mixed reef"}}}
+	sm := &tankShareMock{getTankShareResponse: db.TankShare{ID: 4, HouseholdID: 2, TankID: tankID}}
+	fm := fishMock{listFishResponse: []db.Fish{
+		{ID: 1, TankID: &tankID, Type: "Clownfish", Count: 2, PurchaseDate: "2021-08-06"},
+		{ID: 2, TankID: &otherTankID, Type: "Guppy", Count: 5},
+	}}
+	am := &attachmentMock{
+		listAttachmentsResponse: []db.Attachment{{ID: 7, TankID: &tankID, Caption: "Front"}},
+		getAttachmentResponse:   db.Attachment{ID: 7, TankID: &tankID, ContentType: "image/png", BlobKey: "blob.png", ThumbnailKey: "blob_thumb.jpg"},
+	}
+	readAt := time.Date(2021, 8, 7, 10, 0, 0, 0, time.UTC)
+	rm := &readingsMock{latestResponse: []db.LatestSensorReading{
+		{HouseholdID: 2, TankID: tankID, Parameter: "ph", Value: 8.2, ReadAt: readAt},
+		{HouseholdID: 2, TankID: otherTankID, Parameter: "nitrate", Value: 20, ReadAt: readAt},
+	}}
+	bs := &blobStoreMock{blobs: map[string][]byte{"blob.png": []byte("image"), "blob_thumb.jpg": []byte("thumb")}}
+
+	s := Server{tankQuerier: tm, tankShareQuerier: sm, fishQuerier: fm, attachmentQuerier: am, sensorReadingQuerier: rm, blobStore: bs}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+		return rec
+	}
+
+	t.Run("Given a shared tank", func(t *testing.T) {
+		t.Run("When its showcase is requested", func(t *testing.T) {
+			t.Run("Then a sanitised view of the tank is returned", func(t *testing.T) {
+				rec := get("/api/v1alpha1/showcase/token")
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Equal(t, auth.HashOpaqueToken("token"), sm.getTankShareHash)
+				assert.Equal(t, int32(2), tm.household)
+				assert.Equal(t, &tankID, am.listAttachmentsRequest.TankID)
+				assert.NotContains(t, rec.Body.String(), "Living room")
+				assert.NotContains(t, rec.Body.String(), "2021-08-06")
+
+				var rsp showcase
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(&rsp))
+				assert.Equal(t, "Reef <3", rsp.Tank.Name)
+				assert.Equal(t, []showcaseFish{{Type: "Clownfish", Count: 2}}, rsp.Livestock)
+				assert.Equal(t, []showcasePhoto{{
+					Caption:      "Front",
+					URL:          "/api/v1alpha1/showcase/token/photos/7",
+					ThumbnailURL: "/api/v1alpha1/showcase/token/photos/7/thumbnail",
+				}}, rsp.Photos)
+				assert.Equal(t, []showcaseReading{{Parameter: "ph", Value: 8.2, ReadAt: readAt}}, rsp.LatestReadings)
+				assert.True(t, rm.latestSince.After(time.Now().Add(-showcaseReadingsMaxAge-time.Minute)))
+			})
+		})
+		t.Run("When its page is requested", func(t *testing.T) {
+			t.Run("Then it is rendered as HTML", func(t *testing.T) {
+				rec := get("/showcase/token")
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Equal(t, "text/html; charset=utf-8", rec.Header().Get("Content-Type"))
+				assert.Contains(t, rec.Body.String(), "<h1>Reef &lt;3</h1>")
+				assert.Contains(t, rec.Body.String(), `src="/api/v1alpha1/showcase/token/photos/7/thumbnail"`)
+				assert.Contains(t, rec.Body.String(), "<li>ph: 8.2</li>")
+				assert.NotContains(t, rec.Body.String(), "nitrate")
+			})
+		})
+		t.Run("When one of its photos is requested", func(t *testing.T) {
+			t.Run("Then the photo is returned", func(t *testing.T) {
+				rec := get("/api/v1alpha1/showcase/token/photos/7/thumbnail")
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Equal(t, "thumb", rec.Body.String())
+			})
+		})
+		t.Run("When a photo of another tank is requested", func(t *testing.T) {
+			t.Run("Then not found is returned", func(t *testing.T) {
+				am.getAttachmentResponse.TankID = &otherTankID
+				defer func() { am.getAttachmentResponse.TankID = &tankID }()
+
+				rec := get("/api/v1alpha1/showcase/token/photos/7")
+
+				assert.Equal(t, http.StatusNotFound, rec.Code)
+			})
+		})
+	})
+
+	t.Run("Given a revoked or unknown token", func(t *testing.T) {
+		sm.err = &db.ErrNotFound{}
+		defer func() { sm.err = nil }()
+
+		t.Run("When its showcase or page is requested", func(t *testing.T) {
+			t.Run("Then not found is returned", func(t *testing.T) {
+				assert.Equal(t, http.StatusNotFound, get("/api/v1alpha1/showcase/token").Code)
+				assert.Equal(t, http.StatusNotFound, get("/showcase/token").Code)
+			})
+		})
+	})
+}
+
+// scopedTankMock records the household queries for the tank were scoped to
+type scopedTankMock struct {
+	*tankMock
+	household int32
+}
+
+func (m *scopedTankMock) GetTank(ctx context.Context, id int32) (db.Tank, error) {
+	m.household, _ = db.HouseholdFromContext(ctx)
+
+	return m.tankMock.GetTank(ctx, id)
+}
+
+type tankShareMock struct {
+	insertTankShareRequest db.TankShare
+	insertTankShareHash    string
+	getTankShareHash       string
+	getTankShareResponse   db.TankShare
+	err                    error
+}
+
+func (m *tankShareMock) ListTankShares(context.Context, int32) ([]db.TankShare, error) {
+	return nil, m.err
+}
+
+func (m *tankShareMock) GetTankShare(ctx context.Context, hash string) (db.TankShare, error) {
+	m.getTankShareHash = hash
+
+	return m.getTankShareResponse, m.err
+}
+
+func (m *tankShareMock) InsertTankShare(ctx context.Context, req db.TankShare, hash string) (db.TankShare, error) {
+	m.insertTankShareRequest, m.insertTankShareHash = req, hash
+
+	return req, m.err
+}
+
+func (m *tankShareMock) DeleteTankShare(ctx context.Context, householdID, id int32) (db.TankShare, error) {
+	return db.TankShare{ID: id, HouseholdID: householdID}, m.err
+}
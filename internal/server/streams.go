@@ -0,0 +1,216 @@
+package server
+
+import (
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	// registers google/protobuf/timestamp.proto, which streamsProto depends on
+	_ "google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// The streaming RPCs can't be added to the TrackMyFishService, which is generated from the
+// proto repository, so they're served by services of their own, described by streamsProto
+// and registered by hand the same way generated services are. Their messages are
+// dynamicpb messages of the descriptors.
+const (
+	sensorReadingService = "trackmyfish.v1alpha1.SensorReadingService"
+	streamReadingsMethod = "/" + sensorReadingService + "/StreamReadings"
+
+	tankWatchService = "trackmyfish.v1alpha1.TankWatchService"
+	watchTankMethod  = "/" + tankWatchService + "/WatchTank"
+)
+
+// streamsProto is the descriptor of trackmyfish/v1alpha1/streams.proto, which uses the
+// TankStatistic and Fish messages of the TrackMyFishService, equivalent to:
+//
+//	message SensorReading {
+//	  string sensor_id = 1;
+//	  int64 sequence = 2;
+//	  int32 tank_id = 3;
+//	  string parameter = 4;
+//	  optional double value = 5;
+//	  google.protobuf.Timestamp read_at = 6;
+//	  // id is only set by the server, in TankEvents
+//	  int64 id = 7;
+//	}
+//
+//	message ReadingsAck {
+//	  int32 received = 1;
+//	  int64 written = 2;
+//	  int64 duplicates = 3;
+//	  map<string, int64> sequences = 4;
+//	  repeated ReadingError errors = 5;
+//	  string error = 6;
+//	}
+//
+//	message ReadingError {
+//	  int32 line = 1;
+//	  string error = 2;
+//	}
+//
+//	message WatchTankRequest {
+//	  int32 tank_id = 1;
+//	}
+//
+//	message TankEvent {
+//	  // type is "reading", "tank-statistic" or "fish", and only the entity of the type is set
+//	  string type = 1;
+//	  string operation = 2;
+//	  SensorReading reading = 3;
+//	  TankStatistic tank_statistic = 4;
+//	  Fish fish = 5;
+//	}
+//
+//	service SensorReadingService {
+//	  rpc StreamReadings(stream SensorReading) returns (stream ReadingsAck);
+//	}
+//
+//	service TankWatchService {
+//	  rpc WatchTank(WatchTankRequest) returns (stream TankEvent);
+//	}
+const streamsProto = `
+name: "trackmyfish/v1alpha1/streams.proto"
+package: "trackmyfish.v1alpha1"
+dependency: "google/protobuf/timestamp.proto"
+dependency: "trackmyfish/v1alpha1/trackmyfish.proto"
+syntax: "proto3"
+message_type: {
+	name: "SensorReading"
+	field: { name: "sensor_id" json_name: "sensorId" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING }
+	field: { name: "sequence" json_name: "sequence" number: 2 label: LABEL_OPTIONAL type: TYPE_INT64 }
+	field: { name: "tank_id" json_name: "tankId" number: 3 label: LABEL_OPTIONAL type: TYPE_INT32 }
+	field: { name: "parameter" json_name: "parameter" number: 4 label: LABEL_OPTIONAL type: TYPE_STRING }
+	field: { name: "value" json_name: "value" number: 5 label: LABEL_OPTIONAL type: TYPE_DOUBLE oneof_index: 0 proto3_optional: true }
+	field: { name: "read_at" json_name: "readAt" number: 6 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".google.protobuf.Timestamp" }
+	field: { name: "id" json_name: "id" number: 7 label: LABEL_OPTIONAL type: TYPE_INT64 }
+	oneof_decl: { name: "_value" }
+}
+message_type: {
+	name: "ReadingsAck"
+	field: { name: "received" json_name: "received" number: 1 label: LABEL_OPTIONAL type: TYPE_INT32 }
+	field: { name: "written" json_name: "written" number: 2 label: LABEL_OPTIONAL type: TYPE_INT64 }
+	field: { name: "duplicates" json_name: "duplicates" number: 3 label: LABEL_OPTIONAL type: TYPE_INT64 }
+	field: { name: "sequences" json_name: "sequences" number: 4 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".trackmyfish.v1alpha1.ReadingsAck.SequencesEntry" }
+	field: { name: "errors" json_name: "errors" number: 5 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".trackmyfish.v1alpha1.ReadingError" }
+	field: { name: "error" json_name: "error" number: 6 label: LABEL_OPTIONAL type: TYPE_STRING }
+	nested_type: {
+		name: "SequencesEntry"
+		field: { name: "key" json_name: "key" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING }
+		field: { name: "value" json_name: "value" number: 2 label: LABEL_OPTIONAL type: TYPE_INT64 }
+		options: { map_entry: true }
+	}
+}
+message_type: {
+	name: "ReadingError"
+	field: { name: "line" json_name: "line" number: 1 label: LABEL_OPTIONAL type: TYPE_INT32 }
+	field: { name: "error" json_name: "error" number: 2 label: LABEL_OPTIONAL type: TYPE_STRING }
+}
+message_type: {
+	name: "WatchTankRequest"
+	field: { name: "tank_id" json_name: "tankId" number: 1 label: LABEL_OPTIONAL type: TYPE_INT32 }
+}
+message_type: {
+	name: "TankEvent"
+	field: { name: "type" json_name: "type" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING }
+	field: { name: "operation" json_name: "operation" number: 2 label: LABEL_OPTIONAL type: TYPE_STRING }
+	field: { name: "reading" json_name: "reading" number: 3 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".trackmyfish.v1alpha1.SensorReading" }
+	field: { name: "tank_statistic" json_name: "tankStatistic" number: 4 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".trackmyfish.v1alpha1.TankStatistic" }
+	field: { name: "fish" json_name: "fish" number: 5 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".trackmyfish.v1alpha1.Fish" }
+}
+service: {
+	name: "SensorReadingService"
+	method: {
+		name: "StreamReadings"
+		input_type: ".trackmyfish.v1alpha1.SensorReading"
+		output_type: ".trackmyfish.v1alpha1.ReadingsAck"
+		client_streaming: true
+		server_streaming: true
+	}
+}
+service: {
+	name: "TankWatchService"
+	method: {
+		name: "WatchTank"
+		input_type: ".trackmyfish.v1alpha1.WatchTankRequest"
+		output_type: ".trackmyfish.v1alpha1.TankEvent"
+		server_streaming: true
+	}
+}
+`
+
+// streamsFile is registered with the global registry so the services can be discovered with
+// reflection, e.g. by grpcurl
+var streamsFile = registerFile(streamsProto)
+
+var (
+	sensorReadingDesc    = streamsMessage("SensorReading")
+	readingsAckDesc      = streamsMessage("ReadingsAck")
+	watchTankRequestDesc = streamsMessage("WatchTankRequest")
+	tankEventDesc        = streamsMessage("TankEvent")
+)
+
+// RegisterStreams registers the services of the streaming RPCs on g
+func (s *Server) RegisterStreams(g *grpc.Server) {
+	g.RegisterService(&grpc.ServiceDesc{
+		ServiceName: sensorReadingService,
+		HandlerType: (*interface{})(nil),
+		Streams: []grpc.StreamDesc{
+			{
+				StreamName: "StreamReadings",
+				Handler: func(_ interface{}, stream grpc.ServerStream) error {
+					return s.streamReadingsRPC(stream)
+				},
+				ClientStreams: true,
+				ServerStreams: true,
+			},
+		},
+		Metadata: streamsFile.Path(),
+	}, s)
+
+	g.RegisterService(&grpc.ServiceDesc{
+		ServiceName: tankWatchService,
+		HandlerType: (*interface{})(nil),
+		Streams: []grpc.StreamDesc{
+			{
+				StreamName: "WatchTank",
+				Handler: func(_ interface{}, stream grpc.ServerStream) error {
+					return s.watchTankRPC(stream)
+				},
+				ServerStreams: true,
+			},
+		},
+		Metadata: streamsFile.Path(),
+	}, s)
+}
+
+func registerFile(text string) protoreflect.FileDescriptor {
+	var fdp descriptorpb.FileDescriptorProto
+	if err := prototext.Unmarshal([]byte(text), &fdp); err != nil {
+		panic(errors.Wrap(err, "unable to parse file descriptor"))
+	}
+
+	fd, err := protodesc.NewFile(&fdp, protoregistry.GlobalFiles)
+	if err != nil {
+		panic(errors.Wrapf(err, "unable to build file descriptor %s", fdp.GetName()))
+	}
+
+	if err := protoregistry.GlobalFiles.RegisterFile(fd); err != nil {
+		panic(errors.Wrapf(err, "unable to register file descriptor %s", fd.Path()))
+	}
+
+	return fd
+}
+
+func streamsMessage(name protoreflect.Name) protoreflect.MessageDescriptor {
+	md := streamsFile.Messages().ByName(name)
+	if md == nil {
+		panic(errors.Errorf("message %s not found in %s", name, streamsFile.Path()))
+	}
+
+	return md
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// serveStreams serves the streaming RPCs of s in memory until the test ends, returning a
+// connection to them
+func serveStreams(t *testing.T, s *Server) *grpc.ClientConn {
+	lis := bufconn.Listen(1 << 20)
+
+	g := grpc.NewServer()
+	s.RegisterStreams(g)
+
+	go func() { _ = g.Serve(lis) }()
+	t.Cleanup(g.Stop)
+
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	assert.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return conn
+}
+
+func TestRegisterStreams(t *testing.T) {
+	t.Run("Given the streaming services are registered", func(t *testing.T) {
+		g := grpc.NewServer()
+		(&Server{}).RegisterStreams(g)
+
+		t.Run("When they're described", func(t *testing.T) {
+			t.Run("Then their methods are found in the registry", func(t *testing.T) {
+				for service, methods := range g.GetServiceInfo() {
+					d, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(service))
+					assert.NoError(t, err)
+
+					sd, ok := d.(protoreflect.ServiceDescriptor)
+					assert.True(t, ok)
+
+					for _, m := range methods.Methods {
+						md := sd.Methods().ByName(protoreflect.Name(m.Name))
+						assert.NotNil(t, md)
+						assert.Equal(t, m.IsClientStream, md.IsStreamingClient())
+						assert.Equal(t, m.IsServerStream, md.IsStreamingServer())
+					}
+				}
+
+				assert.Len(t, g.GetServiceInfo(), 2)
+			})
+		})
+	})
+}
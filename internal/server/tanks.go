@@ -0,0 +1,73 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+// tankRoles are the accepted values for a tank's role
+var tankRoles = map[string]bool{
+	db.TankRoleDisplay:    true,
+	db.TankRoleQuarantine: true,
+	db.TankRoleHospital:   true,
+	db.TankRoleBreeding:   true,
+}
+
+type tankRoleModifier interface {
+	SetTankRole(context.Context, int32, string) (db.Tank, error)
+}
+
+type tankRoleRequest struct {
+	Role string `json:"role"`
+}
+
+type tankRoleResponse struct {
+	TankID int32  `json:"tankId"`
+	Role   string `json:"role"`
+}
+
+// handleTankRole serves /api/v1alpha1/tank-roles/{id}, where PUT sets the role of the tank
+func (s *Server) handleTankRole(w http.ResponseWriter, r *http.Request) {
+	id, rest, err := pathID(r.URL.Path, "/api/v1alpha1/tank-roles/")
+	if err != nil || rest != "" {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	if r.Method != http.MethodPut {
+		methodNotAllowed(w, http.MethodPut)
+		return
+	}
+
+	var req tankRoleRequest
+	if err := readJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	role := strings.ToUpper(req.Role)
+	if !tankRoles[role] {
+		writeError(w, http.StatusBadRequest, errors.Errorf("invalid role %q", req.Role))
+		return
+	}
+
+	before, err := s.tankQuerier.GetTank(r.Context(), id)
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to get tank"))
+		return
+	}
+
+	auditBefore(r.Context(), tankRoleResponse{TankID: before.ID, Role: before.Role})
+
+	rsp, err := s.tankRoleModifier.SetTankRole(r.Context(), id, role)
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to set tank role"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, tankRoleResponse{TankID: rsp.ID, Role: rsp.Role})
+}
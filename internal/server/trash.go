@@ -0,0 +1,151 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+const trashPath = "/api/v1alpha1/trash"
+
+// DefaultTrashRetention is how long deleted fish, tanks and tank statistics are kept in
+// the trash before they're purged
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+// trashPurgeInterval is how often the trash is checked for items to purge
+const trashPurgeInterval = time.Hour
+
+type trashQuerier interface {
+	ListTrash(context.Context) ([]db.TrashItem, error)
+}
+
+type trashModifier interface {
+	RestoreFish(context.Context, int32) (db.Fish, error)
+	RestoreTank(context.Context, int32) (db.Tank, error)
+	RestoreTankStatistic(context.Context, int32) (db.TankStatistic, error)
+	PurgeTrash(context.Context, time.Time) (int64, []db.Attachment, error)
+}
+
+type trashItemResponse struct {
+	Type      string     `json:"type"`
+	ID        int32      `json:"id"`
+	Name      string     `json:"name"`
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+}
+
+func toTrashItemResponse(i db.TrashItem) trashItemResponse {
+	return trashItemResponse{Type: i.Type, ID: i.ID, Name: i.Name, DeletedAt: &i.DeletedAt}
+}
+
+// handleTrash serves /api/v1alpha1/trash, the HTTP equivalent of a ListTrash RPC, where
+// GET lists the deleted fish, tanks and tank statistics, most recently deleted first
+func (s *Server) handleTrash(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	rsp, err := s.trashQuerier.ListTrash(r.Context())
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to list trash"))
+		return
+	}
+
+	items := make([]trashItemResponse, len(rsp))
+	for i, item := range rsp {
+		items[i] = toTrashItemResponse(item)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"items": items})
+}
+
+// handleTrashItem serves /api/v1alpha1/trash/{type}/{id}/restore, the HTTP equivalent of
+// the Restore RPCs, where POST moves the item out of the trash. type is one of fish, tanks
+// or tank-statistics.
+func (s *Server) handleTrashItem(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, trashPath+"/"), "/", 2)
+	if len(parts) != 2 {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	id, rest, err := pathID(parts[1], "")
+	if err != nil || rest != "restore" {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	var item trashItemResponse
+
+	switch parts[0] {
+	case db.TrashTypeFish:
+		f, err := s.trashModifier.RestoreFish(r.Context(), id)
+		if err != nil {
+			writeError(w, statusForError(err), errors.Wrap(err, "unable to restore fish"))
+			return
+		}
+
+		item = trashItemResponse{Type: db.TrashTypeFish, ID: f.ID, Name: strings.TrimSpace(f.Type + " " + f.Subtype)}
+	case db.TrashTypeTank:
+		t, err := s.trashModifier.RestoreTank(r.Context(), id)
+		if err != nil {
+			writeError(w, statusForError(err), errors.Wrap(err, "unable to restore tank"))
+			return
+		}
+
+		item = trashItemResponse{Type: db.TrashTypeTank, ID: t.ID, Name: t.Name}
+	case db.TrashTypeTankStatistic:
+		ts, err := s.trashModifier.RestoreTankStatistic(r.Context(), id)
+		if err != nil {
+			writeError(w, statusForError(err), errors.Wrap(err, "unable to restore tank statistic"))
+			return
+		}
+
+		item = trashItemResponse{Type: db.TrashTypeTankStatistic, ID: ts.ID, Name: ts.TestDate}
+	default:
+		writeError(w, http.StatusNotFound, errors.Errorf("unknown trash type %q", parts[0]))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, item)
+}
+
+// PurgeTrash permanently deletes the items which have been in the trash for longer than
+// retention, checking every trashPurgeInterval until ctx is done, along with the blobs of
+// the attachments of purged tanks and fish. Nothing is purged when retention isn't positive.
+func (s *Server) PurgeTrash(ctx context.Context, retention time.Duration) {
+	if retention <= 0 {
+		logrus.Info("Trash retention disabled, deleted items will be kept until restored")
+		return
+	}
+
+	ticker := time.NewTicker(trashPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		_, attachments, err := s.trashModifier.PurgeTrash(ctx, time.Now().Add(-retention))
+		if err != nil {
+			logrus.WithError(err).Error("unable to purge trash")
+		}
+
+		for _, a := range attachments {
+			s.deleteBlobs(ctx, a)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+func TestListTrash(t *testing.T) {
+	deletedAt := time.Date(2021, 8, 6, 10, 0, 0, 0, time.UTC)
+
+	tm := &trashMock{listTrashResponse: []db.TrashItem{{Type: db.TrashTypeTank, ID: 1, Name: "Nano", DeletedAt: deletedAt}}}
+	s := Server{trashQuerier: tm}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	t.Run("Given items in the trash", func(t *testing.T) {
+		t.Run("When the trash is listed", func(t *testing.T) {
+			t.Run("Then the items are returned", func(t *testing.T) {
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1alpha1/trash", nil))
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+
+				var rsp struct {
+					Items []trashItemResponse `json:"items"`
+				}
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(&rsp))
+				assert.Equal(t, []trashItemResponse{{Type: db.TrashTypeTank, ID: 1, Name: "Nano", DeletedAt: &deletedAt}}, rsp.Items)
+			})
+		})
+	})
+}
+
+func TestRestoreFromTrash(t *testing.T) {
+	tm := &trashMock{}
+	s := Server{trashModifier: tm}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	request := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+
+		return rec
+	}
+
+	t.Run("Given an item in the trash", func(t *testing.T) {
+		testCases := []struct {
+			desc     string
+			path     string
+			expected trashItemResponse
+		}{
+			{desc: "fish", path: "/api/v1alpha1/trash/fish/3/restore", expected: trashItemResponse{Type: db.TrashTypeFish, ID: 3, Name: "Shrimp Cherry"}},
+			{desc: "tank", path: "/api/v1alpha1/trash/tanks/3/restore", expected: trashItemResponse{Type: db.TrashTypeTank, ID: 3, Name: "Nano"}},
+			{desc: "tank statistic", path: "/api/v1alpha1/trash/tank-statistics/3/restore", expected: trashItemResponse{Type: db.TrashTypeTankStatistic, ID: 3, Name: "2021/08/06 10:00"}},
+		}
+		for _, tC := range testCases {
+			t.Run("When a "+tC.desc+" is restored", func(t *testing.T) {
+				t.Run("Then it is returned", func(t *testing.T) {
+					rec := request(http.MethodPost, tC.path)
+
+					assert.Equal(t, http.StatusOK, rec.Code)
+
+					var rsp trashItemResponse
+					assert.NoError(t, json.NewDecoder(rec.Body).Decode(&rsp))
+					assert.Equal(t, tC.expected, rsp)
+					assert.Equal(t, int32(3), tm.restoreRequest)
+				})
+			})
+		}
+
+		t.Run("When it isn't in the trash", func(t *testing.T) {
+			t.Run("Then not found is returned", func(t *testing.T) {
+				tm.err = &db.ErrNotFound{}
+				defer func() { tm.err = nil }()
+
+				assert.Equal(t, http.StatusNotFound, request(http.MethodPost, "/api/v1alpha1/trash/fish/3/restore").Code)
+			})
+		})
+		t.Run("When the type or path is unknown", func(t *testing.T) {
+			t.Run("Then not found is returned", func(t *testing.T) {
+				assert.Equal(t, http.StatusNotFound, request(http.MethodPost, "/api/v1alpha1/trash/journal/3/restore").Code)
+				assert.Equal(t, http.StatusNotFound, request(http.MethodPost, "/api/v1alpha1/trash/fish/3").Code)
+				assert.Equal(t, http.StatusNotFound, request(http.MethodPost, "/api/v1alpha1/trash/fish").Code)
+			})
+		})
+		t.Run("When it is restored with GET", func(t *testing.T) {
+			t.Run("Then method not allowed is returned", func(t *testing.T) {
+				assert.Equal(t, http.StatusMethodNotAllowed, request(http.MethodGet, "/api/v1alpha1/trash/fish/3/restore").Code)
+			})
+		})
+	})
+}
+
+func TestPurgeTrash(t *testing.T) {
+	t.Run("Given a retention period", func(t *testing.T) {
+		t.Run("When the trash is purged", func(t *testing.T) {
+			t.Run("Then items deleted before the retention period are purged until cancelled", func(t *testing.T) {
+				tm := &trashMock{}
+				s := Server{trashModifier: tm}
+
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+
+				before := time.Now()
+				s.PurgeTrash(ctx, time.Hour)
+
+				assert.WithinDuration(t, before.Add(-time.Hour), tm.purgeRequest, time.Minute)
+			})
+			t.Run("Then the blobs of the attachments of purged tanks and fish are deleted", func(t *testing.T) {
+				tm := &trashMock{purgeAttachments: []db.Attachment{{ID: 7, BlobKey: "blob.png", ThumbnailKey: "blob_thumb.jpg"}}}
+				bs := &blobStoreMock{blobs: map[string][]byte{"blob.png": []byte("image"), "blob_thumb.jpg": []byte("thumb"), "other.png": []byte("other")}}
+				s := Server{trashModifier: tm, blobStore: bs}
+
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+
+				s.PurgeTrash(ctx, time.Hour)
+
+				assert.Equal(t, map[string][]byte{"other.png": []byte("other")}, bs.blobs)
+			})
+		})
+	})
+
+	t.Run("Given no retention period", func(t *testing.T) {
+		t.Run("When the trash is purged", func(t *testing.T) {
+			t.Run("Then nothing is purged", func(t *testing.T) {
+				tm := &trashMock{}
+				s := Server{trashModifier: tm}
+
+				s.PurgeTrash(context.Background(), 0)
+
+				assert.True(t, tm.purgeRequest.IsZero())
+			})
+		})
+	})
+}
+
+type trashMock struct {
+	listTrashResponse []db.TrashItem
+	restoreRequest    int32
+	purgeRequest      time.Time
+	purgeAttachments  []db.Attachment
+	err               error
+}
+
+func (m *trashMock) ListTrash(context.Context) ([]db.TrashItem, error) {
+	return m.listTrashResponse, m.err
+}
+
+func (m *trashMock) RestoreFish(ctx context.Context, id int32) (db.Fish, error) {
+	m.restoreRequest = id
+
+	return db.Fish{ID: id, Type: "Shrimp", Subtype: "Cherry"}, m.err
+}
+
+func (m *trashMock) RestoreTank(ctx context.Context, id int32) (db.Tank, error) {
+	m.restoreRequest = id
+
+	return db.Tank{ID: id, Name: "Nano"}, m.err
+}
+
+func (m *trashMock) RestoreTankStatistic(ctx context.Context, id int32) (db.TankStatistic, error) {
+	m.restoreRequest = id
+
+	return db.TankStatistic{ID: id, TestDate: "2021/08/06 10:00"}, m.err
+}
+
+func (m *trashMock) PurgeTrash(ctx context.Context, before time.Time) (int64, []db.Attachment, error) {
+	m.purgeRequest = before
+
+	return int64(len(m.purgeAttachments)), m.purgeAttachments, m.err
+}
@@ -0,0 +1,338 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+// maxTreatmentDoses bounds the size of a generated dose schedule
+const maxTreatmentDoses = 500
+
+type treatmentQuerier interface {
+	GetTreatment(context.Context, int32) (db.Treatment, error)
+	ListTreatments(context.Context, db.TreatmentFilter) ([]db.Treatment, error)
+	ListTreatmentDoses(context.Context, int32) ([]db.TreatmentDose, error)
+	ListDueDoses(context.Context, time.Time) ([]db.TreatmentDose, error)
+}
+
+type treatmentModifier interface {
+	InsertTreatment(context.Context, db.Treatment) (db.Treatment, error)
+	DeleteTreatment(context.Context, int32) (db.Treatment, error)
+	AdministerDose(context.Context, int32, time.Time) (db.TreatmentDose, error)
+}
+
+type treatmentRequest struct {
+	TankID            int32   `json:"tankId"`
+	FishIDs           []int32 `json:"fishIds"`
+	Medication        string  `json:"medication"`
+	Dose              float32 `json:"dose"`
+	DoseUnit          string  `json:"doseUnit"`
+	DoseIntervalHours int32   `json:"doseIntervalHours"`
+	StartDate         string  `json:"startDate"`
+	EndDate           string  `json:"endDate"`
+	Notes             string  `json:"notes"`
+}
+
+type treatmentResponse struct {
+	ID                int32     `json:"id"`
+	TankID            int32     `json:"tankId"`
+	FishIDs           []int32   `json:"fishIds"`
+	Medication        string    `json:"medication"`
+	Dose              float32   `json:"dose"`
+	DoseUnit          string    `json:"doseUnit"`
+	DoseIntervalHours int32     `json:"doseIntervalHours"`
+	StartDate         time.Time `json:"startDate"`
+	EndDate           time.Time `json:"endDate"`
+	Notes             string    `json:"notes"`
+	// Active is true while the course is in progress
+	Active bool `json:"active"`
+}
+
+type treatmentDoseResponse struct {
+	ID             int32      `json:"id"`
+	TreatmentID    int32      `json:"treatmentId"`
+	TankID         int32      `json:"tankId"`
+	Medication     string     `json:"medication"`
+	Dose           float32    `json:"dose"`
+	DoseUnit       string     `json:"doseUnit"`
+	DueAt          time.Time  `json:"dueAt"`
+	AdministeredAt *time.Time `json:"administeredAt,omitempty"`
+}
+
+type administerDoseRequest struct {
+	AdministeredAt string `json:"administeredAt"`
+}
+
+func toTreatmentResponse(t db.Treatment, now time.Time) treatmentResponse {
+	fishIDs := t.FishIDs
+	if fishIDs == nil {
+		fishIDs = []int32{}
+	}
+
+	return treatmentResponse{
+		ID:                t.ID,
+		TankID:            t.TankID,
+		FishIDs:           fishIDs,
+		Medication:        t.Medication,
+		Dose:              t.Dose,
+		DoseUnit:          t.DoseUnit,
+		DoseIntervalHours: t.DoseIntervalHours,
+		StartDate:         t.StartDate,
+		EndDate:           t.EndDate,
+		Notes:             t.Notes,
+		Active:            !now.Before(t.StartDate) && !now.After(t.EndDate),
+	}
+}
+
+func toTreatmentDoseResponses(doses []db.TreatmentDose) []treatmentDoseResponse {
+	rsp := make([]treatmentDoseResponse, len(doses))
+	for i, d := range doses {
+		rsp[i] = treatmentDoseResponse{
+			ID:             d.ID,
+			TreatmentID:    d.TreatmentID,
+			TankID:         d.TankID,
+			Medication:     d.Medication,
+			Dose:           d.Dose,
+			DoseUnit:       d.DoseUnit,
+			DueAt:          d.DueAt,
+			AdministeredAt: d.AdministeredAt,
+		}
+	}
+
+	return rsp
+}
+
+// handleTreatments serves /api/v1alpha1/treatments
+//
+// GET lists treatments, newest first, optionally filtered by tankId, fishId (giving the
+// treatment history of a fish) or active=true. POST adds a new treatment and generates
+// its dose schedule.
+func (s *Server) handleTreatments(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.listTreatments(w, r)
+	case http.MethodPost:
+		s.addTreatment(w, r)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// handleTreatment serves /api/v1alpha1/treatments/{id} and /api/v1alpha1/treatments/{id}/doses
+func (s *Server) handleTreatment(w http.ResponseWriter, r *http.Request) {
+	id, rest, err := pathID(r.URL.Path, "/api/v1alpha1/treatments/")
+	if err != nil {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	switch {
+	case rest == "" && r.Method == http.MethodGet:
+		rsp, err := s.treatmentQuerier.GetTreatment(r.Context(), id)
+		if err != nil {
+			writeError(w, statusForError(err), errors.Wrap(err, "unable to get treatment"))
+			return
+		}
+
+		writeJSON(w, http.StatusOK, toTreatmentResponse(rsp, time.Now()))
+	case rest == "" && r.Method == http.MethodDelete:
+		rsp, err := s.treatmentModifier.DeleteTreatment(r.Context(), id)
+		if err != nil {
+			writeError(w, statusForError(err), errors.Wrap(err, "unable to delete treatment"))
+			return
+		}
+
+		writeJSON(w, http.StatusOK, toTreatmentResponse(rsp, time.Now()))
+	case rest == "doses" && r.Method == http.MethodGet:
+		rsp, err := s.treatmentQuerier.ListTreatmentDoses(r.Context(), id)
+		if err != nil {
+			writeError(w, statusForError(err), errors.Wrap(err, "unable to list treatment doses"))
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{"doses": toTreatmentDoseResponses(rsp)})
+	default:
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+// handleDueDoses serves /api/v1alpha1/treatment-doses, returning the reminders for doses which are
+// due at or before the optional before query parameter (defaults to now) and haven't
+// been administered
+func (s *Server) handleDueDoses(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	before, err := parseDate(r.URL.Query().Get("before"), time.Now())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	rsp, err := s.treatmentQuerier.ListDueDoses(r.Context(), before)
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to list due doses"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"doses": toTreatmentDoseResponses(rsp)})
+}
+
+// handleDose serves /api/v1alpha1/treatment-doses/{id}/administer, recording a dose as given
+func (s *Server) handleDose(w http.ResponseWriter, r *http.Request) {
+	id, rest, err := pathID(r.URL.Path, "/api/v1alpha1/treatment-doses/")
+	if err != nil || rest != "administer" {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	var req administerDoseRequest
+	if r.ContentLength != 0 {
+		if err := readJSON(w, r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	at, err := parseDate(req.AdministeredAt, time.Now())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	rsp, err := s.treatmentModifier.AdministerDose(r.Context(), id, at)
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to administer dose"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, toTreatmentDoseResponses([]db.TreatmentDose{rsp})[0])
+}
+
+func (s *Server) listTreatments(w http.ResponseWriter, r *http.Request) {
+	var (
+		filter db.TreatmentFilter
+		err    error
+	)
+
+	if filter.TankID, err = optionalInt32(r, "tankId"); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if filter.FishID, err = optionalInt32(r, "fishId"); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	now := time.Now()
+	if r.URL.Query().Get("active") == "true" {
+		filter.ActiveAt = &now
+	}
+
+	rsp, err := s.treatmentQuerier.ListTreatments(r.Context(), filter)
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to list treatments"))
+		return
+	}
+
+	treatments := make([]treatmentResponse, len(rsp))
+	for i, t := range rsp {
+		treatments[i] = toTreatmentResponse(t, now)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"treatments": treatments})
+}
+
+func (s *Server) addTreatment(w http.ResponseWriter, r *http.Request) {
+	var req treatmentRequest
+	if err := readJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	t, err := validateTreatment(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := s.checkTank(r.Context(), t.TankID); err != nil {
+		writeError(w, statusForError(err), err)
+		return
+	}
+
+	for _, id := range t.FishIDs {
+		if err := s.checkFish(r.Context(), id); err != nil {
+			writeError(w, statusForError(err), err)
+			return
+		}
+	}
+
+	rsp, err := s.treatmentModifier.InsertTreatment(r.Context(), t)
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to add treatment"))
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, toTreatmentResponse(rsp, time.Now()))
+}
+
+func validateTreatment(req treatmentRequest) (db.Treatment, error) {
+	t := db.Treatment{
+		TankID:            req.TankID,
+		FishIDs:           req.FishIDs,
+		Medication:        strings.TrimSpace(req.Medication),
+		Dose:              req.Dose,
+		DoseUnit:          req.DoseUnit,
+		DoseIntervalHours: req.DoseIntervalHours,
+		Notes:             req.Notes,
+	}
+
+	if t.TankID == 0 {
+		return t, errors.New("tankId must be provided")
+	}
+
+	if t.Medication == "" {
+		return t, errors.New("medication must be provided")
+	}
+
+	if t.Dose < 0 {
+		return t, errors.New("dose must not be negative")
+	}
+
+	if t.DoseIntervalHours < 0 {
+		return t, errors.New("doseIntervalHours must not be negative")
+	}
+
+	var err error
+	if t.StartDate, err = parseDate(req.StartDate, time.Now()); err != nil {
+		return t, err
+	}
+
+	if t.EndDate, err = parseDate(req.EndDate, t.StartDate); err != nil {
+		return t, err
+	}
+
+	if t.EndDate.Before(t.StartDate) {
+		return t, errors.New("endDate must not be before startDate")
+	}
+
+	if t.DoseIntervalHours > 0 && t.EndDate.Sub(t.StartDate)/(time.Duration(t.DoseIntervalHours)*time.Hour) >= maxTreatmentDoses {
+		return t, errors.Errorf("treatment would schedule more than %d doses", maxTreatmentDoses)
+	}
+
+	return t, nil
+}
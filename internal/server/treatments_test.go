@@ -0,0 +1,273 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+func TestValidateTreatment(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		req         treatmentRequest
+		expectedErr string
+	}{
+		{
+			desc:        "Missing tankId returns error",
+			req:         treatmentRequest{Medication: "Esha Exit"},
+			expectedErr: "tankId must be provided",
+		},
+		{
+			desc:        "Missing medication returns error",
+			req:         treatmentRequest{TankID: 1, Medication: " "},
+			expectedErr: "medication must be provided",
+		},
+		{
+			desc:        "Negative dose returns error",
+			req:         treatmentRequest{TankID: 1, Medication: "Esha Exit", Dose: -1},
+			expectedErr: "dose must not be negative",
+		},
+		{
+			desc:        "End before start returns error",
+			req:         treatmentRequest{TankID: 1, Medication: "Esha Exit", StartDate: "2021-08-02", EndDate: "2021-08-01"},
+			expectedErr: "endDate must not be before startDate",
+		},
+		{
+			desc:        "Too many doses returns error",
+			req:         treatmentRequest{TankID: 1, Medication: "Esha Exit", DoseIntervalHours: 1, StartDate: "2021-01-01", EndDate: "2022-01-01"},
+			expectedErr: "treatment would schedule more than 500 doses",
+		},
+		{
+			desc: "Valid treatment returns no error",
+			req:  treatmentRequest{TankID: 1, Medication: "Esha Exit", DoseIntervalHours: 24, StartDate: "2021-08-01", EndDate: "2021-08-04"},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			_, err := validateTreatment(tC.req)
+			if tC.expectedErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.EqualError(t, err, tC.expectedErr)
+		})
+	}
+}
+
+func TestAddTreatment(t *testing.T) {
+	tm := &treatmentMock{}
+	fm := &fishMock{}
+	s := Server{treatmentModifier: tm, tankQuerier: &tankMock{}, fishQuerier: fm}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	body := `{"tankId": 1, "fishIds": [2, 3], "medication": "Esha Exit", "dose": 20, "doseUnit": "drops", "doseIntervalHours": 24, "startDate": "2021-08-01", "endDate": "2021-08-04"}`
+
+	t.Run("Given a request to AddTreatment", func(t *testing.T) {
+		t.Run("When a fish isn't visible to the household", func(t *testing.T) {
+			t.Run("Then not found is returned", func(t *testing.T) {
+				fm.err = &db.ErrNotFound{}
+				defer func() { fm.err = nil }()
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/treatments", strings.NewReader(body)))
+
+				assert.Equal(t, http.StatusNotFound, rec.Code)
+			})
+		})
+		t.Run("When an error is returned", func(t *testing.T) {
+			t.Run("Then the error is returned to the caller", func(t *testing.T) {
+				tm.err = errors.New("an error")
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/treatments", strings.NewReader(body)))
+
+				assert.Equal(t, http.StatusInternalServerError, rec.Code)
+				assert.Contains(t, rec.Body.String(), "unable to add treatment: an error")
+			})
+		})
+		t.Run("When no error is returned", func(t *testing.T) {
+			t.Run("Then the Treatment is returned to the caller", func(t *testing.T) {
+				tm.err = nil
+				tm.insertTreatmentResponse = db.Treatment{ID: 5, TankID: 1, FishIDs: []int32{2, 3}, Medication: "Esha Exit"}
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/treatments", strings.NewReader(body)))
+
+				assert.Equal(t, http.StatusCreated, rec.Code)
+
+				assert.Equal(t, []int32{2, 3}, tm.insertTreatmentRequest.FishIDs)
+				assert.Equal(t, time.Date(2021, 8, 4, 0, 0, 0, 0, time.UTC), tm.insertTreatmentRequest.EndDate)
+
+				var rsp treatmentResponse
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(&rsp))
+				assert.Equal(t, int32(5), rsp.ID)
+				assert.Equal(t, []int32{2, 3}, rsp.FishIDs)
+			})
+		})
+	})
+}
+
+func TestListTreatments(t *testing.T) {
+	tm := &treatmentMock{}
+	s := Server{treatmentQuerier: tm}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	t.Run("Given a request to ListTreatments for a fish", func(t *testing.T) {
+		t.Run("When no error is returned", func(t *testing.T) {
+			t.Run("Then the fish's treatment history is returned", func(t *testing.T) {
+				now := time.Now()
+				tm.listTreatmentsResponse = []db.Treatment{
+					{ID: 1, StartDate: now.Add(-time.Hour), EndDate: now.Add(time.Hour)},
+					{ID: 2, StartDate: now.Add(-48 * time.Hour), EndDate: now.Add(-24 * time.Hour)},
+				}
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1alpha1/treatments?fishId=3", nil))
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Equal(t, int32(3), *tm.listTreatmentsRequest.FishID)
+				assert.Nil(t, tm.listTreatmentsRequest.ActiveAt)
+
+				var rsp struct{ Treatments []treatmentResponse }
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(&rsp))
+				assert.Len(t, rsp.Treatments, 2)
+				assert.True(t, rsp.Treatments[0].Active)
+				assert.False(t, rsp.Treatments[1].Active)
+			})
+		})
+		t.Run("When only active treatments are requested", func(t *testing.T) {
+			t.Run("Then the filter is passed on", func(t *testing.T) {
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1alpha1/treatments?active=true", nil))
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.NotNil(t, tm.listTreatmentsRequest.ActiveAt)
+			})
+		})
+	})
+}
+
+func TestDueDoses(t *testing.T) {
+	tm := &treatmentMock{}
+	s := Server{treatmentQuerier: tm, treatmentModifier: tm}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	t.Run("Given a request for the due doses", func(t *testing.T) {
+		t.Run("When no error is returned", func(t *testing.T) {
+			t.Run("Then the reminders are returned", func(t *testing.T) {
+				tm.listDueDosesResponse = []db.TreatmentDose{{ID: 1, Medication: "Esha Exit"}}
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1alpha1/treatment-doses?before=2021-08-02", nil))
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Equal(t, time.Date(2021, 8, 2, 0, 0, 0, 0, time.UTC), tm.before)
+				assert.Contains(t, rec.Body.String(), `"medication":"Esha Exit"`)
+			})
+		})
+	})
+
+	t.Run("Given a request to administer a dose", func(t *testing.T) {
+		t.Run("When the dose doesn't exist", func(t *testing.T) {
+			t.Run("Then not found is returned", func(t *testing.T) {
+				tm.err = &db.ErrNotFound{}
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/treatment-doses/9/administer", nil))
+
+				assert.Equal(t, http.StatusNotFound, rec.Code)
+			})
+		})
+		t.Run("When the dose has already been administered", func(t *testing.T) {
+			t.Run("Then a conflict is returned", func(t *testing.T) {
+				tm.err = &db.ErrConflict{}
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/treatment-doses/9/administer", nil))
+
+				assert.Equal(t, http.StatusConflict, rec.Code)
+			})
+		})
+		t.Run("When no error is returned", func(t *testing.T) {
+			t.Run("Then the administered dose is returned", func(t *testing.T) {
+				tm.err = nil
+				at := time.Date(2021, 8, 1, 9, 30, 0, 0, time.UTC)
+				tm.administerDoseResponse = db.TreatmentDose{ID: 9, AdministeredAt: &at}
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/treatment-doses/9/administer", strings.NewReader(`{"administeredAt": "2021-08-01T09:30:00Z"}`)))
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Equal(t, int32(9), tm.administerDoseID)
+				assert.Equal(t, at, tm.administeredAt)
+			})
+		})
+	})
+}
+
+type treatmentMock struct {
+	insertTreatmentRequest  db.Treatment
+	insertTreatmentResponse db.Treatment
+	getTreatmentResponse    db.Treatment
+	deleteTreatmentResponse db.Treatment
+	listTreatmentsRequest   db.TreatmentFilter
+	listTreatmentsResponse  []db.Treatment
+	listDosesResponse       []db.TreatmentDose
+	listDueDosesResponse    []db.TreatmentDose
+	before                  time.Time
+	administerDoseID        int32
+	administeredAt          time.Time
+	administerDoseResponse  db.TreatmentDose
+	err                     error
+}
+
+func (m *treatmentMock) InsertTreatment(ctx context.Context, req db.Treatment) (db.Treatment, error) {
+	m.insertTreatmentRequest = req
+
+	return m.insertTreatmentResponse, m.err
+}
+
+func (m *treatmentMock) GetTreatment(context.Context, int32) (db.Treatment, error) {
+	return m.getTreatmentResponse, m.err
+}
+
+func (m *treatmentMock) DeleteTreatment(context.Context, int32) (db.Treatment, error) {
+	return m.deleteTreatmentResponse, m.err
+}
+
+func (m *treatmentMock) ListTreatments(ctx context.Context, filter db.TreatmentFilter) ([]db.Treatment, error) {
+	m.listTreatmentsRequest = filter
+
+	return m.listTreatmentsResponse, m.err
+}
+
+func (m *treatmentMock) ListTreatmentDoses(context.Context, int32) ([]db.TreatmentDose, error) {
+	return m.listDosesResponse, m.err
+}
+
+func (m *treatmentMock) ListDueDoses(ctx context.Context, before time.Time) ([]db.TreatmentDose, error) {
+	m.before = before
+
+	return m.listDueDosesResponse, m.err
+}
+
+func (m *treatmentMock) AdministerDose(ctx context.Context, id int32, at time.Time) (db.TreatmentDose, error) {
+	m.administerDoseID, m.administeredAt = id, at
+
+	return m.administerDoseResponse, m.err
+}
@@ -0,0 +1,339 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/trackmyfish/backend/internal/auth"
+	"github.com/trackmyfish/backend/internal/db"
+	"google.golang.org/grpc"
+)
+
+// heartbeatMethod can be called without authenticating, along with the health check
+const heartbeatMethod = "/trackmyfish.v1alpha1.TrackMyFishService/Heartbeat"
+
+// publicStreamMethods are the streaming RPCs which can be called without authenticating,
+// watching the health of the server and reflection
+var publicStreamMethods = []string{healthWatchMethod, "/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo"}
+
+// publicPaths are the HTTP endpoints which can be called without authenticating, in
+// addition to the frontend, signing up and showcases of shared tanks
+var publicPaths = map[string]bool{
+	"/api/v1alpha1/heartbeat": true,
+	"/api/v1alpha1/login":     true,
+}
+
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9._-]{3,64}$`)
+
+type userQuerier interface {
+	GetUser(context.Context, int32) (db.User, error)
+	GetUserByUsername(context.Context, string) (db.User, error)
+	CountUsers(context.Context) (int64, error)
+	ListUsers(context.Context, int32) ([]db.User, error)
+}
+
+type userModifier interface {
+	InsertUser(context.Context, db.User, string) (db.User, error)
+	UpdateUserRole(context.Context, int32, int32, string) (db.User, error)
+	DeleteUser(context.Context, int32, int32) (db.User, error)
+}
+
+type credentialsRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type signupRequest struct {
+	credentialsRequest
+	// Household is the name of the household created for the user, which defaults to
+	// the username
+	Household string `json:"household"`
+	// Invite is the code of an invite to join an existing household instead
+	Invite string `json:"invite"`
+}
+
+type userResponse struct {
+	ID          int32     `json:"id"`
+	HouseholdID int32     `json:"householdId"`
+	Username    string    `json:"username"`
+	Role        string    `json:"role"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+type loginResponse struct {
+	Token     string       `json:"token"`
+	ExpiresAt time.Time    `json:"expiresAt"`
+	User      userResponse `json:"user"`
+}
+
+func toUserResponse(u db.User) userResponse {
+	return userResponse{ID: u.ID, HouseholdID: u.HouseholdID, Username: u.Username, Role: u.Role, CreatedAt: u.CreatedAt}
+}
+
+// UnaryInterceptor returns the gRPC interceptor rejecting unauthenticated calls and calls
+// the role of the user doesn't allow, scoping the rest to the household of the user and
+// recording the changes they make in the audit log
+func (s *Server) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	authenticate := auth.UnaryServerInterceptor(s.tokens, apiKeyVerifier{s.apiKeyQuerier}, heartbeatMethod, healthCheckMethod)
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if info.FullMethod == heartbeatMethod || info.FullMethod == healthCheckMethod {
+			return handler(ctx, req)
+		}
+
+		return authenticate(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			a := accessFor(info.FullMethod)
+
+			ctx, err := s.authorize(withHousehold(ctx), a.resource, a.permission, false)
+			if err != nil {
+				return nil, authorizationError(err)
+			}
+
+			rsp, err := handler(ctx, req)
+			if err == nil && a.permission != auth.PermissionRead {
+				s.auditRPC(ctx, info.FullMethod, a, rsp)
+			}
+
+			return rsp, err
+		})
+	}
+}
+
+// StreamInterceptor returns the gRPC interceptor rejecting streams the same way as
+// UnaryInterceptor rejects calls, and scoping the rest to the household of the user.
+// Streams which change data are recorded in the audit log once they end successfully.
+func (s *Server) StreamInterceptor() grpc.StreamServerInterceptor {
+	authenticate := auth.StreamServerInterceptor(s.tokens, apiKeyVerifier{s.apiKeyQuerier}, publicStreamMethods...)
+
+	public := map[string]bool{}
+	for _, m := range publicStreamMethods {
+		public[m] = true
+	}
+
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if public[info.FullMethod] {
+			return handler(srv, ss)
+		}
+
+		return authenticate(srv, ss, info, func(srv interface{}, ss grpc.ServerStream) error {
+			a := accessFor(info.FullMethod)
+
+			ctx, err := s.authorize(withHousehold(ss.Context()), a.resource, a.permission, tankScopedMethods[info.FullMethod])
+			if err != nil {
+				return authorizationError(err)
+			}
+
+			if err := handler(srv, auth.WithStreamContext(ctx, ss)); err != nil {
+				return err
+			}
+
+			if a.permission != auth.PermissionRead {
+				s.auditRPC(ctx, info.FullMethod, a, nil)
+			}
+
+			return nil
+		})
+	}
+}
+
+// Middleware wraps next, rejecting unauthenticated requests to the API and requests the
+// role of the user doesn't allow, and scoping the rest to the household of the user. The
+// frontend, health checks, heartbeat, login, sign up and showcases of shared tanks remain
+// public.
+func (s *Server) Middleware(next http.Handler) http.Handler {
+	return auth.Middleware(s.tokens, apiKeyVerifier{s.apiKeyQuerier}, isPublicRequest)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := withHousehold(r.Context())
+
+		if !isPublicRequest(r) {
+			var err error
+			if ctx, err = s.authorize(ctx, requestResource(r.URL.Path), requestPermission(r), isTankScoped(r.URL.Path)); err != nil {
+				writeError(w, authorizationStatus(err), err)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}))
+}
+
+// withHousehold scopes the queries made with ctx to the household of the authenticated
+// user. Public requests are left unscoped, so they can't see the data of any household.
+func withHousehold(ctx context.Context) context.Context {
+	id, ok := auth.FromContext(ctx)
+	if !ok {
+		return ctx
+	}
+
+	return db.WithHousehold(ctx, id.HouseholdID)
+}
+
+func isPublicRequest(r *http.Request) bool {
+	if !strings.HasPrefix(r.URL.Path, "/api/") {
+		return true
+	}
+
+	if r.URL.Path == "/api/v1alpha1/users" && r.Method == http.MethodPost {
+		return true
+	}
+
+	if strings.HasPrefix(r.URL.Path, showcasePath) {
+		return true
+	}
+
+	return publicPaths[r.URL.Path]
+}
+
+// handleLogin serves /api/v1alpha1/login, where POST exchanges a username and password
+// for a session token
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	var req credentialsRequest
+	if err := readJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	u, err := s.userQuerier.GetUserByUsername(r.Context(), req.Username)
+	if err != nil && statusForError(err) != http.StatusNotFound {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to get user"))
+		return
+	}
+
+	// u is empty when the user doesn't exist, which CheckPassword always rejects
+	if err := auth.CheckPassword(u.PasswordHash, req.Password); err != nil {
+		logrus.WithFields(logrus.Fields{"username": req.Username}).Warn("Failed login")
+
+		writeError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	s.writeToken(w, http.StatusOK, u)
+}
+
+// handleUsers serves /api/v1alpha1/users, where POST signs up a new user who owns a new
+// household, or joins an existing household with an invite code. Signing up without an
+// invite is only allowed when enabled or there are no users yet, so the first user can
+// be created.
+func (s *Server) handleUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	var req signupRequest
+	if err := readJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if !usernamePattern.MatchString(req.Username) {
+		writeError(w, http.StatusBadRequest, errors.New("username must be 3-64 letters, numbers, '.', '_' or '-'"))
+		return
+	}
+
+	if req.Invite != "" {
+		s.acceptInvite(w, r, req)
+		return
+	}
+
+	household := strings.TrimSpace(req.Household)
+	if household == "" {
+		household = req.Username
+	}
+
+	if len(household) > maxHouseholdNameLength {
+		writeError(w, http.StatusBadRequest, errors.Errorf("household must be at most %d characters", maxHouseholdNameLength))
+		return
+	}
+
+	if !s.allowSignup {
+		count, err := s.userQuerier.CountUsers(r.Context())
+		if err != nil {
+			writeError(w, statusForError(err), errors.Wrap(err, "unable to count users"))
+			return
+		}
+
+		if count > 0 {
+			writeError(w, http.StatusForbidden, errors.New("sign up is disabled"))
+			return
+		}
+	}
+
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	u, err := s.userModifier.InsertUser(r.Context(), db.User{Username: req.Username, PasswordHash: hash}, household)
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to add user"))
+		return
+	}
+
+	s.writeToken(w, http.StatusCreated, u)
+}
+
+// acceptInvite signs up a user into the household of an invite, which is allowed even when
+// signing up is disabled
+func (s *Server) acceptInvite(w http.ResponseWriter, r *http.Request, req signupRequest) {
+	if req.Household != "" {
+		writeError(w, http.StatusBadRequest, errors.New("household can't be set when accepting an invite"))
+		return
+	}
+
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	u, err := s.inviteModifier.AcceptInvite(r.Context(), auth.HashOpaqueToken(req.Invite), db.User{Username: req.Username, PasswordHash: hash})
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to accept invite"))
+		return
+	}
+
+	s.writeToken(w, http.StatusCreated, u)
+}
+
+// handleMe serves /api/v1alpha1/users/me, returning the authenticated user
+func (s *Server) handleMe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	id, ok := auth.FromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, auth.ErrUnauthenticated)
+		return
+	}
+
+	u, err := s.userQuerier.GetUser(r.Context(), id.UserID)
+	if err != nil {
+		writeError(w, statusForError(err), errors.Wrap(err, "unable to get user"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, toUserResponse(u))
+}
+
+func (s *Server) writeToken(w http.ResponseWriter, status int, u db.User) {
+	token, expires, err := s.tokens.Issue(auth.Identity{UserID: u.ID, Username: u.Username, HouseholdID: u.HouseholdID})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, status, loginResponse{Token: token, ExpiresAt: expires, User: toUserResponse(u)})
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trackmyfish/backend/internal/auth"
+	"github.com/trackmyfish/backend/internal/db"
+)
+
+func TestIsPublicRequest(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		method   string
+		path     string
+		expected bool
+	}{
+		{desc: "Frontend is public", method: http.MethodGet, path: "/index.html", expected: true},
+		{desc: "Heartbeat is public", method: http.MethodGet, path: "/api/v1alpha1/heartbeat", expected: true},
+		{desc: "Health checks are public", method: http.MethodGet, path: "/readyz", expected: true},
+		{desc: "Login is public", method: http.MethodPost, path: "/api/v1alpha1/login", expected: true},
+		{desc: "Sign up is public", method: http.MethodPost, path: "/api/v1alpha1/users", expected: true},
+		{desc: "Current user isn't public", method: http.MethodGet, path: "/api/v1alpha1/users/me", expected: false},
+		{desc: "Gateway endpoints aren't public", method: http.MethodDelete, path: "/api/v1alpha1/tanks/1", expected: false},
+		{desc: "HTTP endpoints aren't public", method: http.MethodGet, path: "/api/v1alpha1/attachments", expected: false},
+		{desc: "Showcases are public", method: http.MethodGet, path: "/api/v1alpha1/showcase/token/photos/1", expected: true},
+		{desc: "Showcase pages are public", method: http.MethodGet, path: "/showcase/token", expected: true},
+		{desc: "Tank shares aren't public", method: http.MethodGet, path: "/api/v1alpha1/tank-shares", expected: false},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			assert.Equal(t, tC.expected, isPublicRequest(httptest.NewRequest(tC.method, tC.path, nil)))
+		})
+	}
+}
+
+func TestLogin(t *testing.T) {
+	tokens, err := auth.NewTokenManager("", time.Hour)
+	assert.NoError(t, err)
+
+	hash, err := auth.HashPassword("correct horse")
+	assert.NoError(t, err)
+
+	um := &userMock{getUserByUsernameResponse: db.User{ID: 3, HouseholdID: 2, Username: "nemo", PasswordHash: hash}}
+	s := Server{userQuerier: um, tokens: tokens}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	t.Run("Given a request to log in", func(t *testing.T) {
+		t.Run("When the password is wrong", func(t *testing.T) {
+			t.Run("Then unauthorized is returned", func(t *testing.T) {
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/login", strings.NewReader(`{"username": "nemo", "password": "battery staple"}`)))
+
+				assert.Equal(t, http.StatusUnauthorized, rec.Code)
+			})
+		})
+		t.Run("When the user doesn't exist", func(t *testing.T) {
+			t.Run("Then unauthorized is returned", func(t *testing.T) {
+				um.err = &db.ErrNotFound{}
+				defer func() { um.err = nil }()
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/login", strings.NewReader(`{"username": "dory", "password": "correct horse"}`)))
+
+				assert.Equal(t, http.StatusUnauthorized, rec.Code)
+			})
+		})
+		t.Run("When the password is correct", func(t *testing.T) {
+			t.Run("Then a token for the user is returned", func(t *testing.T) {
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/login", strings.NewReader(`{"username": "nemo", "password": "correct horse"}`)))
+
+				assert.Equal(t, http.StatusOK, rec.Code)
+
+				var rsp loginResponse
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(&rsp))
+
+				id, err := tokens.Verify(rsp.Token)
+				assert.NoError(t, err)
+				assert.Equal(t, auth.Identity{UserID: 3, Username: "nemo", HouseholdID: 2}, id)
+			})
+		})
+	})
+}
+
+func TestSignUp(t *testing.T) {
+	tokens, err := auth.NewTokenManager("", time.Hour)
+	assert.NoError(t, err)
+
+	um := &userMock{}
+	im := &inviteMock{acceptInviteResponse: db.User{ID: 4, HouseholdID: 2, Username: "marlin", Role: "EDITOR"}}
+	s := Server{userQuerier: um, userModifier: um, inviteModifier: im, tokens: tokens}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	t.Run("Given a request to sign up", func(t *testing.T) {
+		t.Run("When the password is too short", func(t *testing.T) {
+			t.Run("Then a bad request is returned", func(t *testing.T) {
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/users", strings.NewReader(`{"username": "nemo", "password": "short"}`)))
+
+				assert.Equal(t, http.StatusBadRequest, rec.Code)
+			})
+		})
+		t.Run("When there are no users", func(t *testing.T) {
+			t.Run("Then the first user is created", func(t *testing.T) {
+				um.insertUserResponse = db.User{ID: 1, Username: "nemo"}
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/users", strings.NewReader(`{"username": "nemo", "password": "correct horse"}`)))
+
+				assert.Equal(t, http.StatusCreated, rec.Code)
+				assert.NoError(t, auth.CheckPassword(um.insertUserRequest.PasswordHash, "correct horse"))
+			})
+			t.Run("Then the household is named after the user", func(t *testing.T) {
+				assert.Equal(t, "nemo", um.insertUserHousehold)
+			})
+		})
+		t.Run("When there are users and sign up is disabled", func(t *testing.T) {
+			t.Run("Then forbidden is returned", func(t *testing.T) {
+				um.countUsersResponse = 1
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/users", strings.NewReader(`{"username": "dory", "password": "correct horse"}`)))
+
+				assert.Equal(t, http.StatusForbidden, rec.Code)
+			})
+		})
+		t.Run("When there are users and sign up is disabled but an invite is given", func(t *testing.T) {
+			t.Run("Then the user joins the household of the invite", func(t *testing.T) {
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/users", strings.NewReader(`{"username": "marlin", "password": "correct horse", "invite": "code"}`)))
+
+				assert.Equal(t, http.StatusCreated, rec.Code)
+				assert.Equal(t, auth.HashOpaqueToken("code"), im.acceptInviteHash)
+				assert.Equal(t, "marlin", im.acceptInviteRequest.Username)
+			})
+		})
+		t.Run("When there are users and sign up is enabled", func(t *testing.T) {
+			t.Run("Then the user is created", func(t *testing.T) {
+				s.allowSignup = true
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1alpha1/users", strings.NewReader(`{"username": "dory", "password": "correct horse", "household": " Reef Club "}`)))
+
+				assert.Equal(t, http.StatusCreated, rec.Code)
+				assert.Equal(t, "Reef Club", um.insertUserHousehold)
+			})
+		})
+	})
+}
+
+type userMock struct {
+	getUserResponse           db.User
+	getUserByUsernameResponse db.User
+	countUsersResponse        int64
+	insertUserRequest         db.User
+	insertUserHousehold       string
+	insertUserResponse        db.User
+	listUsersResponse         []db.User
+	updateUserRoleRequest     db.User
+	err                       error
+}
+
+func (m *userMock) GetUser(context.Context, int32) (db.User, error) {
+	return m.getUserResponse, m.err
+}
+
+func (m *userMock) GetUserByUsername(context.Context, string) (db.User, error) {
+	if m.err != nil {
+		return db.User{}, m.err
+	}
+
+	return m.getUserByUsernameResponse, nil
+}
+
+func (m *userMock) CountUsers(context.Context) (int64, error) {
+	return m.countUsersResponse, m.err
+}
+
+func (m *userMock) ListUsers(context.Context, int32) ([]db.User, error) {
+	return m.listUsersResponse, m.err
+}
+
+func (m *userMock) InsertUser(ctx context.Context, req db.User, household string) (db.User, error) {
+	m.insertUserRequest = req
+	m.insertUserHousehold = household
+
+	return m.insertUserResponse, m.err
+}
+
+func (m *userMock) UpdateUserRole(ctx context.Context, householdID, id int32, role string) (db.User, error) {
+	m.updateUserRoleRequest = db.User{ID: id, HouseholdID: householdID, Role: role}
+
+	return m.updateUserRoleRequest, m.err
+}
+
+func (m *userMock) DeleteUser(ctx context.Context, householdID, id int32) (db.User, error) {
+	return db.User{ID: id, HouseholdID: householdID}, m.err
+}
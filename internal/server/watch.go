@@ -0,0 +1,435 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/trackmyfish/backend/internal/auth"
+	"github.com/trackmyfish/backend/internal/db"
+	trackmyfishv1alpha1 "github.com/trackmyfish/proto/trackmyfish/v1alpha1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// watchPath streams the events of a tank, e.g. /api/v1alpha1/watch/tanks/1
+const watchPath = "/api/v1alpha1/watch/tanks/"
+
+// watchHeartbeatInterval is how often a comment is sent to watching clients without any
+// events, so proxies don't close the connection as idle
+const watchHeartbeatInterval = 30 * time.Second
+
+// watchBufferSize is the most events buffered for a watching client. Clients which fall
+// further behind are disconnected, so they can reconnect and catch up.
+const watchBufferSize = 64
+
+// tankEventsRetryInterval is how long to wait before listening for tank events again after
+// the connection is lost
+const tankEventsRetryInterval = 5 * time.Second
+
+type tankEventListener interface {
+	ListenTankEvents(context.Context, func(db.TankEvent)) error
+}
+
+type fishJSON struct {
+	ID           int32  `json:"id"`
+	TankID       *int32 `json:"tankId,omitempty"`
+	Type         string `json:"type"`
+	Subtype      string `json:"subtype"`
+	Color        string `json:"color"`
+	Gender       string `json:"gender"`
+	PurchaseDate string `json:"purchaseDate"`
+	Count        int32  `json:"count"`
+}
+
+// tankEventJSON is the data of an event sent to watching clients, with the entity of its
+// type
+type tankEventJSON struct {
+	Operation     string             `json:"operation"`
+	Reading       *sensorReadingJSON `json:"reading,omitempty"`
+	TankStatistic *tankStatisticJSON `json:"tankStatistic,omitempty"`
+	Fish          *fishJSON          `json:"fish,omitempty"`
+}
+
+func toTankEventJSON(e db.TankEvent) tankEventJSON {
+	rsp := tankEventJSON{Operation: e.Operation}
+
+	if e.Reading != nil {
+		r := toSensorReadingJSON(*e.Reading)
+		rsp.Reading = &r
+	}
+
+	if e.TankStatistic != nil {
+		rsp.TankStatistic = toTankStatisticJSON(*e.TankStatistic)
+	}
+
+	if e.Fish != nil {
+		rsp.Fish = &fishJSON{
+			ID:           e.Fish.ID,
+			TankID:       e.Fish.TankID,
+			Type:         e.Fish.Type,
+			Subtype:      e.Fish.Subtype,
+			Color:        e.Fish.Color,
+			Gender:       e.Fish.Gender,
+			PurchaseDate: e.Fish.PurchaseDate,
+			Count:        e.Fish.Count,
+		}
+	}
+
+	return rsp
+}
+
+// tankWatchers are the clients watching tanks, which the tank events are fanned out to. The
+// zero value has no watchers.
+type tankWatchers struct {
+	mu       sync.Mutex
+	watchers map[*tankWatcher]bool
+	// closed is set once events are no longer being listened for
+	closed bool
+}
+
+type tankWatcher struct {
+	householdID int32
+	tankID      int32
+	// events is closed if the watcher falls behind
+	events chan db.TankEvent
+}
+
+func (w *tankWatchers) add(householdID, tankID int32) *tankWatcher {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.watchers == nil {
+		w.watchers = map[*tankWatcher]bool{}
+	}
+
+	watcher := &tankWatcher{householdID: householdID, tankID: tankID, events: make(chan db.TankEvent, watchBufferSize)}
+	if w.closed {
+		close(watcher.events)
+		return watcher
+	}
+
+	w.watchers[watcher] = true
+
+	return watcher
+}
+
+func (w *tankWatchers) remove(watcher *tankWatcher) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.watchers[watcher] {
+		delete(w.watchers, watcher)
+		close(watcher.events)
+	}
+}
+
+// publish sends an event to the watchers of the tanks it's for, or of every tank in the
+// household if it isn't for any tank
+func (w *tankWatchers) publish(e db.TankEvent) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for watcher := range w.watchers {
+		if watcher.householdID != e.HouseholdID || !watches(watcher.tankID, e.TankIDs) {
+			continue
+		}
+
+		select {
+		case watcher.events <- e:
+		default:
+			logrus.WithField("tankId", watcher.tankID).Warn("Disconnecting tank watcher which has fallen behind")
+
+			delete(w.watchers, watcher)
+			close(watcher.events)
+		}
+	}
+}
+
+// close disconnects the watchers, along with any which are added afterwards
+func (w *tankWatchers) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for watcher := range w.watchers {
+		delete(w.watchers, watcher)
+		close(watcher.events)
+	}
+
+	w.closed = true
+}
+
+func watches(tankID int32, tankIDs []int32) bool {
+	if len(tankIDs) == 0 {
+		return true
+	}
+
+	for _, id := range tankIDs {
+		if id == tankID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WatchTankEvents pushes the tank events notified by the database, by any replica, to the
+// clients watching the tanks until ctx is done. Listening is retried every
+// tankEventsRetryInterval if the connection is lost. The clients are disconnected once ctx
+// is done, so they can reconnect to another replica while the server shuts down.
+func (s *Server) WatchTankEvents(ctx context.Context) {
+	defer s.tankWatchers.close()
+
+	for {
+		err := s.tankEventListener.ListenTankEvents(ctx, s.tankWatchers.publish)
+		if ctx.Err() != nil {
+			return
+		}
+
+		logrus.WithError(err).Error("unable to listen for tank events, retrying")
+
+		select {
+		case <-time.After(tankEventsRetryInterval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// handleWatchTank serves /api/v1alpha1/watch/tanks/{id}, the HTTP equivalent of the
+// WatchTank RPC, where GET streams the events of a tank as Server-Sent Events
+//
+// An event is sent when a sensor reading is added to the tank, when a fish is added to,
+// changed in or deleted from the tank, and when any tank statistic of the household is
+// added or deleted. Events are named by their type, and their data is the operation and
+// the entity as JSON. There are no alerts to send, as the server doesn't raise any.
+func (s *Server) handleWatchTank(w http.ResponseWriter, r *http.Request) {
+	id, rest, err := pathID(r.URL.Path, watchPath)
+	if err != nil || rest != "" {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	watcher, err := s.startWatching(r.Context(), id)
+	if err != nil {
+		if err == auth.ErrForbidden {
+			writeError(w, http.StatusForbidden, err)
+		} else {
+			writeError(w, statusForError(err), err)
+		}
+
+		return
+	}
+	defer s.tankWatchers.remove(watcher)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, ": watching tank %d\n\n", id)
+	flush(w)
+
+	ticker := time.NewTicker(watchHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case e, ok := <-watcher.events:
+			if !ok {
+				return
+			}
+
+			data, err := json.Marshal(toTankEventJSON(e))
+			if err != nil {
+				logrus.WithError(err).Error("unable to marshal tank event")
+				continue
+			}
+
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data); err != nil {
+				return
+			}
+
+			flush(w)
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+
+			flush(w)
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// watchTankRPC serves the WatchTank RPC, the gRPC equivalent of
+// /api/v1alpha1/watch/tanks/{id}, sending a TankEvent message for each event of the tank
+// until the call is cancelled. The headers are sent once the tank is being watched. Calls
+// end with an Unavailable status if the client falls behind or the server shuts down, so
+// the client can watch the tank again.
+func (s *Server) watchTankRPC(stream grpc.ServerStream) error {
+	req := dynamicpb.NewMessage(watchTankRequestDesc)
+	if err := stream.RecvMsg(req); err != nil {
+		return err
+	}
+
+	id := int32(req.Get(watchTankRequestDesc.Fields().ByName("tank_id")).Int())
+
+	watcher, err := s.startWatching(stream.Context(), id)
+	if err != nil {
+		var nf *db.ErrNotFound
+		switch {
+		case err == auth.ErrForbidden:
+			return status.Error(codes.PermissionDenied, err.Error())
+		case errors.As(err, &nf):
+			return status.Error(codes.NotFound, err.Error())
+		default:
+			logrus.WithError(err).Error("unable to watch tank")
+			return status.Error(codes.Internal, "unable to watch tank")
+		}
+	}
+	defer s.tankWatchers.remove(watcher)
+
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case e, ok := <-watcher.events:
+			if !ok {
+				return status.Error(codes.Unavailable, "no longer watching tank")
+			}
+
+			if err := stream.SendMsg(toTankEventMessage(e)); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		}
+	}
+}
+
+// startWatching adds a watcher of the tank with the given id for the household of the user
+// in ctx, after checking the tank exists and is allowed by the API key of the request, if
+// any. The watcher has to be removed once the client stops watching.
+func (s *Server) startWatching(ctx context.Context, id int32) (*tankWatcher, error) {
+	if !allowsTank(ctx, id) {
+		return nil, auth.ErrForbidden
+	}
+
+	if _, err := s.tankQuerier.GetTank(ctx, id); err != nil {
+		return nil, errors.Wrap(err, "unable to get tank")
+	}
+
+	var householdID int32
+	if identity, ok := auth.FromContext(ctx); ok {
+		householdID = identity.HouseholdID
+	}
+
+	return s.tankWatchers.add(householdID, id), nil
+}
+
+// toTankEventMessage returns e as a TankEvent message
+func toTankEventMessage(e db.TankEvent) proto.Message {
+	fields := tankEventDesc.Fields()
+
+	m := dynamicpb.NewMessage(tankEventDesc)
+	m.Set(fields.ByName("type"), protoreflect.ValueOfString(e.Type))
+	m.Set(fields.ByName("operation"), protoreflect.ValueOfString(e.Operation))
+
+	if e.Reading != nil {
+		m.Set(fields.ByName("reading"), protoreflect.ValueOfMessage(toSensorReadingMessage(*e.Reading)))
+	}
+
+	if e.TankStatistic != nil {
+		m.Set(fields.ByName("tank_statistic"), protoreflect.ValueOfMessage(toTankStatisticProto(*e.TankStatistic).ProtoReflect()))
+	}
+
+	if e.Fish != nil {
+		fish := &trackmyfishv1alpha1.Fish{
+			Id:           e.Fish.ID,
+			Type:         e.Fish.Type,
+			Subtype:      e.Fish.Subtype,
+			Color:        e.Fish.Color,
+			Gender:       stringToGender(e.Fish.Gender),
+			PurchaseDate: e.Fish.PurchaseDate,
+			Count:        e.Fish.Count,
+		}
+
+		m.Set(fields.ByName("fish"), protoreflect.ValueOfMessage(fish.ProtoReflect()))
+	}
+
+	return m
+}
+
+// toSensorReadingMessage returns r as a SensorReading message
+func toSensorReadingMessage(r db.SensorReading) protoreflect.Message {
+	fields := sensorReadingDesc.Fields()
+
+	m := dynamicpb.NewMessage(sensorReadingDesc)
+	m.Set(fields.ByName("id"), protoreflect.ValueOfInt64(r.ID))
+	m.Set(fields.ByName("sensor_id"), protoreflect.ValueOfString(r.SensorID))
+	m.Set(fields.ByName("sequence"), protoreflect.ValueOfInt64(r.Sequence))
+	m.Set(fields.ByName("tank_id"), protoreflect.ValueOfInt32(r.TankID))
+	m.Set(fields.ByName("parameter"), protoreflect.ValueOfString(r.Parameter))
+	m.Set(fields.ByName("value"), protoreflect.ValueOfFloat64(r.Value))
+	m.Set(fields.ByName("read_at"), protoreflect.ValueOfMessage(timestamppb.New(r.ReadAt).ProtoReflect()))
+
+	return m
+}
+
+// toTankStatisticProto returns ts as a TankStatistic message of the TrackMyFishService
+func toTankStatisticProto(ts db.TankStatistic) *trackmyfishv1alpha1.TankStatistic {
+	tstat := &trackmyfishv1alpha1.TankStatistic{
+		Id:       ts.ID,
+		TestDate: ts.TestDate,
+	}
+
+	if ts.PH != nil {
+		tstat.OptionalPh = &trackmyfishv1alpha1.TankStatistic_Ph{Ph: *ts.PH}
+	}
+
+	if ts.GH != nil {
+		tstat.OptionalGh = &trackmyfishv1alpha1.TankStatistic_Gh{Gh: *ts.GH}
+	}
+
+	if ts.KH != nil {
+		tstat.OptionalKh = &trackmyfishv1alpha1.TankStatistic_Kh{Kh: *ts.KH}
+	}
+
+	if ts.Ammonia != nil {
+		tstat.OptionalAmmonia = &trackmyfishv1alpha1.TankStatistic_Ammonia{Ammonia: *ts.Ammonia}
+	}
+
+	if ts.Nitrite != nil {
+		tstat.OptionalNitrite = &trackmyfishv1alpha1.TankStatistic_Nitrite{Nitrite: *ts.Nitrite}
+	}
+
+	if ts.Nitrate != nil {
+		tstat.OptionalNitrate = &trackmyfishv1alpha1.TankStatistic_Nitrate{Nitrate: *ts.Nitrate}
+	}
+
+	if ts.Phosphate != nil {
+		tstat.OptionalPhosphate = &trackmyfishv1alpha1.TankStatistic_Phosphate{Phosphate: *ts.Phosphate}
+	}
+
+	return tstat
+}
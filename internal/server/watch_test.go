@@ -0,0 +1,248 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trackmyfish/backend/internal/auth"
+	"github.com/trackmyfish/backend/internal/db"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func TestWatchTank(t *testing.T) {
+	tm := &tankMock{getTankResponse: db.Tank{ID: 1, Name: "Reef"}}
+	s := &Server{tankQuerier: tm}
+
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	t.Run("Given a client watching a tank", func(t *testing.T) {
+		rsp, err := http.Get(srv.URL + watchPath + "1")
+		assert.NoError(t, err)
+		defer rsp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, rsp.StatusCode)
+		assert.Equal(t, "text/event-stream", rsp.Header.Get("Content-Type"))
+
+		r := bufio.NewReader(rsp.Body)
+
+		// the client is watching once the opening comment is received
+		line, err := r.ReadString('\n')
+		assert.NoError(t, err)
+		assert.Equal(t, ": watching tank 1\n", line)
+		_, _ = r.ReadString('\n')
+
+		t.Run("When events are notified", func(t *testing.T) {
+			t.Run("Then only the events of the tank are sent", func(t *testing.T) {
+				readAt := time.Date(2021, 8, 6, 10, 0, 0, 0, time.UTC)
+
+				s.tankWatchers.publish(db.TankEvent{Type: db.TankEventReading, Operation: "INSERT", TankIDs: []int32{2}, Reading: &db.SensorReading{ID: 3, TankID: 2}})
+				s.tankWatchers.publish(db.TankEvent{Type: db.TankEventReading, Operation: "INSERT", HouseholdID: 5, TankIDs: []int32{1}, Reading: &db.SensorReading{ID: 4, TankID: 1}})
+				s.tankWatchers.publish(db.TankEvent{Type: db.TankEventReading, Operation: "INSERT", TankIDs: []int32{1}, Reading: &db.SensorReading{ID: 5, SensorID: "probe-1", Sequence: 2, TankID: 1, Parameter: "ph", Value: 8.2, ReadAt: readAt}})
+				s.tankWatchers.publish(db.TankEvent{Type: db.TankEventFish, Operation: "DELETE", TankIDs: []int32{1, 2}, Fish: &db.Fish{ID: 6, Type: "Shrimp", Count: 10}})
+
+				lines := make([]string, 6)
+				for i := range lines {
+					lines[i], err = r.ReadString('\n')
+					assert.NoError(t, err)
+				}
+
+				assert.Equal(t, []string{
+					"event: reading\n",
+					`data: {"operation":"INSERT","reading":{"id":5,"sensorId":"probe-1","sequence":2,"tankId":1,"parameter":"ph","value":8.2,"readAt":"2021-08-06T10:00:00Z"}}` + "\n",
+					"\n",
+					"event: fish\n",
+					`data: {"operation":"DELETE","fish":{"id":6,"type":"Shrimp","subtype":"","color":"","gender":"","purchaseDate":"","count":10}}` + "\n",
+					"\n",
+				}, lines)
+			})
+		})
+	})
+
+	t.Run("Given an API key scoped to another tank", func(t *testing.T) {
+		t.Run("When a tank is watched", func(t *testing.T) {
+			t.Run("Then it's forbidden", func(t *testing.T) {
+				req := httptest.NewRequest(http.MethodGet, watchPath+"1", nil)
+				ctx := auth.NewContext(req.Context(), auth.Identity{APIKeyID: 5, Scope: &auth.Scope{Resource: "tanks", Permission: auth.PermissionRead, TankID: 2}})
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, req.WithContext(ctx))
+
+				assert.Equal(t, http.StatusForbidden, rec.Code)
+			})
+		})
+	})
+
+	t.Run("Given a tank which doesn't exist", func(t *testing.T) {
+		t.Run("When it's watched", func(t *testing.T) {
+			t.Run("Then it isn't found", func(t *testing.T) {
+				tm.err = &db.ErrNotFound{}
+				defer func() { tm.err = nil }()
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, watchPath+"9", nil))
+
+				assert.Equal(t, http.StatusNotFound, rec.Code)
+			})
+		})
+	})
+}
+
+func TestWatchTankRPC(t *testing.T) {
+	tm := &tankMock{getTankResponse: db.Tank{ID: 1, Name: "Reef"}}
+	s := &Server{tankQuerier: tm}
+
+	conn := serveStreams(t, s)
+
+	watch := func(ctx context.Context, tankID int32) (grpc.ClientStream, error) {
+		cs, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, watchTankMethod)
+		assert.NoError(t, err)
+
+		req := dynamicpb.NewMessage(watchTankRequestDesc)
+		req.Set(watchTankRequestDesc.Fields().ByName("tank_id"), protoreflect.ValueOfInt32(tankID))
+		assert.NoError(t, cs.SendMsg(req))
+		assert.NoError(t, cs.CloseSend())
+
+		// the tank is being watched once the headers are received
+		_, err = cs.Header()
+
+		return cs, err
+	}
+
+	t.Run("Given a client watching a tank", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		cs, err := watch(ctx, 1)
+		assert.NoError(t, err)
+
+		t.Run("When events are notified", func(t *testing.T) {
+			t.Run("Then only the events of the tank are sent", func(t *testing.T) {
+				readAt := time.Date(2021, 8, 6, 10, 0, 0, 0, time.UTC)
+				ph := float32(8.1)
+
+				s.tankWatchers.publish(db.TankEvent{Type: db.TankEventReading, Operation: "INSERT", TankIDs: []int32{2}, Reading: &db.SensorReading{ID: 3, TankID: 2}})
+				s.tankWatchers.publish(db.TankEvent{Type: db.TankEventReading, Operation: "INSERT", TankIDs: []int32{1}, Reading: &db.SensorReading{ID: 5, SensorID: "probe-1", Sequence: 2, TankID: 1, Parameter: "ph", Value: 8.2, ReadAt: readAt}})
+				s.tankWatchers.publish(db.TankEvent{Type: db.TankEventFish, Operation: "DELETE", TankIDs: []int32{1, 2}, Fish: &db.Fish{ID: 6, Type: "Shrimp", Count: 10}})
+				s.tankWatchers.publish(db.TankEvent{Type: db.TankEventTankStatistic, Operation: "INSERT", TankStatistic: &db.TankStatistic{ID: 7, TestDate: "2021-08-06", PH: &ph}})
+
+				events := make([]string, 3)
+				for i := range events {
+					m := dynamicpb.NewMessage(tankEventDesc)
+					assert.NoError(t, cs.RecvMsg(m))
+
+					b, err := protojson.Marshal(m)
+					assert.NoError(t, err)
+
+					events[i] = compactJSON(t, b)
+				}
+
+				assert.Equal(t, []string{
+					`{"type":"reading","operation":"INSERT","reading":{"sensorId":"probe-1","sequence":"2","tankId":1,"parameter":"ph","value":8.2,"readAt":"2021-08-06T10:00:00Z","id":"5"}}`,
+					`{"type":"fish","operation":"DELETE","fish":{"id":6,"type":"Shrimp","count":10}}`,
+					`{"type":"tank-statistic","operation":"INSERT","tankStatistic":{"id":7,"testDate":"2021-08-06","ph":8.1}}`,
+				}, events)
+			})
+		})
+	})
+
+	t.Run("Given a tank which doesn't exist", func(t *testing.T) {
+		t.Run("When it's watched", func(t *testing.T) {
+			t.Run("Then it isn't found", func(t *testing.T) {
+				tm.err = &db.ErrNotFound{}
+				defer func() { tm.err = nil }()
+
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+
+				cs, _ := watch(ctx, 9)
+				assert.Equal(t, codes.NotFound, status.Code(cs.RecvMsg(dynamicpb.NewMessage(tankEventDesc))))
+			})
+		})
+	})
+}
+
+// compactJSON removes the insignificant whitespace of b, which protojson adds at random
+func compactJSON(t *testing.T, b []byte) string {
+	var buf bytes.Buffer
+	assert.NoError(t, json.Compact(&buf, b))
+
+	return buf.String()
+}
+
+func TestTankWatchers(t *testing.T) {
+	t.Run("Given a watcher which has fallen behind", func(t *testing.T) {
+		var w tankWatchers
+		watcher := w.add(0, 1)
+
+		t.Run("When another event is notified", func(t *testing.T) {
+			t.Run("Then it's disconnected", func(t *testing.T) {
+				for i := 0; i <= watchBufferSize; i++ {
+					w.publish(db.TankEvent{Type: db.TankEventTankStatistic, Operation: "INSERT", TankStatistic: &db.TankStatistic{ID: int32(i)}})
+				}
+
+				received := 0
+				for range watcher.events {
+					received++
+				}
+
+				assert.Equal(t, watchBufferSize, received)
+				assert.Empty(t, w.watchers)
+
+				// removing a disconnected watcher doesn't close its events again
+				w.remove(watcher)
+			})
+		})
+	})
+}
+
+func TestWatchTankEvents(t *testing.T) {
+	t.Run("Given tank events are being listened for", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		lm := &tankEventListenerMock{cancel: cancel}
+		s := &Server{tankEventListener: lm}
+		watcher := s.tankWatchers.add(0, 1)
+
+		t.Run("When an event is notified", func(t *testing.T) {
+			t.Run("Then it's sent to the watchers until the context is done", func(t *testing.T) {
+				s.WatchTankEvents(ctx)
+
+				e := <-watcher.events
+				assert.Equal(t, "INSERT", e.Operation)
+				assert.Equal(t, db.TankEventReading, e.Type)
+
+				// the watchers are disconnected once it stops
+				_, ok := <-watcher.events
+				assert.False(t, ok)
+				_, ok = <-s.tankWatchers.add(0, 1).events
+				assert.False(t, ok)
+			})
+		})
+	})
+}
+
+type tankEventListenerMock struct {
+	cancel context.CancelFunc
+}
+
+func (m *tankEventListenerMock) ListenTankEvents(ctx context.Context, handle func(db.TankEvent)) error {
+	handle(db.TankEvent{Type: db.TankEventReading, Operation: "INSERT", TankIDs: []int32{1}, Reading: &db.SensorReading{TankID: 1}})
+	m.cancel()
+
+	return ctx.Err()
+}
@@ -3,12 +3,20 @@ package main
 import (
 	"context"
 	"embed"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"io/fs"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	"github.com/sirupsen/logrus"
@@ -16,6 +24,10 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
 
+	"github.com/trackmyfish/backend/internal/auth"
+	"github.com/trackmyfish/backend/internal/db"
+	"github.com/trackmyfish/backend/internal/metrics"
+	"github.com/trackmyfish/backend/internal/mqtt"
 	"github.com/trackmyfish/backend/internal/server"
 	trackmyfishv1alpha1 "github.com/trackmyfish/proto/trackmyfish/v1alpha1"
 )
@@ -23,6 +35,10 @@ import (
 //go:embed build
 var feStatic embed.FS
 
+// defaultShutdownTimeout is how long in-flight requests have to finish when shutting down,
+// which is within the 10 seconds Docker waits before killing the container
+const defaultShutdownTimeout = 8 * time.Second
+
 func init() {
 	// Log as JSON instead of the default ASCII formatter.
 	logrus.SetFormatter(&logrus.JSONFormatter{})
@@ -55,11 +71,26 @@ func main() {
 	handleBindEnvErr(viper.BindEnv("server.port", "TMF_SERVER_PORT"))
 	handleBindEnvErr(viper.BindEnv("server.httpProxy.enabled", "TMF_HTTP_PROXY_ENABLED"))
 	handleBindEnvErr(viper.BindEnv("server.httpProxy.port", "TMF_HTTP_PROXY_PORT"))
+	handleBindEnvErr(viper.BindEnv("server.shutdownTimeout", "TMF_SERVER_SHUTDOWN_TIMEOUT"))
+	handleBindEnvErr(viper.BindEnv("metrics.enabled", "TMF_METRICS_ENABLED"))
+	handleBindEnvErr(viper.BindEnv("metrics.port", "TMF_METRICS_PORT"))
 	handleBindEnvErr(viper.BindEnv("db.host", "TMF_DB_HOST"))
 	handleBindEnvErr(viper.BindEnv("db.port", "TMF_DB_PORT"))
 	handleBindEnvErr(viper.BindEnv("db.username", "TMF_DB_USERNAME"))
 	handleBindEnvErr(viper.BindEnv("db.password", "TMF_DB_PASSWORD"))
 	handleBindEnvErr(viper.BindEnv("db.name", "TMF_DB_NAME"))
+	handleBindEnvErr(viper.BindEnv("attachments.path", "TMF_ATTACHMENTS_PATH"))
+	handleBindEnvErr(viper.BindEnv("attachments.maxSize", "TMF_ATTACHMENTS_MAX_SIZE"))
+	handleBindEnvErr(viper.BindEnv("auth.secret", "TMF_AUTH_SECRET"))
+	handleBindEnvErr(viper.BindEnv("auth.tokenTTL", "TMF_AUTH_TOKEN_TTL"))
+	handleBindEnvErr(viper.BindEnv("auth.allowSignup", "TMF_AUTH_ALLOW_SIGNUP"))
+	handleBindEnvErr(viper.BindEnv("trash.retention", "TMF_TRASH_RETENTION"))
+	handleBindEnvErr(viper.BindEnv("mqtt.broker", "TMF_MQTT_BROKER"))
+	handleBindEnvErr(viper.BindEnv("mqtt.clientId", "TMF_MQTT_CLIENT_ID"))
+	handleBindEnvErr(viper.BindEnv("mqtt.username", "TMF_MQTT_USERNAME"))
+	handleBindEnvErr(viper.BindEnv("mqtt.password", "TMF_MQTT_PASSWORD"))
+	handleBindEnvErr(viper.BindEnv("mqtt.qos", "TMF_MQTT_QOS"))
+	handleBindEnvErr(viper.BindEnv("mqtt.household", "TMF_MQTT_HOUSEHOLD"))
 
 	// Merge config
 	if err := viper.MergeInConfig(); err != nil {
@@ -76,6 +107,11 @@ func main() {
 	viper.SetDefault("server.port", 8080)
 	viper.SetDefault("server.httpProxy.enabled", false)
 	viper.SetDefault("server.httpProxy.port", 8443)
+	viper.SetDefault("server.shutdownTimeout", defaultShutdownTimeout)
+
+	// Metrics defaults
+	viper.SetDefault("metrics.enabled", false)
+	viper.SetDefault("metrics.port", 9090)
 
 	// DB defaults
 	viper.SetDefault("db.host", "localhost")
@@ -84,6 +120,24 @@ func main() {
 	viper.SetDefault("db.password", "")
 	viper.SetDefault("db.name", "trackmyfish")
 
+	// Attachment defaults
+	viper.SetDefault("attachments.path", "attachments")
+	viper.SetDefault("attachments.maxSize", server.DefaultMaxAttachmentSize)
+
+	// Auth defaults
+	viper.SetDefault("auth.secret", "")
+	viper.SetDefault("auth.tokenTTL", auth.DefaultTokenTTL)
+	viper.SetDefault("auth.allowSignup", false)
+
+	// Trash defaults
+	viper.SetDefault("trash.retention", server.DefaultTrashRetention)
+
+	// MQTT defaults, the bridge is disabled without a broker
+	viper.SetDefault("mqtt.broker", "")
+	viper.SetDefault("mqtt.clientId", mqtt.DefaultClientID)
+	viper.SetDefault("mqtt.qos", 1)
+	viper.SetDefault("mqtt.household", 0)
+
 	if err := viper.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
 			// Config file not found; ignore as we use defaults/environment variables
@@ -98,69 +152,352 @@ func main() {
 		port             = viper.GetInt("server.port")
 		httpProxyEnabled = viper.GetBool("server.httpProxy.enabled")
 		httpProxyPort    = viper.GetInt("server.httpProxy.port")
+		shutdownTimeout  = viper.GetDuration("server.shutdownTimeout")
+
+		metricsEnabled = viper.GetBool("metrics.enabled")
+		metricsPort    = viper.GetInt("metrics.port")
 
 		dbHost     = viper.GetString("db.host")
 		dbPort     = viper.GetString("db.port")
 		dbUsername = viper.GetString("db.username")
 		dbPassword = viper.GetString("db.password")
 		dbName     = viper.GetString("db.name")
+
+		attachmentsPath    = viper.GetString("attachments.path")
+		attachmentsMaxSize = viper.GetInt64("attachments.maxSize")
+
+		authSecret      = viper.GetString("auth.secret")
+		authTokenTTL    = viper.GetDuration("auth.tokenTTL")
+		authAllowSignup = viper.GetBool("auth.allowSignup")
+
+		trashRetention = viper.GetDuration("trash.retention")
+
+		mqttBroker    = viper.GetString("mqtt.broker")
+		mqttClientID  = viper.GetString("mqtt.clientId")
+		mqttUsername  = viper.GetString("mqtt.username")
+		mqttPassword  = viper.GetString("mqtt.password")
+		mqttQoS       = viper.GetUint("mqtt.qos")
+		mqttHousehold = viper.GetInt32("mqtt.household")
 	)
 
+	if len(os.Args) > 1 {
+		runCommand(os.Args[1], os.Args[2:], db.Config{
+			Host: dbHost, Port: dbPort, Username: dbUsername, Password: dbPassword, Database: dbName,
+		})
+
+		return
+	}
+
 	logrus.WithFields(logrus.Fields{
-		"Server Port":        port,
-		"HTTP Proxy Enabled": httpProxyEnabled,
-		"HTTP Proxy Port":    httpProxyPort,
-		"Database Name":      dbName,
-		"Database Host":      dbHost,
-		"Database Port":      dbPort,
-		"Database Username":  dbUsername,
+		"Server Port":          port,
+		"HTTP Proxy Enabled":   httpProxyEnabled,
+		"HTTP Proxy Port":      httpProxyPort,
+		"Shutdown Timeout":     shutdownTimeout.String(),
+		"Metrics Enabled":      metricsEnabled,
+		"Metrics Port":         metricsPort,
+		"Database Name":        dbName,
+		"Database Host":        dbHost,
+		"Database Port":        dbPort,
+		"Database Username":    dbUsername,
+		"Attachments Path":     attachmentsPath,
+		"Attachments Max Size": attachmentsMaxSize,
+		"Auth Token TTL":       authTokenTTL.String(),
+		"Auth Allow Signup":    authAllowSignup,
+		"Trash Retention":      trashRetention.String(),
+		"MQTT Broker":          mqttBroker,
+		"MQTT Client ID":       mqttClientID,
+		"MQTT QoS":             mqttQoS,
+		"MQTT Household":       mqttHousehold,
 	}).Info("Config Initialised")
 
 	server, err := server.New(
-		server.Config{DBHost: dbHost, DBPort: dbPort, DBUsername: dbUsername, DBPassword: dbPassword, DBName: dbName},
+		server.Config{
+			DBHost: dbHost, DBPort: dbPort, DBUsername: dbUsername, DBPassword: dbPassword, DBName: dbName,
+			AttachmentsPath: attachmentsPath, MaxAttachmentSize: attachmentsMaxSize,
+			AuthSecret: authSecret, TokenTTL: authTokenTTL, AllowSignup: authAllowSignup,
+		},
 	)
 	if err != nil {
 		logrus.Fatalf("Unable to initialise new Server: %+v", err)
 	}
 
-	gServer := grpc.NewServer()
+	// the servers run until a signal is received or one of them fails, which stops the
+	// background tasks too
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var tasks sync.WaitGroup
+
+	tasks.Add(3)
+	go func() {
+		defer tasks.Done()
+		server.MonitorHealth(ctx)
+	}()
+	go func() {
+		defer tasks.Done()
+		server.PurgeTrash(ctx, trashRetention)
+	}()
+	go func() {
+		defer tasks.Done()
+		server.WatchTankEvents(ctx)
+	}()
+
+	var bridge *mqtt.Bridge
+	if mqttBroker != "" {
+		var topics []mqtt.Topic
+		if err := viper.UnmarshalKey("mqtt.topics", &topics); err != nil {
+			logrus.Fatalf("unable to read MQTT topics: %+v", err)
+		}
+
+		bridge, err = mqtt.New(mqtt.Config{
+			Broker: mqttBroker, ClientID: mqttClientID, Username: mqttUsername, Password: mqttPassword,
+			QoS: byte(mqttQoS), HouseholdID: mqttHousehold, Topics: topics,
+		}, server)
+		if err != nil {
+			logrus.Fatalf("Unable to initialise MQTT bridge: %+v", err)
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"broker": mqttBroker,
+			"topics": len(topics),
+		}).Info("Starting MQTT bridge")
+
+		bridge.Start()
+	}
+
+	gServer := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(server.Metrics().UnaryServerInterceptor(), server.UnaryInterceptor()),
+		grpc.ChainStreamInterceptor(server.Metrics().StreamServerInterceptor(), server.StreamInterceptor()),
+	)
 
 	trackmyfishv1alpha1.RegisterTrackMyFishServiceServer(gServer, server)
+	server.RegisterHealth(gServer)
+	server.RegisterStreams(gServer)
 
 	reflection.Register(gServer)
 
 	addr := fmt.Sprintf(":%d", port)
 
-	if httpProxyEnabled {
-		go httpProxyServer(httpProxyPort, addr)
-	}
-
 	listener, err := net.Listen("tcp", addr)
 	if err != nil {
 		logrus.Fatal(err, "Failed to create listener")
 	}
 
+	// serverErrs receives the error of each server which fails
+	serverErrs := make(chan error, 3)
+
+	// the gateway's connection to the gRPC server is kept open until the HTTP server has
+	// shut down, so in-flight requests can finish
+	gatewayCtx, closeGateway := context.WithCancel(context.Background())
+	defer closeGateway()
+
+	var httpServer *http.Server
+	if httpProxyEnabled {
+		httpServer, err = httpProxyServer(gatewayCtx, httpProxyPort, addr, server)
+		if err != nil {
+			logrus.Fatalf("Unable to initialise http proxy server: %+v", err)
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"port": httpProxyPort,
+		}).Info("Starting http proxy server")
+
+		go func() {
+			if err := httpServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				serverErrs <- fmt.Errorf("http proxy server failed: %w", err)
+			}
+		}()
+	}
+
+	var metricsServer *http.Server
+	if metricsEnabled {
+		mux := http.NewServeMux()
+		mux.Handle(metrics.Path, server.Metrics().Handler())
+
+		metricsServer = &http.Server{
+			Addr:              fmt.Sprintf(":%d", metricsPort),
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"port": metricsPort,
+		}).Info("Starting metrics server")
+
+		go func() {
+			if err := metricsServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				serverErrs <- fmt.Errorf("metrics server failed: %w", err)
+			}
+		}()
+	}
+
 	logrus.WithFields(logrus.Fields{
 		"port": port,
 	}).Info("Starting grpc server")
 
-	if err := gServer.Serve(listener); err != nil {
-		logrus.Fatal(err, "Failed to start server")
+	go func() {
+		if err := gServer.Serve(listener); err != nil {
+			serverErrs <- fmt.Errorf("grpc server failed: %w", err)
+		}
+	}()
+
+	var failed bool
+	select {
+	case <-ctx.Done():
+		logrus.Info("Shutting down")
+	case err := <-serverErrs:
+		logrus.WithError(err).Error("Shutting down after a server failed")
+		failed = true
+	}
+
+	stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	// the HTTP proxy is shut down first as it forwards requests to the gRPC server
+	if httpServer != nil {
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			logrus.WithError(err).Warn("Closing http proxy server connections with requests in flight")
+			httpServer.Close() // #nosec G104 -- closing anyway
+		}
+
+		closeGateway()
+	}
+
+	stopGRPCServer(shutdownCtx, gServer)
+
+	// the metrics are served until the requests they count have finished
+	if metricsServer != nil {
+		if err := metricsServer.Shutdown(shutdownCtx); err != nil {
+			metricsServer.Close() // #nosec G104 -- closing anyway
+		}
+	}
+
+	if bridge != nil {
+		bridge.Stop()
+	}
+
+	tasks.Wait()
+	server.Close()
+
+	if failed {
+		os.Exit(1)
+	}
+
+	logrus.Info("Stopped")
+}
+
+// stopGRPCServer stops s once its in-flight RPCs have finished, or cancels them once ctx is
+// done
+func stopGRPCServer(ctx context.Context, s *grpc.Server) {
+	stopped := make(chan struct{})
+
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		logrus.Warn("Cancelling grpc requests in flight")
+		s.Stop()
+		<-stopped
 	}
 }
 
-// httpProxyServer starts a new http server listening on the specified port, proxying
-// requests to the provided grpc service
-func httpProxyServer(port int, grpcAddr string) {
+// runCommand runs a subcommand instead of the server. export writes a backup of a household
+// to stdout, or the file given with -o, and import restores the backup in the file given
+// into a household.
+func runCommand(name string, args []string, c db.Config) {
+	// the backup may be written to stdout, so keep the logs out of it
+	logrus.SetOutput(os.Stderr)
+
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	household := flags.Int("household", 0, "ID of the household, or 0 for data without a household")
+
+	var (
+		output        *string
+		skipConflicts *bool
+	)
+
+	switch name {
+	case "export":
+		output = flags.String("o", "", "file to write the backup to instead of stdout")
+	case "import":
+		skipConflicts = flags.Bool("skip-conflicts", false, "skip rows conflicting with existing rows instead of failing")
+	default:
+		logrus.Fatalf("unknown command %q, expected export or import", name)
+	}
+
+	if err := flags.Parse(args); err != nil {
+		logrus.Fatalf("unable to parse arguments: %+v", err)
+	}
+
+	dbManager, err := db.New(c)
+	if err != nil {
+		logrus.Fatalf("unable to create db instance: %+v", err)
+	}
+	defer dbManager.Close()
+
 	ctx := context.Background()
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
+	if *household != 0 {
+		ctx = db.WithHousehold(ctx, int32(*household))
+	}
+
+	switch name {
+	case "export":
+		b, err := dbManager.Export(ctx)
+		if err != nil {
+			logrus.Fatalf("unable to export backup: %+v", err)
+		}
+
+		var w io.WriteCloser = os.Stdout
+		if *output != "" {
+			if w, err = os.Create(*output); err != nil {
+				logrus.Fatalf("unable to create %s: %+v", *output, err)
+			}
+		}
+
+		if err := json.NewEncoder(w).Encode(b); err != nil {
+			logrus.Fatalf("unable to write backup: %+v", err)
+		}
+
+		if err := w.Close(); err != nil {
+			logrus.Fatalf("unable to write backup: %+v", err)
+		}
+	case "import":
+		if flags.NArg() != 1 {
+			logrus.Fatal("usage: import [-household id] [-skip-conflicts] backup.json")
+		}
+
+		f, err := os.Open(flags.Arg(0)) // #nosec G304 -- path is given by the operator
+		if err != nil {
+			logrus.Fatalf("unable to open backup: %+v", err)
+		}
+		defer f.Close() // #nosec G307 -- only read
 
+		var b db.Backup
+		if err := json.NewDecoder(f).Decode(&b); err != nil {
+			logrus.Fatalf("unable to read backup: %+v", err)
+		}
+
+		if _, err := dbManager.Import(ctx, b, db.ImportOptions{SkipConflicts: *skipConflicts}); err != nil {
+			logrus.Fatalf("unable to import backup: %+v", err)
+		}
+	}
+}
+
+// httpProxyServer creates a new http server listening on the specified port, proxying
+// requests to the provided grpc service and serving the HTTP only endpoints of s. The
+// connection to the grpc service is closed once ctx is done.
+func httpProxyServer(ctx context.Context, port int, grpcAddr string, s *server.Server) (*http.Server, error) {
 	// Register gRPC server endpoint
-	grpcMux := runtime.NewServeMux()
+	grpcMux := runtime.NewServeMux(runtime.WithIncomingHeaderMatcher(headerMatcher))
 	opts := []grpc.DialOption{grpc.WithInsecure()}
 	if err := trackmyfishv1alpha1.RegisterTrackMyFishServiceHandlerFromEndpoint(ctx, grpcMux, grpcAddr, opts); err != nil {
-		logrus.Fatal(err, "Failed to register http handler")
+		return nil, fmt.Errorf("unable to register http handler: %w", err)
 	}
 
 	r := http.NewServeMux()
@@ -173,17 +510,30 @@ func httpProxyServer(port int, grpcAddr string) {
 		grpcMux.ServeHTTP(w, r)
 	})
 
+	s.RegisterHandlers(r)
+
 	sch, err := buildHandler()
 	if err != nil {
-		logrus.Fatal(err, "unable to initialize build handler")
+		return nil, fmt.Errorf("unable to initialize build handler: %w", err)
 	}
 	r.Handle("/", sch)
 
-	logrus.WithFields(logrus.Fields{
-		"port": port,
-	}).Info("Starting http proxy server")
+	// only the headers have a timeout, as streaming requests stay open
+	return &http.Server{
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           s.Metrics().Middleware(r)(s.Middleware(r)),
+		ReadHeaderTimeout: 10 * time.Second,
+	}, nil
+}
+
+// headerMatcher forwards API keys to the gRPC server as metadata, along with the headers
+// the gateway forwards by default (e.g. Authorization)
+func headerMatcher(key string) (string, bool) {
+	if strings.EqualFold(key, auth.APIKeyHeader) {
+		return auth.APIKeyMetadata, true
+	}
 
-	logrus.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", port), r), "Failed to start http proxy server")
+	return runtime.DefaultHeaderMatcher(key)
 }
 
 func buildHandler() (http.Handler, error) {